@@ -0,0 +1,56 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+
+	"go-socket/protocol"
+)
+
+// สถานะใน ack ที่ตอบผู้ส่งทาง WebSocket
+const (
+	ackStatusDelivered = protocol.AckDelivered // ส่งถึงผู้รับที่ออนไลน์แล้ว
+	ackStatusStored    = protocol.AckStored    // บันทึกแล้ว รอผู้รับเชื่อมต่อ
+	ackStatusDuplicate = protocol.AckDuplicate // client_msg_id ซ้ำ ใช้ข้อความเดิม ไม่ได้ส่งซ้ำ
+	ackStatusFailed    = protocol.AckFailed    // บันทึกไม่สำเร็จ ข้อความยังอยู่ใน outbox รอส่งใหม่
+)
+
+// คำตอบของข้อความแชทที่ส่งมาทาง WebSocket (เฉพาะข้อความที่ระบุ client_msg_id)
+type Ack = protocol.Ack
+
+// ความยาวสูงสุดของ client_msg_id (client ควรใช้ UUID)
+const maxClientMsgIDLength = 128
+
+// ตรวจ client_msg_id ที่ client ส่งมา (ไม่ระบุ = ไม่กันข้อความซ้ำ)
+func validateClientMsgID(id string) error {
+	if len(id) > maxClientMsgIDLength {
+		return fmt.Errorf("client_msg_id too long (max %d bytes)", maxClientMsgIDLength)
+	}
+	return nil
+}
+
+// ตอบ ack ให้ connection ที่ส่งข้อความมา หลังบันทึก/ส่งเสร็จ
+func sendAck(msg queuedMessage, result dispatchResult, err error) {
+	if msg.origin == nil || msg.ClientMsgID == "" {
+		return
+	}
+
+	ack := Ack{Type: frameTypeAck, ClientMsgID: msg.ClientMsgID, ServerID: result.Message.ID}
+	if result.Message.ID != 0 {
+		createdAt := result.Message.CreatedAt
+		ack.CreatedAt = &createdAt
+	}
+	switch {
+	case result.Duplicate:
+		ack.Status = ackStatusDuplicate
+	case result.Delivered:
+		ack.Status = ackStatusDelivered
+	case err == nil:
+		ack.Status = ackStatusStored
+	default:
+		ack.Status = ackStatusFailed
+	}
+	if err := msg.origin.send(ack); err != nil && !errors.Is(err, errClientClosed) {
+		messageLogger(msg.Message).Warn("sending ack", "conn_id", msg.origin.connID, "err", err)
+	}
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+// สถานะการส่งของข้อความใน admin feed
+const (
+	feedStatusDelivered = "delivered"
+	feedStatusStored    = "stored"
+)
+
+// ขนาด buffer ต่อผู้ดูแลหนึ่งคน ถ้าเต็มจะทิ้ง event เพื่อไม่ให้ worker ช้าลง
+const adminFeedBuffer = 256
+
+// event ที่ส่งให้ผู้ดูแลระบบทุกครั้งที่ worker จัดการข้อความ
+type FeedEvent struct {
+	Type    string  `json:"type"`
+	Status  string  `json:"status"`
+	Message Message `json:"message"`
+}
+
+// ผู้ดูแลที่เปิด /ws/admin/feed อยู่
+type feedSubscriber struct {
+	tenant     string // ถ้าระบุ จะรับเฉพาะข้อความของ tenant นี้
+	userFilter string // ถ้าระบุ จะรับเฉพาะข้อความที่ผู้ใช้นี้เป็นผู้ส่งหรือผู้รับ
+	events     chan []byte
+}
+
+var feedSubscribers sync.Map // *feedSubscriber -> struct{}
+
+// middleware ตรวจ admin token จาก header Authorization: Bearer <token> หรือ ?token=
+func requireAdmin(c *fiber.Ctx) error {
+	if config.AdminToken == "" {
+		return Forbidden("Admin API disabled")
+	}
+
+	token := strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if token == "" {
+		token = c.Query("token")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(config.AdminToken)) != 1 {
+		return NewError(fiber.StatusUnauthorized, errCodeUnauthorized, "Invalid admin token")
+	}
+	return c.Next()
+}
+
+// ส่งสำเนาข้อความให้ผู้ดูแลที่ติดตาม feed อยู่ (ไม่ block worker)
+func publishToFeed(msg Message, status string) {
+	var payload []byte
+	feedSubscribers.Range(func(key, _ any) bool {
+		sub := key.(*feedSubscriber)
+		if sub.tenant != "" && sub.tenant != tenantOrDefault(msg.TenantID) {
+			return true
+		}
+		if sub.userFilter != "" && sub.userFilter != msg.SenderID && sub.userFilter != msg.ReceiverID {
+			return true
+		}
+
+		if payload == nil {
+			var err error
+			payload, err = json.Marshal(FeedEvent{Type: "feed", Status: status, Message: msg})
+			if err != nil {
+				slog.Error("marshalling feed event", "err", err)
+				return false
+			}
+		}
+
+		select {
+		case sub.events <- payload:
+		default:
+			// ผู้ดูแลอ่านไม่ทัน ทิ้ง event นี้
+		}
+		return true
+	})
+}
+
+// WebSocket /ws/admin/feed?user=<id>&tenant=<id> (ไม่ระบุ = ทุกผู้ใช้/ทุก tenant)
+func handleAdminFeed(c *websocket.Conn) {
+	sub := &feedSubscriber{
+		tenant:     c.Query("tenant"),
+		userFilter: c.Query("user"),
+		events:     make(chan []byte, adminFeedBuffer),
+	}
+	feedSubscribers.Store(sub, struct{}{})
+	slog.Info("admin feed subscriber connected", "tenant_filter", sub.tenant, "user_filter", sub.userFilter)
+
+	// goroutine สำหรับเขียน event ลง socket จะจบเมื่อ done ถูกปิด
+	done := make(chan struct{})
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		for {
+			select {
+			case payload := <-sub.events:
+				if err := writeFrame(c, websocket.TextMessage, payload); err != nil {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// อ่านไว้เพื่อรู้ว่าผู้ดูแลปิด connection เมื่อไร
+	for {
+		if _, _, err := c.ReadMessage(); err != nil {
+			break
+		}
+	}
+
+	feedSubscribers.Delete(sub)
+	close(done)
+	<-writerDone
+	c.Close()
+	slog.Info("admin feed subscriber disconnected", "user_filter", sub.userFilter)
+}
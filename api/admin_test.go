@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	fws "github.com/fasthttp/websocket"
+)
+
+// เปิด /ws/admin/feed ด้วย query ที่ให้ และรอให้ server ลงทะเบียนผู้ติดตาม
+func dialAdminFeed(t *testing.T, query url.Values) *fws.Conn {
+	t.Helper()
+	conn, _, err := fws.DefaultDialer.Dial("ws://"+testAddr+"/ws/admin/feed?"+query.Encode(), nil)
+	if err != nil {
+		t.Fatalf("dial admin feed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	waitFor(t, func() bool {
+		found := false
+		feedSubscribers.Range(func(key, _ any) bool {
+			sub := key.(*feedSubscriber)
+			found = sub.tenant == query.Get("tenant") && sub.userFilter == query.Get("user")
+			return !found
+		})
+		return found
+	})
+	return conn
+}
+
+func TestAdminFeedRequiresAdminToken(t *testing.T) {
+	prevToken := config.AdminToken
+	defer func() { config.AdminToken = prevToken }()
+
+	config.AdminToken = "admin-secret"
+	for _, query := range []string{"", "?token=wrong"} {
+		_, resp, err := fws.DefaultDialer.Dial("ws://"+testAddr+"/ws/admin/feed"+query, nil)
+		if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("%q: expected 401, got %v (%v)", query, resp, err)
+		}
+	}
+
+	// ไม่ได้ตั้ง admin token = ปิด admin API ทั้งหมด
+	config.AdminToken = ""
+	_, resp, err := fws.DefaultDialer.Dial("ws://"+testAddr+"/ws/admin/feed?token=", nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 with admin API disabled, got %v (%v)", resp, err)
+	}
+}
+
+func TestAdminFeedFiltersByTenantAndUser(t *testing.T) {
+	prevToken := config.AdminToken
+	config.AdminToken = "admin-secret"
+	defer func() { config.AdminToken = prevToken }()
+
+	alice, bob, carol := newTestUser("alice"), newTestUser("bob"), newTestUser("carol")
+	conn := dialAdminFeed(t, url.Values{"token": {"admin-secret"}, "tenant": {"acme"}, "user": {alice}})
+
+	// ข้อความที่ไม่ตรง filter ส่งก่อน ถ้าหลุดมาจะเป็น event แรกที่อ่านได้
+	publishToFeed(Message{TenantID: "acme", SenderID: bob, ReceiverID: carol, Text: "other user"}, feedStatusDelivered)
+	publishToFeed(Message{TenantID: "globex", SenderID: alice, ReceiverID: bob, Text: "other tenant"}, feedStatusDelivered)
+	publishToFeed(Message{TenantID: "acme", SenderID: bob, ReceiverID: alice, Text: "match"}, feedStatusStored)
+
+	var event FeedEvent
+	readJSON(t, conn, &event)
+	if event.Type != "feed" || event.Status != feedStatusStored || event.Message.Text != "match" || event.Message.ReceiverID != alice {
+		t.Fatalf("unexpected feed event: %+v", event)
+	}
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// จำนวนข้อความค้างส่งที่คืนใน GET /admin/users/:id/pending ถ้าไม่ระบุ limit และค่าสูงสุด
+const (
+	defaultAdminPendingLimit = 100
+	maxAdminPendingLimit     = 1000
+)
+
+// ความยาวสูงสุดของข้อความประกาศ (ตัวอักษร)
+const maxAnnouncementRunes = 2000
+
+// frame ประกาศจากผู้ดูแลระบบถึงทุก connection ของ tenant
+type Announcement struct {
+	Type      string    `json:"type"` // "announcement"
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// body ของ POST /admin/users/:id/disconnect (ไม่ส่ง body ก็ได้)
+type AdminDisconnectRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ปิดทุก session ของผู้ใช้บน instance นี้ คืนค่าจำนวน connection ที่ปิด
+func disconnectUserLocal(tenant, userID, reason string) int {
+	sessions := getSessions(tenant, userID)
+	for _, cl := range sessions {
+		cl.logger().Info("disconnected by admin", "reason", reason)
+		cl.closeWith(closeKicked, reason)
+	}
+	return len(sessions)
+}
+
+// ส่งประกาศให้ทุก connection ของ tenant บน instance นี้ที่ subscribe frame ประกาศ คืนค่าจำนวนที่ส่งถึง
+func announceLocal(tenant string, a Announcement) int {
+	sent := 0
+	for _, cl := range allSessions() {
+		if cl.tenant != tenant || !cl.wants(frameTypeAnnouncement) {
+			continue
+		}
+		if err := cl.send(a); err != nil {
+			cl.logger().Warn("sending announcement", "err", err)
+			continue
+		}
+		sent++
+	}
+	return sent
+}
+
+// POST /admin/users/:id/disconnect  ผู้ใช้ที่เชื่อมต่อกับ instance อื่นจะถูกส่งต่อไปปิดที่นั่น
+func handleAdminDisconnect(c *fiber.Ctx) error {
+	var req AdminDisconnectRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return InvalidRequest("Invalid request body")
+		}
+	}
+	if req.Reason == "" {
+		req.Reason = "disconnected by admin"
+	}
+
+	tenant, userID := TenantOf(c), c.Params("id")
+	disconnected := disconnectUserLocal(tenant, userID, req.Reason)
+	// อุปกรณ์อื่นของผู้ใช้อาจเชื่อมต่ออยู่กับ instance อื่นด้วย
+	remote := clusterKick(tenant, userID, req.Reason)
+	if disconnected == 0 && !remote {
+		return NotFound("User is not connected")
+	}
+	return c.JSON(fiber.Map{"user_id": userID, "disconnected": disconnected, "remote": remote})
+}
+
+// POST /admin/announcements  body: {"text": "..."}
+func handleAdminAnnouncement(c *fiber.Ctx) error {
+	var req struct {
+		Text string `json:"text"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Text == "" {
+		return InvalidRequest("text is required")
+	}
+	if len([]rune(req.Text)) > maxAnnouncementRunes {
+		return InvalidRequest("text is too long")
+	}
+
+	tenant := TenantOf(c)
+	a := Announcement{Type: frameTypeAnnouncement, Text: req.Text, CreatedAt: time.Now().UTC()}
+	recipients := announceLocal(tenant, a)
+	clusterAnnounce(tenant, a)
+	return c.JSON(fiber.Map{"recipients": recipients})
+}
+
+// GET /admin/queues  ความยาวของคิวภายใน (คิวที่ไม่ได้เปิดใช้มี capacity 0)
+func handleAdminQueues(c *fiber.Ctx) error {
+	var webhookQueue chan WebhookEvent
+	if d := webhooks.Load(); d != nil {
+		webhookQueue = d.queue
+	}
+	var notifyQueue chan Message
+	if d := notifications.Load(); d != nil {
+		notifyQueue = d.queue
+	}
+	return c.JSON(fiber.Map{
+		"broadcast":     queueStats{Length: len(broadcast), Capacity: cap(broadcast)},
+		"priority":      queueStats{Length: len(priorityBroadcast), Capacity: cap(priorityBroadcast)},
+		"lanes":         laneBacklog(),
+		"notifications": queueStats{Length: len(notifyQueue), Capacity: cap(notifyQueue)},
+		"webhooks":      queueStats{Length: len(webhookQueue), Capacity: cap(webhookQueue)},
+		"bots":          queueStats{Length: len(botQueue), Capacity: cap(botQueue)},
+		"sink":          queueStats{Length: len(sinkQueue), Capacity: cap(sinkQueue)},
+	})
+}
+
+// GET /admin/users/:id/pending?limit=  ข้อความที่ยังไม่ได้ส่งถึงผู้ใช้ (เก่าสุดก่อน) พร้อมจำนวนทั้งหมด
+func handleAdminPending(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", defaultAdminPendingLimit)
+	if limit <= 0 || limit > maxAdminPendingLimit {
+		return InvalidRequest(fmt.Sprintf("limit must be between 1 and %d", maxAdminPendingLimit))
+	}
+	userID := c.Params("id")
+	pending, err := messageStore.PendingFor(TenantOf(c), userID)
+	if err != nil {
+		return Internal("Error loading pending messages", err)
+	}
+	total := len(pending)
+	if total > limit {
+		pending = pending[:limit]
+	}
+	if pending == nil {
+		pending = []Message{}
+	}
+	return c.JSON(fiber.Map{"user_id": userID, "total": total, "messages": pending})
+}
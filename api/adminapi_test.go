@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	fws "github.com/fasthttp/websocket"
+)
+
+// เรียก /admin ด้วย admin token คืนค่า status และ body
+func adminRequest(t *testing.T, method, path, body string) (int, []byte) {
+	t.Helper()
+	prevToken := config.AdminToken
+	config.AdminToken = "admin-secret"
+	t.Cleanup(func() { config.AdminToken = prevToken })
+
+	req, _ := http.NewRequest(method, "http://"+testAddr+path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, data
+}
+
+func TestAdminRoutesRequireToken(t *testing.T) {
+	prevToken := config.AdminToken
+	config.AdminToken = "admin-secret"
+	defer func() { config.AdminToken = prevToken }()
+
+	resp, err := http.Get("http://" + testAddr + "/admin/queues")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", resp.StatusCode)
+	}
+}
+
+func TestAdminAnnouncementAndDisconnect(t *testing.T) {
+	alice := newTestUser("alice")
+	conn := dialWS(t, alice)
+
+	if status, _ := adminRequest(t, http.MethodPost, "/admin/announcements", `{"text":"maintenance at 22:00"}`); status != http.StatusOK {
+		t.Fatalf("announce: status %d", status)
+	}
+	var a Announcement
+	readJSON(t, conn, &a)
+	if a.Type != frameTypeAnnouncement || a.Text != "maintenance at 22:00" {
+		t.Fatalf("unexpected announcement: %+v", a)
+	}
+
+	status, body := adminRequest(t, http.MethodPost, "/admin/users/"+alice+"/disconnect", `{"reason":"spam"}`)
+	if status != http.StatusOK || !strings.Contains(string(body), `"disconnected":1`) {
+		t.Fatalf("disconnect: %d %s", status, body)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := conn.ReadMessage(); !fws.IsCloseError(err, closeKicked) {
+		t.Fatalf("expected close %d, got %v", closeKicked, err)
+	}
+	waitFor(t, func() bool { _, ok := getClient(DefaultTenant, alice); return !ok })
+
+	if status, _ := adminRequest(t, http.MethodPost, "/admin/users/"+alice+"/disconnect", ""); status != http.StatusNotFound {
+		t.Fatalf("expected 404 for offline user, got %d", status)
+	}
+}
+
+func TestAdminQueuesAndPending(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: "one"})
+	saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: "two"})
+
+	status, body := adminRequest(t, http.MethodGet, "/admin/users/"+bob+"/pending?limit=1", "")
+	var pending struct {
+		Total    int       `json:"total"`
+		Messages []Message `json:"messages"`
+	}
+	json.Unmarshal(body, &pending)
+	if status != http.StatusOK || pending.Total != 2 || len(pending.Messages) != 1 || pending.Messages[0].Text != "one" {
+		t.Fatalf("unexpected pending: %d %s", status, body)
+	}
+
+	status, body = adminRequest(t, http.MethodGet, "/admin/queues", "")
+	var queues map[string]queueStats
+	json.Unmarshal(body, &queues)
+	if status != http.StatusOK || queues["broadcast"].Capacity != cap(broadcast) {
+		t.Fatalf("unexpected queues: %d %s", status, body)
+	}
+}
@@ -0,0 +1,280 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go-socket/protocol"
+)
+
+// ความยาวสูงสุดของชื่อไฟล์ที่เก็บไว้ (ตัวอักษร)
+const maxAttachmentFilenameRunes = 255
+
+var (
+	errAttachmentNotFound = errors.New("attachment not found")
+	errAttachmentNotOwned = errors.New("attachment was uploaded by another user")
+)
+
+// ไฟล์ที่แนบกับข้อความ (server เติมให้จาก attachment_id)
+type Attachment = protocol.Attachment
+
+// ที่เก็บเนื้อไฟล์ แยกจาก metadata ใน DB เพื่อเปลี่ยนไปใช้ object storage (เช่น S3) ได้โดยไม่แก้ handler
+// key คือ ID ที่ server สร้างเอง (UUID) จึงไม่มี path จาก client ปนอยู่
+type AttachmentStorage interface {
+	Put(key string, r io.Reader) error
+	Open(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+var attachmentStorage AttachmentStorage
+
+// เก็บไฟล์ไว้ในโฟลเดอร์บนเครื่อง (ค่าเริ่มต้น)
+type diskAttachmentStorage struct {
+	dir string
+}
+
+func newDiskAttachmentStorage(dir string) (*diskAttachmentStorage, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("creating attachment directory: %w", err)
+	}
+	return &diskAttachmentStorage{dir: dir}, nil
+}
+
+// เขียนลงไฟล์ชั่วคราวก่อนแล้วค่อย rename กันไฟล์ครึ่งๆ กลางๆ ถ้า upload ขาดกลางทาง
+func (s *diskAttachmentStorage) Put(key string, r io.Reader) error {
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, key))
+}
+
+func (s *diskAttachmentStorage) Open(key string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(s.dir, key))
+}
+
+func (s *diskAttachmentStorage) Delete(key string) error {
+	return os.Remove(filepath.Join(s.dir, key))
+}
+
+// เปิดที่เก็บไฟล์แนบตาม config
+func initAttachments() error {
+	storage, err := newDiskAttachmentStorage(config.AttachmentDir)
+	if err != nil {
+		return err
+	}
+	attachmentStorage = storage
+	return nil
+}
+
+// ชนิดไฟล์จากเนื้อไฟล์จริง (ไม่เชื่อ Content-Type ที่ client ส่งมา) ตัด parameter เช่น charset ออก
+func sniffContentType(head []byte) string {
+	contentType, _, _ := strings.Cut(http.DetectContentType(head), ";")
+	return contentType
+}
+
+// ชื่อไฟล์ที่ปลอดภัยสำหรับเก็บและส่งกลับใน Content-Disposition (ไม่มี path)
+func cleanAttachmentFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" {
+		name = "file"
+	}
+	if runes := []rune(name); len(runes) > maxAttachmentFilenameRunes {
+		name = string(runes[:maxAttachmentFilenameRunes])
+	}
+	return name
+}
+
+// metadata ของไฟล์แนบพร้อมผู้อัปโหลด
+func getAttachment(tenant, id string) (Attachment, string, error) {
+	att := Attachment{ID: id}
+	var uploaderID string
+	err := db.QueryRow("SELECT uploader_id, filename, content_type, size, created_at FROM attachments WHERE id = ? AND tenant_id = ?", id, tenant).
+		Scan(&uploaderID, &att.Filename, &att.ContentType, &att.Size, &att.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Attachment{}, "", errAttachmentNotFound
+	}
+	if err != nil {
+		return Attachment{}, "", fmt.Errorf("fetching attachment: %w", err)
+	}
+	return att, uploaderID, nil
+}
+
+// ตรวจว่าผู้ส่งเป็นคนอัปโหลดไฟล์ที่อ้างถึง แล้วแนบ metadata ให้ msg
+// (ส่งต่อไฟล์ของคนอื่นทำได้ผ่าน /messages/:id/forward เท่านั้น)
+func resolveAttachment(msg *Message) error {
+	if msg.AttachmentID == "" {
+		msg.Attachment = nil
+		return nil
+	}
+	att, uploaderID, err := getAttachment(tenantOrDefault(msg.TenantID), msg.AttachmentID)
+	if err != nil {
+		return err
+	}
+	if uploaderID != msg.SenderID {
+		return errAttachmentNotOwned
+	}
+	msg.Attachment = &att
+	return nil
+}
+
+// ผู้ใช้ดาวน์โหลดไฟล์ได้ถ้าเป็นผู้อัปโหลด หรือเป็นผู้ส่ง/ผู้รับของข้อความที่ยังไม่ถูกลบซึ่งแนบไฟล์นี้
+func canAccessAttachment(tenant, id, uploaderID, userID string) (bool, error) {
+	if userID == uploaderID {
+		return true, nil
+	}
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM messages WHERE tenant_id = ? AND attachment_id = ? AND deleted_at IS NULL AND (sender_id = ? OR receiver_id = ?)", tenant, id, userID, userID).Scan(&n)
+	return n > 0, err
+}
+
+// แนบ metadata ของไฟล์ให้ข้อความที่ดึงจาก DB (tombstone ไม่มีไฟล์แนบ)
+func attachAttachments(msgs []Message) {
+	var ids []any
+	for _, msg := range msgs {
+		if !msg.Deleted {
+			ids = append(ids, msg.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	query := fmt.Sprintf(`SELECT m.id, a.id, a.filename, a.content_type, a.size, a.created_at
+		FROM messages m JOIN attachments a ON a.id = m.attachment_id
+		WHERE m.id IN (%s)`, strings.Join(makePlaceholders(len(ids)), ","))
+	rows, err := db.Query(query, ids...)
+	if err != nil {
+		slog.Error("fetching attachments", "err", err)
+		return
+	}
+	defer rows.Close()
+
+	byMessage := make(map[int64]*Attachment)
+	for rows.Next() {
+		var messageID int64
+		var att Attachment
+		if err := rows.Scan(&messageID, &att.ID, &att.Filename, &att.ContentType, &att.Size, &att.CreatedAt); err != nil {
+			slog.Error("scanning attachment", "err", err)
+			return
+		}
+		byMessage[messageID] = &att
+	}
+	for i := range msgs {
+		if att, ok := byMessage[msgs[i].ID]; ok {
+			msgs[i].AttachmentID = att.ID
+			msgs[i].Attachment = att
+		}
+	}
+}
+
+// POST /attachments?user_id=...  (multipart/form-data ฟิลด์ "file")
+// คืน metadata ของไฟล์ ใช้ id ใส่เป็น attachment_id ของข้อความ
+func handleUploadAttachment(c *fiber.Ctx) error {
+	userID, err := RequestUser(c)
+	if err != nil {
+		return err
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		return InvalidRequest("file is required")
+	}
+	if header.Size > config.AttachmentMaxBytes {
+		return NewError(fiber.StatusRequestEntityTooLarge, errCodeInvalidRequest, fmt.Sprintf("File too large (max %d bytes)", config.AttachmentMaxBytes))
+	}
+	file, err := header.Open()
+	if err != nil {
+		return Internal("Error opening upload", err)
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return InvalidRequest("file is empty")
+	}
+	head = head[:n]
+	contentType := sniffContentType(head)
+	if !slices.Contains(config.AttachmentTypes, contentType) {
+		return NewError(fiber.StatusUnsupportedMediaType, errCodeInvalidRequest, "File type not allowed: "+contentType)
+	}
+
+	tenant := TenantOf(c)
+	att := Attachment{
+		ID:          uuid.NewString(),
+		Filename:    cleanAttachmentFilename(header.Filename),
+		ContentType: contentType,
+		Size:        header.Size,
+		CreatedAt:   time.Now().UTC(),
+	}
+	if err := attachmentStorage.Put(att.ID, io.MultiReader(bytes.NewReader(head), file)); err != nil {
+		return Internal("Error storing attachment", err)
+	}
+	_, err = db.Exec("INSERT INTO attachments (id, tenant_id, uploader_id, filename, content_type, size, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		att.ID, tenant, userID, att.Filename, att.ContentType, att.Size, att.CreatedAt)
+	if err != nil {
+		attachmentStorage.Delete(att.ID)
+		return Internal("Error saving attachment", err)
+	}
+	slog.Info("attachment uploaded", "request_id", requestIDOf(c), "tenant", tenant, "user_id", userID, "attachment_id", att.ID, "content_type", att.ContentType, "size", att.Size)
+
+	return c.Status(fiber.StatusCreated).JSON(att)
+}
+
+// GET /attachments/:id?user_id=...
+func handleGetAttachment(c *fiber.Ctx) error {
+	userID, err := RequestUser(c)
+	if err != nil {
+		return err
+	}
+	tenant := TenantOf(c)
+	att, uploaderID, err := getAttachment(tenant, c.Params("id"))
+	if errors.Is(err, errAttachmentNotFound) {
+		return NotFound("Attachment not found")
+	}
+	if err != nil {
+		return Internal("Error loading attachment", err)
+	}
+	ok, err := canAccessAttachment(tenant, att.ID, uploaderID, userID)
+	if err != nil {
+		return Internal("Error checking attachment access", err)
+	}
+	if !ok {
+		return Forbidden("Not a participant")
+	}
+
+	body, err := attachmentStorage.Open(att.ID)
+	if err != nil {
+		return Internal("Error opening attachment", err)
+	}
+	// รูปแสดงใน browser ได้ ไฟล์อื่นบังคับดาวน์โหลด และห้าม browser เดาชนิดไฟล์เอง
+	disposition := "attachment"
+	if strings.HasPrefix(att.ContentType, "image/") {
+		disposition = "inline"
+	}
+	c.Set(fiber.HeaderContentType, att.ContentType)
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType(disposition, map[string]string{"filename": att.Filename}))
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	return c.SendStream(body, int(att.Size))
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// PNG ขนาดเล็กพอให้ http.DetectContentType รู้จัก
+var testPNG = append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 32)...)
+
+// อัปโหลดไฟล์ในนาม userID คืนค่า status และ metadata
+func uploadAttachment(t *testing.T, userID, filename string, content []byte) (int, Attachment) {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", filename)
+	part.Write(content)
+	form.Close()
+
+	resp, err := http.Post("http://"+testAddr+"/attachments?user_id="+userID, form.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	defer resp.Body.Close()
+	var att Attachment
+	json.NewDecoder(resp.Body).Decode(&att)
+	return resp.StatusCode, att
+}
+
+func getAttachmentAs(t *testing.T, userID, id string) (*http.Response, []byte) {
+	t.Helper()
+	resp, err := http.Get("http://" + testAddr + "/attachments/" + id + "?user_id=" + userID)
+	if err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp, data
+}
+
+func TestAttachmentMessageAndDownload(t *testing.T) {
+	alice, bob, carol := newTestUser("alice"), newTestUser("bob"), newTestUser("carol")
+	status, att := uploadAttachment(t, alice, "../../photo.png", testPNG)
+	if status != http.StatusCreated || att.ContentType != "image/png" || att.Filename != "photo.png" || att.Size != int64(len(testPNG)) {
+		t.Fatalf("unexpected upload result: %d %+v", status, att)
+	}
+
+	// ส่งไฟล์ของคนอื่นไม่ได้
+	resp, err := http.Post("http://"+testAddr+"/send", "application/json", strings.NewReader(`{"sender_id":"`+carol+`","receiver_id":"`+bob+`","attachment_id":"`+att.ID+`"}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for attachment owned by someone else, got %d", resp.StatusCode)
+	}
+
+	bobConn := dialWS(t, bob)
+	resp, err = http.Post("http://"+testAddr+"/send", "application/json", strings.NewReader(`{"sender_id":"`+alice+`","receiver_id":"`+bob+`","attachment_id":"`+att.ID+`"}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	resp.Body.Close()
+	var msg Message
+	readJSON(t, bobConn, &msg)
+	if msg.AttachmentID != att.ID || msg.Attachment == nil || msg.Attachment.Filename != "photo.png" {
+		t.Fatalf("expected attachment on message, got %+v", msg)
+	}
+
+	resp, data := getAttachmentAs(t, bob, att.ID)
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(data, testPNG) {
+		t.Fatalf("receiver download: %d (%d bytes)", resp.StatusCode, len(data))
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "image/png" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	if resp, _ := getAttachmentAs(t, carol, att.ID); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for non-participant, got %d", resp.StatusCode)
+	}
+	if resp, _ := getAttachmentAs(t, bob, "missing"); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown attachment, got %d", resp.StatusCode)
+	}
+}
+
+func TestAttachmentUploadValidation(t *testing.T) {
+	alice := newTestUser("alice")
+	if status, _ := uploadAttachment(t, alice, "archive.zip", []byte("PK\x03\x04 not allowed")); status != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected 415 for zip, got %d", status)
+	}
+
+	prev := config.AttachmentMaxBytes
+	config.AttachmentMaxBytes = 8
+	defer func() { config.AttachmentMaxBytes = prev }()
+	if status, _ := uploadAttachment(t, alice, "photo.png", testPNG); status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for oversized file, got %d", status)
+	}
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	fws "github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// ขนาดคิวของ audit event ที่รอเขียนลง DB
+const auditQueueSize = 1000
+
+// จำนวนแถวต่อหน้าของ GET /audit/sessions
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 500
+)
+
+// แถวใน audit log ของการเชื่อมต่อหนึ่งครั้ง
+type SessionAudit struct {
+	ID               string     `json:"id"`
+	TenantID         string     `json:"tenant_id"`
+	UserID           string     `json:"user_id"`
+	SessionID        string     `json:"session_id"`
+	RemoteIP         string     `json:"remote_ip"`
+	ConnectedAt      time.Time  `json:"connected_at"`
+	DisconnectedAt   *time.Time `json:"disconnected_at,omitempty"`
+	DisconnectReason string     `json:"disconnect_reason,omitempty"`
+}
+
+// event ที่รอเขียน: connect (insert) หรือ disconnect (update) ของแถวเดียวกันผ่านคิวเดียว จึงเขียนตามลำดับเสมอ
+type auditEvent struct {
+	connect *SessionAudit
+	id      string
+	at      time.Time
+	reason  string
+}
+
+var auditQueue = make(chan auditEvent, auditQueueSize)
+
+// เปิด goroutine เขียน audit log (ตัวเดียว เพื่อให้ disconnect ตามหลัง connect เสมอ)
+func startAuditWriter() {
+	go func() {
+		for ev := range auditQueue {
+			var err error
+			if ev.connect != nil {
+				a := ev.connect
+				_, err = db.Exec("INSERT INTO sessions (id, tenant_id, user_id, session_id, remote_ip, connected_at) VALUES (?, ?, ?, ?, ?, ?)",
+					a.ID, a.TenantID, a.UserID, a.SessionID, a.RemoteIP, a.ConnectedAt.UTC())
+			} else {
+				_, err = db.Exec("UPDATE sessions SET disconnected_at = ?, disconnect_reason = ? WHERE id = ?", ev.at.UTC(), ev.reason, ev.id)
+			}
+			if err != nil {
+				slog.Error("writing session audit", "session_audit_id", ev.id, "err", err)
+			}
+		}
+	}()
+}
+
+// ส่ง event เข้าคิวโดยไม่ block การรับส่งข้อความ (คิวเต็ม = ทิ้งและ log)
+func queueAudit(ev auditEvent) {
+	select {
+	case auditQueue <- ev:
+	default:
+		slog.Warn("audit queue full, dropped event", "session_audit_id", ev.id)
+	}
+}
+
+// บันทึกการเชื่อมต่อ คืนค่า ID ของแถวสำหรับบันทึกตอน disconnect
+func auditConnect(cl *client, remoteIP string) string {
+	id := uuid.NewString()
+	queueAudit(auditEvent{id: id, connect: &SessionAudit{
+		ID:          id,
+		TenantID:    cl.tenant,
+		UserID:      cl.userID,
+		SessionID:   cl.sessionID,
+		RemoteIP:    remoteIP,
+		ConnectedAt: cl.connectedAt,
+	}})
+	return id
+}
+
+// บันทึกการตัดการเชื่อมต่อพร้อมเหตุผล
+func auditDisconnect(id, reason string) {
+	queueAudit(auditEvent{id: id, at: time.Now(), reason: reason})
+}
+
+// เหตุผลของการตัดการเชื่อมต่อจาก error ของ read loop (ถ้า server ไม่ได้ปิดเอง)
+func disconnectReason(cl *client, err error) string {
+	if reason := cl.closeReason(); reason != "" {
+		return reason
+	}
+	var closeErr *fws.CloseError
+	if errors.As(err, &closeErr) {
+		return fmt.Sprintf("client closed (%d)", closeErr.Code)
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return "closed"
+}
+
+// connection จบโดยไม่ได้ปิดตามปกติ (หลุด, reset, timeout หรือ close code ที่ไม่ใช่ 1000/1001)
+func isAbnormalClose(err error) bool {
+	var closeErr *fws.CloseError
+	if errors.As(err, &closeErr) {
+		return closeErr.Code != fws.CloseNormalClosure && closeErr.Code != fws.CloseGoingAway
+	}
+	return err != nil
+}
+
+// GET /audit/sessions?user=<id>&tenant=<id>&limit=&offset=  (เฉพาะผู้ดูแล เห็นทุก tenant)
+func handleAuditSessions(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", defaultAuditPageSize)
+	if limit <= 0 || limit > maxAuditPageSize {
+		return InvalidRequest(fmt.Sprintf("limit must be between 1 and %d", maxAuditPageSize))
+	}
+	offset := c.QueryInt("offset", 0)
+	if offset < 0 {
+		return InvalidRequest("offset must not be negative")
+	}
+
+	query := "SELECT id, tenant_id, user_id, session_id, remote_ip, connected_at, disconnected_at, COALESCE(disconnect_reason, '') FROM sessions"
+	var where []string
+	var args []any
+	if tenant := c.Query("tenant"); tenant != "" {
+		where = append(where, "tenant_id = ?")
+		args = append(args, tenant)
+	}
+	if user := c.Query("user"); user != "" {
+		where = append(where, "user_id = ?")
+		args = append(args, user)
+	}
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY connected_at DESC, id LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return Internal("Error fetching session audit", err)
+	}
+	defer rows.Close()
+
+	entries := make([]SessionAudit, 0)
+	for rows.Next() {
+		var a SessionAudit
+		if err := rows.Scan(&a.ID, &a.TenantID, &a.UserID, &a.SessionID, &a.RemoteIP, &a.ConnectedAt, &a.DisconnectedAt, &a.DisconnectReason); err != nil {
+			return Internal("Error scanning session audit", err)
+		}
+		entries = append(entries, a)
+	}
+	if err := rows.Err(); err != nil {
+		return Internal("Error reading session audit", err)
+	}
+
+	return c.JSON(fiber.Map{
+		"sessions": entries,
+		"limit":    limit,
+		"offset":   offset,
+	})
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	fws "github.com/fasthttp/websocket"
+)
+
+func TestSessionAuditRecordsConnectAndDisconnect(t *testing.T) {
+	prevToken := config.AdminToken
+	config.AdminToken = "audit-secret"
+	t.Cleanup(func() { config.AdminToken = prevToken })
+
+	bob := newTestUser("bob")
+	url := "ws://" + testAddr + "/ws/chat/" + bob + "?session=tab-1"
+
+	oldConn, _, err := fws.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer oldConn.Close()
+	waitFor(t, func() bool { _, ok := getClient(DefaultTenant, bob); return ok })
+
+	newConn, _, err := fws.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	oldConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := oldConn.ReadMessage(); !fws.IsCloseError(err, closeSessionReplaced) {
+		t.Fatalf("expected old session to be closed, got %v", err)
+	}
+
+	// client ปิดเองแบบปกติ
+	newConn.WriteMessage(fws.CloseMessage, fws.FormatCloseMessage(fws.CloseNormalClosure, "bye"))
+	newConn.Close()
+
+	fetch := func() []SessionAudit {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+testAddr+"/audit/sessions?user="+bob, nil)
+		req.Header.Set("Authorization", "Bearer audit-secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("get audit: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected status %d", resp.StatusCode)
+		}
+		var body struct {
+			Sessions []SessionAudit `json:"sessions"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return body.Sessions
+	}
+
+	var sessions []SessionAudit
+	waitFor(t, func() bool {
+		sessions = fetch()
+		if len(sessions) != 2 {
+			return false
+		}
+		for _, s := range sessions {
+			if s.DisconnectedAt == nil {
+				return false
+			}
+		}
+		return true
+	})
+
+	reasons := map[string]bool{}
+	for _, s := range sessions {
+		if s.SessionID != "tab-1" || s.RemoteIP != "127.0.0.1" {
+			t.Fatalf("unexpected audit row: %+v", s)
+		}
+		reasons[s.DisconnectReason] = true
+	}
+	if !reasons["session replaced"] || !reasons["client closed (1000)"] {
+		t.Fatalf("unexpected disconnect reasons: %+v", sessions)
+	}
+}
+
+func TestSessionAuditRequiresAdmin(t *testing.T) {
+	prevToken := config.AdminToken
+	config.AdminToken = "audit-secret"
+	t.Cleanup(func() { config.AdminToken = prevToken })
+
+	resp, err := http.Get("http://" + testAddr + "/audit/sessions")
+	if err != nil {
+		t.Fatalf("get audit: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", resp.StatusCode)
+	}
+}
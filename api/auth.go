@@ -0,0 +1,46 @@
+package api
+
+import (
+	"cmp"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// key ใน Locals ที่เก็บ userID ที่ยืนยันตัวตนแล้ว (จาก JWT หรือ API key ของ bot)
+const LocalsAuthUser = "auth_user"
+
+// บันทึกผู้ใช้ที่ยืนยันตัวตนแล้ว (เรียกจาก middleware ที่ตรวจ credential)
+func SetAuthUser(c *fiber.Ctx, userID string) {
+	c.Locals(LocalsAuthUser, userID)
+}
+
+// userID ที่ยืนยันตัวตนแล้วของ request (ค่าว่าง = ไม่ได้ยืนยันตัวตน)
+func AuthUser(c *fiber.Ctx) string {
+	userID, _ := c.Locals(LocalsAuthUser).(string)
+	return userID
+}
+
+// ผู้ใช้ที่ระบุใน body/query ต้องตรงกับผู้ใช้ที่ยืนยันตัวตนแล้ว ถ้ามีให้ใช้ผู้ใช้นั้นแทน (ค่าว่างได้)
+// ไม่ได้ยืนยันตัวตนใช้ค่าที่ส่งมาตามเดิม handler ตรวจค่าว่างเอง
+func BindAuthUser(c *fiber.Ctx, userID *string, field string) error {
+	if user := AuthUser(c); user != "" {
+		if *userID != "" && *userID != user {
+			return Forbidden(field + " does not match token")
+		}
+		*userID = user
+	}
+	return nil
+}
+
+// ผู้ใช้ของ REST request: ผู้ใช้ที่ยืนยันตัวตนแล้ว ไม่เช่นนั้นใช้ :userID ใน path หรือ ?user_id=
+// ถ้ามีทั้งสองอย่าง user_id ต้องตรงกัน
+func RequestUser(c *fiber.Ctx) (string, error) {
+	userID := cmp.Or(c.Params("userID"), c.Query("user_id"))
+	if err := BindAuthUser(c, &userID, "user_id"); err != nil {
+		return "", err
+	}
+	if userID == "" {
+		return "", InvalidRequest("user_id is required")
+	}
+	return userID, nil
+}
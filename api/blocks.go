@@ -0,0 +1,160 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ชนิดของการบล็อก
+const (
+	blockModeBlock = "block" // ไม่รับข้อความจากผู้ใช้นี้ ผู้ส่งได้ error "blocked"
+	blockModeMute  = "mute"  // รับข้อความตามปกติ แต่ไม่แจ้งเตือน (push) ตอนออฟไลน์
+)
+
+var errBlocked = errors.New("recipient has blocked you")
+
+// ผู้ใช้ที่ถูกบล็อกหรือปิดเสียง
+type Block struct {
+	UserID    string    `json:"user_id"` // ผู้ที่ถูกบล็อก
+	Mode      string    `json:"mode"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// body ของ POST /blocks
+type BlockRequest struct {
+	UserID   string `json:"user_id"`   // ผู้บล็อก (ใช้ค่าจาก JWT ถ้าเปิด RequireJWT)
+	TargetID string `json:"target_id"` // ผู้ที่ถูกบล็อก
+	Mode     string `json:"mode"`      // "block" (default) หรือ "mute"
+}
+
+func errSenderBlocked() *Error {
+	return NewError(fiber.StatusForbidden, errCodeBlocked, errBlocked.Error())
+}
+
+// ชนิดการบล็อกที่ blocker ตั้งไว้กับ target (ค่าว่าง = ไม่ได้บล็อก)
+func blockModeOf(tenant, blockerID, targetID string) (string, error) {
+	var mode string
+	err := db.QueryRow("SELECT mode FROM blocks WHERE tenant_id = ? AND blocker_id = ? AND blocked_id = ?", tenantOrDefault(tenant), blockerID, targetID).Scan(&mode)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return mode, err
+}
+
+// ผู้รับบล็อกผู้ส่งไว้หรือไม่ (ข้อความถึงห้องตรวจแยกรายสมาชิกใน roomRecipients)
+func checkNotBlocked(msg Message) error {
+	if msg.RoomID != 0 || msg.ReceiverID == msg.SenderID {
+		return nil
+	}
+	mode, err := blockModeOf(msg.TenantID, msg.ReceiverID, msg.SenderID)
+	if err != nil {
+		return err
+	}
+	if mode == blockModeBlock {
+		return errBlocked
+	}
+	return nil
+}
+
+// ผู้รับที่ปิดเสียงผู้ส่งไว้ ไม่ต้องแจ้งเตือนตอนออฟไลน์
+func isMuted(msg Message) bool {
+	mode, err := blockModeOf(msg.TenantID, msg.ReceiverID, msg.SenderID)
+	if err != nil {
+		messageLogger(msg).Error("checking mute", "err", err)
+		return false
+	}
+	return mode == blockModeMute
+}
+
+// ผู้ใช้ที่บล็อก senderID ไว้ (ใช้กรองสมาชิกห้องและผู้รับ broadcast)
+func blockersOf(tenant, senderID string) (map[string]bool, error) {
+	rows, err := db.Query("SELECT blocker_id FROM blocks WHERE tenant_id = ? AND blocked_id = ? AND mode = ?", tenantOrDefault(tenant), senderID, blockModeBlock)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	blockers := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		blockers[id] = true
+	}
+	return blockers, rows.Err()
+}
+
+// POST /blocks  บล็อกซ้ำ = เปลี่ยน mode
+func handleBlock(c *fiber.Ctx) error {
+	var req BlockRequest
+	if err := c.BodyParser(&req); err != nil {
+		return InvalidRequest("Invalid request body")
+	}
+	if user := AuthUser(c); user != "" {
+		if req.UserID != "" && req.UserID != user {
+			return Forbidden("user_id does not match token")
+		}
+		req.UserID = user
+	}
+	if req.Mode == "" {
+		req.Mode = blockModeBlock
+	}
+	switch {
+	case req.UserID == "" || req.TargetID == "":
+		return InvalidRequest("user_id and target_id are required")
+	case req.UserID == req.TargetID:
+		return InvalidRequest("Cannot block yourself")
+	case req.Mode != blockModeBlock && req.Mode != blockModeMute:
+		return InvalidRequest("mode must be block or mute")
+	}
+
+	block := Block{UserID: req.TargetID, Mode: req.Mode, CreatedAt: time.Now().UTC()}
+	_, err := db.Exec(`INSERT INTO blocks (tenant_id, blocker_id, blocked_id, mode, created_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (tenant_id, blocker_id, blocked_id) DO UPDATE SET mode = excluded.mode`,
+		TenantOf(c), req.UserID, req.TargetID, req.Mode, block.CreatedAt)
+	if err != nil {
+		return Internal("Error saving block", err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(block)
+}
+
+// DELETE /blocks/:id?user_id=...  (:id = ผู้ที่ถูกบล็อก)
+func handleUnblock(c *fiber.Ctx) error {
+	userID, err := RequestUser(c)
+	if err != nil {
+		return err
+	}
+	res, err := db.Exec("DELETE FROM blocks WHERE tenant_id = ? AND blocker_id = ? AND blocked_id = ?", TenantOf(c), userID, c.Params("id"))
+	if err != nil {
+		return Internal("Error removing block", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return NotFound("Block not found")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// GET /blocks?user_id=...
+func handleListBlocks(c *fiber.Ctx) error {
+	userID, err := RequestUser(c)
+	if err != nil {
+		return err
+	}
+	rows, err := db.Query("SELECT blocked_id, mode, created_at FROM blocks WHERE tenant_id = ? AND blocker_id = ? ORDER BY created_at, blocked_id", TenantOf(c), userID)
+	if err != nil {
+		return Internal("Error listing blocks", err)
+	}
+	defer rows.Close()
+	blocks := []Block{}
+	for rows.Next() {
+		var b Block
+		if err := rows.Scan(&b.UserID, &b.Mode, &b.CreatedAt); err != nil {
+			return Internal("Error listing blocks", err)
+		}
+		blocks = append(blocks, b)
+	}
+	return c.JSON(blocks)
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// เรียก API ของ /blocks คืนค่า status และ body
+func blocksRequest(t *testing.T, method, path, body string) (int, []byte) {
+	t.Helper()
+	req, _ := http.NewRequest(method, "http://"+testAddr+path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, data
+}
+
+func TestBlockedSenderGetsErrorFrame(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	if status, body := blocksRequest(t, http.MethodPost, "/blocks", `{"user_id":"`+bob+`","target_id":"`+alice+`"}`); status != http.StatusCreated {
+		t.Fatalf("block: %d %s", status, body)
+	}
+	aliceConn := dialWS(t, alice)
+
+	if err := aliceConn.WriteJSON(Message{SenderID: alice, ReceiverID: bob, Text: "hi"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var frame ErrorFrame
+	readJSON(t, aliceConn, &frame)
+	if frame.Type != frameTypeError || frame.Code != errCodeBlocked {
+		t.Fatalf("unexpected frame: %+v", frame)
+	}
+
+	status, body := blocksRequest(t, http.MethodPost, "/send", `{"sender_id":"`+alice+`","receiver_id":"`+bob+`","text":"hi"}`)
+	if status != http.StatusForbidden || !strings.Contains(string(body), `"code":"blocked"`) {
+		t.Fatalf("expected blocked from /send, got %d %s", status, body)
+	}
+	if n := countStored(t, alice, bob, false); n != 0 {
+		t.Fatalf("expected no stored messages, got %d", n)
+	}
+
+	if status, _ := blocksRequest(t, http.MethodDelete, "/blocks/"+alice+"?user_id="+bob, ""); status != http.StatusNoContent {
+		t.Fatalf("unblock: status %d", status)
+	}
+	if status, _ := blocksRequest(t, http.MethodPost, "/send", `{"sender_id":"`+alice+`","receiver_id":"`+bob+`","text":"hi"}`); status != http.StatusOK {
+		t.Fatalf("send after unblock: status %d", status)
+	}
+}
+
+func TestBroadcastSkipsBlockingReceivers(t *testing.T) {
+	alice, bob, carol := newTestUser("alice"), newTestUser("bob"), newTestUser("carol")
+	blocksRequest(t, http.MethodPost, "/blocks", `{"user_id":"`+bob+`","target_id":"`+alice+`"}`)
+
+	status, body := blocksRequest(t, http.MethodPost, "/broadcast", `{"sender_id":"`+alice+`","receiver_ids":["`+bob+`","`+carol+`"],"text":"hey"}`)
+	var resp struct {
+		Results []BroadcastResult `json:"results"`
+	}
+	json.Unmarshal(body, &resp)
+	if status != http.StatusOK || len(resp.Results) != 2 || !resp.Results[0].Blocked || resp.Results[1].Blocked || resp.Results[1].ID == 0 {
+		t.Fatalf("unexpected broadcast: %d %s", status, body)
+	}
+	if countStored(t, alice, bob, false) != 0 || countStored(t, alice, carol, false) != 1 {
+		t.Fatal("blocked receiver should get no message")
+	}
+}
+
+func TestMuteStillDeliversAndBlockValidation(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	if status, _ := blocksRequest(t, http.MethodPost, "/blocks", `{"user_id":"`+bob+`","target_id":"`+bob+`"}`); status != http.StatusBadRequest {
+		t.Fatalf("expected 400 for self block, got %d", status)
+	}
+	if status, _ := blocksRequest(t, http.MethodPost, "/blocks", `{"user_id":"`+bob+`","target_id":"`+alice+`","mode":"mute"}`); status != http.StatusCreated {
+		t.Fatalf("mute: status %d", status)
+	}
+	if !isMuted(Message{SenderID: alice, ReceiverID: bob}) {
+		t.Fatal("expected alice to be muted by bob")
+	}
+	if status, _ := blocksRequest(t, http.MethodPost, "/send", `{"sender_id":"`+alice+`","receiver_id":"`+bob+`","text":"hi"}`); status != http.StatusOK {
+		t.Fatalf("send to muting user: status %d", status)
+	}
+
+	status, body := blocksRequest(t, http.MethodGet, "/blocks?user_id="+bob, "")
+	var blocks []Block
+	json.Unmarshal(body, &blocks)
+	if status != http.StatusOK || len(blocks) != 1 || blocks[0].UserID != alice || blocks[0].Mode != blockModeMute {
+		t.Fatalf("unexpected blocks: %d %s", status, body)
+	}
+}
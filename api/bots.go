@@ -0,0 +1,208 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// key ใน Locals ที่บอกว่า request นี้ยืนยันตัวตนด้วย API key ของ bot
+const localsAuthBot = "auth_bot"
+
+// event ที่ส่งให้ webhook ของ bot เมื่อมีข้อความถึง bot ที่ไม่ได้เชื่อมต่อ WebSocket อยู่
+const webhookBotMessage = "message.received"
+
+// ผู้ใช้ที่เป็นโปรแกรม ยืนยันตัวตนด้วย API key (Authorization: Bot <key>) แทน JWT
+// ID ของ bot ใช้เป็น user ID ได้ทุกที่ (ส่ง/รับข้อความ, เป็นสมาชิกห้อง)
+type Bot struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	WebhookURL string    `json:"webhook_url,omitempty"` // รับข้อความทาง webhook เมื่อไม่ได้เชื่อมต่อ WebSocket
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// body ของ POST /admin/bots
+type CreateBotRequest struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	WebhookURL string `json:"webhook_url"`
+}
+
+// เก็บเฉพาะ hash ของ API key ใน DB (key แสดงครั้งเดียวตอนสร้าง)
+func hashBotKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func newBotSecret(prefix string) string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return prefix + hex.EncodeToString(b)
+}
+
+// middleware ยืนยันตัวตน bot จาก Authorization: Bot <key> (ไม่มี header = ไม่ใช่ bot ผ่านไปตามปกติ)
+// bot ที่ผ่านการตรวจถูกจำกัดด้วย RequestUser/AuthUser เหมือนผู้ใช้ที่ใช้ JWT คือเห็นเฉพาะบทสนทนาของตัวเอง
+func authenticateBot(c *fiber.Ctx) error {
+	key, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bot ")
+	if !ok {
+		return c.Next()
+	}
+	var botID string
+	err := db.QueryRow("SELECT id FROM bots WHERE tenant_id = ? AND api_key_hash = ?", TenantOf(c), hashBotKey(key)).Scan(&botID)
+	if errors.Is(err, sql.ErrNoRows) {
+		slog.Info("rejected bot key", "request_id", requestIDOf(c), "path", c.Path())
+		return NewError(fiber.StatusUnauthorized, errCodeUnauthorized, "Invalid bot key")
+	}
+	if err != nil {
+		return Internal("Error checking bot key", err)
+	}
+	SetAuthUser(c, botID)
+	c.Locals(localsAuthBot, true)
+	return c.Next()
+}
+
+// request นี้มาจาก bot ที่ยืนยันตัวตนแล้วหรือไม่
+func isBot(c *fiber.Ctx) bool {
+	bot, _ := c.Locals(localsAuthBot).(bool)
+	return bot
+}
+
+// URL ของ webhook ต้องเป็น http(s) แบบเต็ม
+func validateBotWebhookURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("webhook_url must be an absolute http(s) URL")
+	}
+	return nil
+}
+
+// POST /admin/bots  คืน api_key และ webhook_secret ครั้งเดียว (เก็บไว้เองฝั่ง bot)
+func handleCreateBot(c *fiber.Ctx) error {
+	var req CreateBotRequest
+	if err := c.BodyParser(&req); err != nil {
+		return InvalidRequest("Invalid request body")
+	}
+	if req.ID == "" {
+		return InvalidRequest("id is required")
+	}
+	if err := validateBotWebhookURL(req.WebhookURL); err != nil {
+		return InvalidRequest(err.Error())
+	}
+
+	bot := Bot{ID: req.ID, Name: req.Name, WebhookURL: req.WebhookURL, CreatedAt: time.Now().UTC()}
+	apiKey, webhookSecret := newBotSecret("bot_"), newBotSecret("whsec_")
+	res, err := db.Exec("INSERT INTO bots (tenant_id, id, name, api_key_hash, webhook_url, webhook_secret, created_at) VALUES (?, ?, ?, ?, ?, ?, ?) ON CONFLICT (tenant_id, id) DO NOTHING",
+		TenantOf(c), bot.ID, bot.Name, hashBotKey(apiKey), nullString(bot.WebhookURL), webhookSecret, bot.CreatedAt)
+	if err != nil {
+		return Internal("Error creating bot", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return NewError(fiber.StatusConflict, errCodeInvalidRequest, "Bot already exists")
+	}
+	slog.Info("bot created", "request_id", requestIDOf(c), "tenant", TenantOf(c), "bot_id", bot.ID)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"bot":            bot,
+		"api_key":        apiKey,
+		"webhook_secret": webhookSecret,
+	})
+}
+
+// GET /admin/bots
+func handleListBots(c *fiber.Ctx) error {
+	rows, err := db.Query("SELECT id, name, COALESCE(webhook_url, ''), created_at FROM bots WHERE tenant_id = ? ORDER BY id", TenantOf(c))
+	if err != nil {
+		return Internal("Error listing bots", err)
+	}
+	defer rows.Close()
+	bots := []Bot{}
+	for rows.Next() {
+		var bot Bot
+		if err := rows.Scan(&bot.ID, &bot.Name, &bot.WebhookURL, &bot.CreatedAt); err != nil {
+			return Internal("Error listing bots", err)
+		}
+		bots = append(bots, bot)
+	}
+	return c.JSON(bots)
+}
+
+// DELETE /admin/bots/:id  (key ใช้ไม่ได้ทันที ข้อความเดิมยังอยู่)
+func handleDeleteBot(c *fiber.Ctx) error {
+	res, err := db.Exec("DELETE FROM bots WHERE tenant_id = ? AND id = ?", TenantOf(c), c.Params("id"))
+	if err != nil {
+		return Internal("Error deleting bot", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return NotFound("Bot not found")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+var botQueue chan Message // ข้อความถึงผู้รับที่ออฟไลน์ รอตรวจว่าเป็น bot ที่มี webhook หรือไม่
+
+// เปิด worker ส่งข้อความให้ webhook ของ bot (ใช้ขนาดคิว/จำนวน worker/timeout เดียวกับ webhook ของระบบ)
+func startBotDelivery() {
+	botQueue = make(chan Message, config.WebhookQueueSize)
+	client := &http.Client{Timeout: config.WebhookTimeout}
+	for i := 0; i < config.WebhookConcurrency; i++ {
+		go func() {
+			for msg := range botQueue {
+				deliverToBot(client, msg)
+			}
+		}()
+	}
+}
+
+// ส่งต่อข้อความที่ผู้รับออฟไลน์ ถ้าผู้รับเป็น bot ที่มี webhook (ไม่ block worker ถ้าคิวเต็มข้อความรอใน DB ตามปกติ)
+func forwardToBot(msg Message) {
+	if botQueue == nil {
+		return
+	}
+	select {
+	case botQueue <- msg:
+	default:
+		webhookDeliveriesTotal.WithLabelValues(webhookBotMessage, webhookOutcomeDropped).Inc()
+		messageLogger(msg).Warn("bot queue full, message left pending")
+	}
+}
+
+// POST ข้อความไปยัง webhook ของ bot ที่เซ็นด้วย webhook_secret ของ bot นั้น สำเร็จแล้ว mark delivered
+// (ข้อความที่ส่งไม่สำเร็จยังค้างใน DB ให้ bot ดึงตอนเชื่อมต่อ WebSocket หรือผ่าน /sync)
+func deliverToBot(client *http.Client, msg Message) {
+	tenant := tenantOrDefault(msg.TenantID)
+	var webhookURL, secret string
+	err := db.QueryRow("SELECT webhook_url, webhook_secret FROM bots WHERE tenant_id = ? AND id = ? AND webhook_url IS NOT NULL", tenant, msg.ReceiverID).Scan(&webhookURL, &secret)
+	if errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+	if err != nil {
+		messageLogger(msg).Error("loading bot webhook", "err", err)
+		return
+	}
+
+	event := WebhookEvent{ID: uuid.NewString(), Type: webhookBotMessage, TenantID: tenant, CreatedAt: time.Now().UTC(), Data: msg}
+	body, err := json.Marshal(event)
+	if err != nil {
+		messageLogger(msg).Error("marshalling bot event", "err", err)
+		return
+	}
+	if postWebhookWithRetry(client, webhookURL, secret, event, body) {
+		markDelivered([]int64{msg.ID})
+	}
+}
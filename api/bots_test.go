@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	fws "github.com/fasthttp/websocket"
+)
+
+// สร้าง bot ผ่าน admin API คืนค่า API key และ webhook secret
+func createTestBot(t *testing.T, id, webhookURL string) (string, string) {
+	t.Helper()
+	prevToken := config.AdminToken
+	config.AdminToken = "bot-admin"
+	t.Cleanup(func() { config.AdminToken = prevToken })
+
+	req, _ := http.NewRequest(http.MethodPost, "http://"+testAddr+"/admin/bots", strings.NewReader(`{"id":"`+id+`","name":"Helper","webhook_url":"`+webhookURL+`"}`))
+	req.Header.Set("Authorization", "Bearer bot-admin")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("create bot: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create bot: status %d", resp.StatusCode)
+	}
+	var created struct {
+		APIKey        string `json:"api_key"`
+		WebhookSecret string `json:"webhook_secret"`
+	}
+	json.NewDecoder(resp.Body).Decode(&created)
+	return created.APIKey, created.WebhookSecret
+}
+
+// POST /send ในนาม bot
+func botSend(t *testing.T, apiKey, body string) int {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, "http://"+testAddr+"/send", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bot "+apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestBotReceivesMessagesByWebhookAndReplies(t *testing.T) {
+	botID, alice := newTestUser("bot"), newTestUser("alice")
+	received := make(chan Message, 1)
+	var secret string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(headerWebhookTimestamp), 10, 64)
+		if r.Header.Get(headerWebhookSignature) != signWebhook(secret, timestamp, body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var event struct {
+			Data Message `json:"data"`
+		}
+		json.Unmarshal(body, &event)
+		received <- event.Data
+	}))
+	defer server.Close()
+
+	var apiKey string
+	apiKey, secret = createTestBot(t, botID, server.URL)
+
+	aliceConn := dialWS(t, alice)
+	resp, err := http.Post("http://"+testAddr+"/send", "application/json", strings.NewReader(`{"sender_id":"`+alice+`","receiver_id":"`+botID+`","text":"help"}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	resp.Body.Close()
+
+	select {
+	case msg := <-received:
+		if msg.SenderID != alice || msg.Text != "help" {
+			t.Fatalf("unexpected webhook message: %+v", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("bot webhook not called")
+	}
+	waitFor(t, func() bool {
+		pending, _ := messageStore.PendingFor(DefaultTenant, botID)
+		return len(pending) == 0
+	})
+
+	var delivery DeliveryReceipt
+	readJSON(t, aliceConn, &delivery)
+	if delivery.Type != frameTypeDeliveryReceipt || delivery.RecipientID != botID {
+		t.Fatalf("unexpected delivery receipt: %+v", delivery)
+	}
+
+	if status := botSend(t, apiKey, `{"sender_id":"`+botID+`","receiver_id":"`+alice+`","text":"hi!"}`); status != http.StatusOK {
+		t.Fatalf("bot reply: status %d", status)
+	}
+	var reply Message
+	readJSON(t, aliceConn, &reply)
+	if reply.SenderID != botID || reply.Text != "hi!" {
+		t.Fatalf("unexpected reply: %+v", reply)
+	}
+}
+
+func TestBotKeyIsScopedToBot(t *testing.T) {
+	botID, alice := newTestUser("bot"), newTestUser("alice")
+	apiKey, _ := createTestBot(t, botID, "")
+
+	if status := botSend(t, apiKey, `{"sender_id":"`+alice+`","receiver_id":"`+botID+`","text":"spoof"}`); status != http.StatusForbidden {
+		t.Fatalf("expected 403 when sending as another user, got %d", status)
+	}
+	if status := botSend(t, "bot_wrong", `{"sender_id":"`+botID+`","receiver_id":"`+alice+`","text":"hi"}`); status != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for unknown key, got %d", status)
+	}
+
+	header := http.Header{"Authorization": {"Bot " + apiKey}}
+	if _, resp, err := fws.DefaultDialer.Dial("ws://"+testAddr+"/ws/chat/"+alice, header); err == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 connecting as another user, got %v", err)
+	}
+	conn, _, err := fws.DefaultDialer.Dial("ws://"+testAddr+"/ws/chat/"+botID, header)
+	if err != nil {
+		t.Fatalf("bot dial: %v", err)
+	}
+	conn.Close()
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// คำขอส่งข้อความเดียวกันให้ผู้รับหลายคน
+type BroadcastRequest struct {
+	SenderID    string          `json:"sender_id"`
+	ReceiverIDs []string        `json:"receiver_ids"`
+	Text        string          `json:"text"`
+	Mentions    []string        `json:"mentions,omitempty"`
+	Metadata    json.RawMessage `json:"metadata,omitempty"`
+}
+
+// ผลการส่งของผู้รับแต่ละคน
+type BroadcastResult struct {
+	ReceiverID string `json:"receiver_id"`
+	Delivered  bool   `json:"delivered"`
+	ID         int64  `json:"id"`
+	Blocked    bool   `json:"blocked,omitempty"` // ผู้รับบล็อกผู้ส่งไว้ ไม่ได้ส่ง
+}
+
+// POST /broadcast
+// แต่ละสำเนาผ่านการตรวจแบบเดียวกับ /send และส่งผ่าน dispatcher.DeliverStored เหมือนข้อความปกติ
+func handleBroadcastRequest(c *fiber.Ctx) error {
+	var req BroadcastRequest
+	if err := c.BodyParser(&req); err != nil {
+		return InvalidRequest("Invalid request body")
+	}
+	if err := BindAuthUser(c, &req.SenderID, "sender_id"); err != nil {
+		return err
+	}
+	if req.SenderID == "" || len(req.ReceiverIDs) == 0 {
+		return InvalidRequest("sender_id and receiver_ids are required")
+	}
+
+	tenant := TenantOf(c)
+	receivers := uniqueIDs(req.ReceiverIDs)
+	if len(receivers) > config.MaxBroadcastRecipients {
+		return InvalidRequest(fmt.Sprintf("Too many recipients (max %d)", config.MaxBroadcastRecipients))
+	}
+	if ok, wait := allowInbound(tenant, req.SenderID, c.IP(), time.Now()); !ok {
+		return RateLimited(c, wait)
+	}
+
+	// ผู้รับที่บล็อกผู้ส่งไว้ถูกข้าม และแจ้งใน results
+	results := make([]BroadcastResult, len(receivers))
+	msgs := make([]Message, 0, len(receivers))
+	slots := make([]int, 0, len(receivers)) // ตำแหน่งใน results ของแต่ละข้อความ
+	for i, receiverID := range receivers {
+		results[i] = BroadcastResult{ReceiverID: receiverID}
+		msg := Message{TenantID: tenant, SenderID: req.SenderID, ReceiverID: receiverID, Text: req.Text, Mentions: req.Mentions, Metadata: req.Metadata, TraceID: requestIDOf(c)}
+		if err := validateOutgoing(&msg); err != nil {
+			var apiErr *Error
+			if errors.As(err, &apiErr) && apiErr.Code == errCodeBlocked {
+				results[i].Blocked = true
+				continue
+			}
+			return err
+		}
+		markMentioned(&msg)
+		msgs = append(msgs, msg)
+		slots = append(slots, i)
+	}
+	if len(msgs) == 0 {
+		return c.JSON(fiber.Map{"results": results})
+	}
+
+	// นับ quota ตามจำนวนผู้รับที่ส่งจริง
+	if ok, resetsAt := consumeQuota(tenant, req.SenderID, len(msgs), time.Now()); !ok {
+		return errQuotaExceeded(resetsAt)
+	}
+
+	// บันทึกทุกข้อความใน transaction เดียว แล้วส่งแบบเดียวกับข้อความปกติ
+	stored, err := saveMessagesToDB(msgs)
+	if err != nil {
+		messagesDispatchedTotal.WithLabelValues(outcomeFailed).Add(float64(len(msgs)))
+		return Internal("Error saving broadcast messages", err)
+	}
+
+	var deliveredIDs []int64
+	for i, msg := range msgs {
+		msg.ID, msg.CreatedAt = stored[i].ID, stored[i].CreatedAt
+		result := &results[slots[i]]
+		result.ID = msg.ID
+		if dispatcher.DeliverStored(msg) {
+			result.Delivered = true
+			deliveredIDs = append(deliveredIDs, msg.ID)
+		}
+	}
+	markDelivered(deliveredIDs)
+
+	slog.Info("broadcast sent", "request_id", requestIDOf(c), "tenant", tenant, "sender_id", req.SenderID, "receivers", len(receivers), "online", len(deliveredIDs))
+
+	return c.JSON(fiber.Map{"results": results})
+}
+
+// ตัด ID ว่างและ ID ซ้ำออก โดยคงลำดับเดิม
+func uniqueIDs(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	unique := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, id)
+	}
+	return unique
+}
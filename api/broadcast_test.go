@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func postBroadcast(t *testing.T, body string) (int, []BroadcastResult, Error) {
+	t.Helper()
+	resp, err := http.Post("http://"+testAddr+"/broadcast", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	defer resp.Body.Close()
+	var out struct {
+		Results []BroadcastResult `json:"results"`
+		Error
+	}
+	json.NewDecoder(resp.Body).Decode(&out)
+	return resp.StatusCode, out.Results, out.Error
+}
+
+func TestBroadcastUsesNormalDeliveryPath(t *testing.T) {
+	webhookQueue := captureWebhooks(t, webhookMessageSent, webhookMessageStoredOffline)
+
+	alice, bob, carol, dave := newTestUser("alice"), newTestUser("bob"), newTestUser("carol"), newTestUser("dave")
+	if _, err := db.Exec("INSERT INTO blocks (tenant_id, blocker_id, blocked_id, mode, created_at) VALUES (?, ?, ?, ?, ?)", DefaultTenant, dave, alice, blockModeBlock, time.Now().UTC()); err != nil {
+		t.Fatalf("block: %v", err)
+	}
+	sub := &feedSubscriber{userFilter: alice, events: make(chan []byte, 10)}
+	feedSubscribers.Store(sub, struct{}{})
+	defer feedSubscribers.Delete(sub)
+
+	// bob ออนไลน์ carol ออฟไลน์ dave บล็อก alice ไว้
+	bobConn := dialWS(t, bob)
+	code, results, _ := postBroadcast(t, `{"sender_id":"`+alice+`","receiver_ids":["`+bob+`","`+carol+`","`+dave+`"],"text":"hello all"}`)
+	if code != http.StatusOK || len(results) != 3 {
+		t.Fatalf("unexpected response %d %+v", code, results)
+	}
+	if !results[0].Delivered || results[1].Delivered || results[1].ID == 0 || !results[2].Blocked || results[2].ID != 0 {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	var got Message
+	readJSON(t, bobConn, &got)
+	if got.ID != results[0].ID || got.Text != "hello all" {
+		t.Fatalf("unexpected frame: %+v", got)
+	}
+
+	// feed และ webhook ได้ทั้งข้อความที่ส่งถึงและที่เก็บไว้
+	statuses := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case payload := <-sub.events:
+			var event FeedEvent
+			json.Unmarshal(payload, &event)
+			statuses[event.Status] = true
+		case <-time.After(2 * time.Second):
+			t.Fatal("expected feed event")
+		}
+	}
+	if !statuses[feedStatusDelivered] || !statuses[feedStatusStored] {
+		t.Fatalf("unexpected feed statuses: %v", statuses)
+	}
+	events := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case event := <-webhookQueue:
+			events[event.Type] = true
+		case <-time.After(2 * time.Second):
+			t.Fatal("expected webhook event")
+		}
+	}
+	if !events[webhookMessageSent] || !events[webhookMessageStoredOffline] {
+		t.Fatalf("unexpected webhook events: %v", events)
+	}
+}
+
+func TestBroadcastValidatesLikeSend(t *testing.T) {
+	prev := config.MaxTextLength
+	config.MaxTextLength = 5
+	defer func() { config.MaxTextLength = prev }()
+
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	code, _, apiErr := postBroadcast(t, `{"sender_id":"`+alice+`","receiver_ids":["`+bob+`"],"text":"far too long"}`)
+	if details, _ := apiErr.Details.(map[string]any); code != http.StatusBadRequest || details["field"] != "text" {
+		t.Fatalf("expected 400 for text, got %d %+v", code, apiErr)
+	}
+	if n := countStored(t, alice, bob, false); n != 0 {
+		t.Fatalf("invalid broadcast should not be stored, got %d", n)
+	}
+}
+
+func TestBroadcastIsRateLimited(t *testing.T) {
+	withUserRateLimit(t, 1, 1, 0)
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	body := `{"sender_id":"` + alice + `","receiver_ids":["` + bob + `"],"text":"hi"}`
+
+	if code, _, _ := postBroadcast(t, body); code != http.StatusOK {
+		t.Fatalf("expected first broadcast to pass, got %d", code)
+	}
+	if code, _, apiErr := postBroadcast(t, body); code != http.StatusTooManyRequests || apiErr.Code != errCodeRateLimited {
+		t.Fatalf("expected 429, got %d %+v", code, apiErr)
+	}
+}
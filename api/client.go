@@ -0,0 +1,322 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/google/uuid"
+	"go-socket/hub"
+	"go-socket/protocol"
+)
+
+// ประเภท frame ที่ server ส่งให้ client (ใช้กับ ?subscribe=)
+const (
+	frameTypeChat            = protocol.FrameChat
+	frameTypeReaction        = protocol.FrameReaction
+	frameTypeReadReceipt     = protocol.FrameReadReceipt
+	frameTypeDeliveryReceipt = protocol.FrameDeliveryReceipt
+	frameTypeError           = protocol.FrameError
+	frameTypePongApp         = protocol.FramePongApp
+	frameTypeIdleWarning     = protocol.FrameIdleWarning
+	frameTypeAck             = protocol.FrameAck
+	frameTypeTyping          = protocol.FrameTyping
+	frameTypeSynced          = protocol.FrameSynced
+	frameTypeAnnouncement    = protocol.FrameAnnouncement
+
+	frameTypePresenceSnapshot = protocol.FramePresenceSnapshot
+	frameTypePresence         = protocol.FramePresence
+	frameTypeWelcome          = protocol.FrameWelcome
+	frameTypeMessageDeleted   = protocol.FrameMessageDeleted
+)
+
+// frame แจ้งข้อผิดพลาดให้ client ที่ส่งข้อความมา
+type ErrorFrame = protocol.ErrorFrame
+
+// ข้อมูลของ connection ที่เก็บไว้ใน clients
+type client struct {
+	conn            *websocket.Conn // nil เมื่อเชื่อมต่อผ่าน SSE
+	sse             *sseStream      // ไม่ใช่ nil = client รับอย่างเดียวผ่าน /sse/chat/:id (ดู sse.go)
+	tenant          string
+	userID          string
+	sessionID       string // ID ของ session (แท็บ/อุปกรณ์) ที่เชื่อมต่อเข้ามา
+	connID          string // ID ของ connection นี้ (session เดียวกันที่ reconnect ได้ ID ใหม่) ใช้โยง log
+	log             *slog.Logger
+	connectedAt     time.Time
+	subscriptions   map[string]bool // nil = รับทุกประเภท
+	codec           Codec           // รูปแบบ frame ที่ client เลือก (default JSON)
+	protocolVersion int             // เวอร์ชัน protocol ที่ตกลงกันตอน upgrade
+	lastPingApp     time.Time       // ใช้เฉพาะใน read loop ของ connection นี้
+
+	// เวลาที่ได้รับ frame ล่าสุด (UnixNano) และเตือนเรื่อง idle ไปแล้วหรือยัง อ่านจาก idle sweeper
+	lastActivity atomic.Int64
+	idleWarned   atomic.Bool
+
+	// จำนวน ping ที่ส่งไปแล้วยังไม่ได้ pong กลับ อ่าน/เขียนจาก heartbeat reaper และ pong handler
+	missedPongs atomic.Int32
+
+	// frame ขาออกทั้งหมดผ่านคิวนี้ และมี writeLoop เป็น goroutine เดียวที่เขียน socket
+	out        chan outboundFrame
+	stop       chan struct{} // ถูกปิดเมื่อ markClosed ให้ writeLoop เลิกเขียน
+	writerDone chan struct{} // ถูกปิดเมื่อ writeLoop จบแล้ว
+
+	// ห้ามเขียนหลัง handler คืน conn ให้ library แล้ว
+	mu     sync.Mutex
+	closed bool
+	reason string // เหตุผลที่ server ปิด connection นี้เอง (ว่าง = client ปิด/หลุดเอง)
+}
+
+// frame ที่รอ writeLoop เขียน ผลการเขียนส่งกลับทาง result (buffer 1 ช่อง writeLoop ไม่ต้องรอผู้ส่ง)
+type outboundFrame struct {
+	messageType int
+	data        []byte
+	result      chan error
+}
+
+// จำนวน frame ที่รอเขียนได้ต่อ connection และเวลาสูงสุดที่การเขียนหนึ่งครั้งจะค้างได้
+// (client ที่อ่านช้าจนคิวเต็มจะส่งไม่สำเร็จ ข้อความแชทยังค้างอยู่ใน DB)
+const (
+	sendQueueSize = 256
+	writeWait     = 10 * time.Second
+)
+
+var (
+	// connection ถูกปิดแล้ว ข้อความที่ส่งไม่ถึงยังอยู่ใน DB รอส่งตอนเชื่อมต่อใหม่
+	errClientClosed = errors.New("connection closed")
+	// คิวขาออกของ connection เต็ม (client อ่านไม่ทัน)
+	errSendQueueFull = errors.New("send queue full")
+)
+
+// สร้าง client จากค่า ?subscribe=chat,read_receipt
+// ถ้า client ไม่ส่ง session ID มา จะสร้างให้ใหม่
+func newClient(conn *websocket.Conn, tenant, userID, sessionID, subscribe string) *client {
+	if sessionID == "" {
+		sessionID = uuid.NewString()
+	}
+	cl := &client{conn: conn, tenant: tenant, userID: userID, sessionID: sessionID, connectedAt: time.Now(), codec: jsonCodec{}, protocolVersion: protocolV1,
+		out: make(chan outboundFrame, sendQueueSize), stop: make(chan struct{}), writerDone: make(chan struct{})}
+	cl.connID = newCorrelationID()
+	cl.log = slog.With("conn_id", cl.connID, "tenant", tenant, "user_id", userID, "session_id", sessionID)
+	cl.touch(cl.connectedAt)
+	for _, t := range strings.Split(subscribe, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		if cl.subscriptions == nil {
+			cl.subscriptions = make(map[string]bool)
+		}
+		cl.subscriptions[t] = true
+	}
+	go cl.writeLoop()
+	return cl
+}
+
+// goroutine เดียวที่เขียน frame ลง socket ตามลำดับที่เข้าคิว จนกว่า connection จะถูก markClosed
+func (cl *client) writeLoop() {
+	defer close(cl.writerDone)
+	for {
+		select {
+		case <-cl.stop:
+			return
+		case f := <-cl.out:
+			var err error
+			if cl.sse != nil {
+				err = cl.sse.write("", f.data)
+			} else {
+				cl.conn.SetWriteDeadline(time.Now().Add(writeWait))
+				err = writeFrame(cl.conn, f.messageType, f.data)
+			}
+			if err != nil {
+				websocketErrorsTotal.WithLabelValues(wsErrorWrite).Inc()
+			}
+			f.result <- err
+		}
+	}
+}
+
+// เข้ารหัส payload ด้วย codec ของ connection (v3 ห่อด้วย envelope ก่อน) แล้วส่งผ่าน writeLoop รอจนเขียนเสร็จ
+// คืนค่า error ถ้าเขียนไม่สำเร็จ คิวเต็ม หรือ connection ปิดไปก่อนได้เขียน
+func (cl *client) send(payload any) error {
+	if cl.protocolVersion >= protocolV3 {
+		payload = wrapEnvelope(payload)
+	}
+	data, err := cl.codec.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshalling %s frame: %w", cl.codec.Name(), err)
+	}
+
+	f := outboundFrame{messageType: cl.codec.MessageType(), data: data, result: make(chan error, 1)}
+	select {
+	case <-cl.stop:
+		return errClientClosed
+	default:
+	}
+	select {
+	case cl.out <- f:
+	default:
+		websocketErrorsTotal.WithLabelValues(wsErrorQueueFull).Inc()
+		return errSendQueueFull
+	}
+
+	select {
+	case err := <-f.result:
+		return err
+	case <-cl.writerDone:
+		// writeLoop อาจเขียน frame นี้เสร็จพอดีก่อนจบ
+		select {
+		case err := <-f.result:
+			return err
+		default:
+			return errClientClosed
+		}
+	}
+}
+
+// ปิด connection พร้อม close frame และจำเหตุผลไว้สำหรับ audit log
+// (ไม่ทำอะไรถ้า handler คืน conn ไปแล้ว) close frame เป็น control frame เขียนแทรก writeLoop ได้
+func (cl *client) closeWith(code int, text string) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if cl.closed {
+		return
+	}
+	if cl.reason == "" {
+		cl.reason = text
+	}
+	if cl.sse != nil {
+		cl.sse.closeWith(code, text)
+		return
+	}
+	closeWithReason(cl.conn, code, text)
+}
+
+// เหตุผลที่ server ปิด connection นี้ (ว่าง = ไม่ได้ปิดเอง)
+func (cl *client) closeReason() string {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return cl.reason
+}
+
+// ห้ามเขียน socket อีก หยุด writeLoop และรอให้ frame ที่กำลังเขียนอยู่เขียนเสร็จก่อน
+// frame ที่ยังค้างในคิวได้ errClientClosed ต้องเรียกก่อน handleWebSocket คืนค่า (library จะล้าง conn หลังจากนั้น)
+func (cl *client) markClosed() {
+	cl.mu.Lock()
+	if !cl.closed {
+		cl.closed = true
+		close(cl.stop)
+	}
+	cl.mu.Unlock()
+	<-cl.writerDone
+}
+
+// ตรวจสอบว่า connection นี้ต้องการรับ frame ประเภทนี้หรือไม่
+func (cl *client) wants(frameType string) bool {
+	return cl.subscriptions == nil || cl.subscriptions[frameType]
+}
+
+// ข้อมูลที่ hub ใช้แยก connection (tenant -> ผู้ใช้ -> session)
+func (cl *client) Tenant() string         { return cl.tenant }
+func (cl *client) UserID() string         { return cl.userID }
+func (cl *client) SessionID() string      { return cl.sessionID }
+func (cl *client) ConnectedAt() time.Time { return cl.connectedAt }
+
+// connection ที่เปิดอยู่บน instance นี้
+var registry = hub.New[*client](registryHooks{})
+
+// ผูก registry กับ config, cluster และ presence
+type registryHooks struct{}
+
+func (registryHooks) SingleSession() bool { return config.SingleSession }
+
+func (registryHooks) UserOnline(tenant, userID string) {
+	clusterClaim(tenant, userID)
+	publishPresence(tenant, userID, presenceOnline)
+}
+
+func (registryHooks) UserOffline(tenant, userID string) {
+	clusterRelease(tenant, userID)
+	publishPresence(tenant, userID, presenceOffline)
+}
+
+// ลงทะเบียน connection ใหม่ คืนค่า connection เดิมที่ต้องปิด
+// (session เดิมที่ใช้ ID ซ้ำ หรือทุก session ถ้าเปิดโหมด single session)
+func registerClient(cl *client) []*client {
+	return registry.Register(cl)
+}
+
+// ยกเลิกการลงทะเบียน เฉพาะถ้า connection นี้ยังเป็นเจ้าของ session อยู่
+func unregisterClient(cl *client) {
+	registry.Unregister(cl)
+}
+
+// ดึง client (session ล่าสุด) ของผู้ใช้ที่ออนไลน์อยู่
+func getClient(tenant, userID string) (*client, bool) {
+	return registry.Latest(tenant, userID)
+}
+
+// ดึงทุก session ของผู้ใช้ที่ออนไลน์อยู่
+func getSessions(tenant, userID string) []*client {
+	return registry.Sessions(tenant, userID)
+}
+
+// ส่ง payload ให้ทุก session ของผู้ใช้ที่ subscribe frame ประเภทนี้ คืนค่า true ถ้าส่งถึงอย่างน้อยหนึ่ง session
+// session ของผู้ใช้บน instance อื่นได้รับผ่านการส่งต่อ (ถ้าเปิด cluster)
+func sendToUser(tenant, userID, frameType string, payload any) bool {
+	sent := sendToUserRemote(tenant, userID, frameType, payload)
+	for _, cl := range getSessions(tenant, userID) {
+		if !cl.wants(frameType) {
+			continue
+		}
+		if err := cl.send(payload); err != nil {
+			cl.logger().Warn("sending frame", "frame_type", frameType, "err", err)
+			continue
+		}
+		sent = true
+	}
+	return sent
+}
+
+// ส่งข้อความแชทให้ทุก session (อุปกรณ์) ของผู้รับที่ subscribe ข้อความแชท
+// คืนค่า false ถ้าไม่มี session ไหนได้รับ (ผู้เรียกต้องเก็บข้อความลง DB เอง)
+// ข้อความถึงตัวเอง (saved messages) ก็ใช้ทางนี้ ทุก session ได้ session ละครั้งรวมถึงเครื่องที่ส่ง
+func deliverOnline(msg Message) bool {
+	delivered := 0
+	for _, cl := range getSessions(msg.TenantID, msg.ReceiverID) {
+		// connection ที่ไม่ได้ subscribe ข้อความแชท ถือว่าออฟไลน์สำหรับข้อความนี้
+		if !cl.wants(frameTypeChat) {
+			continue
+		}
+		if err := cl.send(cl.chatFrame(msg)); err != nil {
+			messageLogger(msg).Warn("sending message", "conn_id", cl.connID, "err", err)
+			// ถ้าเกิดข้อผิดพลาดในการส่ง, ลบการเชื่อมต่อที่ค้างอยู่ (session อื่นยังอยู่)
+			// และปิด socket ด้วย ให้ client reconnect แล้วได้ข้อความที่ค้างใน DB ไม่ใช่ค้างอยู่แบบไม่ได้รับอะไร
+			unregisterClient(cl)
+			cl.closeWith(closeSlowConsumer, err.Error())
+			continue
+		}
+		delivered++
+	}
+	if delivered == 0 {
+		// ไม่มี WebSocket แต่อาจมี long-poll รออยู่
+		return offerToPoller(msg)
+	}
+
+	// Log ส่งข้อความให้ผู้รับออนไลน์
+	messageLogger(msg).Debug("message delivered", "devices", delivered)
+	return true
+}
+
+// เขียน frame ลง socket โดยบีบอัดเฉพาะข้อความที่ใหญ่กว่า threshold
+// (ถ้า client ไม่ได้ตกลงใช้ permessage-deflate ตอน handshake จะไม่มีผลอะไร)
+func writeFrame(conn *websocket.Conn, messageType int, payload []byte) error {
+	if config.EnableCompression {
+		conn.EnableWriteCompression(len(payload) >= config.CompressionThreshold)
+	}
+	return conn.WriteMessage(messageType, payload)
+}
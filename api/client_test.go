@@ -0,0 +1,99 @@
+package api
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	fws "github.com/fasthttp/websocket"
+)
+
+func TestConcurrentSendsAreWrittenByOneWriter(t *testing.T) {
+	alice := newTestUser("alice")
+	conn := dialWS(t, alice)
+	cl, _ := getClient(DefaultTenant, alice)
+
+	const senders, perSender = 20, 25
+	var wg sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perSender; j++ {
+				if err := cl.send(PongApp{Type: frameTypePongApp, ClientTS: int64(j)}); err != nil {
+					t.Errorf("send: %v", err)
+					return
+				}
+			}
+		}()
+	}
+
+	// ทุก frame ต้องอ่านออกครบและไม่ปนกัน
+	for n := 0; n < senders*perSender; n++ {
+		var pong PongApp
+		readJSON(t, conn, &pong)
+		if pong.Type != frameTypePongApp {
+			t.Fatalf("unexpected frame: %+v", pong)
+		}
+	}
+	wg.Wait()
+}
+
+func TestSendAfterCloseFails(t *testing.T) {
+	alice := newTestUser("alice")
+	conn := dialWS(t, alice)
+	cl, _ := getClient(DefaultTenant, alice)
+
+	conn.Close()
+	waitFor(t, func() bool {
+		select {
+		case <-cl.writerDone:
+			return true
+		default:
+			return false
+		}
+	})
+	if err := cl.send(PongApp{Type: frameTypePongApp}); err != errClientClosed {
+		t.Fatalf("expected errClientClosed, got %v", err)
+	}
+}
+
+func TestFullSendQueueClosesSlowConsumer(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	conn := dialWS(t, bob)
+	waitFor(t, func() bool { _, ok := getClient(DefaultTenant, bob); return ok })
+
+	// bob ไม่อ่านเลย: writer ค้างเมื่อ buffer ของ TCP เต็ม ที่เหลือรอในคิวจนเต็ม
+	text := strings.Repeat("x", 32*1024)
+	var wg sync.WaitGroup
+	for i := 0; i < 2*sendQueueSize; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			deliverOnline(Message{TenantID: DefaultTenant, SenderID: alice, ReceiverID: bob, Text: text})
+		}()
+	}
+
+	// ถูกถอนออกจาก hub และ socket ถูกปิด ไม่ใช่ค้างอยู่โดยไม่ได้รับอะไร
+	waitFor(t, func() bool { _, ok := getClient(DefaultTenant, bob); return !ok })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		var closeErr *fws.CloseError
+		if errors.As(err, &closeErr) && closeErr.Code != closeSlowConsumer && closeErr.Code != fws.CloseAbnormalClosure {
+			t.Fatalf("unexpected close code %d", closeErr.Code)
+		}
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			t.Fatal("slow consumer connection was not closed")
+		}
+		break
+	}
+	wg.Wait()
+}
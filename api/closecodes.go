@@ -0,0 +1,45 @@
+package api
+
+import (
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"go-socket/protocol"
+)
+
+// close code ที่ server ใช้ตอนปิด WebSocket เอง client ใช้ตัดสินใจว่าควร reconnect หรือไม่
+//
+//	1001 going away           server กำลังปิด (deploy/restart) — reconnect แบบ backoff ไป instance อื่น
+//	1007 invalid payload      ส่ง frame ที่ decode ไม่ได้ติดกันเกิน MaxMalformedFrames — แก้ client ก่อน reconnect
+//	1009 message too big      frame ใหญ่เกิน MaxMessageBytes — อย่าส่งข้อความเดิมซ้ำ
+//	1013 try again later      server รับ connection เต็มแล้ว — reconnect แบบ backoff
+//	4000 session replaced     มี connection ใหม่ใช้ session เดียวกัน (หรือโหมด single session) — อย่า reconnect อัตโนมัติ
+//	4001 idle timeout         ไม่มี frame เข้ามาเกิน IdleTimeout (มี idle_warning ก่อน) — reconnect เมื่อผู้ใช้กลับมาใช้งาน
+//	4002 heartbeat timeout    ไม่ตอบ pong ติดกันครบ HeartbeatMaxMissed รอบ — ถือว่าเครือข่ายหลุด reconnect ได้ทันที
+//	4003 kicked               ผู้ดูแลระบบตัดการเชื่อมต่อ (POST /admin/users/:id/disconnect) — อย่า reconnect อัตโนมัติ
+//	4004 handshake timeout    เชื่อมต่อ /ws/chat แล้วไม่ส่ง hello ภายใน HelloTimeout — reconnect แล้วส่ง hello ทันที
+//	4005 handshake failed     hello ผิดรูปแบบหรือ token ไม่ถูกต้อง — ขอ token ใหม่ก่อน reconnect
+//	4006 slow consumer        คิวขาออกเต็มหรือเขียน frame ไม่สำเร็จ (client อ่านไม่ทัน) — reconnect ได้ทันที ข้อความที่ค้างจะถูก replay
+//	4008 too many sessions    เปิด connection เกิน MaxConnectionsPerUser — ปิด tab อื่นก่อน
+//	4029 rate limited         ส่ง frame เกิน rate limit ครบ RateLimitMaxViolations ครั้ง — reconnect แบบ backoff และส่งให้ช้าลง
+//
+// การยืนยันตัวตน (token/origin) ไม่ผ่านจะถูกปฏิเสธตั้งแต่ handshake ด้วย HTTP 401/403
+// จึงไม่มี close frame ให้ (browser จะเห็นเป็น 1006) client ควรขอ token ใหม่ก่อน reconnect
+const (
+	closeMalformedFrames  = protocol.CloseMalformedFrames
+	closeSessionReplaced  = protocol.CloseSessionReplaced
+	closeIdleTimeout      = protocol.CloseIdleTimeout
+	closeHeartbeatTimeout = protocol.CloseHeartbeatTimeout
+	closeKicked           = protocol.CloseKicked
+	closeHandshakeTimeout = protocol.CloseHandshakeTimeout
+	closeHandshakeFailed  = protocol.CloseHandshakeFailed
+	closeSlowConsumer     = protocol.CloseSlowConsumer
+	closeTooManySessions  = protocol.CloseTooManySessions
+	closeRateLimited      = protocol.CloseRateLimited
+)
+
+// ส่ง close frame พร้อมเหตุผล แล้วปิด connection
+func closeWithReason(conn *websocket.Conn, code int, text string) {
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(time.Second))
+	conn.Close()
+}
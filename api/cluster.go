@@ -0,0 +1,464 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// อายุของการ claim ผู้ใช้ของแต่ละ instance ต่ออายุทุก clusterHeartbeat
+	// (instance ที่ตายไปโดยไม่ได้ Release จะหลุดออกจากรายชื่อเอง)
+	clusterConnTTL   = 60 * time.Second
+	clusterHeartbeat = 20 * time.Second
+	// เวลาสูงสุดของคำสั่ง Redis แต่ละครั้ง กันไม่ให้ worker ค้างตอน Redis ช้า
+	clusterOpTimeout = 2 * time.Second
+
+	envelopeMessage  = "message"  // ข้อความแชทที่บันทึกแล้ว ให้ instance ปลายทางส่งและ mark delivered
+	envelopeFrame    = "frame"    // frame อื่น (receipt, typing ฯลฯ) ส่งต่อตามที่ได้รับ
+	envelopePresence = "presence" // ผู้ใช้ออนไลน์/ออฟไลน์ ส่งถึงทุก instance ทาง presenceChannel
+	envelopeKick     = "kick"     // ผู้ดูแลสั่งตัดการเชื่อมต่อ Payload คือเหตุผล
+	envelopeAnnounce = "announce" // ประกาศจากผู้ดูแล ส่งถึงทุก instance ทาง announcementChannel
+
+	// channel ที่ทุก instance subscribe ไว้รับการเปลี่ยนสถานะของผู้ใช้
+	presenceChannel = "chat:presence"
+	// channel ที่ทุก instance subscribe ไว้รับประกาศจากผู้ดูแล
+	announcementChannel = "chat:announcements"
+)
+
+// สิ่งที่ส่งระหว่าง instance ทาง channel ของ instance ปลายทาง
+// (Message.TenantID ไม่ถูก serialize จึงส่ง tenant แยก)
+type clusterEnvelope struct {
+	Kind      string          `json:"kind"`
+	Tenant    string          `json:"tenant"`
+	UserID    string          `json:"user_id"`
+	FrameType string          `json:"frame_type,omitempty"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	Message   *Message        `json:"message,omitempty"`
+	Origin    string          `json:"origin,omitempty"`   // instance ที่ส่ง (ใช้ข้าม envelope ของตัวเอง)
+	TraceID   string          `json:"trace_id,omitempty"` // trace ID ของข้อความ ให้ log ของทั้งสอง instance ต่อกันได้
+	// ต้นทางส่งข้อความถึงอุปกรณ์ของผู้รับแล้ว ปลายทางส่งให้อุปกรณ์ของตัวเองอย่างเดียว
+	// (ไม่ mark delivered, ไม่แจ้ง feed และไม่ส่ง push ซ้ำ)
+	Mirror bool `json:"mirror,omitempty"`
+}
+
+// transport ระหว่าง instance: รู้ว่าผู้ใช้เชื่อมต่ออยู่กับ instance ไหนบ้าง (หลายอุปกรณ์อยู่คนละ instance ได้)
+// ส่ง envelope ไปที่ instance เหล่านั้น และกระจาย presence/ประกาศให้ทุก instance
+// มีสองแบบคือ Redis (redisBroker) และ NATS (natsBroker ใน nats.go)
+type Broker interface {
+	InstanceID() string
+	// บันทึก/ลบว่าผู้ใช้เชื่อมต่ออยู่กับ instance นี้
+	Claim(tenant, userID string)
+	Release(tenant, userID string)
+	// ส่ง envelope ให้ทุก instance อื่นที่ถือ connection ของ env.UserID คืนค่า false ถ้าไม่มี instance อื่นรับ
+	Forward(env clusterEnvelope) bool
+	// ส่ง envelope ถึงทุก instance ทาง presenceChannel หรือ announcementChannel
+	Publish(channel string, env clusterEnvelope)
+	// ผู้ใช้ในรายชื่อที่เชื่อมต่ออยู่กับ instance ใดก็ได้ (รวม instance นี้)
+	Online(tenant string, userIDs []string) []string
+	Close()
+}
+
+// ID ของ process นี้ ใช้ทั้งใน cluster และเป็นเจ้าของแถวใน outbox (ใหม่ทุกครั้งที่เปิด server)
+var localInstanceID = uuid.NewString()
+
+// broker ของ instance นี้ อ่านผ่าน currentCluster (เปลี่ยนตอน join/stop ระหว่างที่ connection ยังทำงานอยู่)
+var cluster atomic.Pointer[Broker]
+
+// nil = instance เดียว
+func currentCluster() Broker {
+	if b := cluster.Load(); b != nil {
+		return *b
+	}
+	return nil
+}
+
+func setCluster(b Broker) {
+	if b == nil {
+		cluster.Store(nil)
+		return
+	}
+	cluster.Store(&b)
+}
+
+// เข้าร่วม cluster ตาม config (ไม่ตั้งทั้ง CHAT_REDIS_URL และ CHAT_NATS_URL = instance เดียว)
+func joinCluster() error {
+	if config.NATSURL != "" {
+		return startNATSCluster(config.NATSURL)
+	}
+	return startCluster(config.RedisURL)
+}
+
+// การเชื่อมต่อ Redis ของ instance นี้
+type redisBroker struct {
+	rdb        *redis.Client
+	instanceID string
+	sub        *redis.PubSub
+	cancel     context.CancelFunc
+}
+
+// sorted set ของ instance ที่ถือ connection ของผู้ใช้ (score = เวลา claim ล่าสุดเป็นวินาที)
+// key ทั้งก้อนต่ออายุด้วยทุก Claim จึงใช้ score แยกอายุของแต่ละ instance แทน TTL ของ key
+func connKey(tenant, userID string) string {
+	return "chat:conn:" + tenant + ":" + userID
+}
+
+func instanceChannel(instanceID string) string {
+	return "chat:instance:" + instanceID
+}
+
+// เชื่อมต่อ Redis แล้วเริ่ม subscribe channel ของ instance นี้และต่ออายุ key ของผู้ใช้ที่เชื่อมต่ออยู่
+// ไม่ตั้ง redisURL = ไม่ทำอะไร
+func startCluster(redisURL string) error {
+	if redisURL == "" {
+		return nil
+	}
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return fmt.Errorf("parsing redis url: %w", err)
+	}
+	rdb := redis.NewClient(opts)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	node := &redisBroker{rdb: rdb, instanceID: localInstanceID, cancel: cancel}
+	channels := []string{instanceChannel(node.instanceID), presenceChannel, announcementChannel}
+	sub := rdb.Subscribe(ctx, channels...)
+	// รอให้ subscribe สำเร็จครบทุก channel ก่อน ไม่งั้นข้อความแรกๆ ที่ส่งมาอาจหาย
+	for range channels {
+		if _, err := sub.Receive(ctx); err != nil {
+			cancel()
+			rdb.Close()
+			return fmt.Errorf("subscribing to redis: %w", err)
+		}
+	}
+
+	node.sub = sub
+	setCluster(node)
+	go node.receive()
+	go node.heartbeat(ctx)
+	// ผู้ใช้ที่เชื่อมต่อไว้ก่อนเปิด cluster
+	claimAll(node)
+	slog.Info("joined cluster", "instance_id", node.instanceID, "redis", opts.Addr)
+	return nil
+}
+
+// ออกจาก cluster (ใช้ตอนปิด server และใน test)
+func stopCluster() {
+	node := currentCluster()
+	if node == nil {
+		return
+	}
+	setCluster(nil)
+	node.Close()
+}
+
+func clusterOpContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), clusterOpTimeout)
+}
+
+func (n *redisBroker) InstanceID() string {
+	return n.instanceID
+}
+
+// หยุด subscribe และปิดการเชื่อมต่อ Redis
+func (n *redisBroker) Close() {
+	n.cancel()
+	n.sub.Close()
+	n.rdb.Close()
+}
+
+// score ต่ำสุดของ instance ที่ยังถือว่ามีชีวิตอยู่
+func liveClaimsSince(now time.Time) string {
+	return strconv.FormatInt(now.Add(-clusterConnTTL).Unix(), 10)
+}
+
+// เพิ่ม instance นี้เข้าชุดของผู้ใช้ และลบ instance ที่ไม่ได้ต่ออายุเกิน clusterConnTTL ไปพร้อมกัน
+func (n *redisBroker) Claim(tenant, userID string) {
+	ctx, cancel := clusterOpContext()
+	defer cancel()
+	key, now := connKey(tenant, userID), time.Now()
+	_, err := n.rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.ZAdd(ctx, key, redis.Z{Score: float64(now.Unix()), Member: n.instanceID})
+		p.ZRemRangeByScore(ctx, key, "-inf", "("+liveClaimsSince(now))
+		p.Expire(ctx, key, clusterConnTTL)
+		return nil
+	})
+	if err != nil {
+		slog.Error("registering user in cluster", "tenant", tenant, "user_id", userID, "err", err)
+	}
+}
+
+// ลบเฉพาะ instance นี้ อุปกรณ์ของผู้ใช้บน instance อื่นยังอยู่
+func (n *redisBroker) Release(tenant, userID string) {
+	ctx, cancel := clusterOpContext()
+	defer cancel()
+	if err := n.rdb.ZRem(ctx, connKey(tenant, userID), n.instanceID).Err(); err != nil {
+		slog.Error("unregistering user from cluster", "tenant", tenant, "user_id", userID, "err", err)
+	}
+}
+
+// claim ผู้ใช้ทุกคนที่เชื่อมต่ออยู่กับ instance นี้ (ตอนเข้าร่วม cluster และต่ออายุ key)
+func claimAll(b Broker) {
+	registry.RangeUsers(func(tenant, userID string) bool {
+		b.Claim(tenant, userID)
+		return true
+	})
+}
+
+func (n *redisBroker) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(clusterHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			claimAll(n)
+		}
+	}
+}
+
+// publish ไปที่ channel ของทุก instance อื่นในชุดของผู้ใช้
+// instance ที่ไม่ได้ subscribe อยู่แล้ว (ตายไปก่อนหมดอายุ) ถูกลบออกจากชุดทันที
+func (n *redisBroker) Forward(env clusterEnvelope) bool {
+	ctx, cancel := clusterOpContext()
+	defer cancel()
+
+	key := connKey(env.Tenant, env.UserID)
+	owners, err := n.rdb.ZRangeByScore(ctx, key, &redis.ZRangeBy{Min: liveClaimsSince(time.Now()), Max: "+inf"}).Result()
+	if err != nil {
+		slog.Error("looking up user in cluster", "tenant", env.Tenant, "user_id", env.UserID, "trace_id", env.TraceID, "err", err)
+		return false
+	}
+
+	env.Origin = n.instanceID
+	var data []byte
+	forwarded := false
+	for _, owner := range owners {
+		if owner == n.instanceID {
+			continue
+		}
+		if data == nil {
+			if data, err = json.Marshal(env); err != nil {
+				slog.Error("marshalling cluster envelope", "trace_id", env.TraceID, "err", err)
+				return false
+			}
+		}
+		receivers, err := n.rdb.Publish(ctx, instanceChannel(owner), data).Result()
+		if err != nil {
+			slog.Error("publishing to instance", "instance_id", owner, "trace_id", env.TraceID, "err", err)
+			continue
+		}
+		if receivers == 0 {
+			n.rdb.ZRem(ctx, key, owner)
+			continue
+		}
+		clusterForwardedTotal.WithLabelValues(env.Kind).Inc()
+		forwarded = true
+	}
+	return forwarded
+}
+
+func (n *redisBroker) Publish(channel string, env clusterEnvelope) {
+	data, err := json.Marshal(env)
+	if err != nil {
+		slog.Error("marshalling cluster envelope", "kind", env.Kind, "err", err)
+		return
+	}
+	ctx, cancel := clusterOpContext()
+	defer cancel()
+	if err := n.rdb.Publish(ctx, channel, data).Err(); err != nil {
+		slog.Error("publishing to cluster", "channel", channel, "tenant", env.Tenant, "err", err)
+	}
+}
+
+func (n *redisBroker) Online(tenant string, userIDs []string) []string {
+	ctx, cancel := clusterOpContext()
+	defer cancel()
+	since := liveClaimsSince(time.Now())
+	counts := make([]*redis.IntCmd, len(userIDs))
+	_, err := n.rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for i, id := range userIDs {
+			counts[i] = p.ZCount(ctx, connKey(tenant, id), since, "+inf")
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Error("looking up presence in cluster", "tenant", tenant, "err", err)
+		return nil
+	}
+	var online []string
+	for i, count := range counts {
+		if count.Val() > 0 {
+			online = append(online, userIDs[i])
+		}
+	}
+	return online
+}
+
+// อ่าน envelope ที่ instance อื่นส่งมาจนกว่าจะปิด subscription
+func (n *redisBroker) receive() {
+	for m := range n.sub.Channel() {
+		receiveClusterEnvelope(n.instanceID, []byte(m.Payload))
+	}
+}
+
+// decode envelope จาก instance อื่น ข้าม envelope ที่ instance นี้ส่งเอง (ส่งให้ connection ของตัวเองไปแล้ว)
+func receiveClusterEnvelope(instanceID string, data []byte) {
+	var env clusterEnvelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		slog.Error("decoding cluster envelope", "err", err)
+		return
+	}
+	if env.Origin == instanceID {
+		return
+	}
+	handleClusterEnvelope(env)
+}
+
+// ส่ง envelope ที่ได้รับให้ผู้ใช้ที่เชื่อมต่ออยู่กับ instance นี้
+func handleClusterEnvelope(env clusterEnvelope) {
+	switch env.Kind {
+	case envelopeMessage:
+		if env.Message == nil {
+			return
+		}
+		msg := *env.Message
+		msg.TenantID = env.Tenant
+		msg.TraceID = env.TraceID
+		if env.Mirror {
+			deliverOnline(msg)
+			return
+		}
+		// ผู้รับหลุดไประหว่างทาง: ข้อความบันทึกไว้แล้ว จะถูกส่งตอนเชื่อมต่อใหม่
+		if !deliverOnline(msg) {
+			publishToFeed(msg, feedStatusStored)
+			notifyOffline(msg)
+			return
+		}
+		if msg.ID != 0 {
+			markDelivered([]int64{msg.ID})
+		}
+		publishToFeed(msg, feedStatusDelivered)
+	case envelopeFrame:
+		var payload map[string]any
+		if err := json.Unmarshal(env.Payload, &payload); err != nil {
+			slog.Error("decoding forwarded frame", "frame_type", env.FrameType, "err", err)
+			return
+		}
+		sendToUser(env.Tenant, env.UserID, env.FrameType, payload)
+	case envelopePresence:
+		var delta PresenceDelta
+		if err := json.Unmarshal(env.Payload, &delta); err != nil {
+			slog.Error("decoding presence from cluster", "err", err)
+			return
+		}
+		publishPresenceLocal(env.Tenant, delta)
+	case envelopeKick:
+		var reason string
+		json.Unmarshal(env.Payload, &reason)
+		disconnectUserLocal(env.Tenant, env.UserID, reason)
+	case envelopeAnnounce:
+		var a Announcement
+		if err := json.Unmarshal(env.Payload, &a); err != nil {
+			slog.Error("decoding announcement from cluster", "err", err)
+			return
+		}
+		announceLocal(env.Tenant, a)
+	}
+}
+
+// บันทึก/ลบ key ของผู้ใช้ตอนเชื่อมต่อครั้งแรกและตอน session สุดท้ายหลุด
+func clusterClaim(tenant, userID string) {
+	if node := currentCluster(); node != nil {
+		node.Claim(tenant, userID)
+	}
+}
+
+func clusterRelease(tenant, userID string) {
+	if node := currentCluster(); node != nil {
+		node.Release(tenant, userID)
+	}
+}
+
+// ส่งข้อความที่บันทึกแล้วให้ทุก instance อื่นที่ผู้รับเชื่อมต่ออยู่ instance ปลายทางจะ mark delivered เอง
+// deliveredLocally = instance นี้ส่งถึงอุปกรณ์ของผู้รับแล้ว ปลายทางจึงส่งให้อุปกรณ์อื่นอย่างเดียว
+func deliverRemote(msg Message, deliveredLocally bool) bool {
+	node := currentCluster()
+	if node == nil {
+		return false
+	}
+	if !node.Forward(clusterEnvelope{Kind: envelopeMessage, Tenant: msg.TenantID, UserID: msg.ReceiverID, Message: &msg, TraceID: msg.TraceID, Mirror: deliveredLocally}) {
+		return false
+	}
+	messageLogger(msg).Debug("message forwarded to another instance")
+	return true
+}
+
+// ส่ง frame ให้ผู้ใช้ที่เชื่อมต่ออยู่กับ instance อื่น
+func sendToUserRemote(tenant, userID, frameType string, payload any) bool {
+	node := currentCluster()
+	if node == nil {
+		return false
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("marshalling frame for cluster", "frame_type", frameType, "err", err)
+		return false
+	}
+	return node.Forward(clusterEnvelope{Kind: envelopeFrame, Tenant: tenant, UserID: userID, FrameType: frameType, Payload: data})
+}
+
+// แจ้งการเปลี่ยนสถานะให้ instance อื่น (instance นี้แจ้ง subscriber ของตัวเองไปแล้ว)
+func clusterPublishPresence(tenant string, delta PresenceDelta) {
+	node := currentCluster()
+	if node == nil {
+		return
+	}
+	payload, err := json.Marshal(delta)
+	if err != nil {
+		slog.Error("marshalling presence for cluster", "err", err)
+		return
+	}
+	node.Publish(presenceChannel, clusterEnvelope{Kind: envelopePresence, Tenant: tenant, UserID: delta.UserID, Payload: payload, Origin: node.InstanceID()})
+}
+
+// ผู้ใช้ในรายชื่อที่เชื่อมต่ออยู่กับ instance ใดก็ได้ใน cluster (ไม่มี cluster = nil)
+func clusterOnline(tenant string, userIDs []string) []string {
+	node := currentCluster()
+	if node == nil || len(userIDs) == 0 {
+		return nil
+	}
+	return node.Online(tenant, userIDs)
+}
+
+// ส่งคำสั่งตัดการเชื่อมต่อให้ทุก instance อื่นที่ผู้ใช้เชื่อมต่ออยู่ คืนค่า false ถ้าผู้ใช้ไม่ได้เชื่อมต่อกับ instance อื่น
+func clusterKick(tenant, userID, reason string) bool {
+	node := currentCluster()
+	if node == nil {
+		return false
+	}
+	payload, _ := json.Marshal(reason)
+	return node.Forward(clusterEnvelope{Kind: envelopeKick, Tenant: tenant, UserID: userID, Payload: payload})
+}
+
+// ส่งประกาศให้ instance อื่น (instance นี้ส่งให้ connection ของตัวเองไปแล้ว)
+func clusterAnnounce(tenant string, a Announcement) {
+	node := currentCluster()
+	if node == nil {
+		return
+	}
+	payload, err := json.Marshal(a)
+	if err != nil {
+		slog.Error("marshalling announcement for cluster", "err", err)
+		return
+	}
+	node.Publish(announcementChannel, clusterEnvelope{Kind: envelopeAnnounce, Tenant: tenant, Payload: payload, Origin: node.InstanceID()})
+}
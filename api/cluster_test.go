@@ -0,0 +1,240 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func withCluster(t *testing.T) *miniredis.Miniredis {
+	mr := miniredis.RunT(t)
+	if err := startCluster("redis://" + mr.Addr()); err != nil {
+		t.Fatalf("startCluster: %v", err)
+	}
+	t.Cleanup(stopCluster)
+	return mr
+}
+
+// บันทึกว่าผู้ใช้เชื่อมต่ออยู่กับ instance อื่น (เหมือนที่ instance นั้น Claim ไว้)
+func claimOnRemote(t *testing.T, mr *miniredis.Miniredis, userID, instanceID string) {
+	t.Helper()
+	if _, err := mr.ZAdd(connKey(DefaultTenant, userID), float64(time.Now().Unix()), instanceID); err != nil {
+		t.Fatalf("zadd: %v", err)
+	}
+}
+
+// subscribe channel ของ instance ปลายทางจำลอง
+func subscribeInstance(t *testing.T, mr *miniredis.Miniredis, instanceID string) *redis.PubSub {
+	t.Helper()
+	remote := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { remote.Close() })
+	sub := remote.Subscribe(context.Background(), instanceChannel(instanceID))
+	t.Cleanup(func() { sub.Close() })
+	if _, err := sub.Receive(context.Background()); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	return sub
+}
+
+func TestClusterForwardsToRemoteInstance(t *testing.T) {
+	mr := withCluster(t)
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+
+	// instance อื่นที่ bob เชื่อมต่ออยู่
+	sub := subscribeInstance(t, mr, "instance-b")
+	claimOnRemote(t, mr, bob, "instance-b")
+
+	aliceConn := dialWS(t, alice)
+	if err := aliceConn.WriteJSON(Message{SenderID: alice, ReceiverID: bob, Text: "across"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	var env clusterEnvelope
+	select {
+	case m := <-sub.Channel():
+		if err := json.Unmarshal([]byte(m.Payload), &env); err != nil {
+			t.Fatalf("decode envelope: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("message was not forwarded to the remote instance")
+	}
+	if env.Kind != envelopeMessage || env.Tenant != DefaultTenant || env.UserID != bob || env.Message == nil || env.Message.Text != "across" || env.Message.ID == 0 {
+		t.Fatalf("unexpected envelope: %+v", env)
+	}
+	if n := countStored(t, alice, bob, false); n != 1 {
+		t.Fatalf("expected forwarded message to be stored once, got %d", n)
+	}
+}
+
+func TestClusterDeliversForwardedMessage(t *testing.T) {
+	mr := withCluster(t)
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+
+	bobConn := dialWS(t, bob)
+	waitFor(t, func() bool {
+		owners, _ := mr.ZMembers(connKey(DefaultTenant, bob))
+		return slices.Equal(owners, []string{currentCluster().InstanceID()})
+	})
+
+	// instance อื่นบันทึกข้อความแล้วส่งต่อมาให้
+	msg := Message{TenantID: DefaultTenant, SenderID: alice, ReceiverID: bob, Text: "from afar"}
+	msg.ID = saveMessageToDB(msg)
+	data, _ := json.Marshal(clusterEnvelope{Kind: envelopeMessage, Tenant: DefaultTenant, UserID: bob, Message: &msg})
+	mr.Publish(instanceChannel(currentCluster().InstanceID()), string(data))
+
+	var got Message
+	readJSON(t, bobConn, &got)
+	if got.ID != msg.ID || got.Text != "from afar" {
+		t.Fatalf("unexpected message: %+v", got)
+	}
+	waitFor(t, func() bool {
+		var delivered bool
+		db.QueryRow("SELECT is_delivered FROM messages WHERE id = ?", msg.ID).Scan(&delivered)
+		return delivered
+	})
+
+	bobConn.Close()
+	waitFor(t, func() bool { return !mr.Exists(connKey(DefaultTenant, bob)) })
+}
+
+func TestClusterSharesPresenceChanges(t *testing.T) {
+	mr := withCluster(t)
+	alice, bob, carol := newTestUser("alice"), newTestUser("bob"), newTestUser("carol")
+
+	remote := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer remote.Close()
+	sub := remote.Subscribe(context.Background(), presenceChannel)
+	defer sub.Close()
+	if _, err := sub.Receive(context.Background()); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	// carol เชื่อมต่ออยู่กับ instance อื่น ต้องอยู่ใน snapshot ด้วย
+	claimOnRemote(t, mr, carol, "instance-b")
+	aliceConn := dialWS(t, alice)
+	aliceConn.WriteJSON(map[string]any{"type": "presence_subscribe", "users": []string{bob, carol}})
+	var snapshot PresenceSnapshot
+	readJSON(t, aliceConn, &snapshot)
+	if len(snapshot.Online) != 1 || snapshot.Online[0] != carol {
+		t.Fatalf("unexpected snapshot: %+v", snapshot)
+	}
+
+	// การเชื่อมต่อของ alice เองถูกประกาศให้ instance อื่นรู้ (ข้าม presence ของผู้ใช้จาก test อื่น)
+	deadline := time.After(2 * time.Second)
+	for published := false; !published; {
+		select {
+		case m := <-sub.Channel():
+			var env clusterEnvelope
+			json.Unmarshal([]byte(m.Payload), &env)
+			if env.UserID != alice {
+				continue
+			}
+			if env.Kind != envelopePresence || env.Origin != currentCluster().InstanceID() {
+				t.Fatalf("unexpected presence envelope: %+v", env)
+			}
+			published = true
+		case <-deadline:
+			t.Fatal("presence was not published to the cluster")
+		}
+	}
+
+	// bob ออนไลน์ที่ instance อื่น subscriber ของ instance นี้ต้องได้ delta
+	payload, _ := json.Marshal(PresenceDelta{Type: frameTypePresence, Event: "user_online", UserID: bob, Status: presenceOnline})
+	data, _ := json.Marshal(clusterEnvelope{Kind: envelopePresence, Tenant: DefaultTenant, UserID: bob, Payload: payload, Origin: "instance-b"})
+	mr.Publish(presenceChannel, string(data))
+
+	var delta PresenceDelta
+	readJSON(t, aliceConn, &delta)
+	if delta.UserID != bob || delta.Event != "user_online" {
+		t.Fatalf("unexpected delta: %+v", delta)
+	}
+}
+
+func TestClusterDeliversToDevicesOnEveryInstance(t *testing.T) {
+	mr := withCluster(t)
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+
+	// bob มีอุปกรณ์หนึ่งบน instance นี้ และอีกเครื่องบน instance-b
+	bobConn := dialWS(t, bob)
+	waitFor(t, func() bool { return mr.Exists(connKey(DefaultTenant, bob)) })
+	sub := subscribeInstance(t, mr, "instance-b")
+	claimOnRemote(t, mr, bob, "instance-b")
+	// instance-c ตายไปโดยไม่ได้ Release: ไม่มีใคร subscribe channel ของมัน
+	claimOnRemote(t, mr, bob, "instance-c")
+
+	aliceConn := dialWS(t, alice)
+	if err := aliceConn.WriteJSON(Message{SenderID: alice, ReceiverID: bob, Text: "everywhere"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var got Message
+	readJSON(t, bobConn, &got)
+	if got.Text != "everywhere" {
+		t.Fatalf("unexpected local message: %+v", got)
+	}
+
+	var env clusterEnvelope
+	select {
+	case m := <-sub.Channel():
+		json.Unmarshal([]byte(m.Payload), &env)
+	case <-time.After(2 * time.Second):
+		t.Fatal("message was not forwarded to the device on the other instance")
+	}
+	if env.Kind != envelopeMessage || env.Message == nil || env.Message.ID != got.ID || !env.Mirror {
+		t.Fatalf("unexpected envelope: %+v", env)
+	}
+	waitFor(t, func() bool {
+		owners, _ := mr.ZMembers(connKey(DefaultTenant, bob))
+		return !slices.Contains(owners, "instance-c")
+	})
+
+	// อุปกรณ์บน instance นี้หลุด อุปกรณ์บน instance-b ยังออนไลน์อยู่
+	bobConn.Close()
+	waitFor(t, func() bool {
+		owners, _ := mr.ZMembers(connKey(DefaultTenant, bob))
+		return slices.Equal(owners, []string{"instance-b"})
+	})
+	if online := clusterOnline(DefaultTenant, []string{bob}); len(online) != 1 {
+		t.Fatalf("bob should still be online on instance-b, got %v", online)
+	}
+}
+
+func TestClusterMirrorOnlyDeliversLocally(t *testing.T) {
+	withCluster(t)
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+
+	bobConn := dialWS(t, bob)
+	// รอให้ส่งข้อความค้างตอนเชื่อมต่อเสร็จก่อน (ไม่งั้นข้อความที่บันทึกด้านล่างอาจถูกส่งซ้ำทางนั้น)
+	bobConn.WriteJSON(map[string]any{"type": "ping_app"})
+	var pong PongApp
+	readJSON(t, bobConn, &pong)
+
+	msg := Message{TenantID: DefaultTenant, SenderID: alice, ReceiverID: bob, Text: "copy"}
+	msg.ID = saveMessageToDB(msg)
+	data, _ := json.Marshal(clusterEnvelope{Kind: envelopeMessage, Tenant: DefaultTenant, UserID: bob, Message: &msg, Origin: "instance-b", Mirror: true})
+	receiveClusterEnvelope(currentCluster().InstanceID(), data)
+
+	var got Message
+	readJSON(t, bobConn, &got)
+	if got.ID != msg.ID {
+		t.Fatalf("unexpected message: %+v", got)
+	}
+	// ต้นทาง mark delivered เอง ปลายทางไม่แตะสถานะ
+	var delivered bool
+	db.QueryRow("SELECT is_delivered FROM messages WHERE id = ?", msg.ID).Scan(&delivered)
+	if delivered {
+		t.Fatal("mirror copy must not mark the message delivered")
+	}
+
+	// envelope ที่ instance นี้ส่งเองถูกข้าม
+	data, _ = json.Marshal(clusterEnvelope{Kind: envelopeMessage, Tenant: DefaultTenant, UserID: bob, Message: &msg, Origin: currentCluster().InstanceID()})
+	receiveClusterEnvelope(currentCluster().InstanceID(), data)
+	bobConn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, data, err := bobConn.ReadMessage(); err == nil {
+		t.Fatalf("own envelope should be ignored, got %s", data)
+	}
+}
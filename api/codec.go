@@ -0,0 +1,66 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// รูปแบบการเข้ารหัส frame บน WebSocket (เลือกต่อ connection)
+type Codec interface {
+	Name() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+	// ประเภท frame ที่ใช้ส่ง (text สำหรับ JSON, binary สำหรับ format แบบ binary)
+	MessageType() int
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                       { return "json" }
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+func (jsonCodec) MessageType() int                   { return websocket.TextMessage }
+
+// MessagePack ใช้ชื่อ field ตาม tag `json` เพื่อให้ client ทั้งสองแบบเห็นโครงสร้างเดียวกัน
+// (metadata เป็น JSON อยู่แล้ว จึงส่งเป็น bytes ของ JSON)
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string { return "msgpack" }
+
+func (msgpackCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+func (msgpackCodec) MessageType() int { return websocket.BinaryMessage }
+
+// codec ที่รองรับ (ชื่อใช้กับ ?codec= และ Sec-WebSocket-Protocol)
+var codecs = map[string]Codec{
+	"json":    jsonCodec{},
+	"msgpack": msgpackCodec{},
+}
+
+// เลือก codec จาก ?codec= ก่อน แล้วจึงดู subprotocol ที่ตกลงกันไว้ ไม่ระบุหรือไม่รู้จัก = JSON
+func negotiateCodec(query, subprotocol string) Codec {
+	if c, ok := codecs[query]; ok {
+		return c
+	}
+	if c, ok := codecs[subprotocol]; ok {
+		return c
+	}
+	return jsonCodec{}
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	fws "github.com/fasthttp/websocket"
+)
+
+func TestCodecsRoundTripMessage(t *testing.T) {
+	want := Message{
+		ID:          42,
+		SenderID:    "alice",
+		ReceiverID:  "bob",
+		Text:        "สวัสดี",
+		ClientMsgID: "c-42",
+		Mentions:    []string{"bob"},
+		Mentioned:   true,
+		Reactions:   map[string]int{"👍": 2},
+		Metadata:    json.RawMessage(`{"lat":13.75}`),
+		ReplyToID:   7,
+		ReplyTo:     &ReplyPreview{ID: 7, SenderID: "bob", Snippet: "hi"},
+	}
+
+	for name, codec := range codecs {
+		data, err := codec.Marshal(want)
+		if err != nil {
+			t.Fatalf("%s marshal: %v", name, err)
+		}
+		var got Message
+		if err := codec.Unmarshal(data, &got); err != nil {
+			t.Fatalf("%s unmarshal: %v", name, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s round trip mismatch:\n got  %+v\n want %+v", name, got, want)
+		}
+	}
+}
+
+func TestMessagePackClientReceivesBinaryFrames(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	aliceConn := dialWS(t, alice)
+
+	bobConn, _, err := fws.DefaultDialer.Dial("ws://"+testAddr+"/ws/chat/"+bob+"?codec=msgpack", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer bobConn.Close()
+	waitFor(t, func() bool { _, ok := getClient(DefaultTenant, bob); return ok })
+
+	if err := aliceConn.WriteJSON(Message{SenderID: alice, ReceiverID: bob, Text: "packed"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	bobConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	kind, data, err := bobConn.ReadMessage()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if kind != fws.BinaryMessage {
+		t.Fatalf("expected binary frame, got type %d", kind)
+	}
+	var got Message
+	if err := (msgpackCodec{}).Unmarshal(data, &got); err != nil {
+		t.Fatalf("decode msgpack: %v", err)
+	}
+	if got.Text != "packed" || got.SenderID != alice {
+		t.Fatalf("unexpected message: %+v", got)
+	}
+}
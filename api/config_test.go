@@ -0,0 +1,77 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// เขียนไฟล์ config ชั่วคราวแล้วชี้ CHAT_CONFIG_FILE ไปที่ไฟล์นั้น
+func writeConfigFile(t *testing.T, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "chat.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	t.Setenv("CHAT_CONFIG_FILE", path)
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	t.Setenv("CHAT_CONFIG_FILE", "")
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.ListenAddr != ":3000" || cfg.Workers != 50 || cfg.BroadcastQueueSize != 5000 || cfg.DBMaxOpenConns != 50 {
+		t.Fatalf("unexpected defaults: %+v", cfg)
+	}
+}
+
+func TestLoadConfigFileWithEnvOverride(t *testing.T) {
+	writeConfigFile(t, `
+listen_addr: ":8080"
+workers: 8
+allowed_origins:
+  - https://a.example
+  - https://b.example
+db_conn_max_lifetime: 1m
+`)
+	t.Setenv("CHAT_WORKERS", "16")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.ListenAddr != ":8080" {
+		t.Errorf("listen addr from file: got %q", cfg.ListenAddr)
+	}
+	if cfg.Workers != 16 {
+		t.Errorf("env should override file: got %d workers", cfg.Workers)
+	}
+	if len(cfg.AllowedOrigins) != 2 || cfg.AllowedOrigins[1] != "https://b.example" {
+		t.Errorf("allowed origins from list: got %v", cfg.AllowedOrigins)
+	}
+	if cfg.DBConnMaxLifetime != time.Minute {
+		t.Errorf("duration from file: got %s", cfg.DBConnMaxLifetime)
+	}
+}
+
+func TestLoadConfigReportsInvalidValues(t *testing.T) {
+	writeConfigFile(t, "worker: 8\n")
+	t.Setenv("CHAT_MAX_CONNECTIONS", "lots")
+	t.Setenv("CHAT_LOG_FORMAT", "xml")
+	t.Setenv("CHAT_BROADCAST_QUEUE_SIZE", "100")
+	t.Setenv("CHAT_ALLOWED_ORIGINS", "https://ok.example,https://bad.example/")
+
+	_, err := LoadConfig()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, want := range []string{"CHAT_MAX_CONNECTIONS", "CHAT_LOG_FORMAT", `unknown key "worker"`, "CHAT_BROADCAST_HIGH_WATER", `invalid origin "https://bad.example/"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error should mention %s: %v", want, err)
+		}
+	}
+}
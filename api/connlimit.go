@@ -0,0 +1,46 @@
+package api
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/gofiber/contrib/websocket"
+)
+
+var (
+	activeConnections atomic.Int64 // จำนวน connection ทั้งหมดที่เปิดอยู่
+
+	userConnMu      sync.Mutex
+	userConnections = make(map[string]int) // tenantKey -> จำนวน connection ที่เปิดอยู่
+)
+
+// จองสิทธิ์เปิด connection ใหม่ ถ้าเกิน limit จะคืนค่า close code และเหตุผล
+func acquireConnection(tenant, userID string) (int, string, bool) {
+	if n := activeConnections.Add(1); config.MaxConnections > 0 && n > int64(config.MaxConnections) {
+		activeConnections.Add(-1)
+		return websocket.CloseTryAgainLater, "server connection limit reached", false
+	}
+
+	userConnMu.Lock()
+	defer userConnMu.Unlock()
+	key := tenantKey(tenant, userID)
+	// โหมด single session ไม่ต้องตรวจต่อผู้ใช้ เพราะ connection ใหม่จะปิด connection เดิมเสมอ
+	if !config.SingleSession && config.MaxConnectionsPerUser > 0 && userConnections[key] >= config.MaxConnectionsPerUser {
+		activeConnections.Add(-1)
+		return closeTooManySessions, "per-user connection limit reached", false
+	}
+	userConnections[key]++
+	return 0, "", true
+}
+
+// คืนสิทธิ์เมื่อ connection ปิด
+func releaseConnection(tenant, userID string) {
+	activeConnections.Add(-1)
+
+	userConnMu.Lock()
+	defer userConnMu.Unlock()
+	key := tenantKey(tenant, userID)
+	if userConnections[key]--; userConnections[key] <= 0 {
+		delete(userConnections, key)
+	}
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"testing"
+
+	fws "github.com/fasthttp/websocket"
+)
+
+// เปิด connection ของผู้ใช้ด้วย session ที่กำหนด (ไม่รอให้ server ลงทะเบียน)
+func dialSession(t *testing.T, userID, session string) *fws.Conn {
+	t.Helper()
+	conn, _, err := fws.DefaultDialer.Dial("ws://"+testAddr+"/ws/chat/"+userID+"?session="+session, nil)
+	if err != nil {
+		t.Fatalf("dial %s/%s: %v", userID, session, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func userConnectionCount(userID string) int {
+	userConnMu.Lock()
+	defer userConnMu.Unlock()
+	return userConnections[tenantKey(DefaultTenant, userID)]
+}
+
+func TestPerUserConnectionCap(t *testing.T) {
+	config.MaxConnectionsPerUser = 2
+	defer func() { config.MaxConnectionsPerUser = defaultConfig().MaxConnectionsPerUser }()
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+
+	phone := dialSession(t, alice, "phone")
+	dialSession(t, alice, "laptop")
+	waitFor(t, func() bool { return len(getSessions(DefaultTenant, alice)) == 2 })
+
+	// connection ที่ 3 ถูกปิดด้วย close code ของ per-user limit และไม่ถูกลงทะเบียน
+	tablet := dialSession(t, alice, "tablet")
+	if code := readCloseCode(t, tablet); code != closeTooManySessions {
+		t.Fatalf("expected close %d, got %d", closeTooManySessions, code)
+	}
+	if n := len(getSessions(DefaultTenant, alice)); n != 2 {
+		t.Fatalf("rejected connection was registered: %d sessions", n)
+	}
+	if n := userConnectionCount(alice); n != 2 {
+		t.Fatalf("rejected connection was counted: %d", n)
+	}
+
+	// limit เป็นต่อผู้ใช้ ผู้ใช้อื่นยังเชื่อมต่อได้
+	dialWS(t, bob)
+
+	// ปิด connection หนึ่งแล้วเปิดใหม่ได้
+	phone.Close()
+	waitFor(t, func() bool { return userConnectionCount(alice) == 1 })
+	dialSession(t, alice, "tablet")
+	waitFor(t, func() bool { return len(getSessions(DefaultTenant, alice)) == 2 })
+}
+
+func TestTotalConnectionCap(t *testing.T) {
+	// จำลอง server ที่มี connection เต็ม limit แล้ว
+	const full = 1 << 20
+	config.MaxConnections = full
+	activeConnections.Add(full)
+	defer func() {
+		activeConnections.Add(-full)
+		config.MaxConnections = defaultConfig().MaxConnections
+	}()
+	alice := newTestUser("alice")
+
+	conn := dialSession(t, alice, "phone")
+	if code := readCloseCode(t, conn); code != fws.CloseTryAgainLater {
+		t.Fatalf("expected close %d, got %d", fws.CloseTryAgainLater, code)
+	}
+	if _, ok := getClient(DefaultTenant, alice); ok {
+		t.Fatal("rejected connection was registered")
+	}
+	if n := userConnectionCount(alice); n != 0 {
+		t.Fatalf("rejected connection was counted for the user: %d", n)
+	}
+
+	// ขยาย limit แล้วเชื่อมต่อได้ตามปกติ
+	config.MaxConnections = 2 * full
+	dialWS(t, alice)
+}
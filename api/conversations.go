@@ -0,0 +1,92 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ข้อความล่าสุดของบทสนทนา
+type LastMessage struct {
+	ID        int64     `json:"id"`
+	SenderID  string    `json:"sender_id"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// จำนวนบทสนทนาต่อหน้าของ GET /conversations
+const (
+	defaultConversationsLimit = 50
+	maxConversationsLimit     = 200
+)
+
+// บทสนทนาหนึ่งรายการในหน้า inbox
+type Conversation struct {
+	PeerID      string      `json:"peer_id"`
+	LastMessage LastMessage `json:"last_message"`
+	UnreadCount int         `json:"unread_count"`
+}
+
+// ดึงบทสนทนาล่าสุดของผู้ใช้ไม่เกิน limit รายการ พร้อมข้อความล่าสุดและจำนวนที่ยังไม่อ่าน เรียงจากล่าสุด
+// ใช้ window function ใน query เดียว แทนการดึง history ทีละคู่สนทนา
+func getConversations(tenant, userID string, limit int) ([]Conversation, error) {
+	query := `
+	WITH conv AS (
+		SELECT id, sender_id, receiver_id, text, text_key_version, created_at, is_read,
+			CASE WHEN sender_id = ? THEN receiver_id ELSE sender_id END AS peer_id
+		FROM messages
+		WHERE tenant_id = ? AND (sender_id = ? OR receiver_id = ?) AND room_id IS NULL AND deleted_at IS NULL
+	), ranked AS (
+		SELECT *,
+			ROW_NUMBER() OVER (PARTITION BY peer_id ORDER BY created_at DESC, id DESC) AS rn,
+			SUM(CASE WHEN receiver_id = ? AND is_read = FALSE THEN 1 ELSE 0 END) OVER (PARTITION BY peer_id) AS unread
+		FROM conv
+	)
+	SELECT peer_id, id, sender_id, text, text_key_version, created_at, unread
+	FROM ranked
+	WHERE rn = 1
+	ORDER BY created_at DESC, id DESC
+	LIMIT ?`
+
+	rows, err := db.Query(query, userID, tenant, userID, userID, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conversations := make([]Conversation, 0)
+	for rows.Next() {
+		var conv Conversation
+		last := &conv.LastMessage
+		var text string
+		var keyVersion int
+		if err := rows.Scan(&conv.PeerID, &last.ID, &last.SenderID, &text, &keyVersion, &last.CreatedAt, &conv.UnreadCount); err != nil {
+			return nil, err
+		}
+		if last.Text, err = openText(text, keyVersion); err != nil {
+			return nil, fmt.Errorf("decrypting message %d: %w", last.ID, err)
+		}
+		conversations = append(conversations, conv)
+	}
+	return conversations, rows.Err()
+}
+
+// GET /conversations?limit=  ผู้ใช้จาก JWT (หรือ ?user_id= เมื่อไม่ได้เปิด RequireJWT)
+// GET /conversations/:userID  แบบเดิม ผู้ใช้ใน path ต้องตรงกับ token เหมือน ?user_id=
+func handleConversations(c *fiber.Ctx) error {
+	userID, err := RequestUser(c)
+	if err != nil {
+		return err
+	}
+	limit := c.QueryInt("limit", defaultConversationsLimit)
+	if limit <= 0 || limit > maxConversationsLimit {
+		return InvalidRequest(fmt.Sprintf("limit must be between 1 and %d", maxConversationsLimit))
+	}
+
+	conversations, err := getConversations(TenantOf(c), userID, limit)
+	if err != nil {
+		return Internal("Error fetching conversations", err)
+	}
+	return c.JSON(conversations)
+}
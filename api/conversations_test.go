@@ -0,0 +1,121 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestConversationsListLatestPerPeer(t *testing.T) {
+	alice, bob, carol := newTestUser("alice"), newTestUser("bob"), newTestUser("carol")
+
+	saveMessageToDB(Message{SenderID: bob, ReceiverID: alice, Text: "hi alice"})
+	saveMessageToDB(Message{SenderID: bob, ReceiverID: alice, Text: "still there?"})
+	saveMessageToDB(Message{SenderID: alice, ReceiverID: carol, Text: "hey carol"})
+	deleted := saveMessageToDB(Message{SenderID: carol, ReceiverID: alice, Text: "oops"})
+	if _, err := db.Exec("UPDATE messages SET deleted_at = CURRENT_TIMESTAMP WHERE id = ?", deleted); err != nil {
+		t.Fatalf("soft delete: %v", err)
+	}
+
+	convs, err := getConversations(DefaultTenant, alice, defaultConversationsLimit)
+	if err != nil {
+		t.Fatalf("getConversations: %v", err)
+	}
+	if len(convs) != 2 {
+		t.Fatalf("expected 2 conversations, got %+v", convs)
+	}
+
+	// ล่าสุดก่อน และไม่นับข้อความที่ถูกลบ
+	if convs[0].PeerID != carol || convs[0].LastMessage.Text != "hey carol" || convs[0].UnreadCount != 0 {
+		t.Fatalf("unexpected first conversation: %+v", convs[0])
+	}
+	if convs[1].PeerID != bob || convs[1].LastMessage.Text != "still there?" || convs[1].UnreadCount != 2 {
+		t.Fatalf("unexpected second conversation: %+v", convs[1])
+	}
+}
+
+func TestConversationCapKeepsUnreadMessages(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	config.MaxMessagesPerConversation = 3
+	defer func() { config.MaxMessagesPerConversation = 0 }()
+
+	// ข้อความเก่าที่ยังไม่อ่านต้องไม่ถูกลบ แม้จะเกิน cap
+	unread := saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: "unread"})
+	for i := 0; i < 4; i++ {
+		saveMessageToDB(Message{SenderID: bob, ReceiverID: alice, Text: "old"})
+		db.Exec("UPDATE messages SET is_read = TRUE WHERE receiver_id = ?", alice)
+	}
+	saveMessageToDB(Message{SenderID: bob, ReceiverID: alice, Text: "newest"})
+
+	// trimmer ทำงานหลังบันทึกเสร็จ ไม่ใช่ระหว่าง saveMessageToDB
+	waitFor(t, func() bool {
+		var n int
+		db.QueryRow("SELECT COUNT(*) FROM messages WHERE conversation_key = ?", conversationKey(alice, bob)).Scan(&n)
+		return n == 4
+	})
+	var exists int
+	db.QueryRow("SELECT COUNT(*) FROM messages WHERE id = ?", unread).Scan(&exists)
+	if exists != 1 {
+		t.Fatal("unread message was trimmed")
+	}
+}
+
+func TestConversationsEndpointForRequestUser(t *testing.T) {
+	alice, bob, carol := newTestUser("alice"), newTestUser("bob"), newTestUser("carol")
+	saveMessageToDB(Message{SenderID: bob, ReceiverID: alice, Text: "from bob"})
+	saveMessageToDB(Message{SenderID: carol, ReceiverID: alice, Text: "from carol"})
+
+	resp, err := http.Get("http://" + testAddr + "/conversations?user_id=" + alice + "&limit=1")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	defer resp.Body.Close()
+	var convs []Conversation
+	if err := json.NewDecoder(resp.Body).Decode(&convs); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(convs) != 1 || convs[0].PeerID != carol || convs[0].UnreadCount != 1 {
+		t.Fatalf("unexpected conversations: %+v", convs)
+	}
+
+	resp, err = http.Get("http://" + testAddr + "/conversations")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 without user, got %d", resp.StatusCode)
+	}
+}
+
+func TestLegacyConversationsRouteRequiresToken(t *testing.T) {
+	withRequireJWT(t)
+	alice := newTestUser("alice")
+	saveMessageToDB(Message{SenderID: newTestUser("bob"), ReceiverID: alice, Text: "private"})
+
+	get := func(token string) int {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+testAddr+"/conversations/"+alice, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := get(""); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", code)
+	}
+	mallory, _, _ := issueJWT(DefaultTenant, newTestUser("mallory"), time.Now())
+	if code := get(mallory); code != http.StatusForbidden {
+		t.Fatalf("expected 403 for another user's inbox, got %d", code)
+	}
+	token, _, _ := issueJWT(DefaultTenant, alice, time.Now())
+	if code := get(token); code != http.StatusOK {
+		t.Fatalf("expected 200 for own inbox, got %d", code)
+	}
+}
@@ -0,0 +1,18 @@
+package api
+
+import "go-socket/store"
+
+// ชนิดของฐานข้อมูลที่ใช้ เลือกจาก DSN ตอนเปิดการเชื่อมต่อ (ดู package store)
+type dialect = store.Dialect
+
+const (
+	dialectSQLite   = store.SQLite
+	dialectPostgres = store.Postgres
+)
+
+// *sql.DB/*sql.Tx ที่แปลง placeholder ตาม dialect
+// โค้ดส่วนอื่นเรียก db.Query/Exec/QueryRow/Begin ได้เหมือนเดิมโดยไม่ต้องรู้ว่าเป็นฐานข้อมูลอะไร
+type (
+	sqlDB = store.DB
+	sqlTx = store.Tx
+)
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"go-socket/store"
+)
+
+func TestDialectForDSN(t *testing.T) {
+	cases := map[string]dialect{
+		"file:chat.db?cache=shared&mode=rwc":   dialectSQLite,
+		"postgres://chat:secret@db:5432/chat":  dialectPostgres,
+		"postgresql://chat@localhost/chat?x=1": dialectPostgres,
+	}
+	for dsn, want := range cases {
+		if got := store.DialectFor(dsn); got != want {
+			t.Errorf("DialectFor(%q) = %v, want %v", dsn, got, want)
+		}
+	}
+}
+
+func TestRebindPlaceholders(t *testing.T) {
+	query := "SELECT id FROM messages WHERE tenant_id = ? AND id IN (?,?)"
+	if got := dialectSQLite.Rebind(query); got != query {
+		t.Fatalf("sqlite query changed: %q", got)
+	}
+	if got, want := dialectPostgres.Rebind(query), "SELECT id FROM messages WHERE tenant_id = $1 AND id IN ($2,$3)"; got != want {
+		t.Fatalf("rebind = %q, want %q", got, want)
+	}
+}
+
+func TestMigrationsTranslateForPostgres(t *testing.T) {
+	for _, m := range migrations {
+		for _, stmt := range append(m.StatementsFor(dialectPostgres), m.DownFor(dialectPostgres)...) {
+			for _, sqliteOnly := range []string{"AUTOINCREMENT", "VIRTUAL", "char(31)", "REFERENCES"} {
+				if strings.Contains(stmt, sqliteOnly) {
+					t.Errorf("migration %d still contains %s: %s", m.Version, sqliteOnly, stmt)
+				}
+			}
+		}
+	}
+}
+
+func TestMigrationsRollBackAndReapply(t *testing.T) {
+	// ใช้ DB แยกจากของ test อื่น
+	conn, err := sql.Open("sqlite3", "file:migrate_test?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer conn.Close()
+	prev := db
+	db = &sqlDB{DB: conn, Dialect: dialectSQLite}
+	defer func() { db = prev }()
+
+	latest := migrations[len(migrations)-1].Version
+	if err := runMigrateCommand([]string{"up"}, nil); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	db.Exec("INSERT INTO messages (sender_id, receiver_id, text, created_at) VALUES ('a', 'b', 'hi', CURRENT_TIMESTAMP)")
+
+	// ไม่ระบุเวอร์ชัน = ย้อนหนึ่งเวอร์ชัน
+	if err := runMigrateCommand([]string{"down"}, nil); err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	applied, _ := appliedMigrations()
+	if got := store.CurrentVersion(applied); got != latest-1 {
+		t.Fatalf("version after down = %d, want %d", got, latest-1)
+	}
+
+	if err := runMigrateCommand([]string{"down", "0"}, nil); err != nil {
+		t.Fatalf("down 0: %v", err)
+	}
+	if applied, _ := appliedMigrations(); len(applied) != 0 {
+		t.Fatalf("expected no applied migrations, got %v", applied)
+	}
+
+	if err := runMigrations(); err != nil {
+		t.Fatalf("reapply: %v", err)
+	}
+	var out bytes.Buffer
+	if err := runMigrateCommand([]string{"status"}, &out); err != nil || strings.Contains(out.String(), "pending") {
+		t.Fatalf("status after reapply: %v\n%s", err, out.String())
+	}
+}
@@ -0,0 +1,18 @@
+package api
+
+import (
+	"log/slog"
+	"time"
+
+	"go-socket/store"
+)
+
+// รัน fn ใหม่เมื่อเจอ SQLITE_BUSY/SQLITE_LOCKED สูงสุด config.DBWriteRetries ครั้ง
+// fn ต้องเริ่ม transaction ใหม่เองทุกรอบ เวลารวมทุกรอบเก็บไว้ใน chat_db_write_duration_seconds{op}
+func retryOnBusy(op string, fn func() error) error {
+	start := time.Now()
+	defer func() { dbWriteDuration.WithLabelValues(op).Observe(time.Since(start).Seconds()) }()
+	return store.RetryOnBusy(config.DBWriteRetries, fn, func(attempt int, err error) {
+		slog.Warn("database busy, retrying", "op", op, "attempt", attempt, "max_retries", config.DBWriteRetries, "err", err)
+	})
+}
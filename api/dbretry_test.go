@@ -0,0 +1,35 @@
+package api
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentSendersAreNotDropped(t *testing.T) {
+	bob := newTestUser("bob")
+	const senders, perSender = 50, 20
+
+	var wg sync.WaitGroup
+	for s := 0; s < senders; s++ {
+		wg.Add(1)
+		go func(sender string) {
+			defer wg.Done()
+			for i := 0; i < perSender; i++ {
+				msg := Message{SenderID: sender, ReceiverID: bob, Text: fmt.Sprintf("msg %d", i), ClientMsgID: fmt.Sprintf("c-%d", i)}
+				if id := saveMessageToDB(msg); id == 0 {
+					t.Errorf("message %s/%d was dropped", sender, i)
+				}
+			}
+		}(newTestUser("sender"))
+	}
+	wg.Wait()
+
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM messages WHERE receiver_id = ?", bob).Scan(&n); err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if n != senders*perSender {
+		t.Fatalf("expected %d stored messages, got %d", senders*perSender, n)
+	}
+}
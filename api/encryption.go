@@ -0,0 +1,99 @@
+package api
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// key version 0 = เก็บเป็น plaintext (ข้อความเก่าก่อนเปิดการเข้ารหัส หรือไม่ได้เปิดไว้)
+const plaintextKeyVersion = 0
+
+var errUnknownKeyVersion = errors.New("unknown encryption key version")
+
+// AES-GCM แยกตาม key version (ใช้ถอดรหัสข้อความเก่าหลังหมุน key)
+var textCiphers map[int]cipher.AEAD
+
+// สร้าง cipher จาก config.EncryptionKeys ต้องเรียกก่อนอ่าน/เขียนข้อความ
+func initEncryption() error {
+	textCiphers = make(map[int]cipher.AEAD, len(config.EncryptionKeys))
+	for version, key := range config.EncryptionKeys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return fmt.Errorf("encryption key v%d: %w", version, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return fmt.Errorf("encryption key v%d: %w", version, err)
+		}
+		textCiphers[version] = aead
+	}
+	if v := config.EncryptionKeyVersion; v != plaintextKeyVersion && textCiphers[v] == nil {
+		return fmt.Errorf("active encryption key v%d is not configured", v)
+	}
+	return nil
+}
+
+// เข้ารหัสข้อความด้วย key ปัจจุบัน คืนค่าข้อความที่เก็บลง DB และ key version
+// (nonce ต่อท้ายด้วย ciphertext แล้ว encode เป็น base64)
+func sealText(plain string) (string, int, error) {
+	version := config.EncryptionKeyVersion
+	aead := textCiphers[version]
+	if aead == nil {
+		return plain, plaintextKeyVersion, nil
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", 0, err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plain), nil)
+	return base64.StdEncoding.EncodeToString(sealed), version, nil
+}
+
+// ถอดรหัสข้อความที่อ่านจาก DB ตาม key version ที่เก็บไว้
+func openText(stored string, version int) (string, error) {
+	if version == plaintextKeyVersion {
+		return stored, nil
+	}
+	aead := textCiphers[version]
+	if aead == nil {
+		return "", fmt.Errorf("%w: v%d", errUnknownKeyVersion, version)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(stored)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("ciphertext too short")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// แปลงเป็น JSON แล้วเข้ารหัส (ใช้กับ payload ใน outbox และ scheduled_messages ที่มีข้อความอยู่ข้างใน)
+func sealPayload(v any) (string, int, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", 0, err
+	}
+	return sealText(string(data))
+}
+
+// ถอดรหัส payload แล้วแปลงจาก JSON
+func openPayload(stored string, version int, v any) error {
+	data, err := openText(stored, version)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(data), v)
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"bytes"
+	"testing"
+)
+
+// เปิดการเข้ารหัสด้วย key ที่กำหนดระหว่าง test แล้วคืนค่าเดิม
+func withEncryptionKeys(t *testing.T, active int, keys map[int][]byte) {
+	t.Helper()
+	prevKeys, prevVersion := config.EncryptionKeys, config.EncryptionKeyVersion
+	config.EncryptionKeys, config.EncryptionKeyVersion = keys, active
+	if err := initEncryption(); err != nil {
+		t.Fatalf("initEncryption: %v", err)
+	}
+	t.Cleanup(func() {
+		config.EncryptionKeys, config.EncryptionKeyVersion = prevKeys, prevVersion
+		initEncryption()
+	})
+}
+
+func TestTextIsEncryptedAtRestAndKeysRotate(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	v1, v2 := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+
+	legacy := saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: "before encryption"})
+
+	withEncryptionKeys(t, 1, map[int][]byte{1: v1})
+	old := saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: "secret v1"})
+
+	withEncryptionKeys(t, 2, map[int][]byte{1: v1, 2: v2})
+	current := saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: "secret v2"})
+
+	var raw string
+	var version int
+	db.QueryRow("SELECT text, text_key_version FROM messages WHERE id = ?", current).Scan(&raw, &version)
+	if raw == "secret v2" || version != 2 {
+		t.Fatalf("expected ciphertext with key v2, got %q (v%d)", raw, version)
+	}
+
+	pending, err := messageStore.PendingFor(DefaultTenant, bob)
+	if err != nil {
+		t.Fatalf("PendingFor: %v", err)
+	}
+	got := make(map[int64]string)
+	for _, msg := range pending {
+		got[msg.ID] = msg.Text
+	}
+	if got[legacy] != "before encryption" || got[old] != "secret v1" || got[current] != "secret v2" {
+		t.Fatalf("unexpected decrypted texts: %v", got)
+	}
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// เวลาล่าสุดที่ log เตือนเรื่องคิวใกล้เต็ม (กัน log ท่วม)
+var lastHighWaterWarning atomic.Int64
+
+// นโยบายเมื่อคิว broadcast เต็ม (config.BroadcastOverflow)
+const (
+	overflowBlock        = "block"        // รอที่ว่างได้ไม่เกิน BroadcastMaxWait (0 = รอไปเรื่อยๆ) read loop ของผู้ส่งหยุดระหว่างรอ
+	overflowDrop         = "drop"         // ทิ้งทันที ผู้ส่งทาง WebSocket ได้ error frame "overloaded"
+	overflowSpill        = "spill"        // พักไว้ใน outbox แล้วส่งเข้าคิวเมื่อมีที่ว่าง (ดู drainSpilled)
+	overflowBackpressure = "backpressure" // จำกัดข้อความค้างในคิวต่อผู้ส่ง ผู้ส่งที่ส่งถี่ถูกหยุดอ่านเฉพาะคนนั้น
+)
+
+// ส่งข้อความเข้าคิวตาม priority และ BroadcastOverflow คืนค่า false ถ้าข้อความถูกทิ้ง
+// (spill คืนค่า true เพราะข้อความยังอยู่ใน outbox และจะถูกส่งภายหลัง)
+func enqueueMessage(msg queuedMessage) bool {
+	queue, name := broadcast, "normal"
+	if msg.Priority == priorityHigh {
+		queue, name = priorityBroadcast, "high"
+	}
+
+	if n := len(queue); n >= config.BroadcastHighWater {
+		warnHighWater(name, n, cap(queue))
+	}
+
+	start := time.Now()
+	defer func() {
+		broadcastEnqueueWait.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	}()
+
+	// เฉพาะข้อความจาก WebSocket: REST และ outbox/scheduler ไม่มี socket ให้หยุดอ่าน
+	if config.BroadcastOverflow == overflowBackpressure && msg.origin != nil {
+		senderGate.acquire(msg.Message, name)
+		msg.gated = true
+	}
+
+	// ยังมีข้อความที่พักไว้ ข้อความใหม่ต้องต่อท้ายใน outbox เพื่อรักษาลำดับ
+	if config.BroadcastOverflow == overflowSpill && spilledCount.Load() > 0 && spillMessage(msg) {
+		return true
+	}
+
+	select {
+	case queue <- msg:
+		return true
+	default:
+	}
+	broadcastOverflowTotal.WithLabelValues(name, config.BroadcastOverflow).Inc()
+
+	switch config.BroadcastOverflow {
+	case overflowDrop:
+		return dropMessage(msg, name)
+	case overflowSpill:
+		if spillMessage(msg) {
+			return true
+		}
+		return dropMessage(msg, name)
+	}
+
+	if config.BroadcastMaxWait <= 0 {
+		queue <- msg
+		return true
+	}
+	timer := time.NewTimer(config.BroadcastMaxWait)
+	defer timer.Stop()
+	select {
+	case queue <- msg:
+		return true
+	case <-timer.C:
+		return dropMessage(msg, name)
+	}
+}
+
+func dropMessage(msg queuedMessage, queue string) bool {
+	if msg.gated {
+		senderGate.release(msg.Message)
+	}
+	broadcastDroppedTotal.WithLabelValues(queue).Inc()
+	messageLogger(msg.Message).Warn("dropped message: queue full", "queue", queue, "policy", config.BroadcastOverflow)
+	return false
+}
+
+// จำนวนข้อความที่ผู้ส่งแต่ละคนค้างอยู่ในคิว (overflow แบบ backpressure)
+type inflightGate struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	inflight map[string]int
+}
+
+var senderGate = newInflightGate()
+
+func newInflightGate() *inflightGate {
+	g := &inflightGate{inflight: make(map[string]int)}
+	g.cond = sync.NewCond(&g.mu)
+	return g
+}
+
+// รอจนผู้ส่งมีข้อความค้างน้อยกว่า BroadcastSenderLimit แล้วนับเพิ่มหนึ่ง
+func (g *inflightGate) acquire(msg Message, queue string) {
+	key := tenantKey(tenantOrDefault(msg.TenantID), msg.SenderID)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.inflight[key] >= config.BroadcastSenderLimit {
+		broadcastOverflowTotal.WithLabelValues(queue, overflowBackpressure).Inc()
+		messageLogger(msg).Debug("sender over in-flight limit, pausing reads", "in_flight", g.inflight[key])
+	}
+	for g.inflight[key] >= config.BroadcastSenderLimit {
+		g.cond.Wait()
+	}
+	g.inflight[key]++
+}
+
+func (g *inflightGate) release(msg Message) {
+	key := tenantKey(tenantOrDefault(msg.TenantID), msg.SenderID)
+	g.mu.Lock()
+	if g.inflight[key]--; g.inflight[key] <= 0 {
+		delete(g.inflight, key)
+	}
+	g.mu.Unlock()
+	g.cond.Broadcast()
+}
+
+// log เตือนว่าคิวใกล้เต็ม ไม่เกิน 1 ครั้งต่อ 10 วินาที
+func warnHighWater(name string, depth, capacity int) {
+	now := time.Now().UnixNano()
+	last := lastHighWaterWarning.Load()
+	if now-last < int64(10*time.Second) || !lastHighWaterWarning.CompareAndSwap(last, now) {
+		return
+	}
+	slog.Warn("broadcast queue above high-water mark", "queue", name, "depth", depth, "capacity", capacity, "high_water", config.BroadcastHighWater)
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSpilledMessagesAreDrainedWithAck(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	aliceConn := dialWS(t, alice)
+	bobConn := dialWS(t, bob)
+	cl, _ := getClient(DefaultTenant, alice)
+
+	msg := queuedMessage{Message: Message{TenantID: DefaultTenant, SenderID: alice, ReceiverID: bob, Text: "spilled", ClientMsgID: "spill-1"}, origin: cl}
+	var err error
+	if msg.outboxID, err = addToOutbox(msg.Message); err != nil {
+		t.Fatalf("addToOutbox: %v", err)
+	}
+	if !spillMessage(msg) {
+		t.Fatal("expected message to be spilled")
+	}
+	var status string
+	db.QueryRow("SELECT status FROM outbox WHERE id = ?", msg.outboxID).Scan(&status)
+	if status != outboxSpilled {
+		t.Fatalf("outbox status = %q, want %q", status, outboxSpilled)
+	}
+
+	if n := drainSpilled(); n != 1 {
+		t.Fatalf("drained %d messages, want 1", n)
+	}
+	var got Message
+	readJSON(t, bobConn, &got)
+	if got.Text != "spilled" {
+		t.Fatalf("unexpected message: %+v", got)
+	}
+	var ack Ack
+	readJSON(t, aliceConn, &ack)
+	if ack.ClientMsgID != "spill-1" || ack.Status != ackStatusDelivered {
+		t.Fatalf("unexpected ack: %+v", ack)
+	}
+	if spilledCount.Load() != 0 {
+		t.Fatalf("spilled count = %d, want 0", spilledCount.Load())
+	}
+}
+
+func TestSenderGateBlocksOverLimit(t *testing.T) {
+	prev := config.BroadcastSenderLimit
+	config.BroadcastSenderLimit = 1
+	defer func() { config.BroadcastSenderLimit = prev }()
+
+	g := newInflightGate()
+	msg := Message{SenderID: newTestUser("alice")}
+	g.acquire(msg, "normal")
+
+	acquired := make(chan struct{})
+	go func() {
+		g.acquire(msg, "normal")
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("second message should wait for the first to be processed")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// ผู้ส่งคนอื่นไม่ถูกกระทบ
+	g.acquire(Message{SenderID: newTestUser("bob")}, "normal")
+
+	g.release(msg)
+	select {
+	case <-acquired:
+	case <-time.After(2 * time.Second):
+		t.Fatal("second message not admitted after release")
+	}
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vmihailenco/msgpack/v5/msgpcode"
+	"go-socket/protocol"
+)
+
+// ประเภทของ envelope ที่เป็นข้อความแชท (v1/v2 ใช้ frame ที่ไม่มี type หรือ "chat")
+const envelopeTypeMessage = protocol.FrameMessage
+
+// ประเภท envelope ที่ client ส่งเข้ามาได้ และต้องมี payload หรือไม่
+var inboundEnvelopeTypes = map[string]bool{
+	envelopeTypeMessage:               true,
+	protocol.FrameReact:               true,
+	protocol.FrameRead:                true,
+	protocol.FrameAck:                 true,
+	protocol.FrameTyping:              true,
+	protocol.FramePingApp:             true,
+	protocol.FrameSync:                true,
+	protocol.FramePresenceSubscribe:   true,
+	protocol.FramePresenceUnsubscribe: false,
+	protocol.FrameHello:               true,
+}
+
+// ทุก frame ของ protocol v3 ทั้งขาเข้าและขาออก
+// id ไม่ซ้ำกันต่อ frame (server สร้างให้ frame ขาออก) ts เป็น Unix milliseconds ตอนที่ส่ง
+// payload คือ frame เดิมของ v2 ยกเว้นข้อความแชทที่เป็น Message ตรงๆ
+type Envelope = protocol.Envelope
+
+// envelope ขาเข้า: เก็บ payload เป็น bytes ตาม codec ของ connection เพื่อส่งต่อให้ handler เดิม decode เอง
+type inboundEnvelope struct {
+	Type    string     `json:"type"`
+	ID      string     `json:"id"`
+	TS      int64      `json:"ts"`
+	Payload rawPayload `json:"payload"`
+}
+
+// payload ที่ยังไม่ decode (ใช้ได้ทั้ง JSON และ MessagePack)
+type rawPayload []byte
+
+func (r *rawPayload) UnmarshalJSON(data []byte) error {
+	if string(data) != "null" {
+		*r = append((*r)[:0], data...)
+	}
+	return nil
+}
+
+func (r *rawPayload) DecodeMsgpack(dec *msgpack.Decoder) error {
+	raw, err := dec.DecodeRaw()
+	if err != nil {
+		return err
+	}
+	if len(raw) != 1 || raw[0] != msgpcode.Nil {
+		*r = rawPayload(raw)
+	}
+	return nil
+}
+
+// แยกประเภท frame ขาเข้าและ bytes ที่ handler ต้อง decode ต่อ
+// v1/v2: frame ทั้งก้อน ข้อความแชทไม่มี type; v3: ตรวจ envelope แล้วคืน payload (ข้อความแชทคืน type ว่าง)
+func (cl *client) decodeFrame(data []byte) (string, []byte, error) {
+	if cl.protocolVersion < protocolV3 {
+		var frame struct {
+			Type string `json:"type"`
+		}
+		if err := cl.codec.Unmarshal(data, &frame); err != nil {
+			return "", nil, err
+		}
+		return frame.Type, data, nil
+	}
+
+	var env inboundEnvelope
+	if err := cl.codec.Unmarshal(data, &env); err != nil {
+		return "", nil, err
+	}
+	needsPayload, known := inboundEnvelopeTypes[env.Type]
+	switch {
+	case env.Type == "":
+		return "", nil, errors.New("envelope type is required")
+	case !known:
+		return "", nil, fmt.Errorf("unknown envelope type %q", env.Type)
+	case needsPayload && len(env.Payload) == 0:
+		return "", nil, fmt.Errorf("%s envelope requires a payload", env.Type)
+	}
+	if env.Type == envelopeTypeMessage {
+		return "", env.Payload, nil
+	}
+	if len(env.Payload) == 0 {
+		// handler เดิม decode frame ว่างได้ (เช่น presence_unsubscribe ไม่ใช้ payload)
+		return env.Type, nil, nil
+	}
+	return env.Type, env.Payload, nil
+}
+
+// ห่อ frame ขาออกด้วย envelope สำหรับ connection v3
+func wrapEnvelope(payload any) Envelope {
+	env := Envelope{ID: uuid.NewString(), TS: time.Now().UnixMilli(), Payload: payload}
+	switch p := payload.(type) {
+	case Envelope:
+		return p
+	case chatFrame:
+		env.Type, env.Payload = envelopeTypeMessage, p.Message
+	case Message:
+		env.Type = envelopeTypeMessage
+	default:
+		env.Type = frameTypeOf(payload)
+	}
+	return env
+}
+
+// อ่าน field type ของ frame (struct ที่มี field Type หรือ map ที่ส่งต่อมาจาก instance อื่นใน cluster)
+func frameTypeOf(payload any) string {
+	if m, ok := payload.(map[string]any); ok {
+		t, _ := m["type"].(string)
+		return t
+	}
+	v := reflect.Indirect(reflect.ValueOf(payload))
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+	if f := v.FieldByName("Type"); f.IsValid() && f.Kind() == reflect.String {
+		return f.String()
+	}
+	return ""
+}
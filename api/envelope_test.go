@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	fws "github.com/fasthttp/websocket"
+)
+
+// envelope ขาออกที่ payload ยังไม่ decode
+type testEnvelope struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id"`
+	TS      int64           `json:"ts"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+func TestV3ClientsExchangeEnvelopes(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	aliceConn := dialWithProtocols(t, alice, "chat.v3")
+	bobConn := dialWithProtocols(t, bob, "chat.v3")
+	if aliceConn.Subprotocol() != "chat.v3" {
+		t.Fatalf("unexpected negotiated protocol %q", aliceConn.Subprotocol())
+	}
+
+	err := aliceConn.WriteJSON(map[string]any{
+		"type": "message", "id": "c-1", "ts": 1,
+		"payload": Message{SenderID: alice, ReceiverID: bob, Text: "hello", ClientMsgID: "c-1"},
+	})
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	var env testEnvelope
+	readJSON(t, bobConn, &env)
+	if env.Type != envelopeTypeMessage || env.ID == "" || env.TS == 0 {
+		t.Fatalf("unexpected envelope: %+v", env)
+	}
+	var got Message
+	if err := json.Unmarshal(env.Payload, &got); err != nil || got.Text != "hello" || got.SenderID != alice {
+		t.Fatalf("unexpected payload %s: %v", env.Payload, err)
+	}
+
+	var ack testEnvelope
+	readJSON(t, aliceConn, &ack)
+	if ack.Type != frameTypeAck {
+		t.Fatalf("expected ack envelope, got %+v", ack)
+	}
+}
+
+func TestV3RejectsInvalidEnvelopes(t *testing.T) {
+	alice := newTestUser("alice")
+	conn := dialWithProtocols(t, alice, "chat.v3")
+
+	for _, raw := range []string{
+		`{"payload":{"text":"no type"}}`,
+		`{"type":"shout","payload":{}}`,
+		`{"type":"typing"}`,
+		`not json`,
+	} {
+		if err := conn.WriteMessage(fws.TextMessage, []byte(raw)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		var env testEnvelope
+		readJSON(t, conn, &env)
+		var frame ErrorFrame
+		if err := json.Unmarshal(env.Payload, &frame); err != nil || env.Type != frameTypeError || frame.Code != errCodeMalformed || frame.Detail == "" {
+			t.Fatalf("%s: expected malformed error envelope, got %+v", raw, env)
+		}
+	}
+}
+
+func TestV1ClientsStillSendBareMessages(t *testing.T) {
+	cl := &client{codec: jsonCodec{}, protocolVersion: protocolV1}
+	frameType, payload, err := cl.decodeFrame([]byte(`{"receiver_id":"bob","text":"hi"}`))
+	if err != nil || frameType != "" || string(payload) != `{"receiver_id":"bob","text":"hi"}` {
+		t.Fatalf("unexpected decode: %q %s %v", frameType, payload, err)
+	}
+}
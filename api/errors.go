@@ -0,0 +1,104 @@
+// Package api คือ chat server: handler ของ HTTP/WebSocket/SSE/GraphQL/gRPC คิวข้อความ และงาน background
+// New สร้าง engine จาก Config แล้วคืน Fiber app (เปิดด้วย Run หรือ Mount เข้ากับแอปอื่น)
+// แอป Fiber ที่ฝัง chat engine ใช้ ErrorHandler WithTenant และ AuthUser ให้ route ของตัวเองตอบ error และแยก tenant แบบเดียวกันได้
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go-socket/protocol"
+)
+
+// รหัส error ที่ client ใช้ตรวจสอบได้
+const (
+	errCodeInvalidRequest = protocol.ErrInvalidRequest
+	errCodeUnauthorized   = protocol.ErrUnauthorized
+	errCodeForbidden      = protocol.ErrForbidden
+	errCodeNotFound       = protocol.ErrNotFound
+	errCodeRateLimited    = protocol.ErrRateLimited
+	errCodeQuotaExceeded  = protocol.ErrQuotaExceeded
+	errCodeMalformed      = protocol.ErrMalformed
+	errCodeInternal       = protocol.ErrInternal
+	errCodeUnavailable    = protocol.ErrUnavailable
+	errCodeBlocked        = protocol.ErrBlocked
+	errCodeOverloaded     = protocol.ErrOverloaded
+)
+
+// error ของ REST API ส่งกลับเป็น {"code": ..., "message": ...}
+type Error struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details any    `json:"details,omitempty"` // ข้อมูลเพิ่มเติมตามชนิดของ error
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+func NewError(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+func InvalidRequest(message string) *Error {
+	return NewError(fiber.StatusBadRequest, protocol.ErrInvalidRequest, message)
+}
+
+func NotFound(message string) *Error {
+	return NewError(fiber.StatusNotFound, protocol.ErrNotFound, message)
+}
+
+func Forbidden(message string) *Error {
+	return NewError(fiber.StatusForbidden, protocol.ErrForbidden, message)
+}
+
+// error ภายในที่ไม่ควรเปิดเผยรายละเอียดให้ client เห็น (log ไว้แทน)
+func Internal(context string, err error) *Error {
+	slog.Error(context, "err", err)
+	return NewError(fiber.StatusInternalServerError, protocol.ErrInternal, "Internal server error")
+}
+
+// 429 พร้อม Retry-After (วินาที ปัดขึ้น)
+func RateLimited(c *fiber.Ctx, wait time.Duration) *Error {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return NewError(fiber.StatusTooManyRequests, protocol.ErrRateLimited, "Rate limit exceeded")
+}
+
+// ErrorHandler ของ Fiber แปลงทุก error ให้อยู่ในรูป Error
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		var fiberErr *fiber.Error
+		if errors.As(err, &fiberErr) {
+			apiErr = NewError(fiberErr.Code, CodeForStatus(fiberErr.Code), fiberErr.Message)
+		} else {
+			apiErr = Internal("Unhandled error", err)
+		}
+	}
+	return c.Status(apiErr.Status).JSON(apiErr)
+}
+
+// เลือกรหัส error ตาม HTTP status สำหรับ error ที่มาจาก Fiber เอง
+func CodeForStatus(status int) string {
+	switch status {
+	case fiber.StatusUnauthorized:
+		return protocol.ErrUnauthorized
+	case fiber.StatusForbidden:
+		return protocol.ErrForbidden
+	case fiber.StatusNotFound:
+		return protocol.ErrNotFound
+	case fiber.StatusTooManyRequests:
+		return protocol.ErrRateLimited
+	case fiber.StatusInternalServerError:
+		return protocol.ErrInternal
+	case fiber.StatusServiceUnavailable:
+		return protocol.ErrUnavailable
+	default:
+		return protocol.ErrInvalidRequest
+	}
+}
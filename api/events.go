@@ -0,0 +1,284 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+)
+
+// audit stream: ทุกข้อความ การส่งถึง การอ่าน และ presence ส่งเข้า Kafka topic แยก (CHAT_KAFKA_EVENTS_TOPIC)
+// สำหรับ analytics/compliance ส่งเป็นชุดแบบ async ถ้า broker ใช้ไม่ได้จะเขียนลงไฟล์ dead-letter (JSON ทีละบรรทัด)
+// และ event ที่ตามมาจะต่อท้ายไฟล์เลยจนกว่าจะส่งไฟล์ใหม่สำเร็จ (ลองทุก deadLetterRetryInterval)
+// event ที่ส่งจากไฟล์จึงมาช้ากว่าเวลาจริง (เรียงด้วย at หรือ id เอง)
+
+const (
+	eventMessage   = "message"   // ข้อความที่ server รับ (บันทึกแล้วหรือส่งแล้ว)
+	eventDelivered = "delivered" // ข้อความถึงอุปกรณ์ของผู้รับ
+	eventRead      = "read"      // ผู้รับอ่านข้อความ
+	eventPresence  = "presence"  // ผู้ใช้ออนไลน์/ออฟไลน์
+)
+
+// ความถี่ที่ลองส่ง event ใน dead-letter ใหม่
+const deadLetterRetryInterval = 30 * time.Second
+
+// event หนึ่งรายการใน audit stream
+type ChatEvent struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	TenantID  string    `json:"tenant_id"`
+	UserID    string    `json:"user_id"`              // ผู้ส่ง (message), ผู้รับ (delivered/read), ผู้ใช้ (presence)
+	PeerID    string    `json:"peer_id,omitempty"`    // ผู้ส่งข้อความ (delivered/read)
+	MessageID int64     `json:"message_id,omitempty"` // delivered/read
+	Status    string    `json:"status,omitempty"`     // presence: online/offline
+	Message   *Message  `json:"message,omitempty"`    // message
+	At        time.Time `json:"at"`
+}
+
+// ปลายทางของ audit stream
+type EventPublisher interface {
+	PublishEvents(events []ChatEvent) error
+}
+
+// ส่ง event เป็น JSON เข้า Kafka ใช้บทสนทนา (หรือผู้ใช้สำหรับ presence) เป็น key เพื่อให้เรียงลำดับใน partition เดียว
+// ใช้ writer ร่วมกับ message sink
+type kafkaEventPublisher struct {
+	writer *kafka.Writer
+	topic  string
+}
+
+func newKafkaEventPublisher(brokers []string, topic string) kafkaEventPublisher {
+	return kafkaEventPublisher{writer: sharedKafkaWriter(brokers), topic: topic}
+}
+
+func (p kafkaEventPublisher) PublishEvents(events []ChatEvent) error {
+	records := make([]kafka.Message, 0, len(events))
+	for _, ev := range events {
+		value, err := json.Marshal(ev)
+		if err != nil {
+			return fmt.Errorf("marshalling event %s: %w", ev.ID, err)
+		}
+		records = append(records, kafka.Message{
+			Topic:   p.topic,
+			Key:     []byte(eventKey(ev)),
+			Value:   value,
+			Headers: []kafka.Header{{Key: "tenant_id", Value: []byte(ev.TenantID)}, {Key: "event_type", Value: []byte(ev.Type)}},
+		})
+	}
+	return p.writer.WriteMessages(context.Background(), records...)
+}
+
+func eventKey(ev ChatEvent) string {
+	switch {
+	case ev.Message != nil && ev.Message.RoomID != 0:
+		return tenantKey(ev.TenantID, fmt.Sprintf("room:%d", ev.Message.RoomID))
+	case ev.Message != nil:
+		return tenantKey(ev.TenantID, conversationKey(ev.Message.SenderID, ev.Message.ReceiverID))
+	case ev.PeerID != "":
+		return tenantKey(ev.TenantID, conversationKey(ev.PeerID, ev.UserID))
+	}
+	return tenantKey(ev.TenantID, ev.UserID)
+}
+
+// คิวของ audit stream อ่านจาก goroutine ที่ส่งข้อความและ presence พร้อมกัน จึงสลับผ่าน atomic
+var eventQueue atomic.Pointer[chan ChatEvent] // nil = ไม่ได้เปิด audit stream
+
+func loadEventQueue() chan ChatEvent {
+	if q := eventQueue.Load(); q != nil {
+		return *q
+	}
+	return nil
+}
+
+// เปิด audit stream ตาม config (ต้องตั้งทั้ง CHAT_KAFKA_BROKERS และ CHAT_KAFKA_EVENTS_TOPIC)
+func startEventStream() {
+	if len(config.KafkaBrokers) == 0 || config.KafkaEventsTopic == "" {
+		return
+	}
+	queue := make(chan ChatEvent, config.SinkQueueSize)
+	eventQueue.Store(&queue)
+	go runEventStream(queue, newKafkaEventPublisher(config.KafkaBrokers, config.KafkaEventsTopic), config.EventsDeadLetterFile, deadLetterRetryInterval)
+	slog.Info("streaming chat events to Kafka", "topic", config.KafkaEventsTopic, "dead_letter", config.EventsDeadLetterFile)
+}
+
+// หยิบ event จากคิวส่งเป็นชุดจนกว่าคิวจะถูกปิด ชุดที่ส่งไม่สำเร็จเขียนลง deadLetter
+// ระหว่างที่ deadLetter ยังค้างอยู่ ชุดถัดไปต่อท้ายไฟล์เลยโดยไม่รอ broker ทีละชุด (คิวจึงไม่เต็มและ event ไม่หาย)
+// แล้วลองส่งทั้งไฟล์ใหม่ทุก retryEvery
+func runEventStream(queue <-chan ChatEvent, pub EventPublisher, deadLetter string, retryEvery time.Duration) {
+	ticker := time.NewTicker(retryEvery)
+	defer ticker.Stop()
+	pending := hasDeadLetters(deadLetter)
+
+	batch := make([]ChatEvent, 0, kafkaBatchSize)
+	for {
+		select {
+		case ev, ok := <-queue:
+			if !ok {
+				return
+			}
+			batch = nextBatch(append(batch[:0], ev), queue)
+			if pending {
+				deadLetterEvents(deadLetter, batch)
+				continue
+			}
+			if err := pub.PublishEvents(batch); err != nil {
+				slog.Error("publishing chat events", "count", len(batch), "err", err)
+				deadLetterEvents(deadLetter, batch)
+				pending = true
+				continue
+			}
+			eventsPublishedTotal.Add(float64(len(batch)))
+		case <-ticker.C:
+			if pending {
+				pending = !replayDeadLetters(deadLetter, pub)
+			}
+		}
+	}
+}
+
+// ต่อท้ายชุดที่ยังส่งไม่ได้ลงไฟล์ dead-letter
+func deadLetterEvents(path string, events []ChatEvent) {
+	if err := appendDeadLetters(path, events); err != nil {
+		// เขียนไฟล์ไม่ได้ = event ชุดนี้หาย
+		eventsDroppedTotal.Add(float64(len(events)))
+		slog.Error("writing event dead-letter file", "path", path, "count", len(events), "err", err)
+		return
+	}
+	eventsDeadLetteredTotal.Add(float64(len(events)))
+}
+
+func hasDeadLetters(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Size() > 0
+}
+
+// ต่อท้าย event ที่ส่งไม่สำเร็จลงไฟล์
+func appendDeadLetters(path string, events []ChatEvent) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, ev := range events {
+		if err := enc.Encode(ev); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ส่ง event ใน dead-letter ใหม่ทีละชุด คืนค่า true ถ้าส่งครบแล้ว (ลบไฟล์)
+// ส่งไม่สำเร็จกลางทาง = เขียนเฉพาะ event ที่ยังไม่ได้ส่งกลับลงไฟล์
+func replayDeadLetters(path string, pub EventPublisher) bool {
+	events, err := readDeadLetters(path)
+	if err != nil {
+		slog.Error("reading event dead-letter file", "path", path, "err", err)
+		return false
+	}
+	for start := 0; start < len(events); start += kafkaBatchSize {
+		batch := events[start:min(start+kafkaBatchSize, len(events))]
+		if err := pub.PublishEvents(batch); err != nil {
+			slog.Warn("replaying chat events", "remaining", len(events)-start, "err", err)
+			if err := rewriteDeadLetters(path, events[start:]); err != nil {
+				slog.Error("rewriting event dead-letter file", "path", path, "err", err)
+			}
+			return false
+		}
+		eventsPublishedTotal.Add(float64(len(batch)))
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Error("removing event dead-letter file", "path", path, "err", err)
+	}
+	if len(events) > 0 {
+		slog.Info("replayed chat events from dead-letter file", "count", len(events))
+	}
+	return true
+}
+
+func readDeadLetters(path string) ([]ChatEvent, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []ChatEvent
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 4<<20)
+	for scanner.Scan() {
+		var ev ChatEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			// บรรทัดที่เขียนไม่ครบตอน process ตาย ข้ามไป
+			eventsDroppedTotal.Inc()
+			continue
+		}
+		events = append(events, ev)
+	}
+	return events, scanner.Err()
+}
+
+// เขียนไฟล์ใหม่ทั้งไฟล์ผ่านไฟล์ชั่วคราว ไม่ให้ไฟล์เหลือครึ่งเดียวถ้า process ตายระหว่างเขียน
+func rewriteDeadLetters(path string, events []ChatEvent) error {
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+	if err := appendDeadLetters(tmp, events); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ส่ง event เข้าคิวแบบ async ไม่ block ผู้เรียก ถ้าคิวเต็มจะทิ้งและนับไว้
+func streamEvent(ev ChatEvent) {
+	queue := loadEventQueue()
+	if queue == nil {
+		return
+	}
+	ev.ID = uuid.NewString()
+	ev.TenantID = tenantOrDefault(ev.TenantID)
+	if ev.At.IsZero() {
+		ev.At = time.Now().UTC()
+	}
+	select {
+	case queue <- ev:
+	default:
+		eventsDroppedTotal.Inc()
+		slog.Warn("event queue full, dropped event", "type", ev.Type, "tenant", ev.TenantID, "user_id", ev.UserID)
+	}
+}
+
+func streamMessage(msg Message) {
+	if eventQueue.Load() == nil {
+		return
+	}
+	streamEvent(ChatEvent{Type: eventMessage, TenantID: msg.TenantID, UserID: msg.SenderID, Message: &msg, At: msg.CreatedAt})
+}
+
+// event ของข้อความที่ผู้รับได้รับ/อ่าน (byPeer = ผู้ส่งข้อความ -> ID ของข้อความ)
+func streamReceipts(eventType, tenant, userID string, byPeer map[string][]int64) {
+	if eventQueue.Load() == nil {
+		return
+	}
+	now := time.Now().UTC()
+	for peerID, ids := range byPeer {
+		for _, id := range ids {
+			streamEvent(ChatEvent{Type: eventType, TenantID: tenant, UserID: userID, PeerID: peerID, MessageID: id, At: now})
+		}
+	}
+}
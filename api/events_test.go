@@ -0,0 +1,187 @@
+package api
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// publisher ที่จำ event ที่ส่งสำเร็จไว้ และล้มเหลวตาม fail
+type recordingPublisher struct {
+	mu       sync.Mutex
+	fail     bool
+	attempts int
+	events   []ChatEvent
+}
+
+func (p *recordingPublisher) PublishEvents(events []ChatEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.attempts++
+	if p.fail {
+		return errors.New("broker unavailable")
+	}
+	p.events = append(p.events, events...)
+	return nil
+}
+
+func (p *recordingPublisher) setFail(fail bool) {
+	p.mu.Lock()
+	p.fail = fail
+	p.mu.Unlock()
+}
+
+func (p *recordingPublisher) attemptCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.attempts
+}
+
+func (p *recordingPublisher) ids() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ids := make([]string, len(p.events))
+	for i, ev := range p.events {
+		ids[i] = ev.ID
+	}
+	return ids
+}
+
+func TestEventStreamDeadLettersAndReplays(t *testing.T) {
+	deadLetter := filepath.Join(t.TempDir(), "events.jsonl")
+	queue := make(chan ChatEvent, 10)
+	pub := &recordingPublisher{fail: true}
+	done := make(chan struct{})
+	go func() {
+		runEventStream(queue, pub, deadLetter, 20*time.Millisecond)
+		close(done)
+	}()
+
+	queue <- ChatEvent{ID: "a", Type: eventPresence}
+	queue <- ChatEvent{ID: "b", Type: eventPresence}
+	waitFor(t, func() bool { events, _ := readDeadLetters(deadLetter); return len(events) == 2 })
+
+	// broker กลับมา: event ใน dead-letter ถูกส่งก่อนตามลำดับเดิม แล้วจึงเป็นชุดใหม่
+	pub.setFail(false)
+	queue <- ChatEvent{ID: "c", Type: eventPresence}
+	waitFor(t, func() bool { return len(pub.ids()) == 3 })
+	close(queue)
+	<-done
+
+	if got := pub.ids(); got[0] != "a" || got[1] != "b" || got[2] != "c" {
+		t.Fatalf("unexpected publish order: %v", got)
+	}
+	if hasDeadLetters(deadLetter) {
+		t.Fatal("dead-letter file should be removed after replay")
+	}
+}
+
+func TestEventStreamSpillsWhileBrokerDown(t *testing.T) {
+	deadLetter := filepath.Join(t.TempDir(), "events.jsonl")
+	queue := make(chan ChatEvent, 10)
+	pub := &recordingPublisher{fail: true}
+	done := make(chan struct{})
+	go func() {
+		runEventStream(queue, pub, deadLetter, time.Hour)
+		close(done)
+	}()
+
+	queue <- ChatEvent{ID: "first", Type: eventPresence}
+	waitFor(t, func() bool { return hasDeadLetters(deadLetter) })
+
+	// broker ยังล่ม: event ที่ตามมาลงไฟล์ทันทีโดยไม่รอ broker ทีละชุด คิวเล็กก็ไม่เต็มและไม่มี event หาย
+	const more = 50
+	for i := 0; i < more; i++ {
+		queue <- ChatEvent{ID: "later", Type: eventPresence}
+	}
+	close(queue)
+	<-done
+
+	if events, _ := readDeadLetters(deadLetter); len(events) != more+1 || events[0].ID != "first" {
+		t.Fatalf("expected %d dead-lettered events in order, got %d", more+1, len(events))
+	}
+	if n := pub.attemptCount(); n != 1 {
+		t.Fatalf("expected one publish attempt while broker is down, got %d", n)
+	}
+}
+
+func TestEventStreamReplaysOnTimerAndKeepsUnsent(t *testing.T) {
+	deadLetter := filepath.Join(t.TempDir(), "events.jsonl")
+	if err := appendDeadLetters(deadLetter, []ChatEvent{{ID: "old", Type: eventRead}}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	pub := &recordingPublisher{fail: true}
+
+	// ส่งไม่ได้: event ยังอยู่ในไฟล์ครบ
+	if replayDeadLetters(deadLetter, pub) {
+		t.Fatal("replay should fail while broker is down")
+	}
+	if events, _ := readDeadLetters(deadLetter); len(events) != 1 || events[0].ID != "old" {
+		t.Fatalf("dead letters lost after failed replay: %+v", events)
+	}
+
+	// ไม่มี event ใหม่ ไฟล์ที่ค้างตั้งแต่ก่อนเปิดถูกส่งตามรอบเวลา
+	pub.setFail(false)
+	queue := make(chan ChatEvent)
+	go runEventStream(queue, pub, deadLetter, 10*time.Millisecond)
+	defer close(queue)
+	waitFor(t, func() bool { return len(pub.ids()) == 1 })
+}
+
+func TestChatEventsAreStreamed(t *testing.T) {
+	events := make(chan ChatEvent, 100)
+	eventQueue.Store(&events)
+	defer eventQueue.Store(nil)
+
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	bobConn := dialWS(t, bob)
+	aliceConn := dialWS(t, alice)
+	if err := aliceConn.WriteJSON(Message{SenderID: alice, ReceiverID: bob, Text: "audited"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var got Message
+	readJSON(t, bobConn, &got)
+
+	seen := make(map[string]ChatEvent)
+	deadline := time.After(2 * time.Second)
+	waitEvents := func(want ...string) {
+		t.Helper()
+		missing := func() bool {
+			for _, key := range want {
+				if _, ok := seen[key]; !ok {
+					return true
+				}
+			}
+			return false
+		}
+		for missing() {
+			select {
+			case ev := <-events:
+				if ev.UserID == alice || ev.UserID == bob {
+					seen[ev.Type+":"+ev.UserID] = ev
+				}
+			case <-deadline:
+				t.Fatalf("missing events, got %v", seen)
+			}
+		}
+	}
+	// อ่านก่อน worker mark delivered จะไม่มี event delivered (ข้อความข้ามไปเป็นอ่านแล้วเลย) จึงรอ delivered ก่อน
+	waitEvents(eventMessage+":"+alice, eventDelivered+":"+bob, eventPresence+":"+bob)
+	bobConn.WriteJSON(map[string]any{"type": "read", "message_ids": []int64{got.ID}})
+	waitEvents(eventRead + ":" + bob)
+
+	if ev := seen[eventMessage+":"+alice]; ev.Message == nil || ev.Message.ID != got.ID || ev.ID == "" {
+		t.Fatalf("unexpected message event: %+v", ev)
+	}
+	if ev := seen[eventDelivered+":"+bob]; ev.MessageID != got.ID || ev.PeerID != alice {
+		t.Fatalf("unexpected delivered event: %+v", ev)
+	}
+	if ev := seen[eventRead+":"+bob]; ev.MessageID != got.ID || ev.PeerID != alice {
+		t.Fatalf("unexpected read event: %+v", ev)
+	}
+	if ev := seen[eventPresence+":"+bob]; ev.Status != presenceOnline || ev.TenantID != DefaultTenant {
+		t.Fatalf("unexpected presence event: %+v", ev)
+	}
+}
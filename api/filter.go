@@ -0,0 +1,124 @@
+package api
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// โหมดของ filter เมื่อเจอคำต้องห้าม
+const (
+	filterModeMask   = "mask"   // แทนคำที่เจอด้วย *
+	filterModeReject = "reject" // ปฏิเสธทั้งข้อความ
+)
+
+var errContentRejected = errors.New("message contains blocked content")
+
+// ตรวจ/แก้ข้อความก่อนบันทึกและส่ง คืนค่าข้อความที่ใช้ต่อ หรือ errContentRejected
+type ContentFilter interface {
+	Filter(text string) (string, error)
+}
+
+// ค่า default: ไม่กรอง
+type noopFilter struct{}
+
+func (noopFilter) Filter(text string) (string, error) { return text, nil }
+
+// กรองตามรายการคำ/regex (ไม่สนตัวพิมพ์เล็กใหญ่) และตัวควบคุม (control character)
+type patternFilter struct {
+	pattern      *regexp.Regexp // nil = ไม่มีรายการคำ
+	controlChars bool
+	reject       bool
+}
+
+func (f patternFilter) Filter(text string) (string, error) {
+	if f.controlChars && strings.IndexFunc(text, isBlockedControl) >= 0 {
+		if f.reject {
+			return "", errContentRejected
+		}
+		text = strings.Map(func(r rune) rune {
+			if isBlockedControl(r) {
+				return -1
+			}
+			return r
+		}, text)
+	}
+
+	if f.pattern == nil || !f.pattern.MatchString(text) {
+		return text, nil
+	}
+	if f.reject {
+		return "", errContentRejected
+	}
+	return f.pattern.ReplaceAllStringFunc(text, func(match string) string {
+		return strings.Repeat("*", utf8.RuneCountInString(match))
+	}), nil
+}
+
+// ตัวควบคุมที่ไม่อนุญาต (ขึ้นบรรทัดใหม่และ tab ยังใช้ได้)
+func isBlockedControl(r rune) bool {
+	return unicode.IsControl(r) && r != '\n' && r != '\t' && r != '\r'
+}
+
+var contentFilter ContentFilter = noopFilter{}
+
+// สร้าง filter จาก config (รายการคำจาก env/ไฟล์ และ regex เพิ่มเติม) ต้องเรียกก่อนรับข้อความ
+func initContentFilter() error {
+	words := append([]string(nil), config.FilterWords...)
+	if config.FilterWordsFile != "" {
+		fileWords, err := readWordList(config.FilterWordsFile)
+		if err != nil {
+			return err
+		}
+		words = append(words, fileWords...)
+	}
+
+	var parts []string
+	for _, w := range words {
+		parts = append(parts, regexp.QuoteMeta(w))
+	}
+	if config.FilterPattern != "" {
+		parts = append(parts, config.FilterPattern)
+	}
+
+	if len(parts) == 0 && !config.FilterControlChars {
+		contentFilter = noopFilter{}
+		return nil
+	}
+
+	f := patternFilter{controlChars: config.FilterControlChars, reject: config.FilterMode == filterModeReject}
+	if len(parts) > 0 {
+		// รวมเป็น regex เดียว ข้อความปกติจึงถูก scan แค่รอบเดียว
+		re, err := regexp.Compile("(?i)(?:" + strings.Join(parts, "|") + ")")
+		if err != nil {
+			return err
+		}
+		f.pattern = re
+	}
+	contentFilter = f
+	return nil
+}
+
+// อ่านรายการคำจากไฟล์ บรรทัดละคำ (ข้ามบรรทัดว่างและบรรทัดที่ขึ้นต้นด้วย #)
+func readWordList(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	return words, scanner.Err()
+}
@@ -0,0 +1,34 @@
+package api
+
+import "testing"
+
+func TestPatternFilterMasksOrRejects(t *testing.T) {
+	// คืนค่าเฉพาะ field ของ filter: การคัดลอกทั้ง config ทับจะชนกับ goroutine ของ server ที่อ่าน config อยู่
+	prevWords, prevFile, prevPattern, prevControl, prevMode := config.FilterWords, config.FilterWordsFile, config.FilterPattern, config.FilterControlChars, config.FilterMode
+	defer func() {
+		config.FilterWords, config.FilterWordsFile, config.FilterPattern, config.FilterControlChars, config.FilterMode = prevWords, prevFile, prevPattern, prevControl, prevMode
+		initContentFilter()
+	}()
+
+	config.FilterWords = []string{"darn", "ไม่สุภาพ"}
+	config.FilterControlChars = true
+	config.FilterMode = filterModeMask
+	if err := initContentFilter(); err != nil {
+		t.Fatalf("initContentFilter: %v", err)
+	}
+	got, err := contentFilter.Filter("Oh DARN, คำไม่สุภาพ\x07 here")
+	if err != nil || got != "Oh ****, คำ******** here" {
+		t.Fatalf("unexpected masked text %q (%v)", got, err)
+	}
+	if got, _ := contentFilter.Filter("hello\nworld"); got != "hello\nworld" {
+		t.Fatalf("clean text must pass unchanged, got %q", got)
+	}
+
+	config.FilterMode = filterModeReject
+	if err := initContentFilter(); err != nil {
+		t.Fatalf("initContentFilter: %v", err)
+	}
+	if _, err := contentFilter.Filter("darn it"); err != errContentRejected {
+		t.Fatalf("expected rejection, got %v", err)
+	}
+}
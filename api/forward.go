@@ -0,0 +1,134 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go-socket/protocol"
+)
+
+var errMessageDeleted = errors.New("message has been deleted")
+
+// ที่มาของข้อความที่ถูกส่งต่อ (ผู้ส่งต้นฉบับ ไม่ใช่ผู้ที่กดส่งต่อ)
+type ForwardedFrom = protocol.ForwardedFrom
+
+// body ของ POST /messages/:id/forward
+type ForwardRequest struct {
+	UserID string `json:"user_id"` // ผู้ที่ส่งต่อ ต้องเป็นผู้ส่งหรือผู้รับของข้อความต้นฉบับ
+	To     string `json:"to"`
+}
+
+// สร้างข้อความใหม่จากข้อความ messageID ส่งจาก userID ถึง to
+// ส่งต่อข้อความที่ถูกส่งต่อมาอีกที ยังอ้างถึงต้นฉบับแรกสุด
+func buildForward(tenant string, messageID int64, userID, to string) (Message, error) {
+	var senderID, receiverID, text string
+	var keyVersion int
+	var metadata, fwdSenderID, attachmentID sql.NullString
+	var fwdFromID sql.NullInt64
+	var deleted bool
+	err := db.QueryRow("SELECT sender_id, receiver_id, text, text_key_version, metadata, attachment_id, forwarded_from_id, forwarded_sender_id, deleted_at IS NOT NULL FROM messages WHERE id = ? AND tenant_id = ?", messageID, tenant).
+		Scan(&senderID, &receiverID, &text, &keyVersion, &metadata, &attachmentID, &fwdFromID, &fwdSenderID, &deleted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Message{}, errMessageNotFound
+	}
+	if err != nil {
+		return Message{}, fmt.Errorf("fetching message: %w", err)
+	}
+	if userID != senderID && userID != receiverID {
+		return Message{}, errNotParticipant
+	}
+	if deleted {
+		return Message{}, errMessageDeleted
+	}
+	if text, err = openText(text, keyVersion); err != nil {
+		return Message{}, fmt.Errorf("decrypting message %d: %w", messageID, err)
+	}
+
+	msg := Message{
+		TenantID:      tenant,
+		SenderID:      userID,
+		ReceiverID:    to,
+		Text:          text,
+		Forwarded:     true,
+		ForwardedFrom: &ForwardedFrom{MessageID: messageID, SenderID: senderID},
+	}
+	if fwdFromID.Valid {
+		msg.ForwardedFrom = &ForwardedFrom{MessageID: fwdFromID.Int64, SenderID: fwdSenderID.String}
+	}
+	if metadata.Valid {
+		msg.Metadata = json.RawMessage(metadata.String)
+	}
+	// ไฟล์แนบอ้างถึงไฟล์เดิม ผู้รับใหม่ดาวน์โหลดได้เพราะเป็นผู้รับของข้อความที่แนบไฟล์นี้
+	if attachmentID.Valid {
+		att, _, err := getAttachment(tenant, attachmentID.String)
+		if err != nil {
+			return Message{}, fmt.Errorf("fetching attachment of message %d: %w", messageID, err)
+		}
+		msg.AttachmentID = att.ID
+		msg.Attachment = &att
+	}
+	return msg, nil
+}
+
+// ลบข้อมูลการส่งต่อที่ client ใส่มาเอง (server เป็นผู้กำหนดผ่าน buildForward เท่านั้น)
+func clearForwarded(msg *Message) {
+	msg.Forwarded = false
+	msg.ForwardedFrom = nil
+}
+
+// POST /messages/:id/forward
+func handleForwardRequest(c *fiber.Ctx) error {
+	messageID, err := c.ParamsInt("id")
+	if err != nil {
+		return InvalidRequest("Invalid message id")
+	}
+
+	var req ForwardRequest
+	if err := c.BodyParser(&req); err != nil {
+		return InvalidRequest("Invalid request body")
+	}
+	if err := BindAuthUser(c, &req.UserID, "user_id"); err != nil {
+		return err
+	}
+	if req.UserID == "" || req.To == "" {
+		return InvalidRequest("user_id and to are required")
+	}
+
+	msg, err := buildForward(TenantOf(c), int64(messageID), req.UserID, req.To)
+	switch {
+	case errors.Is(err, errMessageNotFound):
+		return NotFound("Message not found")
+	case errors.Is(err, errNotParticipant):
+		return Forbidden("Not a participant")
+	case errors.Is(err, errMessageDeleted):
+		return InvalidRequest("Message has been deleted")
+	case err != nil:
+		return Internal("Error loading message", err)
+	}
+	if err := checkNotBlocked(msg); err != nil {
+		if errors.Is(err, errBlocked) {
+			return errSenderBlocked()
+		}
+		return Internal("Error checking blocks", err)
+	}
+	if ok, resetsAt := consumeQuota(msg.TenantID, msg.SenderID, 1, time.Now()); !ok {
+		return errQuotaExceeded(resetsAt)
+	}
+	msg.TraceID = requestIDOf(c)
+
+	result, err := dispatchMessage(msg)
+	if err != nil && !result.Delivered {
+		return NewError(fiber.StatusInternalServerError, errCodeInternal, "Failed to store message")
+	}
+	messageLogger(result.Message).Info("message forwarded", "forwarded_from_id", messageID)
+
+	return c.JSON(fiber.Map{
+		"status":    "Message forwarded",
+		"delivered": result.Delivered,
+		"id":        result.Message.ID,
+	})
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func postForward(t *testing.T, messageID int64, body string) int {
+	t.Helper()
+	resp, err := http.Post("http://"+testAddr+"/messages/"+strconv.FormatInt(messageID, 10)+"/forward", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("post forward: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestForwardDeliversWithAttribution(t *testing.T) {
+	alice, bob, carol := newTestUser("alice"), newTestUser("bob"), newTestUser("carol")
+	original := saveMessageToDB(Message{SenderID: bob, ReceiverID: alice, Text: "meeting moved to 3pm"})
+
+	carolConn := dialWS(t, carol)
+	if code := postForward(t, original, `{"user_id":"`+alice+`","to":"`+carol+`"}`); code != http.StatusOK {
+		t.Fatalf("unexpected status %d", code)
+	}
+
+	var got Message
+	readJSON(t, carolConn, &got)
+	if got.SenderID != alice || got.Text != "meeting moved to 3pm" || !got.Forwarded {
+		t.Fatalf("unexpected frame: %+v", got)
+	}
+	if got.ForwardedFrom == nil || got.ForwardedFrom.MessageID != original || got.ForwardedFrom.SenderID != bob {
+		t.Fatalf("unexpected attribution: %+v", got.ForwardedFrom)
+	}
+
+	// ส่งต่ออีกทอด ยังอ้างถึงต้นฉบับแรก
+	dave := newTestUser("dave")
+	msg, err := buildForward(DefaultTenant, got.ID, carol, dave)
+	if err != nil {
+		t.Fatalf("buildForward: %v", err)
+	}
+	if msg.ForwardedFrom.MessageID != original || msg.ForwardedFrom.SenderID != bob {
+		t.Fatalf("expected original attribution, got %+v", msg.ForwardedFrom)
+	}
+}
+
+func TestForwardRejectsOutsidersAndDeleted(t *testing.T) {
+	alice, bob, carol := newTestUser("alice"), newTestUser("bob"), newTestUser("carol")
+	original := saveMessageToDB(Message{SenderID: bob, ReceiverID: alice, Text: "secret"})
+
+	if code := postForward(t, original, `{"user_id":"`+carol+`","to":"`+carol+`"}`); code != http.StatusForbidden {
+		t.Fatalf("expected 403 for non-participant, got %d", code)
+	}
+
+	db.Exec("UPDATE messages SET deleted_at = CURRENT_TIMESTAMP WHERE id = ?", original)
+	if code := postForward(t, original, `{"user_id":"`+alice+`","to":"`+carol+`"}`); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for deleted message, got %d", code)
+	}
+	if n := countStored(t, alice, carol, false); n != 0 {
+		t.Fatalf("expected nothing forwarded, got %d", n)
+	}
+}
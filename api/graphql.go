@@ -0,0 +1,505 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+// GraphQL บน /graphql ให้ frontend ที่ใช้ Apollo ไม่ต้องรู้จัก JSON protocol ของ /ws/chat
+//   POST /graphql               query history/conversations
+//   GET  /graphql (WebSocket)   subscription messageReceived ตาม protocol graphql-transport-ws (graphql-ws)
+// ผู้ใช้มาจาก JWT (หรือ ?user_id= เมื่อไม่ได้เปิด RequireJWT) เหมือน REST ส่วน connectionParams ไม่ได้ใช้
+
+// sub-protocol ของ graphql-ws และ close code ที่ protocol กำหนด
+const (
+	graphqlWSProtocol = "graphql-transport-ws"
+
+	graphqlCloseBadRequest   = 4400
+	graphqlCloseUnauthorized = 4401
+	graphqlCloseInitTimeout  = 4408
+	graphqlCloseDuplicateID  = 4409
+	graphqlCloseTooManyInits = 4429
+)
+
+// จำนวน operation ที่ทำงานพร้อมกันได้ต่อ connection
+const graphqlMaxOperationsPerWS = 50
+
+// key ใน Locals ที่เก็บผู้ใช้ของ request GraphQL
+const localsGraphQLUser = "graphql_user"
+
+// ผู้ใช้และ tenant ของ operation (ส่งผ่าน context ให้ resolver)
+type graphqlViewer struct {
+	Tenant string
+	UserID string
+}
+
+type graphqlViewerKey struct{}
+
+func viewerOf(ctx context.Context) graphqlViewer {
+	v, _ := ctx.Value(graphqlViewerKey{}).(graphqlViewer)
+	return v
+}
+
+var graphqlMessageType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Message",
+	Fields: graphql.Fields{
+		"id":           &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+		"senderId":     &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"receiverId":   &graphql.Field{Type: graphql.String},
+		"roomId":       &graphql.Field{Type: graphql.ID},
+		"text":         &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"isRead":       &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		"isDelivered":  &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		"state":        &graphql.Field{Type: graphql.String},
+		"createdAt":    &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+		"clientMsgId":  &graphql.Field{Type: graphql.String},
+		"mentions":     &graphql.Field{Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+		"mentioned":    &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		"metadata":     &graphql.Field{Type: graphql.String, Description: "JSON object ที่ client กำหนดเอง"},
+		"replyToId":    &graphql.Field{Type: graphql.ID},
+		"attachmentId": &graphql.Field{Type: graphql.String},
+		"forwarded":    &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		"deleted":      &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+	},
+})
+
+var graphqlHistoryPageType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "HistoryPage",
+	Fields: graphql.Fields{
+		"messages":   &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphqlMessageType)))},
+		"nextCursor": &graphql.Field{Type: graphql.String},
+	},
+})
+
+var graphqlLastMessageType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "LastMessage",
+	Fields: graphql.Fields{
+		"id":        &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+		"senderId":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"text":      &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"createdAt": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+	},
+})
+
+var graphqlConversationType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Conversation",
+	Fields: graphql.Fields{
+		"peerId":      &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"lastMessage": &graphql.Field{Type: graphql.NewNonNull(graphqlLastMessageType)},
+		"unreadCount": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+	},
+})
+
+var graphqlSchema = mustGraphQLSchema()
+
+func mustGraphQLSchema() graphql.Schema {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"history": &graphql.Field{
+					Type:        graphql.NewNonNull(graphqlHistoryPageType),
+					Description: "ประวัติการสนทนากับ peer เรียงจากใหม่ไปเก่า (เหมือน GET /messages)",
+					Args: graphql.FieldConfigArgument{
+						"peer":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+						"before": &graphql.ArgumentConfig{Type: graphql.String},
+						"limit":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultHistoryPageSize},
+					},
+					Resolve: resolveHistory,
+				},
+				"conversations": &graphql.Field{
+					Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphqlConversationType))),
+					Description: "บทสนทนาล่าสุดพร้อมจำนวนที่ยังไม่อ่าน (เหมือน GET /conversations)",
+					Args: graphql.FieldConfigArgument{
+						"limit": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultConversationsLimit},
+					},
+					Resolve: resolveConversations,
+				},
+			},
+		}),
+		Subscription: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Subscription",
+			Fields: graphql.Fields{
+				"messageReceived": &graphql.Field{
+					Type:        graphql.NewNonNull(graphqlMessageType),
+					Description: "ข้อความที่ส่งถึงผู้ใช้ (ทั้งแชตส่วนตัวและห้อง) หลังเริ่ม subscribe",
+					Subscribe:   subscribeMessageReceived,
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return p.Source, nil
+					},
+				},
+			},
+		}),
+	})
+	if err != nil {
+		panic(fmt.Sprintf("graphql schema: %v", err))
+	}
+	return schema
+}
+
+func resolveHistory(p graphql.ResolveParams) (any, error) {
+	viewer := viewerOf(p.Context)
+	limit, _ := p.Args["limit"].(int)
+	if limit <= 0 || limit > maxHistoryPageSize {
+		return nil, fmt.Errorf("limit must be between 1 and %d", maxHistoryPageSize)
+	}
+	var before historyCursor
+	if cursor, _ := p.Args["before"].(string); cursor != "" {
+		var err error
+		if before, err = decodeHistoryCursor(cursor); err != nil {
+			return nil, errors.New("invalid cursor")
+		}
+	}
+	peer, _ := p.Args["peer"].(string)
+	page, err := historyPage(viewer.Tenant, viewer.UserID, peer, before, limit)
+	if err != nil {
+		slog.Error("Error fetching message history", "err", err)
+		return nil, errors.New("internal server error")
+	}
+	messages := make([]map[string]any, len(page.Messages))
+	for i, msg := range page.Messages {
+		messages[i] = graphqlMessage(msg)
+	}
+	result := map[string]any{"messages": messages}
+	if page.NextCursor != "" {
+		result["nextCursor"] = page.NextCursor
+	}
+	return result, nil
+}
+
+func resolveConversations(p graphql.ResolveParams) (any, error) {
+	viewer := viewerOf(p.Context)
+	limit, _ := p.Args["limit"].(int)
+	if limit <= 0 || limit > maxConversationsLimit {
+		return nil, fmt.Errorf("limit must be between 1 and %d", maxConversationsLimit)
+	}
+	conversations, err := getConversations(viewer.Tenant, viewer.UserID, limit)
+	if err != nil {
+		slog.Error("Error fetching conversations", "err", err)
+		return nil, errors.New("internal server error")
+	}
+	result := make([]map[string]any, len(conversations))
+	for i, conv := range conversations {
+		result[i] = map[string]any{
+			"peerId":      conv.PeerID,
+			"unreadCount": conv.UnreadCount,
+			"lastMessage": map[string]any{
+				"id":        strconv.FormatInt(conv.LastMessage.ID, 10),
+				"senderId":  conv.LastMessage.SenderID,
+				"text":      conv.LastMessage.Text,
+				"createdAt": conv.LastMessage.CreatedAt,
+			},
+		}
+	}
+	return result, nil
+}
+
+// ติดตาม admin feed เฉพาะข้อความที่ผู้ใช้เป็นผู้รับ จบเมื่อ context ของ operation ถูกยกเลิก
+func subscribeMessageReceived(p graphql.ResolveParams) (any, error) {
+	viewer := viewerOf(p.Context)
+	sub := &feedSubscriber{
+		tenant:     viewer.Tenant,
+		userFilter: viewer.UserID,
+		events:     make(chan []byte, adminFeedBuffer),
+	}
+	feedSubscribers.Store(sub, struct{}{})
+
+	out := make(chan any)
+	go func() {
+		defer close(out)
+		defer feedSubscribers.Delete(sub)
+		for {
+			select {
+			case payload := <-sub.events:
+				var ev FeedEvent
+				if err := json.Unmarshal(payload, &ev); err != nil {
+					slog.Error("decoding feed event", "err", err)
+					continue
+				}
+				if ev.Message.ReceiverID != viewer.UserID {
+					continue
+				}
+				select {
+				case out <- graphqlMessage(ev.Message):
+				case <-p.Context.Done():
+					return
+				}
+			case <-p.Context.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// ข้อความในรูปที่ default resolver ของ graphql-go อ่านได้ (ชื่อ field แบบ camelCase)
+func graphqlMessage(msg Message) map[string]any {
+	m := map[string]any{
+		"id":          strconv.FormatInt(msg.ID, 10),
+		"senderId":    msg.SenderID,
+		"text":        msg.Text,
+		"isRead":      msg.IsRead,
+		"isDelivered": msg.IsDelivered,
+		"createdAt":   msg.CreatedAt,
+		"mentions":    msg.Mentions,
+		"mentioned":   msg.Mentioned,
+		"forwarded":   msg.Forwarded,
+		"deleted":     msg.Deleted,
+	}
+	optional := map[string]string{
+		"receiverId":   msg.ReceiverID,
+		"state":        msg.State,
+		"clientMsgId":  msg.ClientMsgID,
+		"metadata":     string(msg.Metadata),
+		"attachmentId": msg.AttachmentID,
+	}
+	for key, value := range optional {
+		if value != "" {
+			m[key] = value
+		}
+	}
+	if msg.RoomID != 0 {
+		m["roomId"] = strconv.FormatInt(msg.RoomID, 10)
+	}
+	if msg.ReplyToID != 0 {
+		m["replyToId"] = strconv.FormatInt(msg.ReplyToID, 10)
+	}
+	return m
+}
+
+// middleware หาผู้ใช้ของ request (ต่อจาก requireJWT) แล้วเก็บไว้ใน Locals
+func withGraphQLUser(c *fiber.Ctx) error {
+	userID, err := RequestUser(c)
+	if err != nil {
+		return err
+	}
+	c.Locals(localsGraphQLUser, userID)
+	return c.Next()
+}
+
+// body ของ POST /graphql และ payload ของ subscribe
+type graphqlRequest struct {
+	Query         string         `json:"query"`
+	Variables     map[string]any `json:"variables"`
+	OperationName string         `json:"operationName"`
+}
+
+// POST /graphql (subscription ต้องใช้ WebSocket)
+func handleGraphQL(c *fiber.Ctx) error {
+	var req graphqlRequest
+	if err := c.BodyParser(&req); err != nil || req.Query == "" {
+		return InvalidRequest("query is required")
+	}
+	if graphqlOperation(req) == ast.OperationTypeSubscription {
+		return InvalidRequest("Subscriptions require a WebSocket connection")
+	}
+	viewer := graphqlViewer{Tenant: TenantOf(c), UserID: c.Locals(localsGraphQLUser).(string)}
+	return c.JSON(graphql.Do(graphql.Params{
+		Schema:         graphqlSchema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        context.WithValue(c.UserContext(), graphqlViewerKey{}, viewer),
+	}))
+}
+
+// ชนิดของ operation ที่จะรัน (query/mutation/subscription) ค่าว่าง = parse ไม่ได้หรือไม่พบ
+// graphql.Do ตรวจ error ของ document เองอีกรอบ
+func graphqlOperation(req graphqlRequest) string {
+	doc, err := parser.Parse(parser.ParseParams{Source: req.Query})
+	if err != nil {
+		return ""
+	}
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if req.OperationName == "" || (op.Name != nil && op.Name.Value == req.OperationName) {
+			return op.Operation
+		}
+	}
+	return ""
+}
+
+// frame ของ graphql-transport-ws
+type graphqlWSMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// connection GraphQL หนึ่ง connection: operation ที่ทำงานอยู่แยกตาม id ที่ client กำหนด
+type graphqlConn struct {
+	conn   *websocket.Conn
+	viewer graphqlViewer
+
+	writeMu sync.Mutex
+
+	mu         sync.Mutex
+	operations map[string]context.CancelFunc
+}
+
+func (gc *graphqlConn) write(msg graphqlWSMessage) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	gc.writeMu.Lock()
+	defer gc.writeMu.Unlock()
+	return writeFrame(gc.conn, websocket.TextMessage, payload)
+}
+
+func (gc *graphqlConn) close(code int, reason string) {
+	gc.writeMu.Lock()
+	gc.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	gc.writeMu.Unlock()
+}
+
+// WebSocket /graphql: รอ connection_init ภายใน HelloTimeout แล้วรับ subscribe/complete/ping จนกว่า client จะปิด
+func handleGraphQLWebSocket(c *websocket.Conn) {
+	tenant, _ := c.Locals(LocalsTenant).(string)
+	userID, _ := c.Locals(localsGraphQLUser).(string)
+	gc := &graphqlConn{conn: c, viewer: graphqlViewer{Tenant: tenant, UserID: userID}, operations: make(map[string]context.CancelFunc)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		c.Close()
+	}()
+
+	if config.MaxMessageBytes > 0 {
+		c.SetReadLimit(config.MaxMessageBytes)
+	}
+	c.SetReadDeadline(time.Now().Add(config.HelloTimeout))
+	acknowledged := false
+	for {
+		_, data, err := c.ReadMessage()
+		if err != nil {
+			var netErr net.Error
+			if !acknowledged && errors.As(err, &netErr) && netErr.Timeout() {
+				gc.close(graphqlCloseInitTimeout, "Connection initialisation timeout")
+			}
+			return
+		}
+		var msg graphqlWSMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			gc.close(graphqlCloseBadRequest, "Invalid message")
+			return
+		}
+		switch msg.Type {
+		case "connection_init":
+			if acknowledged {
+				gc.close(graphqlCloseTooManyInits, "Too many initialisation requests")
+				return
+			}
+			acknowledged = true
+			c.SetReadDeadline(time.Time{})
+			if err := gc.write(graphqlWSMessage{Type: "connection_ack"}); err != nil {
+				return
+			}
+		case "ping":
+			if err := gc.write(graphqlWSMessage{Type: "pong"}); err != nil {
+				return
+			}
+		case "pong":
+		case "subscribe":
+			if !acknowledged {
+				gc.close(graphqlCloseUnauthorized, "Unauthorized")
+				return
+			}
+			var req graphqlRequest
+			if msg.ID == "" || json.Unmarshal(msg.Payload, &req) != nil || req.Query == "" {
+				gc.close(graphqlCloseBadRequest, "Invalid subscribe message")
+				return
+			}
+			if !gc.start(ctx, msg.ID, req) {
+				return
+			}
+		case "complete":
+			gc.stop(msg.ID)
+		default:
+			gc.close(graphqlCloseBadRequest, "Unknown message type "+strconv.Quote(msg.Type))
+			return
+		}
+	}
+}
+
+// เริ่ม operation ใน goroutine ของตัวเอง คืนค่า false ถ้าปิด connection ไปแล้ว
+func (gc *graphqlConn) start(parent context.Context, id string, req graphqlRequest) bool {
+	gc.mu.Lock()
+	if _, exists := gc.operations[id]; exists {
+		gc.mu.Unlock()
+		gc.close(graphqlCloseDuplicateID, "Subscriber for "+id+" already exists")
+		return false
+	}
+	if len(gc.operations) >= graphqlMaxOperationsPerWS {
+		gc.mu.Unlock()
+		payload, _ := json.Marshal([]map[string]string{{"message": "too many active operations"}})
+		gc.write(graphqlWSMessage{ID: id, Type: "error", Payload: payload})
+		return true
+	}
+	ctx, cancel := context.WithCancel(context.WithValue(parent, graphqlViewerKey{}, gc.viewer))
+	gc.operations[id] = cancel
+	gc.mu.Unlock()
+
+	go func() {
+		defer gc.stop(id)
+		params := graphql.Params{
+			Schema:         graphqlSchema,
+			RequestString:  req.Query,
+			VariableValues: req.Variables,
+			OperationName:  req.OperationName,
+			Context:        ctx,
+		}
+		if graphqlOperation(req) != ast.OperationTypeSubscription {
+			gc.send(ctx, id, graphql.Do(params))
+		} else {
+			// อ่านจนกว่า channel จะปิด ไม่งั้น goroutine ของ graphql-go จะค้างตอนส่งผล
+			for result := range graphql.Subscribe(params) {
+				gc.send(ctx, id, result)
+			}
+		}
+		if ctx.Err() == nil {
+			gc.write(graphqlWSMessage{ID: id, Type: "complete"})
+		}
+	}()
+	return true
+}
+
+// ส่งผลของ operation (ยกเลิกไปแล้ว = ไม่ส่ง)
+func (gc *graphqlConn) send(ctx context.Context, id string, result *graphql.Result) {
+	if ctx.Err() != nil {
+		return
+	}
+	payload, err := json.Marshal(result)
+	if err != nil {
+		slog.Error("marshalling graphql result", "err", err)
+		return
+	}
+	if err := gc.write(graphqlWSMessage{ID: id, Type: "next", Payload: payload}); err != nil {
+		slog.Debug("writing graphql result", "err", err)
+	}
+}
+
+func (gc *graphqlConn) stop(id string) {
+	gc.mu.Lock()
+	cancel, ok := gc.operations[id]
+	delete(gc.operations, id)
+	gc.mu.Unlock()
+	if ok {
+		cancel()
+	}
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	fws "github.com/fasthttp/websocket"
+)
+
+func postGraphQL(t *testing.T, userID string, req graphqlRequest) (int, map[string]any) {
+	t.Helper()
+	body, _ := json.Marshal(req)
+	resp, err := http.Post("http://"+testAddr+"/graphql?user_id="+userID, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	defer resp.Body.Close()
+	var out map[string]any
+	json.NewDecoder(resp.Body).Decode(&out)
+	return resp.StatusCode, out
+}
+
+func TestGraphQLHistoryAndConversations(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	saveMessageToDB(Message{SenderID: bob, ReceiverID: alice, Text: "first"})
+	saveMessageToDB(Message{SenderID: bob, ReceiverID: alice, Text: "second"})
+
+	status, out := postGraphQL(t, alice, graphqlRequest{
+		Query:     `query($peer: String!) { history(peer: $peer, limit: 1) { messages { id senderId text isRead } nextCursor } conversations { peerId unreadCount lastMessage { text } } }`,
+		Variables: map[string]any{"peer": bob},
+	})
+	if status != http.StatusOK || out["errors"] != nil {
+		t.Fatalf("unexpected response %d: %v", status, out)
+	}
+	data := out["data"].(map[string]any)
+	history := data["history"].(map[string]any)
+	messages := history["messages"].([]any)
+	if len(messages) != 1 || messages[0].(map[string]any)["text"] != "second" || history["nextCursor"] == nil {
+		t.Fatalf("unexpected history: %v", history)
+	}
+	convs := data["conversations"].([]any)
+	conv := convs[0].(map[string]any)
+	if len(convs) != 1 || conv["peerId"] != bob || conv["unreadCount"] != float64(2) || conv["lastMessage"].(map[string]any)["text"] != "second" {
+		t.Fatalf("unexpected conversations: %v", convs)
+	}
+
+	// limit เกินขอบเขตได้ error ของ GraphQL ไม่ใช่ HTTP error
+	_, out = postGraphQL(t, alice, graphqlRequest{Query: `{ history(peer: "x", limit: 1000) { nextCursor } }`})
+	if out["errors"] == nil {
+		t.Fatalf("expected limit error, got %v", out)
+	}
+
+	if status, _ := postGraphQL(t, alice, graphqlRequest{Query: `subscription { messageReceived { id } }`}); status != http.StatusBadRequest {
+		t.Fatalf("expected 400 for subscription over POST, got %d", status)
+	}
+}
+
+func dialGraphQL(t *testing.T, userID string) *fws.Conn {
+	t.Helper()
+	dialer := fws.Dialer{Subprotocols: []string{graphqlWSProtocol}}
+	conn, resp, err := dialer.Dial("ws://"+testAddr+"/graphql?user_id="+userID, nil)
+	if err != nil {
+		t.Fatalf("dial graphql: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if resp.Header.Get("Sec-WebSocket-Protocol") != graphqlWSProtocol {
+		t.Fatalf("expected %s subprotocol, got %q", graphqlWSProtocol, resp.Header.Get("Sec-WebSocket-Protocol"))
+	}
+	return conn
+}
+
+func TestGraphQLMessageReceivedSubscription(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	conn := dialGraphQL(t, bob)
+
+	conn.WriteJSON(graphqlWSMessage{Type: "connection_init"})
+	var msg graphqlWSMessage
+	readJSON(t, conn, &msg)
+	if msg.Type != "connection_ack" {
+		t.Fatalf("expected connection_ack, got %+v", msg)
+	}
+	conn.WriteJSON(graphqlWSMessage{Type: "ping"})
+	readJSON(t, conn, &msg)
+	if msg.Type != "pong" {
+		t.Fatalf("expected pong, got %+v", msg)
+	}
+
+	payload, _ := json.Marshal(graphqlRequest{Query: `subscription { messageReceived { id senderId text } }`})
+	conn.WriteJSON(graphqlWSMessage{ID: "1", Type: "subscribe", Payload: payload})
+	waitFor(t, func() bool {
+		found := false
+		feedSubscribers.Range(func(key, _ any) bool {
+			found = key.(*feedSubscriber).userFilter == bob
+			return !found
+		})
+		return found
+	})
+
+	// ข้อความที่ bob เป็นผู้ส่งไม่ใช่ messageReceived
+	dispatchMessage(Message{SenderID: bob, ReceiverID: alice, Text: "outgoing"})
+	dispatchMessage(Message{SenderID: alice, ReceiverID: bob, Text: "hello bob"})
+
+	readJSON(t, conn, &msg)
+	var result struct {
+		Data struct {
+			MessageReceived struct {
+				ID       string `json:"id"`
+				SenderID string `json:"senderId"`
+				Text     string `json:"text"`
+			} `json:"messageReceived"`
+		} `json:"data"`
+	}
+	json.Unmarshal(msg.Payload, &result)
+	if msg.Type != "next" || msg.ID != "1" || result.Data.MessageReceived.Text != "hello bob" || result.Data.MessageReceived.SenderID != alice {
+		t.Fatalf("unexpected event: %+v %s", msg, msg.Payload)
+	}
+
+	// complete จาก client = หยุด subscription และเลิกติดตาม feed
+	conn.WriteJSON(graphqlWSMessage{ID: "1", Type: "complete"})
+	waitFor(t, func() bool {
+		found := false
+		feedSubscribers.Range(func(key, _ any) bool {
+			found = key.(*feedSubscriber).userFilter == bob
+			return !found
+		})
+		return !found
+	})
+
+	// query ผ่าน WebSocket ได้ next หนึ่งครั้งตามด้วย complete
+	payload, _ = json.Marshal(graphqlRequest{Query: `{ conversations { peerId } }`})
+	conn.WriteJSON(graphqlWSMessage{ID: "2", Type: "subscribe", Payload: payload})
+	readJSON(t, conn, &msg)
+	if msg.Type != "next" || msg.ID != "2" {
+		t.Fatalf("expected next for query, got %+v", msg)
+	}
+	readJSON(t, conn, &msg)
+	if msg.Type != "complete" || msg.ID != "2" {
+		t.Fatalf("expected complete for query, got %+v", msg)
+	}
+}
+
+func TestGraphQLRequiresConnectionInit(t *testing.T) {
+	prev := config.HelloTimeout
+	config.HelloTimeout = 50 * time.Millisecond
+	defer func() { config.HelloTimeout = prev }()
+
+	conn := dialGraphQL(t, newTestUser("bob"))
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := conn.ReadMessage()
+	if !fws.IsCloseError(err, graphqlCloseInitTimeout) {
+		t.Fatalf("expected close %d, got %v", graphqlCloseInitTimeout, err)
+	}
+
+	// subscribe ก่อน connection_init
+	config.HelloTimeout = prev
+	conn = dialGraphQL(t, newTestUser("bob"))
+	payload, _ := json.Marshal(graphqlRequest{Query: `subscription { messageReceived { id } }`})
+	conn.WriteJSON(graphqlWSMessage{ID: "1", Type: "subscribe", Payload: payload})
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err = conn.ReadMessage()
+	if !fws.IsCloseError(err, graphqlCloseUnauthorized) {
+		t.Fatalf("expected close %d, got %v", graphqlCloseUnauthorized, err)
+	}
+}
@@ -0,0 +1,315 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"go-socket/chatpb"
+)
+
+// gRPC ChatService (chatpb/chat.proto) ให้ backend อื่นส่งข้อความ ติดตามข้อความ และอ่านประวัติโดยไม่ต้องใช้ WebSocket
+// listen แยกบน CHAT_GRPC_ADDR ใช้ admin token เดียวกับ /admin และระบุ tenant ผ่าน metadata x-tenant-id
+
+// metadata ที่ระบุ tenant ของ call (ชื่อเดียวกับ header ของ REST)
+var grpcTenantMetadata = strings.ToLower(HeaderTenantID)
+
+var (
+	grpcServer *grpc.Server // nil = ไม่ได้เปิด
+	// ปิดเมื่อเริ่มปิด server ให้ StreamMessages จบ ไม่งั้น GracefulStop จะรอ stream ตลอดไป
+	grpcDraining = make(chan struct{})
+)
+
+type grpcTenantKey struct{}
+
+// สร้าง server พร้อม interceptor ตรวจ token (ใช้ TLS จาก CHAT_TLS_CERT_FILE ถ้าตั้งไว้ autocert ใช้กับ gRPC ไม่ได้)
+func newGRPCServer() (*grpc.Server, error) {
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(grpcUnaryAuth),
+		grpc.StreamInterceptor(grpcStreamAuth),
+	}
+	if config.TLSCertFile != "" {
+		creds, err := credentials.NewServerTLSFromFile(config.TLSCertFile, config.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading TLS certificate: %w", err)
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+	srv := grpc.NewServer(opts...)
+	chatpb.RegisterChatServiceServer(srv, chatService{})
+	return srv, nil
+}
+
+// เปิด gRPC server ตาม config (CHAT_GRPC_ADDR ว่าง = ไม่เปิด)
+func startGRPCServer() error {
+	if config.GRPCAddr == "" {
+		return nil
+	}
+	srv, err := newGRPCServer()
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", config.GRPCAddr)
+	if err != nil {
+		return err
+	}
+	grpcServer = srv
+	go func() {
+		if err := srv.Serve(ln); err != nil {
+			slog.Error("gRPC server", "addr", config.GRPCAddr, "err", err)
+		}
+	}()
+	slog.Info("serving gRPC", "addr", ln.Addr().String(), "tls", config.TLSCertFile != "")
+	return nil
+}
+
+// จบ stream ทั้งหมดแล้วรอ call ที่ค้างอยู่ เกิน deadline จะตัดทันที
+func stopGRPCServer(deadline time.Time) {
+	if grpcServer == nil {
+		return
+	}
+	close(grpcDraining)
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Until(deadline)):
+		slog.Warn("gRPC calls still running after shutdown timeout")
+		grpcServer.Stop()
+	}
+}
+
+// ตรวจ admin token และ tenant จาก metadata คืน context ที่มี tenant ของ call
+func grpcAuthenticate(ctx context.Context) (context.Context, error) {
+	if shuttingDown.Load() {
+		return nil, status.Error(codes.Unavailable, "server is shutting down")
+	}
+	if config.AdminToken == "" {
+		return nil, status.Error(codes.PermissionDenied, "admin API disabled")
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	token := strings.TrimPrefix(firstMetadata(md, "authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(config.AdminToken)) != 1 {
+		return nil, status.Error(codes.Unauthenticated, "invalid admin token")
+	}
+	tenant := DefaultTenant
+	if t := firstMetadata(md, grpcTenantMetadata); t != "" {
+		tenant = strings.ToLower(t)
+	}
+	if !ValidTenant(tenant) {
+		return nil, status.Error(codes.InvalidArgument, "invalid tenant")
+	}
+	return context.WithValue(ctx, grpcTenantKey{}, tenant), nil
+}
+
+func firstMetadata(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func grpcTenant(ctx context.Context) string {
+	if t, ok := ctx.Value(grpcTenantKey{}).(string); ok {
+		return t
+	}
+	return DefaultTenant
+}
+
+func grpcUnaryAuth(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := grpcAuthenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func grpcStreamAuth(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := grpcAuthenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, tenantServerStream{ServerStream: ss, ctx: ctx})
+}
+
+// ServerStream ที่ context มี tenant ของ call
+type tenantServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s tenantServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// แปลง Error เป็น status ของ gRPC ตาม HTTP status
+func grpcError(err error) error {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		return status.Error(codes.Internal, "internal server error")
+	}
+	code := codes.Internal
+	switch apiErr.Status {
+	case fiber.StatusBadRequest:
+		code = codes.InvalidArgument
+	case fiber.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case fiber.StatusForbidden:
+		code = codes.PermissionDenied
+	case fiber.StatusNotFound:
+		code = codes.NotFound
+	case fiber.StatusTooManyRequests:
+		code = codes.ResourceExhausted
+	case fiber.StatusServiceUnavailable:
+		code = codes.Unavailable
+	}
+	return status.Error(code, apiErr.Message)
+}
+
+type chatService struct {
+	chatpb.UnimplementedChatServiceServer
+}
+
+func (chatService) SendMessage(ctx context.Context, req *chatpb.SendMessageRequest) (*chatpb.SendMessageResponse, error) {
+	if req.GetMessage() == nil {
+		return nil, status.Error(codes.InvalidArgument, "message is required")
+	}
+	msg := messageFromProto(req.GetMessage())
+	msg.TenantID = grpcTenant(ctx)
+	if err := validateOutgoing(&msg); err != nil {
+		return nil, grpcError(err)
+	}
+	if ok, resetsAt := consumeQuota(msg.TenantID, msg.SenderID, 1, time.Now()); !ok {
+		return nil, grpcError(errQuotaExceeded(resetsAt))
+	}
+
+	result, err := dispatchMessage(msg)
+	if err != nil && !result.Delivered {
+		return nil, status.Error(codes.Internal, "failed to store message")
+	}
+	return &chatpb.SendMessageResponse{
+		Id:          result.Message.ID,
+		Delivered:   result.Delivered,
+		Duplicate:   result.Duplicate,
+		ClientMsgId: result.Message.ClientMsgID,
+		CreatedAt:   timestamppb.New(result.Message.CreatedAt),
+	}, nil
+}
+
+// ใช้ admin feed เดียวกับ /ws/admin/feed ถ้า client อ่านไม่ทัน event จะถูกทิ้งเหมือนกัน
+func (chatService) StreamMessages(req *chatpb.StreamMessagesRequest, stream chatpb.ChatService_StreamMessagesServer) error {
+	ctx := stream.Context()
+	sub := &feedSubscriber{
+		tenant:     grpcTenant(ctx),
+		userFilter: req.GetUserId(),
+		events:     make(chan []byte, adminFeedBuffer),
+	}
+	feedSubscribers.Store(sub, struct{}{})
+	defer feedSubscribers.Delete(sub)
+
+	for {
+		select {
+		case payload := <-sub.events:
+			var ev FeedEvent
+			if err := json.Unmarshal(payload, &ev); err != nil {
+				slog.Error("decoding feed event", "err", err)
+				continue
+			}
+			if err := stream.Send(&chatpb.MessageEvent{Status: ev.Status, Message: messageToProto(ev.Message)}); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		case <-grpcDraining:
+			return status.Error(codes.Unavailable, "server is shutting down")
+		}
+	}
+}
+
+func (chatService) GetHistory(ctx context.Context, req *chatpb.GetHistoryRequest) (*chatpb.GetHistoryResponse, error) {
+	if req.GetUserId() == "" || req.GetPeerId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id and peer_id are required")
+	}
+	limit := int(req.GetLimit())
+	if limit == 0 {
+		limit = defaultHistoryPageSize
+	}
+	if limit < 0 || limit > maxHistoryPageSize {
+		return nil, status.Errorf(codes.InvalidArgument, "limit must be between 1 and %d", maxHistoryPageSize)
+	}
+	var before historyCursor
+	if req.GetBefore() != "" {
+		var err error
+		if before, err = decodeHistoryCursor(req.GetBefore()); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid cursor")
+		}
+	}
+
+	page, err := historyPage(grpcTenant(ctx), req.GetUserId(), req.GetPeerId(), before, limit)
+	if err != nil {
+		return nil, grpcError(Internal("Error fetching message history", err))
+	}
+	resp := &chatpb.GetHistoryResponse{NextCursor: page.NextCursor}
+	for _, msg := range page.Messages {
+		resp.Messages = append(resp.Messages, messageToProto(msg))
+	}
+	return resp, nil
+}
+
+// เฉพาะ field ที่ผู้ส่งกำหนดได้ ส่วนที่เหลือ server เติมให้เหมือน POST /send
+func messageFromProto(m *chatpb.Message) Message {
+	msg := Message{
+		SenderID:     m.GetSenderId(),
+		ReceiverID:   m.GetReceiverId(),
+		RoomID:       m.GetRoomId(),
+		Text:         m.GetText(),
+		ClientMsgID:  m.GetClientMsgId(),
+		Priority:     m.GetPriority(),
+		Mentions:     m.GetMentions(),
+		ReplyToID:    m.GetReplyToId(),
+		AttachmentID: m.GetAttachmentId(),
+	}
+	if m.GetMetadata() != "" {
+		msg.Metadata = json.RawMessage(m.GetMetadata())
+	}
+	return msg
+}
+
+func messageToProto(msg Message) *chatpb.Message {
+	return &chatpb.Message{
+		Id:           msg.ID,
+		SenderId:     msg.SenderID,
+		ReceiverId:   msg.ReceiverID,
+		RoomId:       msg.RoomID,
+		Text:         msg.Text,
+		IsRead:       msg.IsRead,
+		IsDelivered:  msg.IsDelivered,
+		CreatedAt:    timestamppb.New(msg.CreatedAt),
+		ClientMsgId:  msg.ClientMsgID,
+		Priority:     msg.Priority,
+		Mentions:     msg.Mentions,
+		Metadata:     string(msg.Metadata),
+		ReplyToId:    msg.ReplyToID,
+		AttachmentId: msg.AttachmentID,
+		State:        msg.State,
+		Forwarded:    msg.Forwarded,
+		Deleted:      msg.Deleted,
+	}
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"go-socket/chatpb"
+)
+
+// เปิด gRPC server บน port ว่าง คืน client ของ ChatService
+func startTestGRPC(t *testing.T) chatpb.ChatServiceClient {
+	t.Helper()
+	prevToken := config.AdminToken
+	config.AdminToken = "admin-secret"
+	t.Cleanup(func() { config.AdminToken = prevToken })
+
+	srv, err := newGRPCServer()
+	if err != nil {
+		t.Fatalf("newGRPCServer: %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go srv.Serve(ln)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient(ln.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return chatpb.NewChatServiceClient(conn)
+}
+
+func grpcContext(t *testing.T, tenant string) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	t.Cleanup(cancel)
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer admin-secret")
+	if tenant != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-tenant-id", tenant)
+	}
+	return ctx
+}
+
+func TestGRPCRequiresAdminToken(t *testing.T) {
+	svc := startTestGRPC(t)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer wrong")
+	_, err := svc.GetHistory(ctx, &chatpb.GetHistoryRequest{UserId: "a", PeerId: "b"})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected Unauthenticated, got %v", err)
+	}
+}
+
+func TestGRPCSendMessageDeliversAndStreams(t *testing.T) {
+	svc := startTestGRPC(t)
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	bobConn := dialWS(t, bob)
+
+	stream, err := svc.StreamMessages(grpcContext(t, ""), &chatpb.StreamMessagesRequest{UserId: bob})
+	if err != nil {
+		t.Fatalf("StreamMessages: %v", err)
+	}
+	// รอให้ stream ลงทะเบียนกับ feed ก่อนส่ง
+	waitFor(t, func() bool {
+		found := false
+		feedSubscribers.Range(func(key, _ any) bool {
+			found = key.(*feedSubscriber).userFilter == bob
+			return !found
+		})
+		return found
+	})
+
+	resp, err := svc.SendMessage(grpcContext(t, ""), &chatpb.SendMessageRequest{Message: &chatpb.Message{
+		SenderId: alice, ReceiverId: bob, Text: "from backend", ClientMsgId: "svc-1", Metadata: `{"source":"billing"}`,
+	}})
+	if err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	if !resp.Delivered || resp.Id == 0 || resp.ClientMsgId != "svc-1" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	var got Message
+	readJSON(t, bobConn, &got)
+	if got.ID != resp.Id || got.Text != "from backend" || string(got.Metadata) != `{"source":"billing"}` {
+		t.Fatalf("unexpected message: %+v", got)
+	}
+
+	ev, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+	if ev.Status != feedStatusDelivered || ev.Message.GetId() != resp.Id || ev.Message.GetSenderId() != alice {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+
+	// ส่งซ้ำด้วย client_msg_id เดิม
+	resp, err = svc.SendMessage(grpcContext(t, ""), &chatpb.SendMessageRequest{Message: &chatpb.Message{
+		SenderId: alice, ReceiverId: bob, Text: "from backend", ClientMsgId: "svc-1",
+	}})
+	if err != nil || !resp.Duplicate {
+		t.Fatalf("expected duplicate, got %+v %v", resp, err)
+	}
+}
+
+func TestGRPCSendMessageRejectsInvalid(t *testing.T) {
+	svc := startTestGRPC(t)
+	_, err := svc.SendMessage(grpcContext(t, ""), &chatpb.SendMessageRequest{Message: &chatpb.Message{SenderId: newTestUser("alice")}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+	_, err = svc.SendMessage(grpcContext(t, ""), &chatpb.SendMessageRequest{})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for empty request, got %v", err)
+	}
+}
+
+func TestGRPCGetHistoryPagesWithinTenant(t *testing.T) {
+	svc := startTestGRPC(t)
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	for _, text := range []string{"one", "two", "three"} {
+		saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: text})
+	}
+
+	page, err := svc.GetHistory(grpcContext(t, ""), &chatpb.GetHistoryRequest{UserId: alice, PeerId: bob, Limit: 2})
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if len(page.Messages) != 2 || page.Messages[0].Text != "three" || page.NextCursor == "" {
+		t.Fatalf("unexpected first page: %+v", page)
+	}
+	page, err = svc.GetHistory(grpcContext(t, ""), &chatpb.GetHistoryRequest{UserId: alice, PeerId: bob, Limit: 2, Before: page.NextCursor})
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if len(page.Messages) != 1 || page.Messages[0].Text != "one" || page.NextCursor != "" {
+		t.Fatalf("unexpected second page: %+v", page)
+	}
+
+	// tenant อื่นไม่เห็นข้อความของ tenant public
+	page, err = svc.GetHistory(grpcContext(t, "acme"), &chatpb.GetHistoryRequest{UserId: alice, PeerId: bob})
+	if err != nil || len(page.Messages) != 0 {
+		t.Fatalf("expected empty history in other tenant, got %+v %v", page, err)
+	}
+
+	if _, err := svc.GetHistory(grpcContext(t, ""), &chatpb.GetHistoryRequest{UserId: alice}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument without peer_id, got %v", err)
+	}
+}
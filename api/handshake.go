@@ -0,0 +1,101 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+
+	"go-socket/protocol"
+)
+
+// handshake ของ /ws/chat: ผู้ใช้ไม่อยู่ใน URL (ไม่รั่วไปกับ log ของ proxy) client ต้องส่ง hello frame
+// ที่มี token ภายใน HelloTimeout หลัง upgrade ก่อนส่ง frame อื่นได้ server ตอบ welcome เมื่อผ่าน
+//
+//	v1/v2: {"type":"hello","token":"...","client_version":"web/1.4.0","device_id":"..."}
+//	v3:    {"type":"hello","id":"...","ts":...,"payload":{"token":"...",...}}
+
+type Hello = protocol.Hello
+
+type Welcome = protocol.Welcome
+
+var (
+	errHelloTimeout = errors.New("no hello frame received in time")
+	errHelloInvalid = errors.New("first frame must be a hello with a valid token")
+)
+
+// GET /ws/chat
+func handleHandshakeWebSocket(c *websocket.Conn) {
+	tenant, _ := c.Locals(LocalsTenant).(string)
+	hello, userID, err := readHello(c, tenant, time.Now())
+	if err != nil {
+		slog.Info("handshake rejected", "tenant", tenant, "remote_ip", c.IP(), "err", err)
+		code := closeHandshakeFailed
+		if errors.Is(err, errHelloTimeout) {
+			code = closeHandshakeTimeout
+		}
+		closeWithReason(c, code, err.Error())
+		return
+	}
+	ServeClient(c, tenant, userID, hello.DeviceID, &hello)
+}
+
+// รอ hello frame แรกแล้วตรวจ token คืนค่า hello และผู้ใช้เจ้าของ token
+func readHello(c *websocket.Conn, tenant string, now time.Time) (Hello, string, error) {
+	if config.MaxMessageBytes > 0 {
+		c.SetReadLimit(config.MaxMessageBytes)
+	}
+	c.SetReadDeadline(now.Add(config.HelloTimeout))
+	_, data, err := c.ReadMessage()
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return Hello{}, "", errHelloTimeout
+		}
+		return Hello{}, "", err
+	}
+	c.SetReadDeadline(time.Time{})
+
+	// decode ตาม codec/เวอร์ชันเดียวกับที่ connection จะใช้ต่อ
+	probe := &client{codec: negotiateCodec(c.Query("codec"), c.Subprotocol()), protocolVersion: negotiateProtocolVersion(c.Subprotocol())}
+	frameType, payload, err := probe.decodeFrame(data)
+	if err != nil || frameType != "hello" {
+		return Hello{}, "", errHelloInvalid
+	}
+	var hello Hello
+	if err := probe.codec.Unmarshal(payload, &hello); err != nil || hello.Token == "" {
+		return Hello{}, "", errHelloInvalid
+	}
+
+	userID, err := authenticateHello(tenant, hello.Token, now)
+	if err != nil {
+		return Hello{}, "", err
+	}
+	return hello, userID, nil
+}
+
+// ผู้ใช้ของ token ใน hello: JWT จาก POST /auth/token หรือ connect token (ใช้ได้ครั้งเดียว) จาก POST /auth/ws-token
+func authenticateHello(tenant, token string, now time.Time) (string, error) {
+	if claims, err := parseJWT(token, now); err == nil {
+		if claims.Tenant != tenant {
+			return "", errHelloInvalid
+		}
+		return claims.Subject, nil
+	}
+	tokenTenant, userID, err := consumeWSToken(token, now)
+	if err != nil || tokenTenant != tenant {
+		return "", errHelloInvalid
+	}
+	return userID, nil
+}
+
+// middleware ของ /ws/chat/:id: ปิดการระบุผู้ใช้ใน path เมื่อเปิด RequireHandshake (bot ยังใช้ API key ได้)
+func checkPathIdentity(c *fiber.Ctx) error {
+	if config.RequireHandshake && !isBot(c) {
+		return InvalidRequest("Connect to /ws/chat and authenticate with a hello frame")
+	}
+	return c.Next()
+}
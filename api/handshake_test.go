@@ -0,0 +1,113 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	fws "github.com/fasthttp/websocket"
+)
+
+// เชื่อมต่อ /ws/chat (ยังไม่ส่ง hello)
+func dialHandshake(t *testing.T) *fws.Conn {
+	t.Helper()
+	conn, _, err := fws.DefaultDialer.Dial("ws://"+testAddr+"/ws/chat", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// อ่านจนกว่า server จะปิด connection คืนค่า close code
+func readCloseCode(t *testing.T, conn *fws.Conn) int {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			var closeErr *fws.CloseError
+			if !errors.As(err, &closeErr) {
+				t.Fatalf("expected close frame, got %v", err)
+			}
+			return closeErr.Code
+		}
+	}
+}
+
+func TestHelloHandshakeAuthenticatesConnection(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	token, _, err := issueJWT(DefaultTenant, alice, time.Now())
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	bobConn := dialWS(t, bob)
+
+	conn := dialHandshake(t)
+	if err := conn.WriteJSON(Hello{Type: "hello", Token: token, ClientVersion: "test/1.0", DeviceID: "laptop"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var welcome Welcome
+	readJSON(t, conn, &welcome)
+	if welcome.Type != frameTypeWelcome || welcome.UserID != alice || welcome.SessionID != "laptop" || welcome.ConnID == "" {
+		t.Fatalf("unexpected welcome: %+v", welcome)
+	}
+
+	// ผู้ส่งคือเจ้าของ token เสมอ
+	conn.WriteJSON(Message{SenderID: "someone-else", ReceiverID: bob, Text: "hi"})
+	var got Message
+	readJSON(t, bobConn, &got)
+	if got.SenderID != alice || got.Text != "hi" {
+		t.Fatalf("unexpected message: %+v", got)
+	}
+
+	conn.WriteJSON(Hello{Type: "hello", Token: token})
+	var frame ErrorFrame
+	readJSON(t, conn, &frame)
+	if frame.Code != errCodeInvalidRequest {
+		t.Fatalf("expected error for second hello, got %+v", frame)
+	}
+}
+
+func TestHandshakeRejectsMissingOrBadHello(t *testing.T) {
+	prev := config.HelloTimeout
+	config.HelloTimeout = 200 * time.Millisecond
+	defer func() { config.HelloTimeout = prev }()
+
+	if code := readCloseCode(t, dialHandshake(t)); code != closeHandshakeTimeout {
+		t.Fatalf("expected close %d without hello, got %d", closeHandshakeTimeout, code)
+	}
+
+	conn := dialHandshake(t)
+	conn.WriteJSON(Hello{Type: "hello", Token: "not-a-token"})
+	if code := readCloseCode(t, conn); code != closeHandshakeFailed {
+		t.Fatalf("expected close %d for bad token, got %d", closeHandshakeFailed, code)
+	}
+
+	conn = dialHandshake(t)
+	conn.WriteJSON(Message{SenderID: "alice", ReceiverID: "bob", Text: "no hello"})
+	if code := readCloseCode(t, conn); code != closeHandshakeFailed {
+		t.Fatalf("expected close %d for non-hello frame, got %d", closeHandshakeFailed, code)
+	}
+}
+
+func TestRequireHandshakeDisablesPathIdentity(t *testing.T) {
+	config.RequireHandshake = true
+	defer func() { config.RequireHandshake = false }()
+
+	_, resp, err := fws.DefaultDialer.Dial("ws://"+testAddr+"/ws/chat/"+newTestUser("alice"), nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for /ws/chat/:id, got %v", err)
+	}
+
+	// connect token ใช้ใน hello ได้เช่นกัน
+	bob := newTestUser("bob")
+	token, _ := issueWSToken(DefaultTenant, bob, time.Now())
+	conn := dialHandshake(t)
+	conn.WriteJSON(Hello{Type: "hello", Token: token})
+	var welcome Welcome
+	readJSON(t, conn, &welcome)
+	if welcome.UserID != bob {
+		t.Fatalf("unexpected welcome: %+v", welcome)
+	}
+}
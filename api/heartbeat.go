@@ -0,0 +1,73 @@
+package api
+
+import (
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+)
+
+// เวลาสูงสุดที่การเขียน ping หนึ่งครั้งจะค้างได้ (connection ที่ตายแล้วไม่ควรทำให้ reaper ช้า)
+const pingWriteWait = time.Second
+
+// เปิด goroutine ส่ง ping ทุก HeartbeatInterval และตัด connection ที่ไม่ตอบ pong (0 = ปิดใช้งาน)
+func startHeartbeat() {
+	if config.HeartbeatInterval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(config.HeartbeatInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			sweepHeartbeats()
+		}
+	}()
+}
+
+// ตัด connection ที่ไม่ตอบ pong ติดกันครบ HeartbeatMaxMissed รอบ ที่เหลือส่ง ping รอบใหม่
+// connection ที่หลุดไปเฉยๆ (ไม่มี close frame / TCP ค้าง) จะถูกถอนออกจาก clients และ /online ภายใน
+// HeartbeatInterval * (HeartbeatMaxMissed + 1)
+func sweepHeartbeats() {
+	for _, cl := range allSessions() {
+		if cl.sse != nil {
+			continue // SSE ตอบ pong ไม่ได้ ใช้ keepalive ของ stream แทน
+		}
+		if missed := cl.missedPongs.Load(); missed >= int32(config.HeartbeatMaxMissed) {
+			cl.logger().Info("missed pongs, disconnecting", "missed", missed)
+			heartbeatTimeoutsTotal.Inc()
+			cl.reap()
+			continue
+		}
+		cl.missedPongs.Add(1)
+		if err := cl.ping(); err != nil && err != errClientClosed {
+			cl.logger().Warn("ping failed, disconnecting", "err", err)
+			cl.reap()
+		}
+	}
+}
+
+// ส่ง ping control frame (เขียนแทรก writeLoop ได้เหมือน close frame)
+func (cl *client) ping() error {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if cl.closed {
+		return errClientClosed
+	}
+	return cl.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(pingWriteWait))
+}
+
+// ปิด connection ที่ peer ไม่ตอบแล้ว: close frame อย่างเดียวไม่พอเพราะ peer จะไม่ส่ง close กลับ
+// และ conn.Close ของ connection ที่ fasthttp hijack ไว้ไม่ได้ปิด socket จริง จึงตั้ง read deadline ให้ read loop จบทันที
+func (cl *client) reap() {
+	cl.closeWith(closeHeartbeatTimeout, "heartbeat timeout")
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if !cl.closed {
+		cl.conn.SetReadDeadline(time.Now())
+	}
+}
+
+// ได้ pong ตอบกลับ = connection ยังมีชีวิต (ไม่นับเป็นการใช้งานของ idle timeout)
+func (cl *client) handlePong(string) error {
+	cl.missedPongs.Store(0)
+	return nil
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"testing"
+)
+
+func TestHeartbeatKeepsRespondingConnection(t *testing.T) {
+	alice := newTestUser("alice")
+	conn := dialWS(t, alice)
+	cl, _ := getClient(DefaultTenant, alice)
+	// client ตอบ pong ให้อัตโนมัติระหว่างที่อ่านอยู่
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < config.HeartbeatMaxMissed+1; i++ {
+		sweepHeartbeats()
+		waitFor(t, func() bool { return cl.missedPongs.Load() == 0 })
+	}
+	if reason := cl.closeReason(); reason != "" {
+		t.Fatalf("responsive connection was closed: %s", reason)
+	}
+}
+
+func TestHeartbeatReapsSilentConnection(t *testing.T) {
+	alice := newTestUser("alice")
+	dialWS(t, alice) // ไม่อ่าน = ไม่ตอบ pong
+	cl, _ := getClient(DefaultTenant, alice)
+
+	for i := 0; i < config.HeartbeatMaxMissed; i++ {
+		sweepHeartbeats()
+	}
+	if reason := cl.closeReason(); reason != "" {
+		t.Fatalf("closed before missing %d pongs: %s", config.HeartbeatMaxMissed, reason)
+	}
+
+	sweepHeartbeats()
+	if reason := cl.closeReason(); reason != "heartbeat timeout" {
+		t.Fatalf("expected heartbeat timeout, got %q", reason)
+	}
+	waitFor(t, func() bool {
+		for _, id := range getOnlineUsers(DefaultTenant) {
+			if id == alice {
+				return false
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// จำนวนข้อความต่อหน้าของ GET /messages
+const (
+	defaultHistoryPageSize = 50
+	maxHistoryPageSize     = 200
+)
+
+// หน้าหนึ่งของประวัติการสนทนา เรียงจากใหม่ไปเก่า
+// next_cursor ว่าง = ไม่มีข้อความที่เก่ากว่านี้แล้ว
+type HistoryPage struct {
+	Messages   []Message `json:"messages"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// cursor เป็นเวลาและ ID ของข้อความสุดท้ายในหน้า ("<unix nano>:<id>") จึงไม่ขยับเมื่อมีข้อความใหม่
+// เข้ารหัสไว้เพื่อให้ client ถือเป็นค่าทึบ ไม่ต้องรู้รูปแบบภายใน
+func encodeHistoryCursor(msg Message) string {
+	raw := strconv.FormatInt(msg.CreatedAt.UnixNano(), 10) + ":" + strconv.FormatInt(msg.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeHistoryCursor(cursor string) (historyCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return historyCursor{}, err
+	}
+	nanos, idStr, ok := strings.Cut(string(raw), ":")
+	ts, tsErr := strconv.ParseInt(nanos, 10, 64)
+	id, idErr := strconv.ParseInt(idStr, 10, 64)
+	if !ok || tsErr != nil || idErr != nil || id <= 0 {
+		return historyCursor{}, fmt.Errorf("invalid cursor %q", cursor)
+	}
+	return historyCursor{CreatedAt: time.Unix(0, ts).UTC(), ID: id}, nil
+}
+
+// GET /messages?peer=<id>&before=<cursor>&limit=N
+// ประวัติการสนทนาของผู้ใช้ที่ยืนยันตัวตนแล้วกับ peer เรียงจากใหม่ไปเก่า
+func handleHistory(c *fiber.Ctx) error {
+	userID, err := RequestUser(c)
+	if err != nil {
+		return err
+	}
+	peerID := c.Query("peer")
+	if peerID == "" {
+		return InvalidRequest("peer is required")
+	}
+	limit := c.QueryInt("limit", defaultHistoryPageSize)
+	if limit <= 0 || limit > maxHistoryPageSize {
+		return InvalidRequest(fmt.Sprintf("limit must be between 1 and %d", maxHistoryPageSize))
+	}
+	var before historyCursor
+	if cursor := c.Query("before"); cursor != "" {
+		if before, err = decodeHistoryCursor(cursor); err != nil {
+			return InvalidRequest("Invalid cursor")
+		}
+	}
+
+	page, err := historyPage(TenantOf(c), userID, peerID, before, limit)
+	if err != nil {
+		return Internal("Error fetching message history", err)
+	}
+	return c.JSON(page)
+}
+
+// ประวัติหน้าหนึ่ง (ใช้ร่วมกับ gRPC GetHistory)
+func historyPage(tenant, userID, peerID string, before historyCursor, limit int) (HistoryPage, error) {
+	// ขอเกินไป 1 แถวเพื่อดูว่ายังมีหน้าถัดไปหรือไม่
+	msgs, err := messageStore.History(tenant, userID, peerID, before, limit+1)
+	if err != nil {
+		return HistoryPage{}, err
+	}
+	page := HistoryPage{Messages: msgs}
+	if len(msgs) > limit {
+		page.Messages = msgs[:limit]
+		page.NextCursor = encodeHistoryCursor(page.Messages[limit-1])
+	}
+	return page, nil
+}
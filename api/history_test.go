@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func getHistoryREST(t *testing.T, userID, peerID, cursor string, limit string) (int, HistoryPage) {
+	t.Helper()
+	q := url.Values{"user_id": {userID}, "peer": {peerID}}
+	if cursor != "" {
+		q.Set("before", cursor)
+	}
+	if limit != "" {
+		q.Set("limit", limit)
+	}
+	resp, err := http.Get("http://" + testAddr + "/messages?" + q.Encode())
+	if err != nil {
+		t.Fatalf("get history: %v", err)
+	}
+	defer resp.Body.Close()
+	var page HistoryPage
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+	}
+	return resp.StatusCode, page
+}
+
+func TestHistoryPaginatesNewestFirst(t *testing.T) {
+	alice, bob, carol := newTestUser("alice"), newTestUser("bob"), newTestUser("carol")
+	var ids []int64
+	for _, text := range []string{"one", "two", "three", "four", "five"} {
+		ids = append(ids, saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: text}))
+	}
+	saveMessageToDB(Message{SenderID: carol, ReceiverID: alice, Text: "other conversation"})
+	db.Exec("UPDATE messages SET deleted_at = CURRENT_TIMESTAMP WHERE id = ?", ids[1])
+
+	code, first := getHistoryREST(t, bob, alice, "", "3")
+	if code != http.StatusOK {
+		t.Fatalf("unexpected status %d", code)
+	}
+	if len(first.Messages) != 3 || first.Messages[0].Text != "five" || first.Messages[2].Text != "three" || first.NextCursor == "" {
+		t.Fatalf("unexpected first page: %+v", first)
+	}
+
+	// ข้อความใหม่ที่เข้ามาระหว่างแบ่งหน้าต้องไม่ทำให้หน้าถัดไปเลื่อน
+	saveMessageToDB(Message{SenderID: bob, ReceiverID: alice, Text: "six"})
+
+	_, second := getHistoryREST(t, bob, alice, first.NextCursor, "3")
+	if len(second.Messages) != 2 || second.NextCursor != "" {
+		t.Fatalf("unexpected second page: %+v", second)
+	}
+	if !second.Messages[0].Deleted || second.Messages[0].Text != "" || second.Messages[1].Text != "one" {
+		t.Fatalf("expected tombstone then oldest message, got %+v", second.Messages)
+	}
+}
+
+func TestHistoryRejectsBadRequests(t *testing.T) {
+	alice := newTestUser("alice")
+	if code, _ := getHistoryREST(t, alice, "", "", ""); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without peer, got %d", code)
+	}
+	if code, _ := getHistoryREST(t, alice, "bob", "not-a-cursor", ""); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for bad cursor, got %d", code)
+	}
+	if code, _ := getHistoryREST(t, alice, "bob", "", "1000"); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for oversized limit, got %d", code)
+	}
+}
+
+func TestHistoryOrdersByServerTimestamp(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	base := time.Now().UTC().Truncate(time.Second)
+	// บันทึกลำดับ ID สลับกับเวลา และมีสองข้อความเวลาเท่ากัน (ใช้ ID ตัดสิน)
+	saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: "late", CreatedAt: base.Add(2 * time.Second)})
+	saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: "early", CreatedAt: base})
+	saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: "middle-a", CreatedAt: base.Add(time.Second)})
+	saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: "middle-b", CreatedAt: base.Add(time.Second)})
+
+	var texts []string
+	cursor := ""
+	for {
+		_, page := getHistoryREST(t, bob, alice, cursor, "1")
+		for _, msg := range page.Messages {
+			if msg.CreatedAt.IsZero() {
+				t.Fatalf("message %d has no created_at", msg.ID)
+			}
+			texts = append(texts, msg.Text)
+		}
+		if cursor = page.NextCursor; cursor == "" {
+			break
+		}
+	}
+	if got := strings.Join(texts, ","); got != "late,middle-b,middle-a,early" {
+		t.Fatalf("unexpected order %s", got)
+	}
+}
+
+func TestDeliveredMessageCarriesServerTimestamp(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	aliceConn := dialWS(t, alice)
+	bobConn := dialWS(t, bob)
+
+	claimed := time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := aliceConn.WriteJSON(Message{SenderID: alice, ReceiverID: bob, Text: "when?", CreatedAt: claimed}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var got Message
+	readJSON(t, bobConn, &got)
+	if got.CreatedAt.Equal(claimed) || time.Since(got.CreatedAt) > time.Minute {
+		t.Fatalf("expected server-assigned created_at, got %s", got.CreatedAt)
+	}
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"time"
+
+	"go-socket/protocol"
+)
+
+// frame เตือนก่อนตัด connection ที่ไม่มีการใช้งาน
+type IdleWarning = protocol.IdleWarning
+
+// บันทึกว่ามี frame เข้ามาจาก client (ทุกประเภท รวม ping_app)
+func (cl *client) touch(now time.Time) {
+	cl.lastActivity.Store(now.UnixNano())
+	cl.idleWarned.Store(false)
+}
+
+// เปิด goroutine ตรวจ connection ที่ไม่มีการใช้งาน (เฉพาะเมื่อตั้ง IdleTimeout)
+func startIdleSweeper() {
+	if config.IdleTimeout <= 0 {
+		return
+	}
+	interval := config.IdleTimeout / 10
+	if interval < 100*time.Millisecond {
+		interval = 100 * time.Millisecond
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			sweepIdle(now)
+		}
+	}()
+}
+
+// เตือนแล้วตัด connection ที่ไม่ได้ส่งอะไรเข้ามาเกิน IdleTimeout
+// เก็บรายชื่อ client ก่อน แล้วค่อยเขียน socket หลังปล่อย lock ของ userSessions
+func sweepIdle(now time.Time) {
+	for _, cl := range allSessions() {
+		if cl.sse != nil {
+			continue // SSE รับอย่างเดียว ไม่มี frame จาก client ให้นับเป็นการใช้งาน
+		}
+		lastActivity := time.Unix(0, cl.lastActivity.Load())
+		closesAt := lastActivity.Add(config.IdleTimeout)
+		switch {
+		case !now.Before(closesAt):
+			cl.logger().Info("idle connection, disconnecting", "idle_since", lastActivity)
+			cl.closeWith(closeIdleTimeout, "idle timeout")
+		case !now.Before(closesAt.Add(-config.IdleWarningBefore)) && cl.idleWarned.CompareAndSwap(false, true):
+			cl.send(IdleWarning{Type: frameTypeIdleWarning, ClosesAt: closesAt.UTC()})
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	fws "github.com/fasthttp/websocket"
+)
+
+func withIdleTimeout(t *testing.T, timeout, warning time.Duration) {
+	t.Helper()
+	prevTimeout, prevWarning := config.IdleTimeout, config.IdleWarningBefore
+	config.IdleTimeout, config.IdleWarningBefore = timeout, warning
+	t.Cleanup(func() { config.IdleTimeout, config.IdleWarningBefore = prevTimeout, prevWarning })
+}
+
+func TestIdleConnectionIsWarnedThenClosed(t *testing.T) {
+	withIdleTimeout(t, time.Minute, 10*time.Second)
+	alice := newTestUser("alice")
+	conn := dialWS(t, alice)
+	cl, _ := getClient(DefaultTenant, alice)
+	start := time.Unix(0, cl.lastActivity.Load())
+
+	// ยังไม่ถึงช่วงเตือน
+	sweepIdle(start.Add(30 * time.Second))
+	if cl.idleWarned.Load() {
+		t.Fatal("warned too early")
+	}
+
+	sweepIdle(start.Add(55 * time.Second))
+	var warning IdleWarning
+	readJSON(t, conn, &warning)
+	if warning.Type != frameTypeIdleWarning || !warning.ClosesAt.Equal(start.Add(time.Minute)) {
+		t.Fatalf("unexpected warning: %+v", warning)
+	}
+
+	sweepIdle(start.Add(time.Minute))
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := conn.ReadMessage(); !fws.IsCloseError(err, closeIdleTimeout) {
+		t.Fatalf("expected close %d, got %v", closeIdleTimeout, err)
+	}
+	waitFor(t, func() bool { _, ok := getClient(DefaultTenant, alice); return !ok })
+}
+
+func TestInboundFrameResetsIdleTimer(t *testing.T) {
+	withIdleTimeout(t, time.Minute, 10*time.Second)
+	alice := newTestUser("alice")
+	conn := dialWS(t, alice)
+	cl, _ := getClient(DefaultTenant, alice)
+	start := time.Unix(0, cl.lastActivity.Load())
+
+	sweepIdle(start.Add(55 * time.Second))
+	var warning IdleWarning
+	readJSON(t, conn, &warning)
+
+	if err := conn.WriteMessage(fws.TextMessage, []byte(`{"type":"ping_app","client_ts":1}`)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var pong PongApp
+	readJSON(t, conn, &pong)
+	waitFor(t, func() bool { return !cl.idleWarned.Load() })
+
+	// เวลาเดิมที่ควรถูกตัด ตอนนี้ยังไม่ถึงกำหนดใหม่
+	sweepIdle(start.Add(time.Minute))
+	if reason := cl.closeReason(); reason != "" {
+		t.Fatalf("active connection was closed: %s", reason)
+	}
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// claims ของ access token: subject คือ userID และผูกกับ tenant ที่ออก token
+type AuthClaims struct {
+	Tenant string `json:"tenant"`
+	jwt.RegisteredClaims
+}
+
+// secret ที่ใช้เซ็น JWT ถ้าไม่ได้ตั้งค่าไว้จะสุ่มใหม่ตอนเริ่ม server (token เดิมใช้ไม่ได้หลัง restart)
+var (
+	jwtSecretOnce sync.Once
+	jwtSecret     []byte
+)
+
+func getJWTSecret() []byte {
+	jwtSecretOnce.Do(func() {
+		if config.JWTSecret != "" {
+			jwtSecret = []byte(config.JWTSecret)
+			return
+		}
+		jwtSecret = make([]byte, 32)
+		if _, err := rand.Read(jwtSecret); err != nil {
+			panic(err)
+		}
+	})
+	return jwtSecret
+}
+
+// ออก access token (HS256) ให้ userID ของ tenant
+func issueJWT(tenant, userID string, now time.Time) (string, time.Time, error) {
+	expiresAt := now.Add(config.JWTTTL)
+	claims := AuthClaims{
+		Tenant: tenant,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(getJWTSecret())
+	return token, expiresAt, err
+}
+
+// ตรวจลายเซ็นและอายุของ token คืนค่า claims
+func parseJWT(token string, now time.Time) (*AuthClaims, error) {
+	claims := &AuthClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) {
+		return getJWTSecret(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithTimeFunc(func() time.Time { return now }))
+	if err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+	return claims, nil
+}
+
+// อ่าน token จาก Authorization: Bearer <token> หรือ ?access_token= (browser ตั้ง header ตอน upgrade WebSocket ไม่ได้)
+func bearerToken(c *fiber.Ctx) string {
+	if token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer "); ok {
+		return token
+	}
+	return c.Query("access_token")
+}
+
+// middleware ตรวจ JWT (เมื่อเปิด RequireJWT) และเก็บ userID ไว้ใน Locals
+// ถ้า route มี :userID subject ต้องตรงกับผู้ใช้ใน path
+func requireJWT(c *fiber.Ctx) error {
+	// bot ยืนยันตัวตนด้วย API key แล้ว (authenticateBot) เหลือแค่ตรวจว่าเชื่อมต่อในนามตัวเอง
+	if isBot(c) {
+		if id := c.Params("userID"); id != "" && id != AuthUser(c) {
+			return Forbidden("Bot key does not match user")
+		}
+		return c.Next()
+	}
+	if !config.RequireJWT {
+		return c.Next()
+	}
+
+	claims, err := parseJWT(bearerToken(c), time.Now())
+	if err != nil {
+		slog.Info("rejected JWT", "request_id", requestIDOf(c), "method", c.Method(), "path", c.Path(), "err", err)
+		return NewError(fiber.StatusUnauthorized, errCodeUnauthorized, "Invalid or missing access token")
+	}
+	if claims.Tenant != TenantOf(c) {
+		return Forbidden("Token does not match tenant")
+	}
+	if id := c.Params("userID"); id != "" && id != claims.Subject {
+		slog.Info("rejected JWT for another user", "request_id", requestIDOf(c), "subject", claims.Subject, "user_id", id)
+		return Forbidden("Token does not match user")
+	}
+	SetAuthUser(c, claims.Subject)
+	return c.Next()
+}
+
+// POST /auth/token  (Authorization: Bearer <issuer key>, body {"user_id": ...})
+// ให้ backend ที่ยืนยันตัวตนผู้ใช้แล้วขอ access token ไปให้ client ใช้กับ WebSocket และ /send
+func handleIssueJWT(c *fiber.Ctx) error {
+	if config.WSTokenIssuerKey == "" {
+		return Forbidden("Token issuing disabled")
+	}
+	key := strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(key), []byte(config.WSTokenIssuerKey)) != 1 {
+		return NewError(fiber.StatusUnauthorized, errCodeUnauthorized, "Invalid credentials")
+	}
+
+	var req struct {
+		UserID string `json:"user_id"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.UserID == "" {
+		return InvalidRequest("user_id is required")
+	}
+
+	token, expiresAt, err := issueJWT(TenantOf(c), req.UserID, time.Now())
+	if err != nil {
+		return Internal("Error signing token", err)
+	}
+	return c.JSON(fiber.Map{"token": token, "token_type": "Bearer", "expires_at": expiresAt.UTC()})
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	fws "github.com/fasthttp/websocket"
+)
+
+func withRequireJWT(t *testing.T) {
+	config.RequireJWT = true
+	t.Cleanup(func() { config.RequireJWT = false })
+}
+
+func TestJWTRoundTrip(t *testing.T) {
+	now := time.Now()
+	token, _, err := issueJWT(DefaultTenant, "alice", now)
+	if err != nil {
+		t.Fatalf("issueJWT: %v", err)
+	}
+
+	claims, err := parseJWT(token, now)
+	if err != nil || claims.Subject != "alice" || claims.Tenant != DefaultTenant {
+		t.Fatalf("unexpected claims %+v (%v)", claims, err)
+	}
+	if _, err := parseJWT(token, now.Add(config.JWTTTL+time.Minute)); err == nil {
+		t.Fatal("expected expired token to be rejected")
+	}
+	if _, err := parseJWT(token+"x", now); err == nil {
+		t.Fatal("expected tampered token to be rejected")
+	}
+}
+
+func TestWebSocketUpgradeRequiresJWT(t *testing.T) {
+	withRequireJWT(t)
+	bob := newTestUser("bob")
+	url := "ws://" + testAddr + "/ws/chat/" + bob
+
+	if _, resp, err := fws.DefaultDialer.Dial(url, nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %v", resp)
+	}
+
+	other, _, _ := issueJWT(DefaultTenant, newTestUser("mallory"), time.Now())
+	if _, resp, err := fws.DefaultDialer.Dial(url+"?access_token="+other, nil); err == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for another user's token, got %v", resp)
+	}
+
+	token, _, _ := issueJWT(DefaultTenant, bob, time.Now())
+	conn, _, err := fws.DefaultDialer.Dial(url, http.Header{"Authorization": {"Bearer " + token}})
+	if err != nil {
+		t.Fatalf("dial with token: %v", err)
+	}
+	conn.Close()
+}
+
+func TestSendRequiresMatchingJWT(t *testing.T) {
+	withRequireJWT(t)
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	token, _, _ := issueJWT(DefaultTenant, alice, time.Now())
+
+	send := func(auth, sender string) int {
+		req, _ := http.NewRequest(http.MethodPost, "http://"+testAddr+"/send", strings.NewReader(`{"sender_id":"`+sender+`","receiver_id":"`+bob+`","text":"hi"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if auth != "" {
+			req.Header.Set("Authorization", "Bearer "+auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("send: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := send("", alice); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", code)
+	}
+	if code := send(token, newTestUser("carol")); code != http.StatusForbidden {
+		t.Fatalf("expected 403 when impersonating, got %d", code)
+	}
+	if code := send(token, alice); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if n := countStored(t, alice, bob, false); n != 1 {
+		t.Fatalf("expected 1 stored message, got %d", n)
+	}
+}
+
+func TestIssueJWTRequiresIssuerKey(t *testing.T) {
+	prev := config.WSTokenIssuerKey
+	config.WSTokenIssuerKey = "issuer-secret"
+	t.Cleanup(func() { config.WSTokenIssuerKey = prev })
+
+	post := func(key string) int {
+		req, _ := http.NewRequest(http.MethodPost, "http://"+testAddr+"/auth/token", strings.NewReader(`{"user_id":"alice"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := post("wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", code)
+	}
+	if code := post("issuer-secret"); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+}
+
+func TestUserScopedRoutesRequireMatchingJWT(t *testing.T) {
+	withRequireJWT(t)
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	token, _, _ := issueJWT(DefaultTenant, alice, time.Now())
+	id := saveMessageToDB(Message{SenderID: bob, ReceiverID: alice, Text: "hi"})
+
+	do := func(method, path, body string) int {
+		req, _ := http.NewRequest(method, "http://"+testAddr+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// ทำในนามคนอื่นไม่ได้ ทั้งผ่าน path และ body
+	forbidden := []struct{ method, path, body string }{
+		{http.MethodGet, "/poll/" + bob + "?wait=0s", ""},
+		{http.MethodGet, "/unread/" + bob, ""},
+		{http.MethodPost, "/broadcast", `{"sender_id":"` + bob + `","receiver_ids":["` + alice + `"],"text":"x"}`},
+		{http.MethodPost, "/schedule", `{"sender_id":"` + bob + `","receiver_id":"` + alice + `","text":"x","send_at":"` + time.Now().Add(time.Hour).Format(time.RFC3339) + `"}`},
+		{http.MethodPost, "/read-all", `{"user_id":"` + bob + `","peer_id":"` + alice + `"}`},
+		{http.MethodPost, "/rooms", `{"user_id":"` + bob + `","name":"x"}`},
+		{http.MethodPost, "/messages/" + strconv.FormatInt(id, 10) + "/forward", `{"user_id":"` + bob + `","to":"` + alice + `"}`},
+		{http.MethodPost, "/messages/" + strconv.FormatInt(id, 10) + "/react", `{"user_id":"` + bob + `","emoji":"👍"}`},
+	}
+	for _, r := range forbidden {
+		if code := do(r.method, r.path, r.body); code != http.StatusForbidden {
+			t.Errorf("%s %s: expected 403, got %d", r.method, r.path, code)
+		}
+	}
+	if n := countStored(t, alice, bob, false) + countStored(t, bob, alice, true); n != 1 {
+		t.Fatalf("impersonated requests should not change messages, got %d", n)
+	}
+
+	// ไม่ส่ง sender_id/user_id ใช้ผู้ใช้จาก token
+	if code := do(http.MethodPost, "/broadcast", `{"receiver_ids":["`+bob+`"],"text":"from token"}`); code != http.StatusOK {
+		t.Fatalf("expected 200 for broadcast as token user, got %d", code)
+	}
+	if n := countStored(t, alice, bob, false); n != 1 {
+		t.Fatalf("expected broadcast stored as alice, got %d", n)
+	}
+}
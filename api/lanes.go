@@ -0,0 +1,108 @@
+package api
+
+import (
+	"hash/fnv"
+	"strconv"
+	"sync/atomic"
+)
+
+// ข้อความถึงผู้รับเดียวกัน (หรือห้องเดียวกัน) ต้องถูกจัดการตามลำดับที่รับมา
+// router ตัวเดียวอ่านจาก priorityBroadcast/broadcast แล้วส่งต่อให้ lane ตาม hash ของผู้รับ
+// แต่ละ lane มี worker ของตัวเอง ข้อความใน lane เดียวกันจึงออกตามลำดับ FIFO
+// (ข้อความเร่งด่วนยังแซงข้อความปกติที่ยังอยู่ใน broadcast ได้ตามที่ตั้งใจ)
+
+// ขนาดคิวของแต่ละ lane (lane เต็ม = router รอ ข้อความที่เหลือค้างใน broadcast ตาม overflow policy)
+const laneQueueSize = 64
+
+var lanes []chan queuedMessage
+
+// จำนวน goroutine ของ router และ lane worker ที่ยังทำงานอยู่ (ใช้ใน /readyz)
+var runningWorkers atomic.Int64
+
+// เปิด router และ lane n ตัว (n = config.Workers คือจำนวนผู้รับที่จัดการพร้อมกันได้)
+func startWorkers(n int) {
+	lanes = make([]chan queuedMessage, n)
+	for i := range lanes {
+		lanes[i] = make(chan queuedMessage, laneQueueSize)
+		go laneWorker(lanes[i])
+	}
+	go routeMessages(lanes)
+}
+
+func laneWorker(lane chan queuedMessage) {
+	runningWorkers.Add(1)
+	defer runningWorkers.Add(-1)
+	for msg := range lane {
+		processMessage(msg)
+	}
+}
+
+func routeMessages(lanes []chan queuedMessage) {
+	runningWorkers.Add(1)
+	defer runningWorkers.Add(-1)
+	routeQueues(priorityBroadcast, broadcast, lanes)
+}
+
+// หยิบจาก priority ก่อนเสมอ แต่ถ้าหยิบติดกันครบ maxPriorityStreak
+// จะสุ่มเลือกระหว่างสองคิว เพื่อให้ข้อความปกติยังถูกส่งออกไปได้ หยุดเมื่อคิวใดคิวหนึ่งถูกปิด
+func routeQueues(priority, normal <-chan queuedMessage, lanes []chan queuedMessage) {
+	streak := 0
+	for {
+		if streak < maxPriorityStreak {
+			select {
+			case msg, ok := <-priority:
+				if !ok {
+					return
+				}
+				streak++
+				routeToLane(lanes, msg)
+				continue
+			default:
+			}
+		}
+
+		streak = 0
+		var msg queuedMessage
+		var ok bool
+		select {
+		case msg, ok = <-priority:
+		case msg, ok = <-normal:
+		}
+		if !ok {
+			return
+		}
+		routeToLane(lanes, msg)
+	}
+}
+
+func routeToLane(lanes []chan queuedMessage, msg queuedMessage) {
+	// นับเป็นข้อความที่กำลังจัดการระหว่างรอ lane ว่าง (queuesDrained ตอน shutdown)
+	processingMessages.Add(1)
+	lanes[laneFor(msg.Message, len(lanes))] <- msg
+	processingMessages.Add(-1)
+}
+
+// ข้อความห้องเรียงตามห้อง ข้อความอื่นเรียงตามผู้รับ
+func orderingKey(msg Message) string {
+	tenant := tenantOrDefault(msg.TenantID)
+	if msg.RoomID != 0 {
+		return tenantKey(tenant, "room:"+strconv.FormatInt(msg.RoomID, 10))
+	}
+	return tenantKey(tenant, msg.ReceiverID)
+}
+
+func laneFor(msg Message, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(orderingKey(msg)))
+	return int(h.Sum32() % uint32(n))
+}
+
+// จำนวนข้อความที่รออยู่ในทุก lane และความจุรวม
+func laneBacklog() queueStats {
+	var stats queueStats
+	for _, lane := range lanes {
+		stats.Length += len(lane)
+		stats.Capacity += cap(lane)
+	}
+	return stats
+}
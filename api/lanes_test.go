@@ -0,0 +1,62 @@
+package api
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestMessagesToSameReceiverArriveInOrder(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	aliceConn := dialWS(t, alice)
+	bobConn := dialWS(t, bob)
+
+	const n = 100
+	for i := 0; i < n; i++ {
+		if err := aliceConn.WriteJSON(Message{SenderID: alice, ReceiverID: bob, Text: strconv.Itoa(i)}); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	for i := 0; i < n; i++ {
+		var got Message
+		readJSON(t, bobConn, &got)
+		if got.Text != strconv.Itoa(i) {
+			t.Fatalf("message %d arrived as %q", i, got.Text)
+		}
+	}
+}
+
+func TestLaneForIsStablePerConversation(t *testing.T) {
+	a := Message{TenantID: DefaultTenant, SenderID: "alice", ReceiverID: "bob"}
+	b := Message{TenantID: DefaultTenant, SenderID: "carol", ReceiverID: "bob"}
+	if laneFor(a, 8) != laneFor(b, 8) {
+		t.Fatal("messages to the same receiver must share a lane")
+	}
+	room := Message{TenantID: DefaultTenant, SenderID: "alice", RoomID: 7}
+	if orderingKey(room) == orderingKey(a) || orderingKey(room) != orderingKey(Message{SenderID: "bob", RoomID: 7}) {
+		t.Fatal("room messages should be ordered by room")
+	}
+}
+
+func TestRouterDoesNotStarveNormalMessages(t *testing.T) {
+	const flood = 1000
+	priority := make(chan queuedMessage, flood)
+	normal := make(chan queuedMessage, 1)
+	lane := make(chan queuedMessage, flood+1)
+	for i := 0; i < flood; i++ {
+		priority <- queuedMessage{Message: Message{ReceiverID: "bob", Priority: priorityHigh, Text: strconv.Itoa(i)}}
+	}
+	normal <- queuedMessage{Message: Message{ReceiverID: "bob", Text: "normal"}}
+	defer close(priority)
+	go routeQueues(priority, normal, []chan queuedMessage{lane})
+
+	// คิวเร่งด่วนยังมีข้อความค้างอยู่ตลอด ข้อความปกติต้องได้ออกไปก่อนที่คิวเร่งด่วนจะหมด
+	for i := 0; i <= flood; i++ {
+		if msg := <-lane; msg.Text == "normal" {
+			if i < maxPriorityStreak {
+				t.Fatalf("normal message overtook the priority streak at position %d", i)
+			}
+			return
+		}
+	}
+	t.Fatal("normal message was starved by the priority flood")
+}
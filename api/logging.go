@@ -0,0 +1,71 @@
+package api
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/google/uuid"
+)
+
+// รูปแบบ log: json สำหรับส่งเข้า log pipeline, text สำหรับอ่านเองตอนพัฒนา
+const (
+	logFormatJSON = "json"
+	logFormatText = "text"
+)
+
+// ตั้ง slog เป็น logger หลักตาม cfg (log.Printf ของ library อื่นก็ออกทางนี้ด้วย)
+// แอปที่ฝัง engine ไม่ต้องเรียก ถ้าตั้ง logger ของตัวเองไว้แล้ว
+func InitLogger(cfg Config, w io.Writer) {
+	opts := &slog.HandlerOptions{Level: cfg.LogLevel}
+	var handler slog.Handler = slog.NewJSONHandler(w, opts)
+	if cfg.LogFormat == logFormatText {
+		handler = slog.NewTextHandler(w, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+// แปลงชื่อระดับ log จาก env (debug, info, warn, error)
+func parseLogLevel(v string) (slog.Level, bool) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.ToUpper(v))); err != nil {
+		return 0, false
+	}
+	return level, true
+}
+
+// ID สำหรับโยง log ของ connection หรือข้อความเดียวกันเข้าด้วยกัน
+func newCorrelationID() string {
+	return uuid.NewString()
+}
+
+// request ID ที่ middleware requestid กำหนด (หรือ X-Request-ID ที่ client ส่งมา) ใช้เป็น trace_id ของข้อความจาก REST
+func requestIDOf(c *fiber.Ctx) string {
+	id, _ := c.Locals(requestid.ConfigDefault.ContextKey).(string)
+	return id
+}
+
+// logger ของ connection: ทุกบรรทัดมี conn_id user_id session_id และ tenant
+func (cl *client) logger() *slog.Logger {
+	if cl.log == nil {
+		return slog.Default()
+	}
+	return cl.log
+}
+
+// logger ของข้อความ: trace_id ตามข้อความไปทุกขั้น (รับ -> บันทึก -> ส่ง) รวมถึงข้ามไป instance อื่น
+func messageLogger(msg Message) *slog.Logger {
+	args := []any{"trace_id", msg.TraceID, "tenant", tenantOrDefault(msg.TenantID), "sender_id", msg.SenderID}
+	if msg.RoomID != 0 {
+		args = append(args, "room_id", msg.RoomID)
+	}
+	if msg.ReceiverID != "" {
+		args = append(args, "receiver_id", msg.ReceiverID)
+	}
+	if msg.ID != 0 {
+		args = append(args, "msg_id", msg.ID)
+	}
+	return slog.With(args...)
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	cases := map[string]slog.Level{"debug": slog.LevelDebug, "INFO": slog.LevelInfo, "warn": slog.LevelWarn, "error": slog.LevelError}
+	for in, want := range cases {
+		if got, ok := parseLogLevel(in); !ok || got != want {
+			t.Errorf("parseLogLevel(%q) = %v, %v; want %v", in, got, ok, want)
+		}
+	}
+	if _, ok := parseLogLevel("verbose"); ok {
+		t.Error("expected unknown level to be rejected")
+	}
+}
+
+// buffer ที่เขียนพร้อมกันได้ เพราะ slog.Default ถูกใช้โดย goroutine ของ server จาก test อื่นด้วย
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestMessageLoggerWritesTraceID(t *testing.T) {
+	prev := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	var buf lockedBuffer
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	msg := Message{SenderID: "alice", ReceiverID: "bob", ID: 42, TraceID: "trace-1"}
+	messageLogger(msg).Info("message delivered")
+
+	// ข้ามบรรทัดของ connection ที่ค้างจาก test ก่อนหน้า
+	var line map[string]any
+	for _, raw := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var l map[string]any
+		if err := json.Unmarshal([]byte(raw), &l); err != nil {
+			t.Fatalf("log line is not JSON: %v (%s)", err, raw)
+		}
+		if l["trace_id"] == "trace-1" {
+			line = l
+		}
+	}
+	if line["trace_id"] != "trace-1" || line["sender_id"] != "alice" || line["receiver_id"] != "bob" || line["msg_id"] != float64(42) {
+		t.Fatalf("unexpected log fields: %v", line)
+	}
+}
+
+func TestRequestIDIsEchoed(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "http://"+testAddr+"/online", nil)
+	req.Header.Set("X-Request-ID", "req-123")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("X-Request-ID"); got != "req-123" {
+		t.Fatalf("expected request id to be echoed, got %q", got)
+	}
+}
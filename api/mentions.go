@@ -0,0 +1,54 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"go-socket/protocol"
+)
+
+// จำนวน mention สูงสุดต่อข้อความ
+const maxMentions = 50
+
+// ตรวจว่า userID ถูก mention ใน mentions หรือไม่ (รองรับทั้ง "bob" และ "@bob")
+var isMentioned = protocol.IsMentioned
+
+// ตั้งค่า Mentioned ของ frame ตามผู้รับ
+// ไม่ได้เปลี่ยนการส่งข้อความ ผู้รับที่ไม่ถูก mention ยังได้รับข้อความตามปกติ
+func markMentioned(msg *Message) {
+	msg.Mentioned = isMentioned(msg.Mentions, msg.ReceiverID)
+}
+
+// แนบสถานะ Mentioned ให้ข้อความค้างที่ส่งให้ userID
+func attachMentioned(userID string, msgs []Message) {
+	if len(msgs) == 0 {
+		return
+	}
+
+	args := make([]interface{}, 0, len(msgs)+1)
+	args = append(args, userID)
+	for _, msg := range msgs {
+		args = append(args, msg.ID)
+	}
+	query := fmt.Sprintf("SELECT message_id FROM mentions WHERE user_id = ? AND message_id IN (%s)", strings.Join(makePlaceholders(len(msgs)), ","))
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		slog.Error("fetching mentions", "err", err)
+		return
+	}
+	defer rows.Close()
+
+	mentioned := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			slog.Error("scanning mention", "err", err)
+			return
+		}
+		mentioned[id] = true
+	}
+	for i := range msgs {
+		msgs[i].Mentioned = mentioned[msgs[i].ID]
+	}
+}
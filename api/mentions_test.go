@@ -0,0 +1,86 @@
+package api
+
+import "testing"
+
+func TestIsMentioned(t *testing.T) {
+	cases := []struct {
+		mentions []string
+		want     bool
+	}{
+		{[]string{"bob"}, true},
+		{[]string{"@bob"}, true},
+		{[]string{" @bob "}, true},
+		{[]string{"@all"}, true},
+		{[]string{"all"}, true},
+		{[]string{"@bobby", "@carol"}, false},
+		{nil, false},
+	}
+	for _, tc := range cases {
+		if got := isMentioned(tc.mentions, "bob"); got != tc.want {
+			t.Errorf("isMentioned(%q, bob) = %v, want %v", tc.mentions, got, tc.want)
+		}
+	}
+}
+
+// จำนวนแถวใน mentions ของผู้ใช้
+func countMentions(t *testing.T, userID string) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM mentions WHERE user_id = ?", userID).Scan(&n); err != nil {
+		t.Fatalf("count mentions: %v", err)
+	}
+	return n
+}
+
+func TestMentionIsPersistedForOfflineRecipient(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+
+	dispatchMessage(Message{SenderID: alice, ReceiverID: bob, Text: "hey @" + bob, Mentions: []string{"@" + bob}})
+	dispatchMessage(Message{SenderID: alice, ReceiverID: bob, Text: "no mention"})
+	if n := countMentions(t, bob); n != 1 {
+		t.Fatalf("expected 1 stored mention, got %d", n)
+	}
+
+	// ข้อความค้างที่ส่งตอนเชื่อมต่อยังบอกได้ว่าข้อความไหน mention ผู้รับ
+	bobConn := dialWS(t, bob)
+	var first, second Message
+	readJSON(t, bobConn, &first)
+	readJSON(t, bobConn, &second)
+	if first.Text != "hey @"+bob || !first.Mentioned {
+		t.Fatalf("expected mentioned message, got %+v", first)
+	}
+	if second.Text != "no mention" || second.Mentioned {
+		t.Fatalf("expected plain message, got %+v", second)
+	}
+}
+
+func TestAllMentionFlagsEveryRoomMember(t *testing.T) {
+	alice, bob, carol := newTestUser("alice"), newTestUser("bob"), newTestUser("carol")
+	room, err := createRoom(DefaultTenant, "team", alice, []string{bob, carol})
+	if err != nil {
+		t.Fatalf("createRoom: %v", err)
+	}
+	bobConn := dialWS(t, bob)
+
+	if _, err := dispatchMessage(Message{TenantID: DefaultTenant, SenderID: alice, RoomID: room.ID, Text: "standup", Mentions: []string{"@all"}}); err != nil {
+		t.Fatalf("dispatchMessage: %v", err)
+	}
+
+	// สมาชิกที่ออนไลน์ได้ frame ที่มี mentioned
+	var online Message
+	readJSON(t, bobConn, &online)
+	if online.Text != "standup" || !online.Mentioned {
+		t.Fatalf("expected mentioned room message, got %+v", online)
+	}
+
+	// สมาชิกที่ออฟไลน์ได้ mentioned ตอนเชื่อมต่อภายหลัง
+	if n := countMentions(t, carol); n != 1 {
+		t.Fatalf("expected stored mention for offline member, got %d", n)
+	}
+	carolConn := dialWS(t, carol)
+	var replayed Message
+	readJSON(t, carolConn, &replayed)
+	if replayed.Text != "standup" || !replayed.Mentioned {
+		t.Fatalf("expected mentioned replayed message, got %+v", replayed)
+	}
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go-socket/protocol"
+)
+
+// ดึงข้อความเดียวให้ userID ซึ่งต้องเป็นผู้ส่งหรือผู้รับ
+// ข้อความที่ถูกลบแล้วคืนเป็น tombstone (ไม่มีเนื้อหา metadata หรือ reaction เดิม)
+func getMessage(tenant string, messageID int64, userID string) (Message, error) {
+	msg := Message{ID: messageID, TenantID: tenant}
+	var text string
+	var keyVersion int
+	var metadata, fwdSenderID sql.NullString
+	var fwdFromID sql.NullInt64
+	err := db.QueryRow(`SELECT sender_id, receiver_id, COALESCE(room_id, 0), text, text_key_version, COALESCE(client_msg_id, ''), is_read, is_delivered, created_at,
+		metadata, COALESCE(reply_to_id, 0), forwarded_from_id, forwarded_sender_id, deleted_at IS NOT NULL
+		FROM messages WHERE id = ? AND tenant_id = ?`, messageID, tenant).
+		Scan(&msg.SenderID, &msg.ReceiverID, &msg.RoomID, &text, &keyVersion, &msg.ClientMsgID, &msg.IsRead, &msg.IsDelivered, &msg.CreatedAt,
+			&metadata, &msg.ReplyToID, &fwdFromID, &fwdSenderID, &msg.Deleted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Message{}, errMessageNotFound
+	}
+	if err != nil {
+		return Message{}, fmt.Errorf("fetching message: %w", err)
+	}
+	if userID != msg.SenderID && userID != msg.ReceiverID {
+		return Message{}, errNotParticipant
+	}
+	if msg.Deleted {
+		msg.ReplyToID = 0
+		return msg, nil
+	}
+
+	if msg.Text, err = openText(text, keyVersion); err != nil {
+		return Message{}, fmt.Errorf("decrypting message %d: %w", messageID, err)
+	}
+	if metadata.Valid {
+		msg.Metadata = json.RawMessage(metadata.String)
+	}
+	if fwdFromID.Valid {
+		msg.Forwarded = true
+		msg.ForwardedFrom = &ForwardedFrom{MessageID: fwdFromID.Int64, SenderID: fwdSenderID.String}
+	}
+
+	msgs := []Message{msg}
+	attachReactions(msgs)
+	attachAttachments(msgs)
+	attachMentioned(userID, msgs)
+	attachReplyPreviews(msgs)
+	return msgs[0], nil
+}
+
+// GET /messages/:id  ผู้ใช้จาก JWT (หรือ ?user_id= เมื่อไม่ได้เปิด RequireJWT) ต้องเป็นผู้ส่งหรือผู้รับ
+func handleGetMessage(c *fiber.Ctx) error {
+	messageID, err := c.ParamsInt("id")
+	if err != nil {
+		return InvalidRequest("Invalid message id")
+	}
+	userID, err := RequestUser(c)
+	if err != nil {
+		return err
+	}
+
+	msg, err := getMessage(TenantOf(c), int64(messageID), userID)
+	switch {
+	case errors.Is(err, errMessageNotFound):
+		return NotFound("Message not found")
+	case errors.Is(err, errNotParticipant):
+		return Forbidden("Not a participant")
+	case err != nil:
+		return Internal("Error loading message", err)
+	}
+	return c.JSON(msg)
+}
+
+var errNotSender = errors.New("only the sender can delete the message")
+
+// event แจ้งการลบข้อความ
+type MessageDeleted = protocol.MessageDeleted
+
+// สำเนาของข้อความที่ถูกลบ (ข้อความห้องมีหนึ่งแถวต่อสมาชิก)
+type deletedCopy struct {
+	ID         int64
+	ReceiverID string
+}
+
+// ลบข้อความ (soft delete) ผู้ส่งลบข้อความของตัวเองได้ ในห้อง admin/owner ลบข้อความของคนอื่นได้ด้วย
+// ข้อความห้องลบทุกสำเนาพร้อมกัน ข้อความที่ลบไปแล้วคืนค่าว่าง
+func deleteMessage(tenant string, messageID int64, userID string) (Message, []deletedCopy, error) {
+	msg := Message{ID: messageID, TenantID: tenant}
+	err := db.QueryRow("SELECT sender_id, receiver_id, COALESCE(room_id, 0) FROM messages WHERE id = ? AND tenant_id = ?", messageID, tenant).
+		Scan(&msg.SenderID, &msg.ReceiverID, &msg.RoomID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return msg, nil, errMessageNotFound
+	}
+	if err != nil {
+		return msg, nil, fmt.Errorf("fetching message: %w", err)
+	}
+
+	if msg.RoomID != 0 {
+		required := roomRoleMember
+		if userID != msg.SenderID {
+			required = roomRoleAdmin
+		}
+		if _, err := requireRoomRole(tenant, msg.RoomID, userID, required); err != nil {
+			return msg, nil, err
+		}
+	} else if userID != msg.SenderID {
+		if userID == msg.ReceiverID {
+			return msg, nil, errNotSender
+		}
+		return msg, nil, errNotParticipant
+	}
+
+	var copies []deletedCopy
+	err = retryOnBusy("deleting message", func() error {
+		rows, err := db.Query(`UPDATE messages SET deleted_at = ? WHERE tenant_id = ? AND deleted_at IS NULL
+			AND (id = ? OR (room_id = ? AND sender_id = ? AND created_at = (SELECT created_at FROM messages WHERE id = ?)))
+			RETURNING id, receiver_id`, time.Now().UTC(), tenant, messageID, msg.RoomID, msg.SenderID, messageID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		copies = copies[:0]
+		for rows.Next() {
+			var c deletedCopy
+			if err := rows.Scan(&c.ID, &c.ReceiverID); err != nil {
+				return err
+			}
+			copies = append(copies, c)
+		}
+		return rows.Err()
+	})
+	return msg, copies, err
+}
+
+// DELETE /messages/:id  ผู้ใช้จาก JWT (หรือ ?user_id= เมื่อไม่ได้เปิด RequireJWT)
+func handleDeleteMessage(c *fiber.Ctx) error {
+	messageID, err := c.ParamsInt("id")
+	if err != nil {
+		return InvalidRequest("Invalid message id")
+	}
+	userID, err := RequestUser(c)
+	if err != nil {
+		return err
+	}
+
+	tenant := TenantOf(c)
+	msg, copies, err := deleteMessage(tenant, int64(messageID), userID)
+	switch {
+	case errors.Is(err, errMessageNotFound):
+		return NotFound("Message not found")
+	case errors.Is(err, errNotParticipant):
+		return Forbidden("Not a participant")
+	case errors.Is(err, errNotSender):
+		return Forbidden("Only the sender can delete this message")
+	case err != nil:
+		return roomAPIError(err)
+	}
+
+	// แจ้งผู้รับทุกสำเนา และอุปกรณ์อื่นของผู้ส่งในแชท 1 ต่อ 1
+	for _, cp := range copies {
+		sendToUser(tenant, cp.ReceiverID, frameTypeMessageDeleted, MessageDeleted{Type: frameTypeMessageDeleted, MessageID: cp.ID, RoomID: msg.RoomID, DeletedBy: userID})
+		if msg.RoomID == 0 && cp.ReceiverID != msg.SenderID {
+			sendToUser(tenant, msg.SenderID, frameTypeMessageDeleted, MessageDeleted{Type: frameTypeMessageDeleted, MessageID: cp.ID, DeletedBy: userID})
+		}
+	}
+	slog.Info("message deleted", "request_id", requestIDOf(c), "tenant", tenant, "user_id", userID, "msg_id", messageID, "room_id", msg.RoomID, "copies", len(copies))
+
+	return c.JSON(fiber.Map{"status": "Message deleted", "deleted": len(copies)})
+}
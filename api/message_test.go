@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func getMessageREST(t *testing.T, messageID int64, userID string) (int, Message) {
+	t.Helper()
+	resp, err := http.Get("http://" + testAddr + "/messages/" + strconv.FormatInt(messageID, 10) + "?user_id=" + userID)
+	if err != nil {
+		t.Fatalf("get message: %v", err)
+	}
+	defer resp.Body.Close()
+	var msg Message
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+	}
+	return resp.StatusCode, msg
+}
+
+func TestGetMessageReturnsFullMessage(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	parent := saveMessageToDB(Message{SenderID: bob, ReceiverID: alice, Text: "lunch?"})
+	id := saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: "sure", ReplyToID: parent, Metadata: json.RawMessage(`{"kind":"text"}`)})
+	if _, _, err := toggleReaction(DefaultTenant, ReactionRequest{MessageID: id, UserID: bob, Emoji: "👍"}); err != nil {
+		t.Fatalf("toggleReaction: %v", err)
+	}
+
+	code, msg := getMessageREST(t, id, bob)
+	if code != http.StatusOK {
+		t.Fatalf("unexpected status %d", code)
+	}
+	if msg.Text != "sure" || msg.SenderID != alice || msg.Reactions["👍"] != 1 || string(msg.Metadata) != `{"kind":"text"}` {
+		t.Fatalf("unexpected message: %+v", msg)
+	}
+	if msg.ReplyTo == nil || msg.ReplyTo.ID != parent || msg.ReplyTo.Snippet != "lunch?" {
+		t.Fatalf("unexpected reply preview: %+v", msg.ReplyTo)
+	}
+}
+
+func TestGetMessageRejectsOutsidersAndHidesDeleted(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	id := saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: "secret"})
+
+	if code, _ := getMessageREST(t, id, newTestUser("mallory")); code != http.StatusForbidden {
+		t.Fatalf("expected 403 for non-participant, got %d", code)
+	}
+	if code, _ := getMessageREST(t, id+1000000, bob); code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown message, got %d", code)
+	}
+
+	db.Exec("UPDATE messages SET deleted_at = CURRENT_TIMESTAMP WHERE id = ?", id)
+	code, msg := getMessageREST(t, id, bob)
+	if code != http.StatusOK || !msg.Deleted || msg.Text != "" || msg.SenderID != alice {
+		t.Fatalf("expected tombstone, got %d %+v", code, msg)
+	}
+}
+
+func TestGetMessageUsesAuthenticatedUser(t *testing.T) {
+	withRequireJWT(t)
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	id := saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: "secret"})
+	url := "http://" + testAddr + "/messages/" + strconv.FormatInt(id, 10)
+
+	get := func(token, query string) int {
+		req, _ := http.NewRequest(http.MethodGet, url+query, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("get message: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// รู้ชื่อผู้รับอย่างเดียวไม่พอ ต้องมี token ของผู้เข้าร่วม
+	if code := get("", "?user_id="+bob); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", code)
+	}
+	mallory, _, _ := issueJWT(DefaultTenant, newTestUser("mallory"), time.Now())
+	if code := get(mallory, "?user_id="+bob); code != http.StatusForbidden {
+		t.Fatalf("expected 403 when claiming another user, got %d", code)
+	}
+	if code := get(mallory, ""); code != http.StatusForbidden {
+		t.Fatalf("expected 403 for non-participant token, got %d", code)
+	}
+	token, _, _ := issueJWT(DefaultTenant, bob, time.Now())
+	if code := get(token, ""); code != http.StatusOK {
+		t.Fatalf("expected 200 for participant, got %d", code)
+	}
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ขนาดสูงสุดของ metadata ต่อข้อความ (byte)
+const maxMetadataBytes = 4096
+
+var errInvalidMetadata = errors.New("metadata must be valid JSON")
+
+// ตรวจสอบ metadata ที่ client แนบมา (ว่างได้)
+func validateMetadata(metadata json.RawMessage) error {
+	if len(metadata) == 0 {
+		return nil
+	}
+	if len(metadata) > maxMetadataBytes {
+		return fmt.Errorf("metadata exceeds %d bytes", maxMetadataBytes)
+	}
+	if !json.Valid(metadata) {
+		return errInvalidMetadata
+	}
+	return nil
+}
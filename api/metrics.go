@@ -0,0 +1,147 @@
+package api
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go-socket/hub"
+)
+
+// ผลของการส่งข้อความแชทหนึ่งข้อความ (label outcome ของ chat_messages_dispatched_total)
+const (
+	outcomeDelivered = hub.OutcomeDelivered
+	outcomeRemote    = hub.OutcomeRemote
+	outcomeStored    = hub.OutcomeStored
+	outcomeDuplicate = hub.OutcomeDuplicate
+	outcomeFailed    = hub.OutcomeFailed
+)
+
+// ประเภทของ error บน WebSocket (label kind ของ chat_websocket_errors_total)
+const (
+	wsErrorRead      = "read"       // connection หลุดโดยไม่มี close frame ปกติ
+	wsErrorReadLimit = "read_limit" // frame ใหญ่เกิน MaxMessageBytes
+	wsErrorWrite     = "write"      // เขียน frame ไม่สำเร็จ
+	wsErrorQueueFull = "queue_full" // คิวขาออกของ connection เต็ม
+)
+
+// metric ต่างๆ ของ server (ดูได้ที่ /metrics)
+var (
+	activeConnectionsGauge = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "chat_active_connections",
+		Help: "Number of WebSocket connections currently open on this instance.",
+	}, func() float64 { return float64(activeConnections.Load()) })
+
+	broadcastQueueDepth = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "chat_broadcast_queue_depth",
+		Help:        "Number of messages waiting in the broadcast channel.",
+		ConstLabels: prometheus.Labels{"queue": "normal"},
+	}, func() float64 { return float64(len(broadcast)) })
+
+	priorityQueueDepth = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "chat_broadcast_queue_depth",
+		Help:        "Number of messages waiting in the broadcast channel.",
+		ConstLabels: prometheus.Labels{"queue": "high"},
+	}, func() float64 { return float64(len(priorityBroadcast)) })
+
+	messagesDispatchedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "chat_messages_dispatched_total",
+		Help: "Number of chat messages handled by the workers, by outcome (delivered, remote, stored, duplicate, failed).",
+	}, []string{"outcome"})
+
+	dbWriteDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "chat_db_write_duration_seconds",
+		Help:    "Time spent on database writes, including retries while the database is busy.",
+		Buckets: []float64{0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5},
+	}, []string{"op"})
+
+	dbWriteBatchSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "chat_db_write_batch_size",
+		Help:    "Number of messages saved per batched insert transaction.",
+		Buckets: []float64{1, 2, 5, 10, 20, 50, 100, 200},
+	})
+
+	websocketErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "chat_websocket_errors_total",
+		Help: "Number of WebSocket read and write errors, by kind.",
+	}, []string{"kind"})
+
+	messagesPurgedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "chat_messages_purged_total",
+		Help: "Number of messages deleted by the retention job.",
+	})
+
+	broadcastEnqueueWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "chat_broadcast_enqueue_wait_seconds",
+		Help:    "Time spent waiting to enqueue a message into the broadcast channel.",
+		Buckets: []float64{0.0001, 0.001, 0.01, 0.05, 0.1, 0.5, 1, 5},
+	}, []string{"queue"})
+
+	broadcastDroppedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "chat_broadcast_dropped_total",
+		Help: "Number of messages dropped because the broadcast channel stayed full.",
+	}, []string{"queue"})
+
+	broadcastOverflowTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "chat_broadcast_overflow_total",
+		Help: "Number of times a message found the broadcast channel full (or its sender over the in-flight limit), by queue and overflow policy.",
+	}, []string{"queue", "policy"})
+
+	malformedFramesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "chat_malformed_frames_total",
+		Help: "Number of WebSocket frames that could not be decoded.",
+	})
+
+	rateLimitedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "chat_rate_limited_total",
+		Help: "Number of WebSocket frames and /send requests rejected by the rate limiter, by scope (user, ip).",
+	}, []string{"scope"})
+
+	heartbeatTimeoutsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "chat_heartbeat_timeouts_total",
+		Help: "Number of WebSocket connections closed for missing consecutive pongs.",
+	})
+
+	notificationsDroppedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "chat_notifications_dropped_total",
+		Help: "Number of offline notifications dropped because the notification queue was full.",
+	})
+
+	pushNotificationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "chat_push_notifications_total",
+		Help: "Number of push notifications attempted for offline recipients, by platform (fcm, apns) and outcome (sent, failed, unregistered).",
+	}, []string{"platform", "outcome"})
+
+	webhookDeliveriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "chat_webhook_deliveries_total",
+		Help: "Number of webhook deliveries per URL, by event type and outcome (delivered, failed, dropped).",
+	}, []string{"event", "outcome"})
+
+	sinkDroppedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "chat_sink_dropped_total",
+		Help: "Number of messages not mirrored to the external sink because its queue was full.",
+	})
+
+	sinkErrorsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "chat_sink_errors_total",
+		Help: "Number of messages the external sink failed to publish.",
+	})
+
+	eventsPublishedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "chat_events_published_total",
+		Help: "Number of chat events published to the audit stream, including replayed dead letters.",
+	})
+
+	eventsDeadLetteredTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "chat_events_dead_lettered_total",
+		Help: "Number of chat events written to the dead-letter file because the broker was unavailable.",
+	})
+
+	eventsDroppedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "chat_events_dropped_total",
+		Help: "Number of chat events lost because the event queue was full or the dead-letter file could not be written.",
+	})
+
+	clusterForwardedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "chat_cluster_forwarded_total",
+		Help: "Number of messages and frames forwarded to the instance holding the receiver's connection.",
+	}, []string{"kind"})
+)
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func getMetrics(t *testing.T) string {
+	t.Helper()
+	resp, err := http.Get("http://" + testAddr + "/metrics")
+	if err != nil {
+		t.Fatalf("get metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read metrics: %v", err)
+	}
+	return string(body)
+}
+
+func TestMetricsExposeServerState(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	aliceConn := dialWS(t, alice)
+
+	aliceConn.WriteJSON(Message{SenderID: alice, ReceiverID: bob, Text: "offline"})
+	waitFor(t, func() bool { return countStored(t, alice, bob, false) == 1 })
+
+	body := getMetrics(t)
+	for _, name := range []string{
+		"chat_active_connections",
+		`chat_broadcast_queue_depth{queue="normal"}`,
+		`chat_broadcast_queue_depth{queue="high"}`,
+		`chat_messages_dispatched_total{outcome="stored"}`,
+		`chat_db_write_duration_seconds_count{op="saving messages"}`,
+	} {
+		if !strings.Contains(body, name) {
+			t.Errorf("metrics missing %s", name)
+		}
+	}
+}
@@ -0,0 +1,535 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"go-socket/store"
+)
+
+// migration หนึ่งเวอร์ชันของ schema (ดู store.Migration)
+// ฟีเจอร์ใหม่ที่ต้องแก้ schema ให้เพิ่ม migration ใหม่ต่อท้ายเสมอ ห้ามแก้ของเดิม
+type migration = store.Migration
+
+var migrations = []migration{
+	{
+		Version: 1,
+		Name:    "initial schema",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS messages (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				sender_id TEXT,
+				receiver_id TEXT,
+				text TEXT,
+				is_read BOOLEAN DEFAULT FALSE
+			);`,
+			// index สำหรับนับข้อความที่ยังไม่ได้อ่านของผู้รับ
+			`CREATE INDEX IF NOT EXISTS idx_messages_receiver_is_read ON messages (receiver_id, is_read);`,
+			// ตารางเก็บ reaction ของข้อความ (1 reaction ต่อ ข้อความ/ผู้ใช้/emoji)
+			`CREATE TABLE IF NOT EXISTS reactions (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				message_id INTEGER NOT NULL,
+				user_id TEXT NOT NULL,
+				emoji TEXT NOT NULL,
+				UNIQUE (message_id, user_id, emoji)
+			);`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS reactions;`,
+			`DROP TABLE IF EXISTS messages;`,
+		},
+	},
+	{
+		Version: 2,
+		Name:    "client message idempotency key",
+		Statements: []string{
+			`ALTER TABLE messages ADD COLUMN client_msg_id TEXT;`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_sender_client_msg ON messages (sender_id, client_msg_id);`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS idx_messages_sender_client_msg;`,
+			`ALTER TABLE messages DROP COLUMN client_msg_id;`,
+		},
+	},
+	{
+		Version: 3,
+		Name:    "message created_at",
+		Statements: []string{
+			`ALTER TABLE messages ADD COLUMN created_at TIMESTAMP;`,
+			// ข้อความเก่าที่ไม่มีเวลา ให้นับอายุตั้งแต่ตอน migrate
+			`UPDATE messages SET created_at = CURRENT_TIMESTAMP WHERE created_at IS NULL;`,
+			`CREATE INDEX IF NOT EXISTS idx_messages_created_at ON messages (created_at);`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS idx_messages_created_at;`,
+			`ALTER TABLE messages DROP COLUMN created_at;`,
+		},
+	},
+	{
+		Version: 4,
+		Name:    "separate delivered and read flags",
+		Statements: []string{
+			`ALTER TABLE messages ADD COLUMN is_delivered BOOLEAN DEFAULT FALSE;`,
+			// ก่อนหน้านี้ is_read ถูกตั้งตอนส่งข้อความค้าง จึงนับว่าส่งถึงแล้ว
+			`UPDATE messages SET is_delivered = TRUE WHERE is_read = TRUE;`,
+			`CREATE INDEX IF NOT EXISTS idx_messages_receiver_is_delivered ON messages (receiver_id, is_delivered);`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS idx_messages_receiver_is_delivered;`,
+			`ALTER TABLE messages DROP COLUMN is_delivered;`,
+		},
+	},
+	{
+		Version: 5,
+		Name:    "mentions",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS mentions (
+				message_id INTEGER NOT NULL,
+				user_id TEXT NOT NULL,
+				PRIMARY KEY (message_id, user_id)
+			);`,
+			`CREATE INDEX IF NOT EXISTS idx_mentions_user ON mentions (user_id);`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS mentions;`,
+		},
+	},
+	{
+		Version: 6,
+		Name:    "soft delete and sender index",
+		Statements: []string{
+			`ALTER TABLE messages ADD COLUMN deleted_at TIMESTAMP;`,
+			// ใช้ร่วมกับ idx_messages_receiver_is_read สำหรับหาข้อความทั้งสองทิศทางของผู้ใช้
+			`CREATE INDEX IF NOT EXISTS idx_messages_sender_receiver ON messages (sender_id, receiver_id);`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS idx_messages_sender_receiver;`,
+			`ALTER TABLE messages DROP COLUMN deleted_at;`,
+		},
+	},
+	{
+		Version: 7,
+		Name:    "message metadata",
+		Statements: []string{
+			// JSON ที่ client แนบมา เก็บเป็น TEXT ตามเดิม
+			`ALTER TABLE messages ADD COLUMN metadata TEXT;`,
+		},
+		Down: []string{
+			`ALTER TABLE messages DROP COLUMN metadata;`,
+		},
+	},
+	{
+		Version: 8,
+		Name:    "reply threading",
+		Statements: []string{
+			`ALTER TABLE messages ADD COLUMN reply_to_id INTEGER REFERENCES messages (id);`,
+			`CREATE INDEX IF NOT EXISTS idx_messages_reply_to ON messages (reply_to_id);`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS idx_messages_reply_to;`,
+			`ALTER TABLE messages DROP COLUMN reply_to_id;`,
+		},
+	},
+	{
+		Version: 9,
+		Name:    "outbox",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS outbox (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				payload TEXT NOT NULL,
+				status TEXT NOT NULL DEFAULT 'pending',
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL
+			);`,
+			`CREATE INDEX IF NOT EXISTS idx_outbox_status ON outbox (status, id);`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS outbox;`,
+		},
+	},
+	{
+		Version: 10,
+		Name:    "read-all index",
+		Statements: []string{
+			// สำหรับ mark ข้อความทั้งหมดจากคู่สนทนาหนึ่งคนว่าอ่านแล้ว
+			`CREATE INDEX IF NOT EXISTS idx_messages_receiver_sender_is_read ON messages (receiver_id, sender_id, is_read);`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS idx_messages_receiver_sender_is_read;`,
+		},
+	},
+	{
+		Version: 11,
+		Name:    "conversation key",
+		Statements: []string{
+			// key ของคู่สนทนาที่ไม่ขึ้นกับทิศทาง (ต้องตรงกับ conversationKey ใน Go)
+			`ALTER TABLE messages ADD COLUMN conversation_key TEXT GENERATED ALWAYS AS (
+				CASE WHEN sender_id < receiver_id THEN sender_id || char(31) || receiver_id
+				ELSE receiver_id || char(31) || sender_id END
+			) VIRTUAL;`,
+			`CREATE INDEX IF NOT EXISTS idx_messages_conversation ON messages (conversation_key, id);`,
+		},
+		// PostgreSQL รองรับเฉพาะ STORED และต้องเทียบแบบ byte (COLLATE "C") ให้ตรงกับ SQLite และ Go
+		Postgres: []string{
+			`ALTER TABLE messages ADD COLUMN conversation_key TEXT GENERATED ALWAYS AS (
+				CASE WHEN sender_id < receiver_id COLLATE "C" THEN sender_id || chr(31) || receiver_id
+				ELSE receiver_id || chr(31) || sender_id END
+			) STORED;`,
+			`CREATE INDEX IF NOT EXISTS idx_messages_conversation ON messages (conversation_key, id);`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS idx_messages_conversation;`,
+			`ALTER TABLE messages DROP COLUMN conversation_key;`,
+		},
+	},
+	{
+		Version: 12,
+		Name:    "scheduled messages",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS scheduled_messages (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				sender_id TEXT NOT NULL,
+				receiver_id TEXT NOT NULL,
+				payload TEXT NOT NULL,
+				send_at TIMESTAMP NOT NULL,
+				status TEXT NOT NULL DEFAULT 'pending',
+				created_at TIMESTAMP NOT NULL
+			);`,
+			`CREATE INDEX IF NOT EXISTS idx_scheduled_due ON scheduled_messages (status, send_at);`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS scheduled_messages;`,
+		},
+	},
+	{
+		Version: 13,
+		Name:    "presence",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS presence (
+				user_id TEXT PRIMARY KEY,
+				last_seen TIMESTAMP NOT NULL
+			);`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS presence;`,
+		},
+	},
+	{
+		Version: 14,
+		Name:    "encryption key versions",
+		Statements: []string{
+			// 0 = plaintext (แถวเดิมทั้งหมดก่อนเปิดการเข้ารหัส)
+			`ALTER TABLE messages ADD COLUMN text_key_version INTEGER NOT NULL DEFAULT 0;`,
+			`ALTER TABLE outbox ADD COLUMN key_version INTEGER NOT NULL DEFAULT 0;`,
+			`ALTER TABLE scheduled_messages ADD COLUMN key_version INTEGER NOT NULL DEFAULT 0;`,
+		},
+		Down: []string{
+			`ALTER TABLE messages DROP COLUMN text_key_version;`,
+			`ALTER TABLE outbox DROP COLUMN key_version;`,
+			`ALTER TABLE scheduled_messages DROP COLUMN key_version;`,
+		},
+	},
+	{
+		Version: 15,
+		Name:    "session audit log",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS sessions (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL,
+				session_id TEXT NOT NULL,
+				remote_ip TEXT NOT NULL,
+				connected_at TIMESTAMP NOT NULL,
+				disconnected_at TIMESTAMP,
+				disconnect_reason TEXT
+			);`,
+			`CREATE INDEX IF NOT EXISTS idx_sessions_user_connected ON sessions (user_id, connected_at);`,
+			`CREATE INDEX IF NOT EXISTS idx_sessions_connected ON sessions (connected_at);`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS sessions;`,
+		},
+	},
+	{
+		Version: 16,
+		Name:    "forwarded messages",
+		Statements: []string{
+			// เก็บผู้ส่งต้นฉบับไว้ด้วย เพื่อให้แสดงที่มาได้แม้ต้นฉบับจะถูกลบไปแล้ว
+			`ALTER TABLE messages ADD COLUMN forwarded_from_id INTEGER;`,
+			`ALTER TABLE messages ADD COLUMN forwarded_sender_id TEXT;`,
+		},
+		Down: []string{
+			`ALTER TABLE messages DROP COLUMN forwarded_from_id;`,
+			`ALTER TABLE messages DROP COLUMN forwarded_sender_id;`,
+		},
+	},
+	{
+		Version: 17,
+		Name:    "tenant isolation",
+		Statements: []string{
+			// แถวเดิมทั้งหมดเป็นของ tenant "public"
+			`ALTER TABLE messages ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'public';`,
+			`DROP INDEX IF EXISTS idx_messages_sender_client_msg;`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_tenant_sender_client_msg ON messages (tenant_id, sender_id, client_msg_id);`,
+			`ALTER TABLE outbox ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'public';`,
+			`ALTER TABLE scheduled_messages ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'public';`,
+			`ALTER TABLE sessions ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'public';`,
+			// primary key ของ presence ต้องรวม tenant จึงต้องสร้างตารางใหม่
+			`CREATE TABLE presence_new (
+				tenant_id TEXT NOT NULL DEFAULT 'public',
+				user_id TEXT NOT NULL,
+				last_seen TIMESTAMP NOT NULL,
+				PRIMARY KEY (tenant_id, user_id)
+			);`,
+			`INSERT INTO presence_new (user_id, last_seen) SELECT user_id, last_seen FROM presence;`,
+			`DROP TABLE presence;`,
+			`ALTER TABLE presence_new RENAME TO presence;`,
+		},
+		Down: []string{
+			// แถวของทุก tenant รวมกันเป็นชุดเดียว (presence ที่ user_id ซ้ำกันเหลือแถวล่าสุด)
+			// ถ้า client_msg_id ซ้ำกันข้าม tenant สร้าง unique index ไม่ได้และ rollback ล้มเหลวทั้งเวอร์ชัน
+			`DROP INDEX IF EXISTS idx_messages_tenant_sender_client_msg;`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_sender_client_msg ON messages (sender_id, client_msg_id);`,
+			`ALTER TABLE messages DROP COLUMN tenant_id;`,
+			`ALTER TABLE outbox DROP COLUMN tenant_id;`,
+			`ALTER TABLE scheduled_messages DROP COLUMN tenant_id;`,
+			`ALTER TABLE sessions DROP COLUMN tenant_id;`,
+			`CREATE TABLE presence_old (
+				user_id TEXT PRIMARY KEY,
+				last_seen TIMESTAMP NOT NULL
+			);`,
+			`INSERT INTO presence_old (user_id, last_seen) SELECT user_id, MAX(last_seen) FROM presence GROUP BY user_id;`,
+			`DROP TABLE presence;`,
+			`ALTER TABLE presence_old RENAME TO presence;`,
+		},
+	},
+	{
+		Version: 18,
+		Name:    "rooms",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS rooms (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				tenant_id TEXT NOT NULL DEFAULT 'public',
+				name TEXT NOT NULL,
+				created_by TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL
+			);`,
+			`CREATE TABLE IF NOT EXISTS room_members (
+				room_id INTEGER NOT NULL REFERENCES rooms (id),
+				user_id TEXT NOT NULL,
+				joined_at TIMESTAMP NOT NULL,
+				PRIMARY KEY (room_id, user_id)
+			);`,
+			`CREATE INDEX IF NOT EXISTS idx_room_members_user ON room_members (user_id);`,
+			// ข้อความห้องเก็บเป็นแถวของสมาชิกแต่ละคน client_msg_id เดียวกันจึงซ้ำกันได้ข้ามผู้รับ
+			`ALTER TABLE messages ADD COLUMN room_id INTEGER REFERENCES rooms (id);`,
+			`DROP INDEX IF EXISTS idx_messages_tenant_sender_client_msg;`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_tenant_sender_receiver_client_msg ON messages (tenant_id, sender_id, receiver_id, client_msg_id);`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS idx_messages_tenant_sender_receiver_client_msg;`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_tenant_sender_client_msg ON messages (tenant_id, sender_id, client_msg_id);`,
+			`ALTER TABLE messages DROP COLUMN room_id;`,
+			`DROP TABLE IF EXISTS room_members;`,
+			`DROP TABLE IF EXISTS rooms;`,
+		},
+	},
+	{
+		Version: 19,
+		Name:    "history pagination index",
+		Statements: []string{
+			// สำหรับ GET /messages: หาบทสนทนาใน tenant แล้วไล่ ID ถอยหลังจาก cursor ได้จาก index เดียว
+			`CREATE INDEX IF NOT EXISTS idx_messages_tenant_conversation ON messages (tenant_id, conversation_key, id);`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS idx_messages_tenant_conversation;`,
+		},
+	},
+	{
+		Version: 20,
+		Name:    "history ordered by created_at",
+		Statements: []string{
+			// ประวัติการสนทนาเรียงตามเวลาที่ server รับข้อความ (id ใช้ตัดสินเมื่อเวลาเท่ากัน)
+			`CREATE INDEX IF NOT EXISTS idx_messages_tenant_conversation_created ON messages (tenant_id, conversation_key, created_at, id);`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS idx_messages_tenant_conversation_created;`,
+		},
+	},
+	{
+		Version: 21,
+		Name:    "attachments",
+		Statements: []string{
+			// metadata ของไฟล์แนบ เนื้อไฟล์อยู่ใน AttachmentStorage ตาม id
+			`CREATE TABLE IF NOT EXISTS attachments (
+				id TEXT PRIMARY KEY,
+				tenant_id TEXT NOT NULL DEFAULT 'public',
+				uploader_id TEXT NOT NULL,
+				filename TEXT NOT NULL,
+				content_type TEXT NOT NULL,
+				size INTEGER NOT NULL,
+				created_at TIMESTAMP NOT NULL
+			);`,
+			`ALTER TABLE messages ADD COLUMN attachment_id TEXT REFERENCES attachments (id);`,
+			`CREATE INDEX IF NOT EXISTS idx_messages_attachment ON messages (attachment_id);`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS idx_messages_attachment;`,
+			`ALTER TABLE messages DROP COLUMN attachment_id;`,
+			`DROP TABLE IF EXISTS attachments;`,
+		},
+	},
+	{
+		Version: 22,
+		Name:    "device tokens",
+		Statements: []string{
+			// token รับ push ของแต่ละอุปกรณ์ (FCM/APNs) token หนึ่งเป็นของผู้ใช้คนเดียว
+			`CREATE TABLE IF NOT EXISTS device_tokens (
+				tenant_id TEXT NOT NULL DEFAULT 'public',
+				token TEXT NOT NULL,
+				user_id TEXT NOT NULL,
+				platform TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL,
+				PRIMARY KEY (tenant_id, token)
+			);`,
+			`CREATE INDEX IF NOT EXISTS idx_device_tokens_user ON device_tokens (tenant_id, user_id);`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS device_tokens;`,
+		},
+	},
+	{
+		Version: 23,
+		Name:    "bots",
+		Statements: []string{
+			// bot เก็บเฉพาะ hash ของ API key, webhook_secret ใช้เซ็น request ที่ส่งไปยัง webhook_url ของ bot
+			`CREATE TABLE IF NOT EXISTS bots (
+				tenant_id TEXT NOT NULL DEFAULT 'public',
+				id TEXT NOT NULL,
+				name TEXT NOT NULL DEFAULT '',
+				api_key_hash TEXT NOT NULL UNIQUE,
+				webhook_url TEXT,
+				webhook_secret TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				PRIMARY KEY (tenant_id, id)
+			);`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS bots;`,
+		},
+	},
+	{
+		Version: 24,
+		Name:    "blocks",
+		Statements: []string{
+			// mode: block = ไม่รับข้อความ, mute = รับแต่ไม่แจ้งเตือน
+			`CREATE TABLE IF NOT EXISTS blocks (
+				tenant_id TEXT NOT NULL DEFAULT 'public',
+				blocker_id TEXT NOT NULL,
+				blocked_id TEXT NOT NULL,
+				mode TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				PRIMARY KEY (tenant_id, blocker_id, blocked_id)
+			);`,
+			`CREATE INDEX IF NOT EXISTS idx_blocks_blocked ON blocks (tenant_id, blocked_id);`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS blocks;`,
+		},
+	},
+	{
+		Version: 25,
+		Name:    "delivery state timestamps",
+		Statements: []string{
+			// เวลาที่ข้อความเปลี่ยนเป็น delivered/read (แถวเดิมไม่รู้เวลาจริง ใช้เวลาที่ส่ง)
+			`ALTER TABLE messages ADD COLUMN delivered_at TIMESTAMP;`,
+			`ALTER TABLE messages ADD COLUMN read_at TIMESTAMP;`,
+			`UPDATE messages SET delivered_at = created_at WHERE is_delivered = TRUE;`,
+			`UPDATE messages SET read_at = created_at WHERE is_read = TRUE;`,
+		},
+		Down: []string{
+			`ALTER TABLE messages DROP COLUMN read_at;`,
+			`ALTER TABLE messages DROP COLUMN delivered_at;`,
+		},
+	},
+	{
+		Version: 26,
+		Name:    "room roles",
+		Statements: []string{
+			// owner | admin | member ผู้สร้างห้องเดิมเป็น owner
+			`ALTER TABLE room_members ADD COLUMN role TEXT NOT NULL DEFAULT 'member';`,
+			`UPDATE room_members SET role = 'owner' WHERE EXISTS (SELECT 1 FROM rooms r WHERE r.id = room_members.room_id AND r.created_by = room_members.user_id);`,
+		},
+		Down: []string{
+			`ALTER TABLE room_members DROP COLUMN role;`,
+		},
+	},
+	{
+		Version: 27,
+		Name:    "outbox lease",
+		Statements: []string{
+			// instance ที่รับข้อความเป็นเจ้าของแถวจนกว่า lease_until จะหมด แถวเดิมไม่มีเจ้าของ (รับไปส่งต่อได้ทันที)
+			`ALTER TABLE outbox ADD COLUMN owner_id TEXT NOT NULL DEFAULT '';`,
+			`ALTER TABLE outbox ADD COLUMN lease_until TIMESTAMP;`,
+		},
+		Down: []string{
+			`ALTER TABLE outbox DROP COLUMN lease_until;`,
+			`ALTER TABLE outbox DROP COLUMN owner_id;`,
+		},
+	},
+}
+
+// รัน migration ที่ยังไม่เคยรันกับ db ของ server
+func runMigrations() error {
+	return store.Migrate(db, migrations)
+}
+
+// เวอร์ชันที่รันไปแล้วใน db ของ server
+func appliedMigrations() (map[int]bool, error) {
+	return store.Applied(db)
+}
+
+// คำสั่ง "migrate" ของ binary (ไม่เปิด server):
+//
+//	migrate [up]            รัน migration ที่ค้างอยู่
+//	migrate down [version]  ย้อนกลับไปที่ version (ไม่ระบุ = ย้อนเวอร์ชันล่าสุดหนึ่งเวอร์ชัน)
+//	migrate status          แสดงเวอร์ชันที่รันแล้ว/ค้างอยู่
+func runMigrateCommand(args []string, out io.Writer) error {
+	cmd := "up"
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+
+	switch cmd {
+	case "up":
+		return runMigrations()
+	case "down":
+		applied, err := appliedMigrations()
+		if err != nil {
+			return err
+		}
+		target := store.CurrentVersion(applied) - 1
+		if len(args) > 0 {
+			if target, err = strconv.Atoi(args[0]); err != nil || target < 0 {
+				return fmt.Errorf("invalid version %q", args[0])
+			}
+		}
+		return store.Rollback(db, migrations, max(target, 0))
+	case "status":
+		applied, err := appliedMigrations()
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			state := "pending"
+			if applied[m.Version] {
+				state = "applied"
+			}
+			fmt.Fprintf(out, "%3d  %-8s %s\n", m.Version, state, m.Name)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q (want up, down or status)", cmd)
+	}
+}
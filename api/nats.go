@@ -0,0 +1,200 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+)
+
+// cluster ผ่าน NATS (core NATS ไม่ต้องเปิด JetStream)
+// instance ที่ถือ connection ของผู้ใช้ subscribe subject ของผู้ใช้นั้นไว้ ทุก instance ที่ subscribe ได้ envelope เดียวกัน
+// การส่งต่อใช้ request/reply: ได้คำตอบ = มี instance รับแล้ว, no responders = ผู้ใช้ไม่ได้เชื่อมต่อกับ instance ใด
+// subscription หายไปพร้อม connection ของ instance ที่ตาย จึงไม่ต้องต่ออายุ key แบบ Redis
+
+// envelope ที่ใช้ถามว่าผู้ใช้ออนไลน์หรือไม่ (instance ปลายทางตอบอย่างเดียว ไม่ทำอะไรต่อ)
+const envelopeProbe = "probe"
+
+// การเชื่อมต่อ NATS ของ instance นี้
+type natsBroker struct {
+	nc         *nats.Conn
+	instanceID string
+	channels   []*nats.Subscription // presenceChannel และ announcementChannel
+
+	mu    sync.Mutex
+	users map[string]*nats.Subscription // subject ของผู้ใช้ที่เชื่อมต่ออยู่กับ instance นี้
+}
+
+// subject ของผู้ใช้ (tenant และ user ID อาจมี "." หรือ wildcard จึง encode ก่อน)
+func userSubject(tenant, userID string) string {
+	return "chat.user." + base64.RawURLEncoding.EncodeToString([]byte(tenantKey(tenant, userID)))
+}
+
+// subject ของ channel ที่ทุก instance subscribe (chat:presence -> chat.presence)
+func natsChannelSubject(channel string) string {
+	return strings.ReplaceAll(channel, ":", ".")
+}
+
+// เชื่อมต่อ NATS แล้ว subscribe presence/ประกาศ และ subject ของผู้ใช้ที่เชื่อมต่ออยู่แล้ว
+func startNATSCluster(natsURL string) error {
+	instanceID := localInstanceID
+	nc, err := nats.Connect(natsURL, nats.Name("go-socket "+instanceID), nats.MaxReconnects(-1))
+	if err != nil {
+		return fmt.Errorf("connecting to nats: %w", err)
+	}
+
+	node := &natsBroker{nc: nc, instanceID: instanceID, users: make(map[string]*nats.Subscription)}
+	for _, channel := range []string{presenceChannel, announcementChannel} {
+		sub, err := nc.Subscribe(natsChannelSubject(channel), func(m *nats.Msg) {
+			receiveClusterEnvelope(node.instanceID, m.Data)
+		})
+		if err != nil {
+			nc.Close()
+			return fmt.Errorf("subscribing to nats: %w", err)
+		}
+		node.channels = append(node.channels, sub)
+	}
+	// รอให้ server รับ subscription ก่อน ไม่งั้นข้อความแรกๆ ที่ส่งมาอาจหาย
+	if err := nc.FlushTimeout(clusterOpTimeout); err != nil {
+		nc.Close()
+		return fmt.Errorf("subscribing to nats: %w", err)
+	}
+
+	setCluster(node)
+	claimAll(node)
+	slog.Info("joined cluster", "instance_id", node.instanceID, "nats", nc.ConnectedUrlRedacted())
+	return nil
+}
+
+func (n *natsBroker) InstanceID() string {
+	return n.instanceID
+}
+
+func (n *natsBroker) Close() {
+	n.nc.Close()
+}
+
+func (n *natsBroker) holds(subject string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	_, ok := n.users[subject]
+	return ok
+}
+
+func (n *natsBroker) Claim(tenant, userID string) {
+	subject := userSubject(tenant, userID)
+	n.mu.Lock()
+	if _, ok := n.users[subject]; ok {
+		n.mu.Unlock()
+		return
+	}
+	sub, err := n.nc.Subscribe(subject, n.receive)
+	if err == nil {
+		n.users[subject] = sub
+	}
+	n.mu.Unlock()
+	if err == nil {
+		// ให้ instance อื่นส่งถึงได้ทันทีหลัง Claim คืนค่า
+		err = n.nc.FlushTimeout(clusterOpTimeout)
+	}
+	if err != nil {
+		slog.Error("registering user in cluster", "tenant", tenant, "user_id", userID, "err", err)
+	}
+}
+
+func (n *natsBroker) Release(tenant, userID string) {
+	subject := userSubject(tenant, userID)
+	n.mu.Lock()
+	sub, ok := n.users[subject]
+	delete(n.users, subject)
+	n.mu.Unlock()
+	if !ok {
+		return
+	}
+	if err := sub.Unsubscribe(); err != nil {
+		slog.Error("unregistering user from cluster", "tenant", tenant, "user_id", userID, "err", err)
+	}
+}
+
+// ตอบรับก่อนแล้วค่อยจัดการ ผู้ส่งจะได้ไม่ต้องรอการเขียน socket (envelope ที่ publish เฉยๆ ไม่ต้องตอบ)
+func (n *natsBroker) receive(m *nats.Msg) {
+	if m.Reply == "" {
+		receiveClusterEnvelope(n.instanceID, m.Data)
+		return
+	}
+	if err := m.Respond(nil); err != nil {
+		slog.Error("answering cluster request", "err", err)
+	}
+	receiveClusterEnvelope(n.instanceID, m.Data)
+}
+
+// instance นี้ถือผู้ใช้อยู่ด้วย: request จะได้คำตอบจาก subscription ของตัวเอง จึง publish ให้ instance อื่นแทน
+// (ไม่รู้ว่ามี instance อื่นรับหรือไม่ คืนค่า false เพราะผู้เรียกส่งถึงอุปกรณ์บน instance นี้แล้ว)
+func (n *natsBroker) Forward(env clusterEnvelope) bool {
+	env.Origin = n.instanceID
+	data, err := json.Marshal(env)
+	if err != nil {
+		slog.Error("marshalling cluster envelope", "trace_id", env.TraceID, "err", err)
+		return false
+	}
+	subject := userSubject(env.Tenant, env.UserID)
+	if n.holds(subject) {
+		if err := n.nc.Publish(subject, data); err != nil {
+			slog.Error("forwarding to instance", "tenant", env.Tenant, "user_id", env.UserID, "trace_id", env.TraceID, "err", err)
+		}
+		return false
+	}
+	if _, err := n.nc.Request(subject, data, clusterOpTimeout); err != nil {
+		if !errors.Is(err, nats.ErrNoResponders) {
+			slog.Error("forwarding to instance", "tenant", env.Tenant, "user_id", env.UserID, "trace_id", env.TraceID, "err", err)
+		}
+		return false
+	}
+	clusterForwardedTotal.WithLabelValues(env.Kind).Inc()
+	return true
+}
+
+func (n *natsBroker) Publish(channel string, env clusterEnvelope) {
+	data, err := json.Marshal(env)
+	if err != nil {
+		slog.Error("marshalling cluster envelope", "kind", env.Kind, "err", err)
+		return
+	}
+	if err := n.nc.Publish(natsChannelSubject(channel), data); err != nil {
+		slog.Error("publishing to cluster", "channel", channel, "tenant", env.Tenant, "err", err)
+	}
+}
+
+// ถามทุกผู้ใช้พร้อมกัน ผู้ใช้ที่ไม่มี instance ไหนถือจะได้ no responders กลับมาทันที
+func (n *natsBroker) Online(tenant string, userIDs []string) []string {
+	found := make([]bool, len(userIDs))
+	var wg sync.WaitGroup
+	for i, id := range userIDs {
+		subject := userSubject(tenant, id)
+		if n.holds(subject) {
+			found[i] = true
+			continue
+		}
+		data, _ := json.Marshal(clusterEnvelope{Kind: envelopeProbe, Tenant: tenant, UserID: id, Origin: n.instanceID})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := n.nc.Request(subject, data, clusterOpTimeout)
+			found[i] = err == nil
+		}()
+	}
+	wg.Wait()
+
+	var online []string
+	for i, ok := range found {
+		if ok {
+			online = append(online, userIDs[i])
+		}
+	}
+	return online
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+)
+
+// เปิด NATS server ในตัว แล้วเข้าร่วม cluster คืน connection แยกที่ทำหน้าที่เป็น instance อื่น
+func withNATSCluster(t *testing.T) *nats.Conn {
+	opts := natsserver.DefaultTestOptions
+	opts.Port = -1
+	srv := natsserver.RunServer(&opts)
+	t.Cleanup(srv.Shutdown)
+	if err := startNATSCluster(srv.ClientURL()); err != nil {
+		t.Fatalf("startNATSCluster: %v", err)
+	}
+	t.Cleanup(stopCluster)
+
+	remote, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(remote.Close)
+	return remote
+}
+
+func TestNATSClusterForwardsToRemoteInstance(t *testing.T) {
+	remote := withNATSCluster(t)
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+
+	// instance อื่นที่ bob เชื่อมต่ออยู่
+	received := make(chan *nats.Msg, 1)
+	sub, err := remote.Subscribe(userSubject(DefaultTenant, bob), func(m *nats.Msg) {
+		m.Respond(nil)
+		received <- m
+	})
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	defer sub.Unsubscribe()
+	remote.Flush()
+
+	aliceConn := dialWS(t, alice)
+	if err := aliceConn.WriteJSON(Message{SenderID: alice, ReceiverID: bob, Text: "across"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	var env clusterEnvelope
+	select {
+	case m := <-received:
+		if err := json.Unmarshal(m.Data, &env); err != nil {
+			t.Fatalf("decode envelope: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("message was not forwarded to the remote instance")
+	}
+	if env.Kind != envelopeMessage || env.UserID != bob || env.Message == nil || env.Message.Text != "across" || env.Message.ID == 0 {
+		t.Fatalf("unexpected envelope: %+v", env)
+	}
+
+	// ไม่มี instance ไหนถือ carol: no responders = ไม่ได้ส่งต่อ
+	if sendToUserRemote(DefaultTenant, newTestUser("carol"), frameTypeTyping, map[string]any{"type": frameTypeTyping}) {
+		t.Fatal("forward to a user with no instance should fail")
+	}
+}
+
+func TestNATSClusterDeliversAndTracksPresence(t *testing.T) {
+	remote := withNATSCluster(t)
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+
+	bobConn := dialWS(t, bob)
+	waitFor(t, func() bool { return len(clusterOnline(DefaultTenant, []string{bob, alice})) == 1 })
+
+	// instance อื่นบันทึกข้อความแล้วส่งต่อมาให้
+	msg := Message{TenantID: DefaultTenant, SenderID: alice, ReceiverID: bob, Text: "from afar"}
+	msg.ID = saveMessageToDB(msg)
+	data, _ := json.Marshal(clusterEnvelope{Kind: envelopeMessage, Tenant: DefaultTenant, UserID: bob, Message: &msg})
+	if _, err := remote.Request(userSubject(DefaultTenant, bob), data, time.Second); err != nil {
+		t.Fatalf("request: %v", err)
+	}
+
+	var got Message
+	readJSON(t, bobConn, &got)
+	if got.ID != msg.ID || got.Text != "from afar" {
+		t.Fatalf("unexpected message: %+v", got)
+	}
+
+	// หลุดแล้ว instance อื่นต้องส่งถึง bob ไม่ได้อีก
+	bobConn.Close()
+	waitFor(t, func() bool {
+		_, err := remote.Request(userSubject(DefaultTenant, bob), data, 100*time.Millisecond)
+		return err == nats.ErrNoResponders
+	})
+}
+
+func TestNATSClusterSharesPresenceChanges(t *testing.T) {
+	remote := withNATSCluster(t)
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+
+	aliceConn := dialWS(t, alice)
+	aliceConn.WriteJSON(map[string]any{"type": "presence_subscribe", "users": []string{bob}})
+	var snapshot PresenceSnapshot
+	readJSON(t, aliceConn, &snapshot)
+
+	// bob ออนไลน์ที่ instance อื่น subscriber ของ instance นี้ต้องได้ delta
+	payload, _ := json.Marshal(PresenceDelta{Type: frameTypePresence, Event: "user_online", UserID: bob, Status: presenceOnline})
+	data, _ := json.Marshal(clusterEnvelope{Kind: envelopePresence, Tenant: DefaultTenant, UserID: bob, Payload: payload, Origin: "instance-b"})
+	remote.Publish(natsChannelSubject(presenceChannel), data)
+
+	var delta PresenceDelta
+	readJSON(t, aliceConn, &delta)
+	if delta.UserID != bob || delta.Event != "user_online" {
+		t.Fatalf("unexpected delta: %+v", delta)
+	}
+}
+
+func TestNATSClusterDeliversToDevicesOnEveryInstance(t *testing.T) {
+	remote := withNATSCluster(t)
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+
+	// bob มีอุปกรณ์หนึ่งบน instance นี้ และอีกเครื่องบน instance อื่น
+	bobConn := dialWS(t, bob)
+	received := make(chan *nats.Msg, 1)
+	sub, err := remote.Subscribe(userSubject(DefaultTenant, bob), func(m *nats.Msg) { received <- m })
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	defer sub.Unsubscribe()
+	remote.Flush()
+
+	aliceConn := dialWS(t, alice)
+	if err := aliceConn.WriteJSON(Message{SenderID: alice, ReceiverID: bob, Text: "everywhere"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var got Message
+	readJSON(t, bobConn, &got)
+
+	var env clusterEnvelope
+	select {
+	case m := <-received:
+		json.Unmarshal(m.Data, &env)
+	case <-time.After(2 * time.Second):
+		t.Fatal("message was not forwarded to the device on the other instance")
+	}
+	if env.Kind != envelopeMessage || env.Message == nil || env.Message.ID != got.ID || !env.Mirror {
+		t.Fatalf("unexpected envelope: %+v", env)
+	}
+	// instance นี้ไม่ส่งข้อความเดียวกันให้ตัวเองซ้ำ
+	bobConn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, data, err := bobConn.ReadMessage(); err == nil {
+		t.Fatalf("unexpected duplicate frame: %s", data)
+	}
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+)
+
+// ตัวรับแจ้งเตือนเมื่อมีข้อความถูกเก็บไว้ให้ผู้รับที่ออฟไลน์ (เช่น push notification หรือ webhook)
+type NotificationSink interface {
+	NotifyOffline(msg Message)
+}
+
+// ส่งข้อความเป็น JSON ไปยัง URL ที่ตั้งไว้ (ให้ระบบ push ภายนอกรับต่อ)
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+// payload ที่ POST ไปยัง webhook
+type OfflineNotification struct {
+	Type    string  `json:"type"` // "offline_message"
+	Message Message `json:"message"`
+}
+
+func (s webhookSink) NotifyOffline(msg Message) {
+	body, err := json.Marshal(OfflineNotification{Type: "offline_message", Message: msg})
+	if err != nil {
+		messageLogger(msg).Error("marshalling notification", "err", err)
+		return
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		messageLogger(msg).Error("calling notification webhook", "err", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		messageLogger(msg).Warn("notification webhook rejected message", "status", resp.StatusCode)
+	}
+}
+
+// คิวแจ้งเตือนกับ sink ที่ worker ส่งให้ worker ของข้อความอ่านพร้อมกัน จึงสลับทั้งชุดผ่าน atomic
+type notifyDispatch struct {
+	queue chan Message
+	sink  NotificationSink
+}
+
+var notifications atomic.Pointer[notifyDispatch] // nil = ไม่ได้เปิดการแจ้งเตือน
+
+// ส่งแจ้งเตือนเดียวกันให้ทุก sink ตามลำดับ (เช่น webhook และ push)
+type multiSink []NotificationSink
+
+func (s multiSink) NotifyOffline(msg Message) {
+	for _, sink := range s {
+		sink.NotifyOffline(msg)
+	}
+}
+
+// เลือก sink ตาม config และเปิด worker จำนวนจำกัดสำหรับส่งแจ้งเตือน
+func startNotifier() error {
+	var sinks multiSink
+	if config.NotifyWebhookURL != "" {
+		sinks = append(sinks, webhookSink{url: config.NotifyWebhookURL, client: &http.Client{Timeout: config.NotifyTimeout}})
+	}
+	notifiers, err := newPushNotifiers(config)
+	if err != nil {
+		return err
+	}
+	if len(notifiers) > 0 {
+		sinks = append(sinks, pushSink{notifiers: notifiers})
+	}
+	switch len(sinks) {
+	case 0:
+		return nil
+	case 1:
+		startNotifyWorkers(sinks[0])
+	default:
+		startNotifyWorkers(sinks)
+	}
+	return nil
+}
+
+// เปิด worker ส่งแจ้งเตือนให้ sink
+func startNotifyWorkers(sink NotificationSink) {
+	d := &notifyDispatch{queue: make(chan Message, config.NotifyQueueSize), sink: sink}
+	notifications.Store(d)
+	for i := 0; i < config.NotifyConcurrency; i++ {
+		go func() {
+			for msg := range d.queue {
+				if isMuted(msg) {
+					continue
+				}
+				d.sink.NotifyOffline(msg)
+			}
+		}()
+	}
+}
+
+// แจ้งเตือนแบบ async ไม่ block worker ถ้าคิวเต็มจะทิ้งการแจ้งเตือน (ข้อความยังอยู่ใน DB)
+func notifyOffline(msg Message) {
+	d := notifications.Load()
+	if d == nil {
+		return
+	}
+	select {
+	case d.queue <- msg:
+	default:
+		notificationsDroppedTotal.Inc()
+		messageLogger(msg).Warn("notification queue full, dropped notification")
+	}
+}
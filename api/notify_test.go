@@ -0,0 +1,66 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+// sink ที่ส่งทุกการแจ้งเตือนเข้า channel
+type notifyRecorder chan Message
+
+func (s notifyRecorder) NotifyOffline(msg Message) { s <- msg }
+
+func TestOfflineNotificationOnlyForOfflineRecipients(t *testing.T) {
+	sink := make(notifyRecorder, 10)
+	startNotifyWorkers(sink)
+	t.Cleanup(func() { notifications.Store(nil) })
+
+	alice, bob, carol := newTestUser("alice"), newTestUser("bob"), newTestUser("carol")
+	aliceConn := dialWS(t, alice)
+	bobConn := dialWS(t, bob)
+
+	// bob ออนไลน์: ได้ข้อความ ไม่ได้แจ้งเตือน
+	aliceConn.WriteJSON(Message{SenderID: alice, ReceiverID: bob, Text: "online"})
+	var got Message
+	readJSON(t, bobConn, &got)
+
+	aliceConn.WriteJSON(Message{SenderID: alice, ReceiverID: carol, Text: "offline"})
+	select {
+	case msg := <-sink:
+		if msg.ReceiverID != carol || msg.Text != "offline" {
+			t.Fatalf("notified for the wrong message: %+v", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("offline recipient was not notified")
+	}
+	select {
+	case msg := <-sink:
+		t.Fatalf("unexpected extra notification: %+v", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestNotificationQueueDropsWhenFull(t *testing.T) {
+	// คิวขนาด 1 ที่ไม่มี worker อ่าน: การแจ้งเตือนที่สองต้องถูกทิ้งโดยไม่ block ผู้เรียก
+	d := &notifyDispatch{queue: make(chan Message, 1), sink: make(notifyRecorder)}
+	notifications.Store(d)
+	t.Cleanup(func() { notifications.Store(nil) })
+
+	done := make(chan struct{})
+	go func() {
+		notifyOffline(Message{ReceiverID: "bob", Text: "first"})
+		notifyOffline(Message{ReceiverID: "bob", Text: "second"})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("notifyOffline blocked on a full queue")
+	}
+	if len(d.queue) != 1 {
+		t.Fatalf("expected one queued notification, got %d", len(d.queue))
+	}
+	if msg := <-d.queue; msg.Text != "first" {
+		t.Fatalf("expected the first notification to be kept, got %q", msg.Text)
+	}
+}
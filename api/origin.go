@@ -0,0 +1,55 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+)
+
+// ตรวจสอบว่า origin อยู่ใน allowlist หรือไม่ (DevMode = อนุญาตทุก origin)
+func isOriginAllowed(origin string) bool {
+	if config.DevMode {
+		return true
+	}
+	for _, allowed := range config.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// ค่าใน AllowedOrigins ต้องตรงกับ header Origin ที่ browser ส่ง (ไม่มี path หรือ / ปิดท้าย)
+func validateOrigin(origin string) error {
+	if origin == "*" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" || u.RawQuery != "" || u.User != nil {
+		return fmt.Errorf("invalid origin %q (want scheme://host[:port])", origin)
+	}
+	return nil
+}
+
+// middleware ตรวจ Origin ก่อน upgrade WebSocket (กัน Cross-Site WebSocket Hijacking)
+// client ที่ไม่ใช่ browser จะไม่ส่ง Origin มา จึงอนุญาตให้ผ่าน
+func checkOrigin(c *fiber.Ctx) error {
+	origin := c.Get(fiber.HeaderOrigin)
+	if origin != "" && !isOriginAllowed(origin) {
+		slog.Info("rejected WebSocket upgrade", "request_id", requestIDOf(c), "origin", origin)
+		return Forbidden("Origin not allowed")
+	}
+	return c.Next()
+}
+
+// CORS สำหรับ REST API ใช้ allowlist เดียวกับ WebSocket (ตอบ origin ที่อนุญาตกลับไปทีละ origin พร้อม Vary: Origin)
+func corsMiddleware() fiber.Handler {
+	return cors.New(cors.Config{
+		AllowOriginsFunc: isOriginAllowed,
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, X-Request-ID",
+	})
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	fws "github.com/fasthttp/websocket"
+)
+
+func TestWebSocketOriginCheck(t *testing.T) {
+	url := "ws://" + testAddr + "/ws/chat/" + newTestUser("origin")
+
+	allowed := http.Header{"Origin": {"http://allowed.example"}}
+	conn, _, err := fws.DefaultDialer.Dial(url, allowed)
+	if err != nil {
+		t.Fatalf("allowed origin rejected: %v", err)
+	}
+	conn.Close()
+
+	denied := http.Header{"Origin": {"http://evil.example"}}
+	_, resp, err := fws.DefaultDialer.Dial(url, denied)
+	if err == nil {
+		t.Fatal("disallowed origin was upgraded")
+	}
+	if resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403, got %v", resp)
+	}
+}
+
+func TestCORSHeadersOnREST(t *testing.T) {
+	for origin, want := range map[string]string{
+		"http://allowed.example": "http://allowed.example",
+		"http://evil.example":    "",
+	} {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+testAddr+"/online", nil)
+		req.Header.Set("Origin", origin)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		resp.Body.Close()
+		if got := resp.Header.Get("Access-Control-Allow-Origin"); got != want {
+			t.Fatalf("origin %s: expected allow-origin %q, got %q", origin, want, got)
+		}
+	}
+}
+
+func TestDevModeAllowsAnyOrigin(t *testing.T) {
+	prev := config.DevMode
+	config.DevMode = true
+	defer func() { config.DevMode = prev }()
+
+	url := "ws://" + testAddr + "/ws/chat/" + newTestUser("origin")
+	conn, _, err := fws.DefaultDialer.Dial(url, http.Header{"Origin": {"http://evil.example"}})
+	if err != nil {
+		t.Fatalf("dev mode rejected origin: %v", err)
+	}
+	conn.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, "http://"+testAddr+"/online", nil)
+	req.Header.Set("Origin", "null")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "null" {
+		t.Fatalf("expected allow-origin null in dev mode, got %q", got)
+	}
+}
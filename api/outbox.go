@@ -0,0 +1,237 @@
+package api
+
+import (
+	"cmp"
+	"database/sql"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// สถานะของข้อความใน outbox
+const (
+	outboxPending   = "pending"   // รับมาแล้ว ยังไม่ได้ส่ง/บันทึก
+	outboxDelivered = "delivered" // ส่งถึงผู้รับที่ออนไลน์แล้ว
+	outboxPersisted = "persisted" // ผู้รับออฟไลน์ บันทึกลง messages รอส่งตอนเชื่อมต่อ
+	outboxDropped   = "dropped"   // คิวเต็ม ปฏิเสธข้อความ (client ได้ error frame แล้ว)
+	outboxSpilled   = "spilled"   // คิวเต็ม พักไว้ให้ drainSpilled ส่งเข้าคิวเมื่อมีที่ว่าง (overflow แบบ spill)
+)
+
+// ความถี่ที่ตรวจหาข้อความที่พักไว้ใน outbox และจำนวนต่อรอบ
+const (
+	spillDrainInterval = 200 * time.Millisecond
+	spillDrainBatch    = 500
+)
+
+// connection ของข้อความที่พักไว้ (outbox id -> *client) เพื่อให้ยังตอบ ack ได้หลังส่งเข้าคิวใหม่
+var spilledOrigins sync.Map
+
+// จำนวนข้อความที่พักอยู่ใน outbox ตอนนี้ ถ้ายังมี ข้อความใหม่ต้องพักต่อท้ายเพื่อไม่ให้แซงคิว
+var spilledCount atomic.Int64
+
+// เก็บแถวที่จบแล้วไว้ช่วงหนึ่งเพื่อใช้ตรวจสอบย้อนหลัง
+const outboxKeepCompleted = time.Hour
+
+// แถวที่ยังไม่จบเป็นของ instance ที่รับข้อความมา (owner_id = localInstanceID) และต่ออายุ lease ทุก outboxLeaseRenew
+// เมื่อใช้ฐานข้อมูลร่วมกันหลาย replica instance อื่นรับแถวไปส่งต่อได้เฉพาะเมื่อ lease หมดแล้ว (เจ้าของตายไป)
+// ไม่งั้น replica ที่เพิ่งเปิดจะส่งซ้ำข้อความที่ replica อื่นกำลังจัดการอยู่
+const (
+	outboxLease      = 30 * time.Second
+	outboxLeaseRenew = 10 * time.Second
+)
+
+// บันทึกข้อความที่รับมาจาก WebSocket ลง outbox ทันที ก่อนเข้าคิว
+// ถ้า process crash ระหว่างอยู่ในคิว ข้อความจะถูกส่งใหม่ตอนเปิด server (at-least-once)
+//
+// การส่งซ้ำหลัง crash อาจทำให้ผู้รับได้ข้อความเดิมสองครั้ง client จึงควรใส่ client_msg_id
+// ทุกข้อความ เพื่อให้ server ตัดข้อความซ้ำด้วย unique index และให้ฝั่งรับกรองด้วย id
+func addToOutbox(msg Message) (int64, error) {
+	payload, keyVersion, err := sealPayload(msg)
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	err = retryOnBusy("saving outbox", func() error {
+		now := time.Now().UTC()
+		return db.QueryRow("INSERT INTO outbox (tenant_id, payload, key_version, status, owner_id, lease_until, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id", tenantOrDefault(msg.TenantID), payload, keyVersion, outboxPending, localInstanceID, now.Add(outboxLease), now, now).Scan(&id)
+	})
+	return id, err
+}
+
+// อัปเดตสถานะของข้อความใน outbox หลัง worker จัดการเสร็จ
+func completeOutbox(id int64, status string) {
+	if id == 0 {
+		return
+	}
+	if _, err := db.Exec("UPDATE outbox SET status = ?, updated_at = ? WHERE id = ?", status, time.Now().UTC(), id); err != nil {
+		slog.Error("updating outbox", "outbox_id", id, "err", err)
+	}
+}
+
+// รับแถว pending/spilled ที่ lease หมดแล้ว (จากการ crash ของ instance นี้รอบก่อนหรือ replica อื่น) มาเป็นของตัวเอง
+// แล้วส่งเข้าคิวใหม่ ต้องเรียกหลัง startWorkers แถวที่พักไว้ถูกส่งใหม่ด้วย แม้จะเปลี่ยน BroadcastOverflow ไปแล้ว
+// แถวที่ replica อื่นยังต่ออายุอยู่ไม่ถูกแตะ
+func recoverOutbox() {
+	now := time.Now().UTC()
+	rows, err := db.Query("UPDATE outbox SET status = ?, owner_id = ?, lease_until = ?, updated_at = ? WHERE status IN (?, ?) AND (lease_until IS NULL OR lease_until < ?) RETURNING id, tenant_id, payload, key_version",
+		outboxPending, localInstanceID, now.Add(outboxLease), now, outboxPending, outboxSpilled, now)
+	if err != nil {
+		slog.Error("claiming outbox", "err", err)
+		return
+	}
+	pending, err := scanOutbox(rows)
+	if err != nil {
+		slog.Error("loading outbox", "err", err)
+		return
+	}
+	// RETURNING ไม่รับประกันลำดับ
+	slices.SortFunc(pending, func(a, b queuedMessage) int { return cmp.Compare(a.outboxID, b.outboxID) })
+
+	for _, msg := range pending {
+		if !enqueueMessage(msg) {
+			// ยังเป็น pending ของ instance นี้ ปล่อยให้ lease หมดแล้วรับกลับมาใหม่รอบถัดไป
+			messageLogger(msg.Message).Warn("outbox message not requeued: broadcast queue is full", "outbox_id", msg.outboxID)
+		}
+	}
+	if len(pending) > 0 {
+		slog.Info("requeued pending outbox messages", "count", len(pending))
+	}
+}
+
+// ต่ออายุ lease ของแถวที่ instance นี้ยังจัดการไม่เสร็จ
+func renewOutboxLeases(now time.Time) {
+	if _, err := db.Exec("UPDATE outbox SET lease_until = ? WHERE owner_id = ? AND status IN (?, ?)", now.Add(outboxLease).UTC(), localInstanceID, outboxPending, outboxSpilled); err != nil {
+		slog.Error("renewing outbox leases", "err", err)
+	}
+}
+
+// ต่ออายุ lease ของตัวเอง และรับแถวของ instance ที่ตายไปมาส่งต่อเป็นระยะ
+func startOutboxLeases() {
+	go func() {
+		ticker := time.NewTicker(outboxLeaseRenew)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			renewOutboxLeases(now)
+			recoverOutbox()
+		}
+	}()
+}
+
+// โหลดข้อความใน outbox ของ instance นี้ตามสถานะ เรียงตามลำดับที่รับมา (limit 0 = ทั้งหมด)
+func loadOutbox(status string, limit int) ([]queuedMessage, error) {
+	query := "SELECT id, tenant_id, payload, key_version FROM outbox WHERE status = ? AND owner_id = ? ORDER BY id"
+	args := []any{status, localInstanceID}
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanOutbox(rows)
+}
+
+// decode แถวของ outbox (id, tenant_id, payload, key_version) แถวที่ decode ไม่ได้ถูก mark dropped
+func scanOutbox(rows *sql.Rows) ([]queuedMessage, error) {
+	var msgs []queuedMessage
+	for rows.Next() {
+		var id int64
+		var tenant, payload string
+		var keyVersion int
+		if err := rows.Scan(&id, &tenant, &payload, &keyVersion); err != nil {
+			slog.Error("scanning outbox", "err", err)
+			continue
+		}
+		var msg Message
+		if err := openPayload(payload, keyVersion, &msg); err != nil {
+			slog.Error("decoding outbox", "outbox_id", id, "err", err)
+			completeOutbox(id, outboxDropped)
+			continue
+		}
+		msg.TenantID = tenant
+		msgs = append(msgs, queuedMessage{Message: msg, outboxID: id})
+	}
+	rows.Close()
+	return msgs, rows.Err()
+}
+
+// พักข้อความที่เข้าคิวไม่ได้ไว้ใน outbox คืนค่า false ถ้าไม่มีแถวใน outbox ให้พัก
+func spillMessage(msg queuedMessage) bool {
+	if msg.outboxID == 0 {
+		return false
+	}
+	if msg.origin != nil {
+		spilledOrigins.Store(msg.outboxID, msg.origin)
+	}
+	completeOutbox(msg.outboxID, outboxSpilled)
+	spilledCount.Add(1)
+	messageLogger(msg.Message).Debug("spilled message to outbox", "outbox_id", msg.outboxID)
+	return true
+}
+
+// ส่งข้อความที่พักไว้เข้าคิวตามลำดับเท่าที่คิวมีที่ว่าง คืนค่าจำนวนที่ส่งเข้าคิว
+// เปลี่ยนสถานะเป็น pending ก่อนเข้าคิว (worker อาจจัดการเสร็จก่อนที่จะอัปเดตได้)
+func drainSpilled() int {
+	spilled, err := loadOutbox(outboxSpilled, spillDrainBatch)
+	if err != nil {
+		slog.Error("loading spilled outbox", "err", err)
+		return 0
+	}
+
+	drained := 0
+	for _, msg := range spilled {
+		queue := broadcast
+		if msg.Priority == priorityHigh {
+			queue = priorityBroadcast
+		}
+		if len(queue) >= cap(queue) {
+			break
+		}
+		if origin, ok := spilledOrigins.LoadAndDelete(msg.outboxID); ok {
+			msg.origin = origin.(*client)
+		}
+		completeOutbox(msg.outboxID, outboxPending)
+		spilledCount.Add(-1)
+		select {
+		case queue <- msg:
+			drained++
+		default:
+			// worker อื่นเติมคิวเต็มพอดี พักไว้ตามเดิม
+			spillMessage(msg)
+			return drained
+		}
+	}
+	return drained
+}
+
+// เปิด goroutine ส่งข้อความที่พักไว้ (เฉพาะเมื่อใช้ overflow แบบ spill)
+func startSpillDrainer() {
+	if config.BroadcastOverflow != overflowSpill {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(spillDrainInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n := drainSpilled(); n > 0 {
+				slog.Debug("requeued spilled messages", "count", n)
+			}
+		}
+	}()
+}
+
+// ลบแถวที่จบแล้วและเก่ากว่า outboxKeepCompleted เป็นระยะ
+func startOutboxSweeper() {
+	go func() {
+		ticker := time.NewTicker(10 * time.Minute)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			if _, err := db.Exec("DELETE FROM outbox WHERE status NOT IN (?, ?) AND updated_at < ?", outboxPending, outboxSpilled, now.Add(-outboxKeepCompleted).UTC()); err != nil {
+				slog.Error("sweeping outbox", "err", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPendingOutboxIsReplayedOnStartup(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+
+	// จำลองข้อความที่รับมาแล้วแต่ process crash ก่อน worker จัดการ (lease ไม่ถูกต่ออายุจนหมด)
+	id, err := addToOutbox(Message{SenderID: alice, ReceiverID: bob, Text: "survived a crash", ClientMsgID: "crash-1"})
+	if err != nil {
+		t.Fatalf("addToOutbox: %v", err)
+	}
+	db.Exec("UPDATE outbox SET owner_id = ?, lease_until = ? WHERE id = ?", "crashed-instance", time.Now().Add(-time.Second).UTC(), id)
+
+	recoverOutbox()
+
+	waitFor(t, func() bool {
+		var status string
+		db.QueryRow("SELECT status FROM outbox WHERE id = ?", id).Scan(&status)
+		return status == outboxPersisted
+	})
+	if n := countStored(t, alice, bob, true); n != 1 {
+		t.Fatalf("expected recovered message to be stored once, got %d", n)
+	}
+	var owner string
+	db.QueryRow("SELECT owner_id FROM outbox WHERE id = ?", id).Scan(&owner)
+	if owner != localInstanceID {
+		t.Fatalf("recovered row should belong to this instance, got %q", owner)
+	}
+}
+
+func TestRecoverOutboxSkipsRowsLeasedByLiveReplica(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+
+	// replica อื่นที่ยังทำงานอยู่เพิ่งรับข้อความนี้ไว้
+	id, err := addToOutbox(Message{SenderID: alice, ReceiverID: bob, Text: "in flight elsewhere"})
+	if err != nil {
+		t.Fatalf("addToOutbox: %v", err)
+	}
+	leaseUntil := time.Now().Add(outboxLease).UTC()
+	db.Exec("UPDATE outbox SET owner_id = ?, lease_until = ? WHERE id = ?", "live-replica", leaseUntil, id)
+
+	recoverOutbox()
+	renewOutboxLeases(time.Now())
+	time.Sleep(100 * time.Millisecond)
+
+	var status, owner string
+	db.QueryRow("SELECT status, owner_id FROM outbox WHERE id = ?", id).Scan(&status, &owner)
+	if status != outboxPending || owner != "live-replica" {
+		t.Fatalf("row of a live replica was taken over: status=%q owner=%q", status, owner)
+	}
+	if n := countStored(t, alice, bob, false); n != 0 {
+		t.Fatalf("message of a live replica was delivered twice, stored %d", n)
+	}
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"time"
+
+	"go-socket/protocol"
+)
+
+// ระยะห่างขั้นต่ำระหว่าง ping_app ของ connection เดียวกัน (กัน client ใช้เป็นช่องทาง flood)
+const pingAppMinInterval = 500 * time.Millisecond
+
+// คำขอทดสอบ connection จาก client ({"type":"ping_app","client_ts":...})
+type PingApp = protocol.PingApp
+
+// คำตอบของ ping_app
+type PongApp = protocol.PongApp
+
+// ตอบ ping_app ทันทีทาง connection เดิม โดยไม่แตะ DB หรือคิว broadcast
+func handlePingApp(cl *client, raw []byte) {
+	now := time.Now()
+	if now.Sub(cl.lastPingApp) < pingAppMinInterval {
+		cl.send(ErrorFrame{Type: frameTypeError, Code: errCodeRateLimited, Detail: "ping_app sent too often"})
+		return
+	}
+	cl.lastPingApp = now
+
+	var req PingApp
+	if err := cl.codec.Unmarshal(raw, &req); err != nil {
+		return
+	}
+	cl.send(PongApp{Type: frameTypePongApp, ClientTS: req.ClientTS, ServerTS: now.UnixMilli()})
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ค่า default และค่าสูงสุดของ ?wait=
+const (
+	defaultPollWait = 25 * time.Second
+	maxPollWait     = 60 * time.Second
+	pollBuffer      = 100
+)
+
+// long-poll request ที่รอข้อความอยู่ (1 ต่อผู้ใช้)
+type poller struct {
+	mu     sync.Mutex
+	closed bool
+	ch     chan Message
+	done   chan struct{} // ถูกปิดเมื่อ poller ถูกแทนที่หรือจบการรอ
+}
+
+var pollers sync.Map // tenantKey -> *poller
+
+// ส่งข้อความให้ poller ที่รออยู่ คืนค่า false ถ้าไม่มี poller หรือ buffer เต็ม
+func offerToPoller(msg Message) bool {
+	v, exists := pollers.Load(tenantKey(msg.TenantID, msg.ReceiverID))
+	if !exists {
+		return false
+	}
+	p := v.(*poller)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return false
+	}
+	select {
+	case p.ch <- msg:
+		messageLogger(msg).Debug("message delivered to long-poll")
+		return true
+	default:
+		return false
+	}
+}
+
+// ปิด poller และคืนข้อความที่ยังค้างใน buffer
+func (p *poller) close() []Message {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.done)
+	}
+	p.mu.Unlock()
+
+	var rest []Message
+	for {
+		select {
+		case msg := <-p.ch:
+			rest = append(rest, msg)
+		default:
+			return rest
+		}
+	}
+}
+
+// GET /poll/:userID?wait=25s
+// คืนข้อความที่ค้างอยู่ทันที ถ้าไม่มีจะรอจนกว่ามีข้อความใหม่หรือหมดเวลา
+func handlePoll(c *fiber.Ctx) error {
+	tenant, userID := TenantOf(c), c.Params("userID")
+
+	wait := defaultPollWait
+	if v := c.Query("wait"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return InvalidRequest("Invalid wait duration")
+		}
+		wait = min(d, maxPollWait)
+	}
+
+	// ข้อความที่เก็บไว้ตอนออฟไลน์
+	pending, err := messageStore.PendingFor(tenant, userID)
+	if err != nil {
+		return Internal("Error fetching messages", err)
+	}
+	if len(pending) > 0 {
+		ids := make([]int64, len(pending))
+		for i, msg := range pending {
+			ids[i] = msg.ID
+		}
+		markDelivered(ids)
+		return c.JSON(fiber.Map{"messages": pending})
+	}
+
+	// ลงทะเบียน poller ใหม่ (แทนที่ poller เดิมของผู้ใช้คนนี้ถ้ามี)
+	p := &poller{ch: make(chan Message, pollBuffer), done: make(chan struct{})}
+	key := tenantKey(tenant, userID)
+	messages := make([]Message, 0)
+	if old, loaded := pollers.Swap(key, p); loaded {
+		// poller เดิมจะคืนผลเปล่าทันที ข้อความที่ค้างอยู่ตอบกลับใน request นี้เลย
+		// (ไม่ส่งต่อผ่าน p.ch เพราะ offerToPoller อาจเติม buffer จนเต็มไปแล้ว ทำให้ค้าง)
+		messages = append(messages, old.(*poller).close()...)
+	}
+
+	if len(messages) == 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case msg := <-p.ch:
+			messages = append(messages, msg)
+		case <-timer.C:
+		case <-p.done:
+		}
+		timer.Stop()
+	}
+
+	pollers.CompareAndDelete(key, p)
+	messages = append(messages, p.close()...)
+	return c.JSON(fiber.Map{"messages": messages})
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// ผลของ GET /poll/:userID
+type pollResult struct {
+	Messages []Message `json:"messages"`
+	Err      error
+}
+
+// เปิด long-poll ใน goroutine แล้วคืน channel ที่ได้ผลเมื่อ request จบ
+func startPoll(userID, wait string) <-chan pollResult {
+	out := make(chan pollResult, 1)
+	go func() {
+		var res pollResult
+		resp, err := http.Get("http://" + testAddr + "/poll/" + userID + "?wait=" + wait)
+		if err != nil {
+			res.Err = err
+		} else {
+			res.Err = json.NewDecoder(resp.Body).Decode(&res)
+			resp.Body.Close()
+		}
+		out <- res
+	}()
+	return out
+}
+
+// รอผลของ long-poll (สูงสุด 2 วินาที)
+func awaitPoll(t *testing.T, ch <-chan pollResult) []Message {
+	t.Helper()
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			t.Fatalf("poll: %v", res.Err)
+		}
+		return res.Messages
+	case <-time.After(2 * time.Second):
+		t.Fatal("poll did not return in time")
+		return nil
+	}
+}
+
+// poller ที่ลงทะเบียนอยู่ของผู้ใช้ (nil ถ้าไม่มี)
+func currentPoller(userID string) *poller {
+	v, ok := pollers.Load(tenantKey(DefaultTenant, userID))
+	if !ok {
+		return nil
+	}
+	return v.(*poller)
+}
+
+func TestLongPollReceivesNewMessage(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+
+	result := startPoll(bob, "5s")
+	waitFor(t, func() bool { return currentPoller(bob) != nil })
+
+	dispatchMessage(Message{SenderID: alice, ReceiverID: bob, Text: "via poll"})
+
+	messages := awaitPoll(t, result)
+	if len(messages) != 1 || messages[0].Text != "via poll" {
+		t.Fatalf("unexpected messages: %+v", messages)
+	}
+	if currentPoller(bob) != nil {
+		t.Fatal("poller still registered after request finished")
+	}
+	// ส่งถึงทาง long-poll แล้ว ไม่ต้องค้างไว้ให้ส่งซ้ำ
+	if n := countStored(t, alice, bob, true); n != 1 {
+		t.Fatalf("expected the message to be stored once, got %d", n)
+	}
+	if pending, _ := messageStore.PendingFor(DefaultTenant, bob); len(pending) != 0 {
+		t.Fatalf("delivered message is still pending: %+v", pending)
+	}
+}
+
+func TestLongPollTimesOutEmpty(t *testing.T) {
+	bob := newTestUser("bob")
+
+	start := time.Now()
+	messages := awaitPoll(t, startPoll(bob, "100ms"))
+	if len(messages) != 0 {
+		t.Fatalf("expected no messages, got %+v", messages)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("poll returned before wait elapsed: %v", elapsed)
+	}
+	if currentPoller(bob) != nil {
+		t.Fatal("poller still registered after timeout")
+	}
+}
+
+func TestLongPollReturnsPendingImmediately(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: "while offline"})
+
+	messages := awaitPoll(t, startPoll(bob, "30s"))
+	if len(messages) != 1 || messages[0].Text != "while offline" {
+		t.Fatalf("unexpected messages: %+v", messages)
+	}
+	if currentPoller(bob) != nil {
+		t.Fatal("poller registered although pending messages were returned")
+	}
+}
+
+func TestNewLongPollReplacesOld(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+
+	first := startPoll(bob, "5s")
+	waitFor(t, func() bool { return currentPoller(bob) != nil })
+	old := currentPoller(bob)
+
+	second := startPoll(bob, "5s")
+	// poller เดิมคืนผลเปล่าทันทีที่ถูกแทนที่
+	if messages := awaitPoll(t, first); len(messages) != 0 {
+		t.Fatalf("replaced poll got messages: %+v", messages)
+	}
+	waitFor(t, func() bool { p := currentPoller(bob); return p != nil && p != old })
+
+	dispatchMessage(Message{SenderID: alice, ReceiverID: bob, Text: "to new poll"})
+	messages := awaitPoll(t, second)
+	if len(messages) != 1 || messages[0].Text != "to new poll" {
+		t.Fatalf("unexpected messages: %+v", messages)
+	}
+	if currentPoller(bob) != nil {
+		t.Fatal("poller still registered after request finished")
+	}
+}
+
+func TestReplacedPollerHandsOverBufferedMessages(t *testing.T) {
+	bob := newTestUser("bob")
+
+	// poller เดิมที่ buffer เต็ม ต้องไม่ทำให้ request ใหม่ค้าง
+	old := &poller{ch: make(chan Message, pollBuffer), done: make(chan struct{})}
+	for i := 0; i < pollBuffer; i++ {
+		old.ch <- Message{SenderID: "alice", ReceiverID: bob, Text: "buffered"}
+	}
+	pollers.Store(tenantKey(DefaultTenant, bob), old)
+
+	messages := awaitPoll(t, startPoll(bob, "5s"))
+	if len(messages) != pollBuffer {
+		t.Fatalf("expected %d handed-over messages, got %d", pollBuffer, len(messages))
+	}
+	select {
+	case <-old.done:
+	default:
+		t.Fatal("old poller was not closed")
+	}
+	if currentPoller(bob) != nil {
+		t.Fatal("poller still registered after request finished")
+	}
+}
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go-socket/protocol"
+)
+
+// จำนวนผู้ใช้สูงสุดต่อการถาม presence หนึ่งครั้ง
+const maxPresenceUsers = 1000
+
+// คำขอตรวจสถานะออนไลน์ของผู้ใช้หลายคน (POST /presence)
+type PresenceRequest struct {
+	UserIDs []string `json:"user_ids"`
+}
+
+// สถานะของผู้ใช้หนึ่งคน (last_seen มีเฉพาะคนที่ออฟไลน์และเคยเชื่อมต่อ)
+type Presence struct {
+	Online   bool       `json:"online"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+}
+
+// บันทึกเวลาที่ผู้ใช้ออฟไลน์ล่าสุด
+func recordLastSeen(tenant, userID string, at time.Time) {
+	_, err := db.Exec("INSERT INTO presence (tenant_id, user_id, last_seen) VALUES (?, ?, ?) ON CONFLICT (tenant_id, user_id) DO UPDATE SET last_seen = excluded.last_seen", tenant, userID, at.UTC())
+	if err != nil {
+		slog.Error("recording last seen", "tenant", tenant, "user_id", userID, "err", err)
+	}
+}
+
+// ดึงสถานะของผู้ใช้หลายคน: คนที่ออนไลน์ดูจาก registry (และ cluster) อย่างเดียว
+// query last_seen เฉพาะคนที่ออฟไลน์
+func getPresence(tenant string, userIDs []string) (map[string]Presence, error) {
+	result := make(map[string]Presence, len(userIDs))
+	offline := []any{tenant}
+	remote := clusterOnline(tenant, userIDs)
+	for _, id := range userIDs {
+		if registry.Online(tenant, id) || slices.Contains(remote, id) {
+			result[id] = Presence{Online: true}
+			continue
+		}
+		result[id] = Presence{}
+		offline = append(offline, id)
+	}
+	if len(offline) == 1 {
+		return result, nil
+	}
+
+	query := fmt.Sprintf("SELECT user_id, last_seen FROM presence WHERE tenant_id = ? AND user_id IN (%s)", strings.Join(makePlaceholders(len(offline)-1), ","))
+	rows, err := db.Query(query, offline...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var lastSeen time.Time
+		if err := rows.Scan(&id, &lastSeen); err != nil {
+			return nil, err
+		}
+		result[id] = Presence{LastSeen: &lastSeen}
+	}
+	return result, rows.Err()
+}
+
+// POST /presence  {"user_ids": [...]}
+func handlePresence(c *fiber.Ctx) error {
+	var req PresenceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return InvalidRequest("Invalid request body")
+	}
+	userIDs := uniqueIDs(req.UserIDs)
+	if len(userIDs) == 0 {
+		return InvalidRequest("user_ids is required")
+	}
+	if len(userIDs) > maxPresenceUsers {
+		return InvalidRequest(fmt.Sprintf("Too many user_ids (max %d)", maxPresenceUsers))
+	}
+
+	presence, err := getPresence(TenantOf(c), userIDs)
+	if err != nil {
+		return Internal("Error fetching presence", err)
+	}
+	return c.JSON(presence)
+}
+
+// สถานะที่ส่งใน presence delta
+const (
+	presenceOnline  = "online"
+	presenceOffline = "offline"
+)
+
+// ชื่อ event ของ presence delta ตามสถานะ
+var presenceEvents = map[string]string{
+	presenceOnline:  "user_online",
+	presenceOffline: "user_offline",
+}
+
+// คำขอติดตาม presence ทาง WebSocket ({"type":"presence_subscribe","users":[...]})
+// ไม่ระบุ users = ติดตามทุกคน
+type PresenceSubscribe = protocol.PresenceSubscribe
+
+// รายชื่อผู้ใช้ที่ออนไลน์ตอน subscribe (ส่งครั้งเดียว)
+type PresenceSnapshot = protocol.PresenceSnapshot
+
+// การเปลี่ยนสถานะของผู้ใช้หนึ่งคน
+type PresenceDelta = protocol.PresenceDelta
+
+// connection ที่ติดตาม presence อยู่ (*client -> map[string]bool ของผู้ใช้ที่สนใจ, nil = ทุกคน)
+var presenceSubscribers sync.Map
+
+// กันไม่ให้ delta ถูกส่งแทรกก่อน snapshot ของ subscriber ใหม่
+var presenceMu sync.RWMutex
+
+// ลงทะเบียนรับ presence delta แล้วส่ง snapshot ปัจจุบันให้ก่อน
+func handlePresenceSubscribe(cl *client, raw []byte) {
+	var req PresenceSubscribe
+	if err := cl.codec.Unmarshal(raw, &req); err != nil {
+		return
+	}
+	users := uniqueIDs(req.Users)
+	if len(users) > maxPresenceUsers {
+		cl.send(ErrorFrame{Type: frameTypeError, Code: errCodeInvalidRequest, Detail: fmt.Sprintf("Too many users (max %d)", maxPresenceUsers)})
+		return
+	}
+	var filter map[string]bool
+	if len(users) > 0 {
+		filter = make(map[string]bool, len(users))
+		for _, id := range users {
+			filter[id] = true
+		}
+	}
+
+	presenceMu.Lock()
+	defer presenceMu.Unlock()
+	presenceSubscribers.Store(cl, filter)
+
+	online := make([]string, 0)
+	for _, id := range getOnlineUsers(cl.tenant) {
+		if filter == nil || filter[id] {
+			online = append(online, id)
+		}
+	}
+	// ผู้ใช้ที่เชื่อมต่อกับ instance อื่น (ถามได้เฉพาะรายชื่อที่ระบุ ไม่ไล่ดูทั้ง cluster)
+	if filter != nil {
+		for _, id := range clusterOnline(cl.tenant, users) {
+			if !slices.Contains(online, id) {
+				online = append(online, id)
+			}
+		}
+	}
+	cl.send(PresenceSnapshot{Type: frameTypePresenceSnapshot, Online: online})
+}
+
+// เลิกติดตาม presence (ตอน disconnect หรือ client ส่ง presence_unsubscribe)
+func unsubscribePresence(cl *client) {
+	presenceSubscribers.Delete(cl)
+}
+
+// แจ้งการเปลี่ยนสถานะให้ subscriber ของ instance นี้ และ instance อื่นใน cluster
+func publishPresence(tenant, userID, status string) {
+	delta := PresenceDelta{Type: frameTypePresence, Event: presenceEvents[status], UserID: userID, Status: status}
+	if status == presenceOffline {
+		now := time.Now().UTC()
+		delta.LastSeen = &now
+	}
+	publishPresenceLocal(tenant, delta)
+	clusterPublishPresence(tenant, delta)
+	streamEvent(ChatEvent{Type: eventPresence, TenantID: tenant, UserID: userID, Status: status})
+}
+
+// ส่ง delta ให้ทุก connection ใน tenant เดียวกันที่ติดตามผู้ใช้คนนี้ (ยกเว้นตัวเอง)
+func publishPresenceLocal(tenant string, delta PresenceDelta) {
+	userID := delta.UserID
+
+	presenceMu.RLock()
+	defer presenceMu.RUnlock()
+	presenceSubscribers.Range(func(key, value any) bool {
+		cl := key.(*client)
+		filter := value.(map[string]bool)
+		if cl.tenant != tenant || cl.userID == userID || (filter != nil && !filter[userID]) {
+			return true
+		}
+		if err := cl.send(delta); err != nil && !errors.Is(err, errClientClosed) {
+			cl.logger().Warn("sending presence", "err", err)
+		}
+		return true
+	})
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPresenceSubscribeStreamsDeltas(t *testing.T) {
+	alice, bob, carol, dave := newTestUser("alice"), newTestUser("bob"), newTestUser("carol"), newTestUser("dave")
+	daveConn := dialWS(t, dave)
+	defer daveConn.Close()
+
+	aliceConn := dialWS(t, alice)
+	if err := aliceConn.WriteJSON(map[string]any{"type": "presence_subscribe", "users": []string{bob, dave}}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var snapshot PresenceSnapshot
+	readJSON(t, aliceConn, &snapshot)
+	if snapshot.Type != frameTypePresenceSnapshot || len(snapshot.Online) != 1 || snapshot.Online[0] != dave {
+		t.Fatalf("unexpected snapshot: %+v", snapshot)
+	}
+
+	// carol ไม่ได้อยู่ในรายชื่อที่ติดตาม ต้องไม่มี delta
+	dialWS(t, carol)
+	bobConn := dialWS(t, bob)
+
+	var delta PresenceDelta
+	readJSON(t, aliceConn, &delta)
+	if delta.Type != frameTypePresence || delta.Event != "user_online" || delta.UserID != bob || delta.Status != presenceOnline {
+		t.Fatalf("unexpected delta: %+v", delta)
+	}
+
+	bobConn.Close()
+	readJSON(t, aliceConn, &delta)
+	if delta.UserID != bob || delta.Event != "user_offline" || delta.Status != presenceOffline || delta.LastSeen == nil {
+		t.Fatalf("unexpected delta: %+v", delta)
+	}
+}
+
+func TestPresenceSubscriberRemovedOnDisconnect(t *testing.T) {
+	alice := newTestUser("alice")
+	aliceConn := dialWS(t, alice)
+	aliceConn.WriteJSON(map[string]any{"type": "presence_subscribe"})
+	var snapshot PresenceSnapshot
+	readJSON(t, aliceConn, &snapshot)
+
+	cl, _ := getClient(DefaultTenant, alice)
+	aliceConn.Close()
+	waitFor(t, func() bool {
+		_, subscribed := presenceSubscribers.Load(cl)
+		return !subscribed
+	})
+
+	// ส่ง delta หลัง disconnect ต้องไม่ค้างหรือ panic
+	done := make(chan struct{})
+	go func() {
+		publishPresence(DefaultTenant, newTestUser("bob"), presenceOnline)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("publishPresence blocked")
+	}
+}
+
+// รายชื่อจาก GET /online
+func getOnline(t *testing.T) []string {
+	t.Helper()
+	resp, err := http.Get("http://" + testAddr + "/online")
+	if err != nil {
+		t.Fatalf("get online: %v", err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		OnlineUsers []string `json:"online_users"`
+		Count       int      `json:"count"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Count != len(body.OnlineUsers) {
+		t.Fatalf("count %d does not match %d users", body.Count, len(body.OnlineUsers))
+	}
+	return body.OnlineUsers
+}
+
+func TestOnlineListsConnectedUsers(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	aliceConn := dialWS(t, alice)
+	dialWS(t, bob)
+
+	online := getOnline(t)
+	if !slices.Contains(online, alice) || !slices.Contains(online, bob) {
+		t.Fatalf("expected both users online, got %v", online)
+	}
+
+	aliceConn.Close()
+	waitFor(t, func() bool { return !slices.Contains(getOnline(t), alice) })
+	if !slices.Contains(getOnline(t), bob) {
+		t.Fatal("bob should still be online")
+	}
+}
+
+// เรียก POST /presence คืนค่า status และสถานะของผู้ใช้แต่ละคน
+func postPresence(t *testing.T, userIDs []string) (int, map[string]Presence) {
+	t.Helper()
+	body, _ := json.Marshal(PresenceRequest{UserIDs: userIDs})
+	resp, err := http.Post("http://"+testAddr+"/presence", "application/json", strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	defer resp.Body.Close()
+	var presence map[string]Presence
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&presence); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+	}
+	return resp.StatusCode, presence
+}
+
+func TestPresenceReportsOnlineAndLastSeen(t *testing.T) {
+	alice, bob, carol := newTestUser("alice"), newTestUser("bob"), newTestUser("carol")
+	dialWS(t, alice)
+	before := time.Now().Add(-time.Second)
+	bobConn := dialWS(t, bob)
+	bobConn.Close()
+	waitFor(t, func() bool { _, ok := getClient(DefaultTenant, bob); return !ok })
+
+	// ID ซ้ำถูกรวมเป็นรายการเดียว
+	status, presence := postPresence(t, []string{alice, bob, carol, alice})
+	if status != http.StatusOK || len(presence) != 3 {
+		t.Fatalf("unexpected response %d: %+v", status, presence)
+	}
+	if p := presence[alice]; !p.Online || p.LastSeen != nil {
+		t.Fatalf("expected alice online without last_seen, got %+v", p)
+	}
+	// ไม่เคยเชื่อมต่อ: ออฟไลน์และไม่มี last_seen
+	if p := presence[carol]; p.Online || p.LastSeen != nil {
+		t.Fatalf("expected carol unknown, got %+v", p)
+	}
+
+	// last_seen ถูกบันทึกตอน bob ตัดการเชื่อมต่อ
+	waitFor(t, func() bool {
+		_, presence = postPresence(t, []string{bob})
+		return presence[bob].LastSeen != nil
+	})
+	if p := presence[bob]; p.Online || p.LastSeen.Before(before) {
+		t.Fatalf("expected bob offline with recent last_seen, got %+v", p)
+	}
+}
+
+func TestPresenceValidatesUserIDs(t *testing.T) {
+	if status, _ := postPresence(t, nil); status != http.StatusBadRequest {
+		t.Fatalf("empty user_ids: expected 400, got %d", status)
+	}
+	tooMany := make([]string, maxPresenceUsers+1)
+	for i := range tooMany {
+		tooMany[i] = newTestUser("u")
+	}
+	if status, _ := postPresence(t, tooMany); status != http.StatusBadRequest {
+		t.Fatalf("too many user_ids: expected 400, got %d", status)
+	}
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"go-socket/protocol"
+)
+
+// เวอร์ชันของ protocol บน WebSocket (เลือกต่อ connection ผ่าน Sec-WebSocket-Protocol)
+//
+//	v1 (chat.v1 หรือไม่ระบุ)  frame ข้อความแชทเป็น Message ตรงๆ ไม่มี type
+//	v2 (chat.v2)              ทุก frame ที่ server ส่งมี "type" รวมถึงข้อความแชท ("type":"chat")
+//	v3 (chat.v3)              ทุก frame ทั้งสองทิศทางเป็น envelope {type, id, ts, payload} (ดู envelope.go)
+const (
+	protocolV1 = protocol.V1
+	protocolV2 = protocol.V2
+	protocolV3 = protocol.V3
+)
+
+// ชื่อ subprotocol ของแต่ละเวอร์ชัน
+var protocolVersions = map[string]int{
+	protocol.SubprotocolV1: protocolV1,
+	protocol.SubprotocolV2: protocolV2,
+	protocol.SubprotocolV3: protocolV3,
+}
+
+// subprotocol ที่ server ยอมรับ เรียงตามลำดับที่ server เลือกก่อน (เวอร์ชันสูงสุดก่อน)
+// "json"/"msgpack" คือการเลือก codec แบบเดิม ถือเป็น v1 (ใช้ ?codec= คู่กับ chat.v2 แทน)
+var wsSubprotocols = []string{protocol.SubprotocolV3, protocol.SubprotocolV2, protocol.SubprotocolV1, "msgpack", "json"}
+
+// frame ข้อความแชทของ v2
+type chatFrame struct {
+	Type string `json:"type"`
+	Message
+}
+
+// เวอร์ชันจาก subprotocol ที่ตกลงกันไว้ ไม่ได้ระบุ = v1
+func negotiateProtocolVersion(subprotocol string) int {
+	if v, ok := protocolVersions[subprotocol]; ok {
+		return v
+	}
+	return protocolV1
+}
+
+// ปฏิเสธการ upgrade ถ้า client ขอ subprotocol มาแต่ไม่มีตัวไหนที่ server รองรับ
+// (client ที่ไม่ส่ง Sec-WebSocket-Protocol มาเลยใช้ v1)
+func checkProtocol(c *fiber.Ctx) error {
+	header := c.Get(fiber.HeaderSecWebSocketProtocol)
+	if header == "" {
+		return c.Next()
+	}
+	for _, requested := range strings.Split(header, ",") {
+		requested = strings.TrimSpace(requested)
+		for _, supported := range wsSubprotocols {
+			if requested == supported {
+				return c.Next()
+			}
+		}
+	}
+	return InvalidRequest("No supported protocol version (supported: " + strings.Join(wsSubprotocols, ", ") + ")")
+}
+
+// แปลงข้อความแชทเป็น frame ตามเวอร์ชัน protocol ของ connection
+func (cl *client) chatFrame(msg Message) any {
+	if cl.protocolVersion >= protocolV2 {
+		return chatFrame{Type: frameTypeChat, Message: msg}
+	}
+	return msg
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	fws "github.com/fasthttp/websocket"
+)
+
+// เชื่อมต่อโดยขอ subprotocol ที่กำหนด
+func dialWithProtocols(t *testing.T, userID string, protocols ...string) *fws.Conn {
+	t.Helper()
+	dialer := fws.Dialer{Subprotocols: protocols}
+	conn, _, err := dialer.Dial("ws://"+testAddr+"/ws/chat/"+userID, nil)
+	if err != nil {
+		t.Fatalf("dial %s: %v", userID, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	waitFor(t, func() bool { _, ok := getClient(DefaultTenant, userID); return ok })
+	return conn
+}
+
+func TestV1AndV2ClientsConnectSimultaneously(t *testing.T) {
+	alice, bob, carol := newTestUser("alice"), newTestUser("bob"), newTestUser("carol")
+	aliceConn := dialWS(t, alice)
+	v1 := dialWithProtocols(t, bob, "chat.v1")
+	v2 := dialWithProtocols(t, carol, "chat.v1", "chat.v2")
+
+	if v1.Subprotocol() != "chat.v1" || v2.Subprotocol() != "chat.v2" {
+		t.Fatalf("unexpected negotiated protocols %q / %q", v1.Subprotocol(), v2.Subprotocol())
+	}
+
+	for _, to := range []string{bob, carol} {
+		if err := aliceConn.WriteJSON(Message{SenderID: alice, ReceiverID: to, Text: "hi " + to}); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	var old map[string]any
+	readJSON(t, v1, &old)
+	if _, hasType := old["type"]; hasType || old["text"] != "hi "+bob {
+		t.Fatalf("v1 frame should be a bare message, got %v", old)
+	}
+
+	var framed chatFrame
+	readJSON(t, v2, &framed)
+	if framed.Type != frameTypeChat || framed.Text != "hi "+carol {
+		t.Fatalf("v2 frame should be typed, got %+v", framed)
+	}
+}
+
+func TestUnsupportedProtocolVersionIsRejected(t *testing.T) {
+	dialer := fws.Dialer{Subprotocols: []string{"chat.v9"}}
+	_, resp, err := dialer.Dial("ws://"+testAddr+"/ws/chat/"+newTestUser("future"), nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unsupported version, got %v", resp)
+	}
+}
@@ -0,0 +1,476 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// แพลตฟอร์มของ device token
+const (
+	pushPlatformFCM  = "fcm"
+	pushPlatformAPNs = "apns"
+)
+
+// label outcome ของ chat_push_notifications_total
+const (
+	pushOutcomeSent         = "sent"
+	pushOutcomeFailed       = "failed"
+	pushOutcomeUnregistered = "unregistered" // token ใช้ไม่ได้แล้ว ลบออกจาก DB
+)
+
+// ความยาวสูงสุดของ device token ที่รับลงทะเบียน
+const maxDeviceTokenLength = 4096
+
+// token นี้ใช้ไม่ได้แล้ว (ถอนการติดตั้งแอป/หมดอายุ) ต้องลบออกจาก DB
+var errDeviceUnregistered = errors.New("device token is no longer registered")
+
+// error ชั่วคราวจากผู้ให้บริการ push (429, 5xx, network) ควรลองส่งใหม่
+type retryablePushError struct {
+	err        error
+	retryAfter time.Duration // ผู้ให้บริการบอกเวลาที่ควรรอ (0 = ใช้ backoff ตาม config)
+}
+
+func (e *retryablePushError) Error() string { return e.err.Error() }
+func (e *retryablePushError) Unwrap() error { return e.err }
+
+// อุปกรณ์ที่ลงทะเบียนรับ push
+type Device struct {
+	UserID   string `json:"user_id"`
+	Platform string `json:"platform"`
+	Token    string `json:"token"`
+}
+
+// เนื้อหาของ push notification
+type PushNotification struct {
+	Title string            `json:"title"`
+	Body  string            `json:"body"`
+	Data  map[string]string `json:"data,omitempty"`
+}
+
+// ผู้ให้บริการ push ของแพลตฟอร์มหนึ่ง (FCM, APNs)
+type Notifier interface {
+	Push(ctx context.Context, token string, n PushNotification) error
+}
+
+// แปลง HTTP status ที่ไม่สำเร็จเป็น error ตามชนิด (ลองใหม่ได้หรือไม่)
+func pushStatusError(platform string, resp *http.Response, detail string) error {
+	err := fmt.Errorf("%s push failed: %s %s", platform, resp.Status, strings.TrimSpace(detail))
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		var wait time.Duration
+		if secs, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil {
+			wait = time.Duration(secs) * time.Second
+		}
+		return &retryablePushError{err: err, retryAfter: wait}
+	}
+	return err
+}
+
+// FCM HTTP v1 ยืนยันตัวตนด้วย service account (OAuth2 JWT bearer grant)
+type fcmNotifier struct {
+	client      *http.Client
+	endpoint    string // https://fcm.googleapis.com/v1/projects/<project>/messages:send
+	tokenURL    string
+	clientEmail string
+	key         *rsa.PrivateKey
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+// ไฟล์ service account ที่ดาวน์โหลดจาก Firebase console
+type fcmServiceAccount struct {
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+func newFCMNotifier(credentialsFile string, client *http.Client) (*fcmNotifier, error) {
+	data, err := os.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading FCM credentials: %w", err)
+	}
+	var sa fcmServiceAccount
+	if err := json.Unmarshal(data, &sa); err != nil {
+		return nil, fmt.Errorf("parsing FCM credentials: %w", err)
+	}
+	if sa.ProjectID == "" || sa.ClientEmail == "" || sa.TokenURI == "" {
+		return nil, errors.New("FCM credentials missing project_id, client_email or token_uri")
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(sa.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("parsing FCM private key: %w", err)
+	}
+	return &fcmNotifier{
+		client:      client,
+		endpoint:    "https://fcm.googleapis.com/v1/projects/" + url.PathEscape(sa.ProjectID) + "/messages:send",
+		tokenURL:    sa.TokenURI,
+		clientEmail: sa.ClientEmail,
+		key:         key,
+	}, nil
+}
+
+// access token ของ Google (อายุ 1 ชั่วโมง) ขอใหม่ก่อนหมดอายุ 1 นาที
+func (f *fcmNotifier) token(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	if f.accessToken != "" && now.Before(f.expiresAt.Add(-time.Minute)) {
+		return f.accessToken, nil
+	}
+
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   f.clientEmail,
+		"scope": "https://www.googleapis.com/auth/firebase.messaging",
+		"aud":   f.tokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(f.key)
+	if err != nil {
+		return "", fmt.Errorf("signing FCM assertion: %w", err)
+	}
+	form := url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"}, "assertion": {assertion}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "", &retryablePushError{err: fmt.Errorf("fetching FCM access token: %w", err)}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", pushStatusError(pushPlatformFCM, resp, string(detail))
+	}
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("decoding FCM access token: %w", err)
+	}
+	f.accessToken = result.AccessToken
+	f.expiresAt = now.Add(time.Duration(result.ExpiresIn) * time.Second)
+	return f.accessToken, nil
+}
+
+func (f *fcmNotifier) Push(ctx context.Context, token string, n PushNotification) error {
+	accessToken, err := f.token(ctx)
+	if err != nil {
+		return err
+	}
+	payload := map[string]any{"message": map[string]any{
+		"token":        token,
+		"notification": map[string]string{"title": n.Title, "body": n.Body},
+		"data":         n.Data,
+	}}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return &retryablePushError{err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	// token ที่ถูกถอนแล้ว FCM ตอบ 404 (UNREGISTERED)
+	if resp.StatusCode == http.StatusNotFound || bytes.Contains(detail, []byte("UNREGISTERED")) {
+		return errDeviceUnregistered
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		f.mu.Lock()
+		f.accessToken = ""
+		f.mu.Unlock()
+		return &retryablePushError{err: pushStatusError(pushPlatformFCM, resp, string(detail))}
+	}
+	return pushStatusError(pushPlatformFCM, resp, string(detail))
+}
+
+// APNs แบบ token-based (.p8 key) provider token อายุได้ไม่เกิน 1 ชั่วโมง และห้ามสร้างใหม่ถี่กว่า 20 นาที
+type apnsNotifier struct {
+	client *http.Client
+	host   string // https://api.push.apple.com หรือ sandbox
+	topic  string // bundle ID ของแอป
+	keyID  string
+	teamID string
+	key    *ecdsa.PrivateKey
+
+	mu          sync.Mutex
+	bearer      string
+	bearerSince time.Time
+}
+
+func newAPNsNotifier(cfg Config, client *http.Client) (*apnsNotifier, error) {
+	data, err := os.ReadFile(cfg.APNsKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading APNs key: %w", err)
+	}
+	key, err := jwt.ParseECPrivateKeyFromPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing APNs key: %w", err)
+	}
+	host := "https://api.sandbox.push.apple.com"
+	if cfg.APNsProduction {
+		host = "https://api.push.apple.com"
+	}
+	return &apnsNotifier{client: client, host: host, topic: cfg.APNsTopic, keyID: cfg.APNsKeyID, teamID: cfg.APNsTeamID, key: key}, nil
+}
+
+func (a *apnsNotifier) providerToken(now time.Time) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.bearer != "" && now.Sub(a.bearerSince) < 50*time.Minute {
+		return a.bearer, nil
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"iss": a.teamID, "iat": now.Unix()})
+	token.Header["kid"] = a.keyID
+	signed, err := token.SignedString(a.key)
+	if err != nil {
+		return "", fmt.Errorf("signing APNs provider token: %w", err)
+	}
+	a.bearer, a.bearerSince = signed, now
+	return signed, nil
+}
+
+func (a *apnsNotifier) Push(ctx context.Context, token string, n PushNotification) error {
+	bearer, err := a.providerToken(time.Now())
+	if err != nil {
+		return err
+	}
+	payload := map[string]any{"aps": map[string]any{
+		"alert": map[string]string{"title": n.Title, "body": n.Body},
+		"sound": "default",
+	}}
+	for k, v := range n.Data {
+		payload[k] = v
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.host+"/3/device/"+url.PathEscape(token), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("authorization", "bearer "+bearer)
+	req.Header.Set("apns-topic", a.topic)
+	req.Header.Set("apns-push-type", "alert")
+	req.Header.Set("apns-priority", "10")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return &retryablePushError{err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	var reason struct {
+		Reason string `json:"reason"`
+	}
+	json.NewDecoder(io.LimitReader(resp.Body, 1024)).Decode(&reason)
+	if resp.StatusCode == http.StatusGone || reason.Reason == "BadDeviceToken" || reason.Reason == "Unregistered" {
+		return errDeviceUnregistered
+	}
+	if reason.Reason == "ExpiredProviderToken" {
+		a.mu.Lock()
+		a.bearer = ""
+		a.mu.Unlock()
+		return &retryablePushError{err: pushStatusError(pushPlatformAPNs, resp, reason.Reason)}
+	}
+	return pushStatusError(pushPlatformAPNs, resp, reason.Reason)
+}
+
+// ส่ง push ไปยังทุกอุปกรณ์ของผู้รับที่ออฟไลน์
+type pushSink struct {
+	notifiers map[string]Notifier // ตาม platform
+}
+
+func (s pushSink) NotifyOffline(msg Message) {
+	devices, err := devicesOf(tenantOrDefault(msg.TenantID), msg.ReceiverID)
+	if err != nil {
+		messageLogger(msg).Error("loading device tokens", "err", err)
+		return
+	}
+	n := pushNotificationFor(msg)
+	for _, device := range devices {
+		notifier, ok := s.notifiers[device.Platform]
+		if !ok {
+			continue
+		}
+		err := sendPush(notifier, device.Token, n)
+		switch {
+		case err == nil:
+			pushNotificationsTotal.WithLabelValues(device.Platform, pushOutcomeSent).Inc()
+		case errors.Is(err, errDeviceUnregistered):
+			pushNotificationsTotal.WithLabelValues(device.Platform, pushOutcomeUnregistered).Inc()
+			messageLogger(msg).Info("removing unregistered device token", "platform", device.Platform)
+			if err := deleteDevice(tenantOrDefault(msg.TenantID), device.UserID, device.Token); err != nil {
+				messageLogger(msg).Error("removing device token", "err", err)
+			}
+		default:
+			pushNotificationsTotal.WithLabelValues(device.Platform, pushOutcomeFailed).Inc()
+			messageLogger(msg).Warn("push notification failed", "platform", device.Platform, "err", err)
+		}
+	}
+}
+
+// ส่ง push หนึ่งครั้ง ลองใหม่ตาม PushMaxRetries เมื่อเป็น error ชั่วคราว (backoff เพิ่มเท่าตัวทุกรอบ)
+func sendPush(notifier Notifier, token string, n PushNotification) error {
+	backoff := config.PushRetryBackoff
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), config.NotifyTimeout)
+		err := notifier.Push(ctx, token, n)
+		cancel()
+
+		var retryable *retryablePushError
+		if err == nil || !errors.As(err, &retryable) || attempt >= config.PushMaxRetries {
+			return err
+		}
+		wait := backoff
+		if retryable.retryAfter > wait {
+			wait = retryable.retryAfter
+		}
+		time.Sleep(wait)
+		backoff *= 2
+	}
+}
+
+// หัวข้อคือผู้ส่ง เนื้อหาคือข้อความแบบย่อ (หรือชื่อไฟล์ถ้าส่งแต่ไฟล์แนบ)
+func pushNotificationFor(msg Message) PushNotification {
+	body := replySnippet(msg.Text)
+	if body == "" && msg.Attachment != nil {
+		body = "📎 " + msg.Attachment.Filename
+	}
+	data := map[string]string{
+		"type":       "message",
+		"message_id": strconv.FormatInt(msg.ID, 10),
+		"sender_id":  msg.SenderID,
+	}
+	if msg.RoomID != 0 {
+		data["room_id"] = strconv.FormatInt(msg.RoomID, 10)
+	}
+	return PushNotification{Title: msg.SenderID, Body: body, Data: data}
+}
+
+// สร้าง Notifier ตามผู้ให้บริการที่ตั้งค่าไว้ (ไม่ได้ตั้งค่า = map ว่าง)
+func newPushNotifiers(cfg Config) (map[string]Notifier, error) {
+	notifiers := make(map[string]Notifier)
+	client := &http.Client{Timeout: cfg.NotifyTimeout}
+	if cfg.FCMCredentialsFile != "" {
+		fcm, err := newFCMNotifier(cfg.FCMCredentialsFile, client)
+		if err != nil {
+			return nil, err
+		}
+		notifiers[pushPlatformFCM] = fcm
+	}
+	if cfg.APNsKeyFile != "" {
+		apns, err := newAPNsNotifier(cfg, client)
+		if err != nil {
+			return nil, err
+		}
+		notifiers[pushPlatformAPNs] = apns
+	}
+	return notifiers, nil
+}
+
+func devicesOf(tenant, userID string) ([]Device, error) {
+	rows, err := db.Query("SELECT platform, token FROM device_tokens WHERE tenant_id = ? AND user_id = ?", tenant, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var devices []Device
+	for rows.Next() {
+		device := Device{UserID: userID}
+		if err := rows.Scan(&device.Platform, &device.Token); err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+	return devices, rows.Err()
+}
+
+// token หนึ่งผูกกับผู้ใช้คนเดียว ลงทะเบียนซ้ำจากผู้ใช้อื่น (login สลับบัญชีบนเครื่องเดิม) จะย้ายไปเป็นของผู้ใช้ใหม่
+func registerDevice(tenant string, device Device, now time.Time) error {
+	_, err := db.Exec(`INSERT INTO device_tokens (tenant_id, token, user_id, platform, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (tenant_id, token) DO UPDATE SET user_id = excluded.user_id, platform = excluded.platform, updated_at = excluded.updated_at`,
+		tenant, device.Token, device.UserID, device.Platform, now, now)
+	return err
+}
+
+func deleteDevice(tenant, userID, token string) error {
+	_, err := db.Exec("DELETE FROM device_tokens WHERE tenant_id = ? AND user_id = ? AND token = ?", tenant, userID, token)
+	return err
+}
+
+// POST /devices  body: {"user_id": "...", "platform": "fcm"|"apns", "token": "..."}
+func handleRegisterDevice(c *fiber.Ctx) error {
+	var device Device
+	if err := c.BodyParser(&device); err != nil {
+		return InvalidRequest("Invalid request body")
+	}
+	if user := AuthUser(c); user != "" {
+		if device.UserID != "" && device.UserID != user {
+			return Forbidden("user_id does not match token")
+		}
+		device.UserID = user
+	}
+	switch {
+	case device.UserID == "":
+		return InvalidRequest("user_id is required")
+	case device.Platform != pushPlatformFCM && device.Platform != pushPlatformAPNs:
+		return InvalidRequest("platform must be fcm or apns")
+	case device.Token == "" || len(device.Token) > maxDeviceTokenLength:
+		return InvalidRequest(fmt.Sprintf("token is required (max %d bytes)", maxDeviceTokenLength))
+	}
+
+	if err := registerDevice(TenantOf(c), device, time.Now().UTC()); err != nil {
+		return Internal("Error registering device", err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(device)
+}
+
+// DELETE /devices/:token?user_id=...  (เรียกตอน logout)
+func handleUnregisterDevice(c *fiber.Ctx) error {
+	userID, err := RequestUser(c)
+	if err != nil {
+		return err
+	}
+	token, err := url.PathUnescape(c.Params("token"))
+	if err != nil || token == "" {
+		return InvalidRequest("Invalid token")
+	}
+	if err := deleteDevice(TenantOf(c), userID, token); err != nil {
+		return Internal("Error removing device", err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Notifier ปลอมที่คืน error ตามลำดับใน errs แล้วจึงสำเร็จ
+type fakeNotifier struct {
+	mu    sync.Mutex
+	errs  []error
+	calls int
+	sent  []PushNotification
+}
+
+func (f *fakeNotifier) Push(_ context.Context, _ string, n PushNotification) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		return err
+	}
+	f.sent = append(f.sent, n)
+	return nil
+}
+
+func registerTestDevice(t *testing.T, userID, platform, token string) int {
+	t.Helper()
+	body := `{"user_id":"` + userID + `","platform":"` + platform + `","token":"` + token + `"}`
+	resp, err := http.Post("http://"+testAddr+"/devices", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestPushSinkRetriesAndRemovesUnregisteredTokens(t *testing.T) {
+	prev := config.PushRetryBackoff
+	config.PushRetryBackoff = time.Millisecond
+	defer func() { config.PushRetryBackoff = prev }()
+
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	if status := registerTestDevice(t, bob, pushPlatformFCM, bob+"-phone"); status != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", status)
+	}
+	registerTestDevice(t, bob, pushPlatformAPNs, bob+"-tablet")
+	if status := registerTestDevice(t, bob, "sms", bob+"-x"); status != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown platform, got %d", status)
+	}
+
+	fcm := &fakeNotifier{errs: []error{&retryablePushError{err: errors.New("503")}}}
+	apns := &fakeNotifier{errs: []error{errDeviceUnregistered}}
+	sink := pushSink{notifiers: map[string]Notifier{pushPlatformFCM: fcm, pushPlatformAPNs: apns}}
+	sink.NotifyOffline(Message{ID: 7, SenderID: alice, ReceiverID: bob, Text: "hello"})
+
+	if fcm.calls != 2 || len(fcm.sent) != 1 || fcm.sent[0].Title != alice || fcm.sent[0].Body != "hello" || fcm.sent[0].Data["message_id"] != "7" {
+		t.Fatalf("expected one retry then delivery, got %d calls %+v", fcm.calls, fcm.sent)
+	}
+	devices, err := devicesOf(DefaultTenant, bob)
+	if err != nil {
+		t.Fatalf("devices: %v", err)
+	}
+	if len(devices) != 1 || devices[0].Platform != pushPlatformFCM {
+		t.Fatalf("expected unregistered apns token to be removed, got %+v", devices)
+	}
+}
+
+func TestUnregisterDevice(t *testing.T) {
+	bob := newTestUser("bob")
+	registerTestDevice(t, bob, pushPlatformFCM, "tok:"+bob)
+
+	req, _ := http.NewRequest(http.MethodDelete, "http://"+testAddr+"/devices/tok:"+bob+"?user_id="+bob, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", resp.StatusCode)
+	}
+	if devices, _ := devicesOf(DefaultTenant, bob); len(devices) != 0 {
+		t.Fatalf("expected no devices, got %+v", devices)
+	}
+}
+
+func TestAPNsStatusMapping(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	statuses := map[string]int{"/3/device/gone": http.StatusGone, "/3/device/busy": http.StatusServiceUnavailable, "/3/device/ok": http.StatusOK}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("authorization"), "bearer ") || r.Header.Get("apns-topic") != "com.example.chat" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(statuses[r.URL.Path])
+	}))
+	defer server.Close()
+
+	apns := &apnsNotifier{client: server.Client(), host: server.URL, topic: "com.example.chat", keyID: "KEY", teamID: "TEAM", key: key}
+	ctx := context.Background()
+	if err := apns.Push(ctx, "ok", PushNotification{}); err != nil {
+		t.Fatalf("ok: %v", err)
+	}
+	if err := apns.Push(ctx, "gone", PushNotification{}); !errors.Is(err, errDeviceUnregistered) {
+		t.Fatalf("gone: expected errDeviceUnregistered, got %v", err)
+	}
+	var retryable *retryablePushError
+	if err := apns.Push(ctx, "busy", PushNotification{}); !errors.As(err, &retryable) {
+		t.Fatalf("busy: expected retryable error, got %v", err)
+	}
+}
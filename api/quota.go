@@ -0,0 +1,51 @@
+package api
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	quotaMu     sync.Mutex
+	quotaWindow time.Time      // เวลาเริ่มของรอบปัจจุบัน
+	quotaCounts map[string]int // tenantKey -> จำนวนข้อความที่ส่งในรอบนี้
+)
+
+// ตรวจและหัก quota ของผู้ส่ง n ข้อความ คืนค่า false ถ้าเกิน quota พร้อมเวลาที่ quota จะรีเซ็ต
+func consumeQuota(tenant, userID string, n int, now time.Time) (bool, time.Time) {
+	if config.DailyMessageQuota <= 0 || isAdminUser(userID) {
+		return true, time.Time{}
+	}
+
+	// รอบเริ่มที่ขอบของ QuotaWindow ตามเวลา UTC (24h = เที่ยงคืน)
+	windowStart := now.UTC().Truncate(config.QuotaWindow)
+	resetsAt := windowStart.Add(config.QuotaWindow)
+
+	quotaMu.Lock()
+	defer quotaMu.Unlock()
+	if !windowStart.Equal(quotaWindow) || quotaCounts == nil {
+		quotaWindow = windowStart
+		quotaCounts = make(map[string]int)
+	}
+
+	key := tenantKey(tenant, userID)
+	if quotaCounts[key]+n > config.DailyMessageQuota {
+		return false, resetsAt
+	}
+	quotaCounts[key] += n
+	return true, resetsAt
+}
+
+// ผู้ใช้ที่อยู่ใน AdminUsers
+func isAdminUser(userID string) bool {
+	return slices.Contains(config.AdminUsers, userID)
+}
+
+func errQuotaExceeded(resetsAt time.Time) *Error {
+	err := NewError(fiber.StatusTooManyRequests, errCodeQuotaExceeded, "Daily message quota exceeded")
+	err.Details = fiber.Map{"resets_at": resetsAt}
+	return err
+}
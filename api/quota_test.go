@@ -0,0 +1,120 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// เปิด quota ต่อวันสำหรับ test นี้
+func withDailyQuota(t *testing.T, n int) {
+	t.Helper()
+	config.DailyMessageQuota = n
+	t.Cleanup(func() { config.DailyMessageQuota = 0 })
+}
+
+func TestQuotaResetsAtWindowBoundary(t *testing.T) {
+	withDailyQuota(t, 2)
+	alice := newTestUser("alice")
+	now := time.Date(2026, 3, 14, 15, 30, 0, 0, time.UTC)
+	midnight := time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 2; i++ {
+		if ok, resetsAt := consumeQuota(DefaultTenant, alice, 1, now); !ok || !resetsAt.Equal(midnight) {
+			t.Fatalf("message %d: ok=%v resets_at=%v", i, ok, resetsAt)
+		}
+	}
+	ok, resetsAt := consumeQuota(DefaultTenant, alice, 1, now)
+	if ok || !resetsAt.Equal(midnight) {
+		t.Fatalf("expected quota exceeded until %v, got ok=%v resets_at=%v", midnight, ok, resetsAt)
+	}
+
+	// ผู้ใช้ชื่อเดียวกันใน tenant อื่นมี quota แยก
+	if ok, _ := consumeQuota("acme", alice, 1, now); !ok {
+		t.Fatal("quota leaked across tenants")
+	}
+	// เกินทั้งชุดถูกปฏิเสธทั้งชุด ไม่หักบางส่วน
+	if ok, _ := consumeQuota("acme", alice, 2, now); ok {
+		t.Fatal("batch over quota was accepted")
+	}
+	if ok, _ := consumeQuota("acme", alice, 1, now); !ok {
+		t.Fatal("rejected batch consumed quota")
+	}
+
+	// รอบใหม่เริ่มที่เที่ยงคืน UTC
+	if ok, _ := consumeQuota(DefaultTenant, alice, 1, midnight); !ok {
+		t.Fatal("quota did not reset at the window boundary")
+	}
+}
+
+func TestAdminIsExemptFromQuota(t *testing.T) {
+	withDailyQuota(t, 1)
+	admin := newTestUser("admin")
+	config.AdminUsers = []string{admin}
+	defer func() { config.AdminUsers = nil }()
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := consumeQuota(DefaultTenant, admin, 1, time.Now()); !ok {
+			t.Fatalf("admin message %d rejected", i)
+		}
+	}
+}
+
+func TestWebSocketQuotaExceededFrame(t *testing.T) {
+	withDailyQuota(t, 1)
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	aliceConn := dialWS(t, alice)
+
+	aliceConn.WriteJSON(Message{SenderID: alice, ReceiverID: bob, Text: "first", ClientMsgID: "q-1"})
+	var ack Ack
+	readJSON(t, aliceConn, &ack)
+	if ack.Type != frameTypeAck || ack.ClientMsgID != "q-1" {
+		t.Fatalf("unexpected ack: %+v", ack)
+	}
+
+	aliceConn.WriteJSON(Message{SenderID: alice, ReceiverID: bob, Text: "second", ClientMsgID: "q-2"})
+	var frame ErrorFrame
+	readJSON(t, aliceConn, &frame)
+	if frame.Type != frameTypeError || frame.Code != errCodeQuotaExceeded {
+		t.Fatalf("unexpected frame: %+v", frame)
+	}
+	wantReset := time.Now().UTC().Truncate(config.QuotaWindow).Add(config.QuotaWindow)
+	if frame.ResetsAt == nil || !frame.ResetsAt.Equal(wantReset) {
+		t.Fatalf("expected resets_at %v, got %v", wantReset, frame.ResetsAt)
+	}
+	if n := countStored(t, alice, bob, false); n != 1 {
+		t.Fatalf("expected only the first message to be stored, got %d", n)
+	}
+}
+
+func TestSendQuotaExceededError(t *testing.T) {
+	withDailyQuota(t, 1)
+	alice := newTestUser("alice")
+	body := `{"sender_id":"` + alice + `","receiver_id":"` + newTestUser("bob") + `","text":"hi"}`
+
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		resp, err := http.Post("http://"+testAddr+"/send", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		var apiErr struct {
+			Code    string `json:"code"`
+			Details struct {
+				ResetsAt time.Time `json:"resets_at"`
+			} `json:"details"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Fatalf("request %d: expected %d, got %d", i, want, resp.StatusCode)
+		}
+		if want == http.StatusTooManyRequests {
+			wantReset := time.Now().UTC().Truncate(config.QuotaWindow).Add(config.QuotaWindow)
+			if apiErr.Code != errCodeQuotaExceeded || !apiErr.Details.ResetsAt.Equal(wantReset) {
+				t.Fatalf("unexpected error: %+v", apiErr)
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// scope ของ rate limit (label scope ของ chat_rate_limited_total)
+const (
+	rateScopeUser = "user"
+	rateScopeIP   = "ip"
+)
+
+// token bucket: เติม rate token ต่อวินาที เก็บได้สูงสุด burst
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// หัก 1 token ถ้ามี คืนค่าเวลาที่ต้องรอจนกว่าจะมี token ถ้าไม่มี
+func (b *tokenBucket) take(now time.Time, rate float64, burst int) (bool, time.Duration) {
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+// bucket แยกตาม key (ผู้ใช้หรือ IP)
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: make(map[string]*tokenBucket)}
+}
+
+// perMinute <= 0 = ไม่จำกัด
+func (l *rateLimiter) allow(key string, perMinute, burst int, now time.Time) (bool, time.Duration) {
+	if perMinute <= 0 {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(burst), last: now}
+		l.buckets[key] = b
+	}
+	return b.take(now, float64(perMinute)/60, burst)
+}
+
+// ลบ bucket ที่ไม่ได้ใช้นานพอจะเติมเต็มแล้ว (ผลเหมือนสร้างใหม่) กัน map โตไม่สิ้นสุด
+func (l *rateLimiter) sweep(now time.Time, idle time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > idle {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+var (
+	userRateLimiter = newRateLimiter()
+	ipRateLimiter   = newRateLimiter()
+)
+
+// ตรวจ rate limit ของผู้ส่งและ IP ก่อนรับข้อความ/frame คืนค่าเวลาที่ควรรอถ้าเกิน
+func allowInbound(tenant, userID, ip string, now time.Time) (bool, time.Duration) {
+	if ok, wait := userRateLimiter.allow(tenantKey(tenant, userID), config.RateLimitPerUser, config.RateLimitBurst, now); !ok {
+		rateLimitedTotal.WithLabelValues(rateScopeUser).Inc()
+		return false, wait
+	}
+	if ok, wait := ipRateLimiter.allow(ip, config.RateLimitPerIP, config.RateLimitBurst, now); !ok {
+		rateLimitedTotal.WithLabelValues(rateScopeIP).Inc()
+		return false, wait
+	}
+	return true, 0
+}
+
+// เปิด goroutine ล้าง bucket เก่า (เฉพาะเมื่อเปิด rate limit)
+func startRateLimitSweeper() {
+	if config.RateLimitPerUser <= 0 && config.RateLimitPerIP <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			userRateLimiter.sweep(now, time.Minute)
+			ipRateLimiter.sweep(now, time.Minute)
+		}
+	}()
+}
+
+// ตอบ error frame ให้ connection ที่ส่งเร็วเกิน คืนค่า false ถ้าเกินครบ RateLimitMaxViolations ครั้ง
+// (ปิด connection แล้ว ผู้เรียกต้องออกจาก read loop)
+func reportRateLimited(cl *client, violations int, wait time.Duration) bool {
+	retryAt := time.Now().Add(wait).UTC()
+	cl.send(ErrorFrame{Type: frameTypeError, Code: errCodeRateLimited, Detail: "rate limit exceeded, frame dropped", ResetsAt: &retryAt})
+
+	if config.RateLimitMaxViolations > 0 && violations >= config.RateLimitMaxViolations {
+		cl.logger().Warn("rate limit exceeded repeatedly, disconnecting", "violations", violations)
+		cl.closeWith(closeRateLimited, "rate limit exceeded")
+		return false
+	}
+	return true
+}
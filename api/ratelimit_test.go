@@ -0,0 +1,84 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	fws "github.com/fasthttp/websocket"
+)
+
+// เปิด rate limit ต่อผู้ใช้ระหว่าง test แล้วคืนค่าเดิม
+func withUserRateLimit(t *testing.T, perMinute, burst, maxViolations int) {
+	t.Helper()
+	prev := config
+	config.RateLimitPerUser = perMinute
+	config.RateLimitBurst = burst
+	config.RateLimitMaxViolations = maxViolations
+	t.Cleanup(func() { config = prev })
+}
+
+func TestTokenBucketRefills(t *testing.T) {
+	now := time.Now()
+	b := &tokenBucket{tokens: 2, last: now}
+	for i := 0; i < 2; i++ {
+		if ok, _ := b.take(now, 1, 2); !ok {
+			t.Fatalf("take %d should be allowed within burst", i)
+		}
+	}
+	ok, wait := b.take(now, 1, 2)
+	if ok || wait != time.Second {
+		t.Fatalf("expected to wait 1s, got ok=%v wait=%s", ok, wait)
+	}
+	if ok, _ := b.take(now.Add(time.Second), 1, 2); !ok {
+		t.Fatal("expected a token after refill")
+	}
+}
+
+func TestWebSocketFloodIsRateLimitedThenDisconnected(t *testing.T) {
+	withUserRateLimit(t, 1, 2, 2)
+	alice := newTestUser("alice")
+	bob := newTestUser("bob")
+	conn := dialWS(t, alice)
+
+	typing := map[string]any{"type": "typing", "receiver_id": bob, "state": "start"}
+	for i := 0; i < 4; i++ {
+		if err := conn.WriteJSON(typing); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		var frame ErrorFrame
+		readJSON(t, conn, &frame)
+		if frame.Code != errCodeRateLimited || frame.ResetsAt == nil {
+			t.Fatalf("unexpected frame: %+v", frame)
+		}
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := conn.ReadMessage(); !fws.IsCloseError(err, closeRateLimited) {
+		t.Fatalf("expected close %d, got %v", closeRateLimited, err)
+	}
+	waitFor(t, func() bool { _, ok := getClient(DefaultTenant, alice); return !ok })
+}
+
+func TestSendIsRateLimited(t *testing.T) {
+	withUserRateLimit(t, 1, 1, 0)
+	alice := newTestUser("alice")
+	body := `{"sender_id":"` + alice + `","receiver_id":"` + newTestUser("bob") + `","text":"hi"}`
+
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		resp, err := http.Post("http://"+testAddr+"/send", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Fatalf("request %d: expected %d, got %d", i, want, resp.StatusCode)
+		}
+		if want == http.StatusTooManyRequests && resp.Header.Get("Retry-After") == "" {
+			t.Fatal("expected Retry-After header")
+		}
+	}
+}
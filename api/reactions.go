@@ -0,0 +1,248 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"go-socket/protocol"
+)
+
+// ความยาวสูงสุดของ emoji (byte) กันไม่ให้ส่งข้อความยาวๆ มาแทน emoji
+const maxEmojiBytes = 32
+
+// จำนวน emoji ที่ต่างกันได้สูงสุดต่อข้อความ (emoji ที่มีอยู่แล้วยังกดเพิ่ม/ยกเลิกได้)
+const maxEmojisPerMessage = 20
+
+var (
+	errInvalidEmoji     = errors.New("invalid emoji")
+	errMessageNotFound  = errors.New("message not found")
+	errNotParticipant   = errors.New("user is not a participant of the message")
+	errTooManyReactions = errors.New("too many different reactions on the message")
+)
+
+// คำขอกด reaction (ใช้ทั้ง REST และ WebSocket)
+type ReactionRequest = protocol.ReactionRequest
+
+// event ที่ส่งให้อีกฝ่ายเมื่อมีการกด/ยกเลิก reaction
+type ReactionEvent = protocol.ReactionEvent
+
+// ตรวจสอบว่า emoji ไม่ว่าง ไม่ยาวเกินไป และไม่มีช่องว่าง/ตัวควบคุม
+func validateEmoji(emoji string) error {
+	if emoji == "" || len(emoji) > maxEmojiBytes || !utf8.ValidString(emoji) {
+		return errInvalidEmoji
+	}
+	if strings.IndexFunc(emoji, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) >= 0 {
+		return errInvalidEmoji
+	}
+	return nil
+}
+
+// สลับสถานะ reaction: ถ้ามีอยู่แล้วจะลบออก ถ้ายังไม่มีจะเพิ่ม
+// คืนค่า event สำหรับส่งต่อ (พร้อมจำนวนของ emoji นี้) และ ID ของอีกฝ่ายในบทสนทนา
+// ข้อความของ tenant อื่นหรือที่ถูกลบแล้วถือว่าไม่พบ
+func toggleReaction(tenant string, req ReactionRequest) (ReactionEvent, string, error) {
+	if err := validateEmoji(req.Emoji); err != nil {
+		return ReactionEvent{}, "", err
+	}
+
+	var senderID, receiverID string
+	err := db.QueryRow("SELECT sender_id, receiver_id FROM messages WHERE id = ? AND tenant_id = ? AND deleted_at IS NULL", req.MessageID, tenant).Scan(&senderID, &receiverID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ReactionEvent{}, "", errMessageNotFound
+	}
+	if err != nil {
+		return ReactionEvent{}, "", err
+	}
+
+	// เฉพาะผู้ส่งหรือผู้รับเท่านั้นที่กด reaction ได้
+	peerID := ""
+	switch req.UserID {
+	case senderID:
+		peerID = receiverID
+	case receiverID:
+		peerID = senderID
+	default:
+		return ReactionEvent{}, "", errNotParticipant
+	}
+
+	var action string
+	var count int
+	err = retryOnBusy("toggling reaction", func() error {
+		action, count, err = writeReactionToggle(req)
+		return err
+	})
+	if err != nil {
+		return ReactionEvent{}, "", err
+	}
+
+	event := ReactionEvent{
+		Type:      frameTypeReaction,
+		MessageID: req.MessageID,
+		Emoji:     req.Emoji,
+		UserID:    req.UserID,
+		Action:    action,
+		Count:     count,
+	}
+	return event, peerID, nil
+}
+
+// ลบ reaction ถ้ามี ไม่มีก็เพิ่ม ใน transaction เดียว คืนค่า action และจำนวนของ emoji นี้หลังเปลี่ยน
+// การกดพร้อมกันสองครั้งชนกันที่ unique key ได้ INSERT จึงข้ามแถวที่มีอยู่แล้วแทนที่จะ error
+func writeReactionToggle(req ReactionRequest) (string, int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", 0, err
+	}
+	defer tx.Rollback()
+
+	action := "remove"
+	res, err := tx.Exec("DELETE FROM reactions WHERE message_id = ? AND user_id = ? AND emoji = ?", req.MessageID, req.UserID, req.Emoji)
+	if err != nil {
+		return "", 0, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		action = "add"
+		// emoji ใหม่ของข้อความนับรวมกับจำนวน emoji ที่ต่างกันที่มีอยู่แล้ว
+		var distinct int
+		var exists bool
+		if err := tx.QueryRow("SELECT COUNT(DISTINCT emoji), COALESCE(MAX(CASE WHEN emoji = ? THEN 1 ELSE 0 END), 0) = 1 FROM reactions WHERE message_id = ?", req.Emoji, req.MessageID).Scan(&distinct, &exists); err != nil {
+			return "", 0, err
+		}
+		if !exists && distinct >= maxEmojisPerMessage {
+			return "", 0, errTooManyReactions
+		}
+		if _, err := tx.Exec("INSERT INTO reactions (message_id, user_id, emoji) VALUES (?, ?, ?) ON CONFLICT (message_id, user_id, emoji) DO NOTHING", req.MessageID, req.UserID, req.Emoji); err != nil {
+			return "", 0, err
+		}
+	}
+
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM reactions WHERE message_id = ? AND emoji = ?", req.MessageID, req.Emoji).Scan(&count); err != nil {
+		return "", 0, err
+	}
+	return action, count, tx.Commit()
+}
+
+// ดึงจำนวน reaction ของหลายข้อความในครั้งเดียว
+func getReactionCounts(ids []int64) (map[int64]map[string]int, error) {
+	counts := make(map[int64]map[string]int)
+	if len(ids) == 0 {
+		return counts, nil
+	}
+
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	query := fmt.Sprintf("SELECT message_id, emoji, COUNT(*) FROM reactions WHERE message_id IN (%s) GROUP BY message_id, emoji", strings.Join(makePlaceholders(len(ids)), ","))
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var emoji string
+		var n int
+		if err := rows.Scan(&id, &emoji, &n); err != nil {
+			return nil, err
+		}
+		if counts[id] == nil {
+			counts[id] = make(map[string]int)
+		}
+		counts[id][emoji] = n
+	}
+	return counts, rows.Err()
+}
+
+// แนบจำนวน reaction ให้กับรายการข้อความ
+func attachReactions(msgs []Message) {
+	ids := make([]int64, len(msgs))
+	for i := range msgs {
+		ids[i] = msgs[i].ID
+	}
+
+	counts, err := getReactionCounts(ids)
+	if err != nil {
+		slog.Error("fetching reactions", "err", err)
+		return
+	}
+	for i := range msgs {
+		msgs[i].Reactions = counts[msgs[i].ID]
+	}
+}
+
+// POST /messages/:id/react
+func handleReactRequest(c *fiber.Ctx) error {
+	messageID, err := c.ParamsInt("id")
+	if err != nil {
+		return InvalidRequest("Invalid message id")
+	}
+
+	var req ReactionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return InvalidRequest("Invalid request body")
+	}
+	if err := BindAuthUser(c, &req.UserID, "user_id"); err != nil {
+		return err
+	}
+	if req.UserID == "" {
+		return InvalidRequest("user_id and emoji are required")
+	}
+	req.MessageID = int64(messageID)
+	tenant := TenantOf(c)
+
+	event, peerID, err := toggleReaction(tenant, req)
+	if err != nil {
+		return reactionAPIError(err)
+	}
+
+	sendToUser(tenant, peerID, frameTypeReaction, event)
+	slog.Info("reaction toggled", "request_id", requestIDOf(c), "tenant", tenant, "user_id", req.UserID, "msg_id", req.MessageID, "action", event.Action, "emoji", req.Emoji)
+
+	return c.JSON(event)
+}
+
+// แปลง error ของ toggleReaction เป็น error ของ API (ใช้ทั้ง REST และ error frame)
+func reactionAPIError(err error) *Error {
+	switch {
+	case errors.Is(err, errInvalidEmoji):
+		return InvalidRequest("Invalid emoji")
+	case errors.Is(err, errTooManyReactions):
+		return InvalidRequest(fmt.Sprintf("Too many different reactions on this message (max %d)", maxEmojisPerMessage))
+	case errors.Is(err, errMessageNotFound):
+		return NotFound("Message not found")
+	case errors.Is(err, errNotParticipant):
+		return Forbidden("Not a participant")
+	default:
+		return Internal("Error toggling reaction", err)
+	}
+}
+
+// จัดการ reaction ที่ส่งมาทาง WebSocket ({"type":"react",...}) ผิดพลาดตอบกลับด้วย error frame
+func handleReactFrame(cl *client, raw []byte) {
+	var req ReactionRequest
+	if err := cl.codec.Unmarshal(raw, &req); err != nil || req.MessageID <= 0 {
+		cl.send(ErrorFrame{Type: frameTypeError, Code: errCodeInvalidRequest, Detail: "react requires message_id and emoji"})
+		return
+	}
+	// ผู้กด reaction คือเจ้าของ connection เสมอ
+	req.UserID = cl.userID
+
+	event, peerID, err := toggleReaction(cl.tenant, req)
+	if err != nil {
+		apiErr := reactionAPIError(err)
+		cl.send(ErrorFrame{Type: frameTypeError, Code: apiErr.Code, Detail: apiErr.Message})
+		return
+	}
+
+	sendToUser(cl.tenant, peerID, frameTypeReaction, event)
+	cl.logger().Info("reaction toggled", "msg_id", req.MessageID, "action", event.Action, "emoji", req.Emoji)
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestReactionToggleBroadcastsCount(t *testing.T) {
+	alice, bob, carol := newTestUser("alice"), newTestUser("bob"), newTestUser("carol")
+	id := saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: "ship it?"})
+	bobConn := dialWS(t, bob)
+	var pending Message
+	readJSON(t, bobConn, &pending)
+	aliceConn := dialWS(t, alice)
+
+	// carol ไม่ได้อยู่ในบทสนทนา ใช้เพิ่มจำนวนผ่าน DB ตรงๆ เพื่อให้ count ไม่ใช่ 1 แค่เพราะมีคนเดียว
+	db.Exec("INSERT INTO reactions (message_id, user_id, emoji) VALUES (?, ?, ?)", id, carol, "👍")
+
+	react := func() ReactionEvent {
+		t.Helper()
+		if err := aliceConn.WriteJSON(map[string]any{"type": "react", "message_id": id, "emoji": "👍"}); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		var event ReactionEvent
+		readJSON(t, bobConn, &event)
+		return event
+	}
+
+	if event := react(); event.Type != frameTypeReaction || event.Action != "add" || event.UserID != alice || event.MessageID != id || event.Count != 2 {
+		t.Fatalf("unexpected add event: %+v", event)
+	}
+	if event := react(); event.Action != "remove" || event.Count != 1 {
+		t.Fatalf("unexpected remove event: %+v", event)
+	}
+	if counts, err := getReactionCounts([]int64{id}); err != nil || counts[id]["👍"] != 1 {
+		t.Fatalf("unexpected stored counts: %v (%v)", counts[id], err)
+	}
+}
+
+func TestReactionCapsDistinctEmojisPerMessage(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	id := saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: "vote"})
+	toggle := func(userID, emoji string) error {
+		_, _, err := toggleReaction(DefaultTenant, ReactionRequest{MessageID: id, UserID: userID, Emoji: emoji})
+		return err
+	}
+
+	for i := 0; i < maxEmojisPerMessage; i++ {
+		if err := toggle(alice, "e"+strconv.Itoa(i)); err != nil {
+			t.Fatalf("toggle %d: %v", i, err)
+		}
+	}
+	if err := toggle(bob, "one-too-many"); !errors.Is(err, errTooManyReactions) {
+		t.Fatalf("expected errTooManyReactions, got %v", err)
+	}
+	// emoji ที่มีอยู่แล้วยังกดเพิ่มและยกเลิกได้
+	if err := toggle(bob, "e0"); err != nil {
+		t.Fatalf("reacting with an existing emoji: %v", err)
+	}
+	if err := toggle(alice, "e1"); err != nil {
+		t.Fatalf("removing a reaction at the cap: %v", err)
+	}
+}
+
+func TestConcurrentReactionTogglesDoNotFail(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	id := saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: "race"})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := toggleReaction(DefaultTenant, ReactionRequest{MessageID: id, UserID: bob, Emoji: "🔥"}); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("concurrent toggle failed: %v", err)
+	}
+}
+
+func TestReactFrameErrorsAreReported(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	id := saveMessageToDB(Message{SenderID: bob, ReceiverID: alice, Text: "hi"})
+	deleted := saveMessageToDB(Message{SenderID: bob, ReceiverID: alice, Text: "gone"})
+	others := saveMessageToDB(Message{SenderID: bob, ReceiverID: newTestUser("carol"), Text: "not yours"})
+	db.Exec("UPDATE messages SET deleted_at = CURRENT_TIMESTAMP WHERE id = ?", deleted)
+	markDelivered([]int64{id, deleted})
+
+	conn := dialWS(t, alice)
+	for _, tc := range []struct {
+		frame any
+		code  string
+	}{
+		{map[string]any{"type": "react", "message_id": id, "emoji": "not an emoji but a sentence"}, errCodeInvalidRequest},
+		{map[string]any{"type": "react", "message_id": "x", "emoji": "👍"}, errCodeInvalidRequest},
+		{map[string]any{"type": "react", "message_id": others, "emoji": "👍"}, errCodeForbidden},
+		{map[string]any{"type": "react", "message_id": deleted, "emoji": "👍"}, errCodeNotFound},
+	} {
+		if err := conn.WriteJSON(tc.frame); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		var errFrame ErrorFrame
+		readJSON(t, conn, &errFrame)
+		if errFrame.Type != frameTypeError || errFrame.Code != tc.code {
+			t.Fatalf("frame %v: expected %s error frame, got %+v", tc.frame, tc.code, errFrame)
+		}
+	}
+}
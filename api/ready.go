@@ -0,0 +1,66 @@
+package api
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// เวลาที่ server เริ่มทำงาน (แสดงใน /healthz)
+var startedAt = time.Now()
+
+// GET /healthz process ยังทำงานอยู่ (liveness) ไม่แตะ DB หรือคิว
+func handleHealth(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"status": "ok",
+		"uptime": time.Since(startedAt).Round(time.Second).String(),
+	})
+}
+
+// GET /readyz พร้อมรับ traffic หรือไม่ (readiness): DB ใช้งานได้, router และ worker ทำงานครบ
+// และคิว broadcast ยังไม่เกิน BroadcastHighWater พร้อมแสดงการใช้งาน connection เทียบกับ limit
+func handleReady(c *fiber.Ctx) error {
+	ready := true
+	dbStatus := "ok"
+	if err := db.Ping(); err != nil {
+		ready = false
+		dbStatus = err.Error()
+	}
+
+	// router 1 ตัว + lane worker ตามจำนวน lane
+	expectedWorkers := int64(len(lanes) + 1)
+	running := runningWorkers.Load()
+	if len(lanes) == 0 || running < expectedWorkers {
+		ready = false
+	}
+
+	queued := len(broadcast) + len(priorityBroadcast)
+	saturated := queued >= config.BroadcastHighWater
+	if saturated {
+		ready = false
+	}
+
+	status := fiber.StatusOK
+	if !ready {
+		status = fiber.StatusServiceUnavailable
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"ready":    ready,
+		"database": dbStatus,
+		"workers": fiber.Map{
+			"running":  running,
+			"expected": expectedWorkers,
+		},
+		"queue": fiber.Map{
+			"length":     queued,
+			"capacity":   cap(broadcast) + cap(priorityBroadcast),
+			"high_water": config.BroadcastHighWater,
+			"saturated":  saturated,
+		},
+		"connections": fiber.Map{
+			"current":      activeConnections.Load(),
+			"max":          config.MaxConnections,
+			"max_per_user": config.MaxConnectionsPerUser,
+		},
+	})
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func getProbe(t *testing.T, path string) (int, map[string]any) {
+	t.Helper()
+	resp, err := http.Get("http://" + testAddr + path)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	var body map[string]any
+	json.NewDecoder(resp.Body).Decode(&body)
+	return resp.StatusCode, body
+}
+
+func TestReadyzReportsWorkersAndQueue(t *testing.T) {
+	status, body := getProbe(t, "/readyz")
+	if status != http.StatusOK || body["ready"] != true {
+		t.Fatalf("expected ready, got %d %v", status, body)
+	}
+	workers, _ := body["workers"].(map[string]any)
+	if workers["running"] != workers["expected"] {
+		t.Fatalf("expected all workers running, got %v", workers)
+	}
+
+	// high water 0 = คิวว่างก็ถือว่าเต็ม
+	prev := config.BroadcastHighWater
+	config.BroadcastHighWater = 0
+	defer func() { config.BroadcastHighWater = prev }()
+	status, body = getProbe(t, "/readyz")
+	queue, _ := body["queue"].(map[string]any)
+	if status != http.StatusServiceUnavailable || queue["saturated"] != true {
+		t.Fatalf("expected 503 with saturated queue, got %d %v", status, body)
+	}
+}
+
+func TestHealthzStaysUpWhileDraining(t *testing.T) {
+	shuttingDown.Store(true)
+	t.Cleanup(func() { shuttingDown.Store(false) })
+
+	if status, _ := getProbe(t, "/healthz"); status != http.StatusOK {
+		t.Fatalf("expected healthz 200 while draining, got %d", status)
+	}
+	if status, _ := getProbe(t, "/readyz"); status != http.StatusServiceUnavailable {
+		t.Fatalf("expected readyz 503 while draining, got %d", status)
+	}
+}
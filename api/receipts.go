@@ -0,0 +1,243 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+	"go-socket/protocol"
+)
+
+// คำขอ mark ข้อความว่าอ่านแล้ว ({"type":"read","message_ids":[...]})
+type ReadRequest = protocol.ReadRequest
+
+// คำขอ mark ทั้งบทสนทนาว่าอ่านแล้ว (POST /read-all)
+type ReadAllRequest struct {
+	UserID string `json:"user_id"` // ผู้อ่าน (ผู้รับข้อความ)
+	PeerID string `json:"peer_id"` // ผู้ส่งข้อความในบทสนทนา
+}
+
+// คำขอ mark ข้อความว่าอ่านแล้วทาง REST (POST /messages/read)
+// ระบุ peer_id (และ up_to_id ถ้าอ่านถึงแค่ข้อความนั้น) หรือ message_ids อย่างใดอย่างหนึ่ง
+type MarkReadRequest struct {
+	UserID     string  `json:"user_id"` // ผู้อ่าน (ไม่ต้องใส่ถ้าใช้ JWT)
+	PeerID     string  `json:"peer_id"`
+	UpToID     int64   `json:"up_to_id"`
+	MessageIDs []int64 `json:"message_ids"`
+}
+
+// จำนวน message_ids สูงสุดต่อคำขอ
+const maxReadMessageIDs = 500
+
+// สถานะของข้อความ ไล่ตามลำดับ sent -> delivered -> read
+// ผู้ส่งรู้ว่า sent จาก ack, delivered จาก delivery receipt และ read จาก read receipt
+const (
+	messageStateSent      = protocol.StateSent      // บันทึกแล้ว ยังไม่ถึงอุปกรณ์ของผู้รับ
+	messageStateDelivered = protocol.StateDelivered // ถึงอุปกรณ์ของผู้รับแล้ว
+	messageStateRead      = protocol.StateRead      // ผู้รับอ่านแล้ว
+)
+
+// read receipt ที่ส่งให้ผู้ส่งข้อความ
+type ReadReceipt = protocol.ReadReceipt
+
+// สถานะใน ack ที่ผู้รับส่งกลับมาทาง WebSocket
+const (
+	receiptStatusDelivered = protocol.ReceiptDelivered // ได้รับข้อความบนอุปกรณ์แล้ว
+	receiptStatusRead      = protocol.ReceiptRead      // ผู้ใช้เปิดอ่านแล้ว
+)
+
+// ack ที่ผู้รับส่งยืนยันข้อความหนึ่งข้อความ ({"type":"ack","message_id":...,"status":"delivered"|"read"})
+// ไม่ระบุ status = read
+type ReceiptAck = protocol.ReceiptAck
+
+// delivery receipt ที่ส่งให้ผู้ส่งข้อความ
+type DeliveryReceipt = protocol.DeliveryReceipt
+
+// ส่ง delivery receipt ให้ผู้ส่งแต่ละคนที่ออนไลน์อยู่
+func sendDeliveryReceipts(tenant, recipientID string, delivered map[string][]int64) {
+	for senderID, ids := range delivered {
+		if senderID == recipientID {
+			continue
+		}
+		sendToUser(tenant, senderID, frameTypeDeliveryReceipt, DeliveryReceipt{
+			Type:        frameTypeDeliveryReceipt,
+			State:       messageStateDelivered,
+			RecipientID: recipientID,
+			MessageIDs:  ids,
+		})
+	}
+}
+
+// จัดการ ack ของผู้รับที่ส่งมาทาง WebSocket แล้วแจ้งผู้ส่งด้วย receipt ตามสถานะ
+func handleReceiptAck(cl *client, raw []byte) {
+	var ack ReceiptAck
+	if err := cl.codec.Unmarshal(raw, &ack); err != nil || ack.MessageID <= 0 {
+		cl.send(ErrorFrame{Type: frameTypeError, Code: errCodeInvalidRequest, Detail: "ack requires message_id"})
+		return
+	}
+	ids := []int64{ack.MessageID}
+
+	switch ack.Status {
+	case receiptStatusDelivered:
+		delivered, err := ackDelivered(cl.tenant, cl.userID, ids)
+		if err != nil {
+			cl.logger().Warn("acknowledging delivery", "msg_id", ack.MessageID, "err", err)
+			return
+		}
+		streamReceipts(eventDelivered, cl.tenant, cl.userID, delivered)
+		sendDeliveryReceipts(cl.tenant, cl.userID, delivered)
+	case "", receiptStatusRead:
+		read, err := markRead(cl.tenant, cl.userID, ids)
+		if err != nil {
+			cl.logger().Warn("marking messages read", "err", err)
+			return
+		}
+		sendReadReceipts(cl.tenant, cl.userID, read)
+	default:
+		cl.send(ErrorFrame{Type: frameTypeError, Code: errCodeInvalidRequest, Detail: "unknown ack status " + ack.Status})
+		return
+	}
+	cl.logger().Debug("message acknowledged", "msg_id", ack.MessageID, "status", ack.Status)
+}
+
+// ส่ง read receipt ให้ผู้ส่งแต่ละคนที่ออนไลน์อยู่
+// (ทุกทางที่ mark read ผ่านฟังก์ชันนี้ จึงส่ง event read เข้า audit stream ที่นี่ด้วย)
+func sendReadReceipts(tenant, readerID string, read map[string][]int64) {
+	streamReceipts(eventRead, tenant, readerID, read)
+	for senderID, ids := range read {
+		// ไม่ส่ง receipt กลับหาตัวเอง (กรณี saved messages)
+		if senderID == readerID {
+			continue
+		}
+		sendToUser(tenant, senderID, frameTypeReadReceipt, ReadReceipt{
+			Type:       frameTypeReadReceipt,
+			State:      messageStateRead,
+			ReaderID:   readerID,
+			MessageIDs: ids,
+		})
+	}
+}
+
+// จัดการ read receipt ที่ส่งมาทาง WebSocket
+func handleReadFrame(cl *client, raw []byte) {
+	var req ReadRequest
+	if err := cl.codec.Unmarshal(raw, &req); err != nil || len(req.MessageIDs) == 0 {
+		cl.send(ErrorFrame{Type: frameTypeError, Code: errCodeInvalidRequest, Detail: "read requires message_ids"})
+		return
+	}
+	// จำกัดเท่ากับ REST ไม่งั้น IN (...) ยาวเกินจำนวนตัวแปรที่ SQLite รับได้
+	if len(req.MessageIDs) > maxReadMessageIDs {
+		cl.send(ErrorFrame{Type: frameTypeError, Code: errCodeInvalidRequest, Detail: fmt.Sprintf("too many message_ids (max %d)", maxReadMessageIDs)})
+		return
+	}
+
+	read, err := markRead(cl.tenant, cl.userID, req.MessageIDs)
+	if err != nil {
+		cl.logger().Warn("marking messages read", "err", err)
+		return
+	}
+
+	sendReadReceipts(cl.tenant, cl.userID, read)
+	cl.logger().Debug("messages read", "count", len(req.MessageIDs))
+}
+
+// POST /read-all  {"user_id": ..., "peer_id": ...}
+func handleReadAll(c *fiber.Ctx) error {
+	var req ReadAllRequest
+	if err := c.BodyParser(&req); err != nil {
+		return InvalidRequest("Invalid request body")
+	}
+	if err := BindAuthUser(c, &req.UserID, "user_id"); err != nil {
+		return err
+	}
+	if req.UserID == "" || req.PeerID == "" {
+		return InvalidRequest("user_id and peer_id are required")
+	}
+
+	tenant := TenantOf(c)
+	ids, err := markConversationRead(tenant, req.UserID, req.PeerID, 0)
+	if err != nil {
+		return Internal("Error marking conversation read", err)
+	}
+	if len(ids) > 0 {
+		sendReadReceipts(tenant, req.UserID, map[string][]int64{req.PeerID: ids})
+	}
+	slog.Debug("conversation read", "request_id", requestIDOf(c), "tenant", tenant, "user_id", req.UserID, "peer_id", req.PeerID, "count", len(ids))
+
+	return c.JSON(fiber.Map{"updated": len(ids)})
+}
+
+// POST /messages/read  {"peer_id": ..., "up_to_id": ...} หรือ {"message_ids": [...]}
+// สำหรับ client ที่อ่าน history ทาง REST ส่ง read receipt ให้ผู้ส่งที่ออนไลน์เหมือนอ่านผ่าน WebSocket
+func handleMarkRead(c *fiber.Ctx) error {
+	var req MarkReadRequest
+	if err := c.BodyParser(&req); err != nil {
+		return InvalidRequest("Invalid request body")
+	}
+	if err := BindAuthUser(c, &req.UserID, "user_id"); err != nil {
+		return err
+	}
+	switch {
+	case req.UserID == "":
+		return InvalidRequest("user_id is required")
+	case (req.PeerID == "") == (len(req.MessageIDs) == 0):
+		return InvalidRequest("Exactly one of peer_id or message_ids is required")
+	case len(req.MessageIDs) > maxReadMessageIDs:
+		return InvalidRequest(fmt.Sprintf("Too many message_ids (max %d)", maxReadMessageIDs))
+	case req.UpToID < 0:
+		return InvalidRequest("up_to_id must not be negative")
+	}
+
+	tenant := TenantOf(c)
+	read := make(map[string][]int64)
+	if req.PeerID != "" {
+		ids, err := markConversationRead(tenant, req.UserID, req.PeerID, req.UpToID)
+		if err != nil {
+			return Internal("Error marking conversation read", err)
+		}
+		if len(ids) > 0 {
+			read[req.PeerID] = ids
+		}
+	} else {
+		var err error
+		if read, err = markRead(tenant, req.UserID, req.MessageIDs); err != nil {
+			return Internal("Error marking messages read", err)
+		}
+	}
+	sendReadReceipts(tenant, req.UserID, read)
+
+	ids := make([]int64, 0)
+	for _, senderIDs := range read {
+		ids = append(ids, senderIDs...)
+	}
+	slices.Sort(ids)
+	slog.Debug("messages read", "request_id", requestIDOf(c), "tenant", tenant, "user_id", req.UserID, "count", len(ids))
+
+	return c.JSON(fiber.Map{"updated": len(ids), "message_ids": ids})
+}
+
+// เรียก messageStore โดยลองใหม่เมื่อ SQLite ไม่ว่าง เหมือนการบันทึกข้อความ (receipt มักชนกับ worker ที่ mark delivered)
+func ackDelivered(tenant, receiverID string, ids []int64) (delivered map[string][]int64, err error) {
+	err = retryOnBusy("acknowledging delivery", func() error {
+		delivered, err = messageStore.AckDelivered(tenant, receiverID, ids)
+		return err
+	})
+	return delivered, err
+}
+
+func markRead(tenant, readerID string, ids []int64) (read map[string][]int64, err error) {
+	err = retryOnBusy("marking read", func() error {
+		read, err = messageStore.MarkRead(tenant, readerID, ids)
+		return err
+	})
+	return read, err
+}
+
+func markConversationRead(tenant, readerID, peerID string, upToID int64) (ids []int64, err error) {
+	err = retryOnBusy("marking conversation read", func() error {
+		ids, err = messageStore.MarkConversationRead(tenant, readerID, peerID, upToID)
+		return err
+	})
+	return ids, err
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// เรียก POST /messages/read คืนค่า status และ message_ids ที่ถูก mark
+func postMarkRead(t *testing.T, body string) (int, []int64) {
+	t.Helper()
+	resp, err := http.Post("http://"+testAddr+"/messages/read", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		MessageIDs []int64 `json:"message_ids"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	return resp.StatusCode, result.MessageIDs
+}
+
+func TestMarkReadOverRESTSendsReceipt(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	first := saveMessageToDB(Message{SenderID: bob, ReceiverID: alice, Text: "one"})
+	second := saveMessageToDB(Message{SenderID: bob, ReceiverID: alice, Text: "two"})
+	third := saveMessageToDB(Message{SenderID: bob, ReceiverID: alice, Text: "three"})
+	bobConn := dialWS(t, bob)
+
+	// อ่านถึงข้อความที่สอง
+	status, ids := postMarkRead(t, fmt.Sprintf(`{"user_id":%q,"peer_id":%q,"up_to_id":%d}`, alice, bob, second))
+	if status != http.StatusOK || len(ids) != 2 || ids[0] != first || ids[1] != second {
+		t.Fatalf("unexpected result: %d %v", status, ids)
+	}
+	var receipt ReadReceipt
+	readJSON(t, bobConn, &receipt)
+	if receipt.Type != frameTypeReadReceipt || receipt.ReaderID != alice || len(receipt.MessageIDs) != 2 {
+		t.Fatalf("unexpected receipt: %+v", receipt)
+	}
+
+	// ตาม ID ที่ระบุ ข้อความที่อ่านแล้วไม่นับซ้ำ
+	status, ids = postMarkRead(t, fmt.Sprintf(`{"user_id":%q,"message_ids":[%d,%d]}`, alice, second, third))
+	if status != http.StatusOK || len(ids) != 1 || ids[0] != third {
+		t.Fatalf("unexpected result: %d %v", status, ids)
+	}
+	if n := countStored(t, bob, alice, true); n != 0 {
+		t.Fatalf("expected no unread messages, got %d", n)
+	}
+}
+
+func TestMarkReadRequiresPeerOrIDs(t *testing.T) {
+	alice := newTestUser("alice")
+	for _, body := range []string{
+		`{"user_id":"` + alice + `"}`,
+		`{"user_id":"` + alice + `","peer_id":"bob","message_ids":[1]}`,
+		`{"peer_id":"bob"}`,
+	} {
+		if status, _ := postMarkRead(t, body); status != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, status)
+		}
+	}
+}
+
+func TestHistoryReportsDeliveryState(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	sent := saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: "sent"})
+	delivered := saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: "delivered"})
+	read := saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: "read"})
+	aliceConn := dialWS(t, alice)
+
+	markDelivered([]int64{delivered, read})
+	var receipt DeliveryReceipt
+	readJSON(t, aliceConn, &receipt)
+	if receipt.Type != frameTypeDeliveryReceipt || receipt.State != messageStateDelivered || receipt.RecipientID != bob || len(receipt.MessageIDs) != 2 {
+		t.Fatalf("unexpected delivery receipt: %+v", receipt)
+	}
+	if status, _ := postMarkRead(t, fmt.Sprintf(`{"user_id":%q,"message_ids":[%d]}`, bob, read)); status != http.StatusOK {
+		t.Fatalf("mark read: status %d", status)
+	}
+
+	_, page := getHistoryREST(t, alice, bob, "", "")
+	states := make(map[int64]Message)
+	for _, msg := range page.Messages {
+		states[msg.ID] = msg
+	}
+	if m := states[sent]; m.State != messageStateSent || m.DeliveredAt != nil || m.ReadAt != nil {
+		t.Fatalf("unexpected sent message: %+v", m)
+	}
+	if m := states[delivered]; m.State != messageStateDelivered || m.DeliveredAt == nil || m.ReadAt != nil {
+		t.Fatalf("unexpected delivered message: %+v", m)
+	}
+	if m := states[read]; m.State != messageStateRead || m.DeliveredAt == nil || m.ReadAt == nil {
+		t.Fatalf("unexpected read message: %+v", m)
+	}
+}
+
+func TestReadFrameRejectsInvalidInput(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	id := saveMessageToDB(Message{SenderID: bob, ReceiverID: alice, Text: "unread"})
+	conn := dialWS(t, alice)
+	var pending Message
+	readJSON(t, conn, &pending)
+
+	tooMany := make([]int64, maxReadMessageIDs+1)
+	for i := range tooMany {
+		tooMany[i] = id
+	}
+	for _, frame := range []any{
+		map[string]any{"type": "read", "message_ids": tooMany},
+		map[string]any{"type": "read"},
+		map[string]any{"type": "read", "message_ids": "not a list"},
+	} {
+		if err := conn.WriteJSON(frame); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		var errFrame ErrorFrame
+		readJSON(t, conn, &errFrame)
+		if errFrame.Type != frameTypeError || errFrame.Code != errCodeInvalidRequest {
+			t.Fatalf("expected invalid_request error frame, got %+v", errFrame)
+		}
+	}
+	if n := countStored(t, bob, alice, true); n != 1 {
+		t.Fatalf("rejected read frames must not mark anything read, unread=%d", n)
+	}
+}
+
+func TestReadAllMarksOnlyReceivedMessagesFromPeer(t *testing.T) {
+	alice, bob, carol := newTestUser("alice"), newTestUser("bob"), newTestUser("carol")
+	saveMessageToDB(Message{SenderID: bob, ReceiverID: alice, Text: "one"})
+	saveMessageToDB(Message{SenderID: bob, ReceiverID: alice, Text: "two"})
+	saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: "mine"})
+	saveMessageToDB(Message{SenderID: carol, ReceiverID: alice, Text: "other chat"})
+	bobConn := dialWS(t, bob)
+	var pending Message
+	readJSON(t, bobConn, &pending)
+
+	resp, err := http.Post("http://"+testAddr+"/read-all", "application/json", strings.NewReader(fmt.Sprintf(`{"user_id":%q,"peer_id":%q}`, alice, bob)))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Updated int `json:"updated"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	if resp.StatusCode != http.StatusOK || result.Updated != 2 {
+		t.Fatalf("unexpected result: %d %+v", resp.StatusCode, result)
+	}
+
+	var receipt ReadReceipt
+	readJSON(t, bobConn, &receipt)
+	if receipt.Type != frameTypeReadReceipt || receipt.ReaderID != alice || len(receipt.MessageIDs) != 2 {
+		t.Fatalf("unexpected receipt: %+v", receipt)
+	}
+	if n := countStored(t, bob, alice, true); n != 0 {
+		t.Fatalf("expected bob's messages to be read, unread=%d", n)
+	}
+	// ข้อความที่ alice ส่งเอง และของบทสนทนาอื่นต้องไม่ถูก mark
+	if n := countStored(t, alice, bob, true); n != 1 {
+		t.Fatalf("messages alice sent must stay unread, unread=%d", n)
+	}
+	if n := countStored(t, carol, alice, true); n != 1 {
+		t.Fatalf("other conversations must stay unread, unread=%d", n)
+	}
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+
+	"go-socket/protocol"
+)
+
+// ความยาวสูงสุดของข้อความต้นทางที่แนบไปกับ reply (ตัวอักษร)
+const maxReplySnippetRunes = 100
+
+var (
+	errReplyNotFound          = errors.New("reply_to message not found")
+	errReplyCrossConversation = errors.New("reply_to message belongs to another conversation")
+)
+
+// ข้อความต้นทางแบบย่อ สำหรับให้ client แสดง thread
+type ReplyPreview = protocol.ReplyPreview
+
+// ตัดข้อความให้สั้นพอสำหรับ preview
+func replySnippet(text string) string {
+	if utf8.RuneCountInString(text) <= maxReplySnippetRunes {
+		return text
+	}
+	return string([]rune(text)[:maxReplySnippetRunes]) + "…"
+}
+
+// ตรวจสอบข้อความต้นทางของ reply และแนบ preview ให้ msg
+// ต้นทางต้องยังไม่ถูกลบ และอยู่ในบทสนทนาเดียวกัน (ผู้ใช้คู่เดียวกัน หรือห้องเดียวกัน)
+func resolveReplyTo(msg *Message) error {
+	if msg.ReplyToID == 0 {
+		return nil
+	}
+
+	var senderID, receiverID, text string
+	var roomID int64
+	var keyVersion int
+	err := db.QueryRow("SELECT sender_id, receiver_id, COALESCE(room_id, 0), text, text_key_version FROM messages WHERE id = ? AND tenant_id = ? AND deleted_at IS NULL", msg.ReplyToID, tenantOrDefault(msg.TenantID)).Scan(&senderID, &receiverID, &roomID, &text, &keyVersion)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errReplyNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("fetching reply_to message: %w", err)
+	}
+
+	sameConversation := roomID == 0 && ((senderID == msg.SenderID && receiverID == msg.ReceiverID) ||
+		(senderID == msg.ReceiverID && receiverID == msg.SenderID))
+	if msg.RoomID != 0 {
+		// ในห้อง ต้นทางเป็นสำเนาของสมาชิกคนใดก็ได้ในห้องเดียวกัน
+		sameConversation = roomID == msg.RoomID
+	}
+	if !sameConversation {
+		return errReplyCrossConversation
+	}
+	if text, err = openText(text, keyVersion); err != nil {
+		return fmt.Errorf("decrypting reply_to message: %w", err)
+	}
+
+	msg.ReplyTo = &ReplyPreview{ID: msg.ReplyToID, SenderID: senderID, Snippet: replySnippet(text)}
+	return nil
+}
+
+// แนบ preview ของข้อความต้นทางให้ข้อความที่ดึงจาก DB (ต้นทางที่ถูกลบไปแล้วจะไม่มี preview)
+func attachReplyPreviews(msgs []Message) {
+	var ids []any
+	for _, msg := range msgs {
+		if msg.ReplyToID != 0 {
+			ids = append(ids, msg.ReplyToID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	query := fmt.Sprintf("SELECT id, sender_id, text, text_key_version FROM messages WHERE deleted_at IS NULL AND id IN (%s)", strings.Join(makePlaceholders(len(ids)), ","))
+	rows, err := db.Query(query, ids...)
+	if err != nil {
+		slog.Error("fetching reply previews", "err", err)
+		return
+	}
+	defer rows.Close()
+
+	previews := make(map[int64]*ReplyPreview)
+	for rows.Next() {
+		var p ReplyPreview
+		var text string
+		var keyVersion int
+		if err := rows.Scan(&p.ID, &p.SenderID, &text, &keyVersion); err != nil {
+			slog.Error("scanning reply preview", "err", err)
+			return
+		}
+		if text, err = openText(text, keyVersion); err != nil {
+			slog.Error("decrypting reply preview", "msg_id", p.ID, "err", err)
+			continue
+		}
+		p.Snippet = replySnippet(text)
+		previews[p.ID] = &p
+	}
+	for i := range msgs {
+		if msgs[i].ReplyToID != 0 {
+			msgs[i].ReplyTo = previews[msgs[i].ReplyToID]
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package api
+
+import "testing"
+
+func TestReplyToRequiresSameConversation(t *testing.T) {
+	alice, bob, carol := newTestUser("alice"), newTestUser("bob"), newTestUser("carol")
+	parent := saveMessageToDB(Message{SenderID: bob, ReceiverID: alice, Text: "lunch at noon?"})
+	other := saveMessageToDB(Message{SenderID: carol, ReceiverID: alice, Text: "not your thread"})
+
+	reply := Message{SenderID: alice, ReceiverID: bob, Text: "sure", ReplyToID: parent}
+	if err := resolveReplyTo(&reply); err != nil {
+		t.Fatalf("resolveReplyTo: %v", err)
+	}
+	if reply.ReplyTo == nil || reply.ReplyTo.SenderID != bob || reply.ReplyTo.Snippet != "lunch at noon?" {
+		t.Fatalf("unexpected preview: %+v", reply.ReplyTo)
+	}
+
+	cross := Message{SenderID: alice, ReceiverID: bob, Text: "sure", ReplyToID: other}
+	if err := resolveReplyTo(&cross); err != errReplyCrossConversation {
+		t.Fatalf("expected cross-conversation error, got %v", err)
+	}
+
+	db.Exec("UPDATE messages SET deleted_at = CURRENT_TIMESTAMP WHERE id = ?", parent)
+	deleted := Message{SenderID: alice, ReceiverID: bob, Text: "sure", ReplyToID: parent}
+	if err := resolveReplyTo(&deleted); err != errReplyNotFound {
+		t.Fatalf("expected not found for deleted parent, got %v", err)
+	}
+}
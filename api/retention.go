@@ -0,0 +1,350 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go-socket/store"
+)
+
+// เปิด purge job ถ้ามีการตั้งค่า retention ไว้ (ค่า default คือไม่ลบข้อความ)
+func startRetentionJob() {
+	if config.RetentionReadAfter <= 0 && config.RetentionMaxAge <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(config.RetentionInterval)
+		defer ticker.Stop()
+
+		for run := 1; ; run++ {
+			<-ticker.C
+			runRetention(run, time.Now())
+		}
+	}()
+}
+
+// retention job หนึ่งรอบ (run นับจาก 1) คืนค่า true ถ้ารอบนี้ได้ VACUUM
+func runRetention(run int, now time.Time) bool {
+	purged, err := purgeOldMessages(now)
+	if err != nil {
+		slog.Error("purging messages", "err", err)
+		return false
+	}
+	slog.Info("purged expired messages", "count", purged)
+
+	// คืนพื้นที่ไฟล์ DB เป็นระยะ (VACUUM ใช้เวลานาน จึงไม่รันทุกรอบ)
+	// PostgreSQL มี autovacuum อยู่แล้ว
+	if db.Dialect != dialectSQLite || config.RetentionVacuumEvery <= 0 || run%config.RetentionVacuumEvery != 0 {
+		return false
+	}
+	if _, err := db.Exec("VACUUM"); err != nil {
+		slog.Error("running VACUUM", "err", err)
+		return false
+	}
+	return true
+}
+
+// ลบข้อความที่หมดอายุตามการตั้งค่า คืนค่าจำนวนแถวที่ลบ
+func purgeOldMessages(now time.Time) (int64, error) {
+	var purged int64
+
+	if config.RetentionReadAfter > 0 {
+		n, err := purgeInBatches("is_read = TRUE AND created_at < ?", now.Add(-config.RetentionReadAfter).UTC(), now)
+		purged += n
+		if err != nil {
+			return purged, err
+		}
+	}
+
+	if config.RetentionMaxAge > 0 {
+		n, err := purgeInBatches("created_at < ?", now.Add(-config.RetentionMaxAge).UTC(), now)
+		purged += n
+		if err != nil {
+			return purged, err
+		}
+	}
+	return purged, nil
+}
+
+// ลบข้อความที่ตรงเงื่อนไขทีละ RetentionBatchSize แถว แต่ละ batch เป็น transaction สั้นๆ
+// และพักระหว่าง batch ให้ worker ที่บันทึกข้อความได้ lock ของ SQLite
+func purgeInBatches(where string, cutoff, now time.Time) (int64, error) {
+	var purged int64
+	for {
+		n, err := purgeBatch(where, cutoff, now)
+		purged += n
+		if err != nil || n < int64(config.RetentionBatchSize) {
+			return purged, err
+		}
+		time.Sleep(config.RetentionBatchPause)
+	}
+}
+
+func purgeBatch(where string, cutoff, now time.Time) (int64, error) {
+	rows, err := db.Query("SELECT id FROM messages WHERE "+where+" ORDER BY id LIMIT ?", cutoff, config.RetentionBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	var ids []any
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	if config.RetentionArchiveDir != "" {
+		if err := archiveMessages(ids, now); err != nil {
+			return 0, fmt.Errorf("archiving messages: %w", err)
+		}
+	}
+
+	if err := deleteMessages(ids); err != nil {
+		return 0, err
+	}
+	messagesPurgedTotal.Add(float64(len(ids)))
+	return int64(len(ids)), nil
+}
+
+// ลบข้อความตาม ids ใน transaction เดียวพร้อม reaction และ mention ของข้อความ
+// reply/forward ที่อ้างถึงข้อความเหล่านี้ถูกตั้งเป็น NULL และไฟล์แนบที่ไม่มีข้อความอื่นใช้แล้วถูกลบตามไปด้วย
+func deleteMessages(ids []any) error {
+	placeholders := strings.Join(makePlaceholders(len(ids)), ",")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// ข้อความที่ส่งต่อใช้ไฟล์แนบเดียวกับต้นฉบับ จึงลบไฟล์ได้ก็ต่อเมื่อไม่เหลือข้อความที่อ้างถึงแล้ว
+	attachmentIDs, err := queryStrings(tx, "SELECT DISTINCT attachment_id FROM messages WHERE id IN ("+placeholders+") AND attachment_id IS NOT NULL", ids...)
+	if err != nil {
+		return err
+	}
+	for _, table := range []string{"reactions", "mentions"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE message_id IN ("+placeholders+")", ids...); err != nil {
+			return err
+		}
+	}
+	for _, column := range []string{"reply_to_id", "forwarded_from_id"} {
+		if _, err := tx.Exec("UPDATE messages SET "+column+" = NULL WHERE "+column+" IN ("+placeholders+")", ids...); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM messages WHERE id IN ("+placeholders+")", ids...); err != nil {
+		return err
+	}
+	var orphaned []string
+	if len(attachmentIDs) > 0 {
+		args := make([]any, len(attachmentIDs))
+		for i, id := range attachmentIDs {
+			args[i] = id
+		}
+		orphaned, err = queryStrings(tx, "DELETE FROM attachments WHERE id IN ("+strings.Join(makePlaceholders(len(args)), ",")+") AND NOT EXISTS (SELECT 1 FROM messages WHERE messages.attachment_id = attachments.id) RETURNING id", args...)
+		if err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// ลบเนื้อไฟล์หลัง commit ถ้าลบไม่สำเร็จจะเหลือแค่ไฟล์ที่ไม่มีใครอ้างถึง
+	for _, id := range orphaned {
+		if err := attachmentStorage.Delete(id); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("deleting attachment file", "attachment_id", id, "err", err)
+		}
+	}
+	return nil
+}
+
+// คอลัมน์แรกของทุกแถวจาก query เป็น string
+func queryStrings(tx *store.Tx, query string, args ...any) ([]string, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
+
+// เขียนแถวของข้อความต่อท้าย <RetentionArchiveDir>/messages-YYYY-MM-DD.jsonl (หนึ่งแถวต่อบรรทัด ทุกคอลัมน์ตามที่เก็บใน DB)
+// ข้อความที่เข้ารหัสไว้ยังเป็น ciphertext ในไฟล์ ถ้าลบไม่สำเร็จ batch ถัดไปอาจเขียนแถวเดิมซ้ำ
+func archiveMessages(ids []any, now time.Time) error {
+	if err := os.MkdirAll(config.RetentionArchiveDir, 0o700); err != nil {
+		return err
+	}
+	rows, err := db.Query("SELECT * FROM messages WHERE id IN ("+strings.Join(makePlaceholders(len(ids)), ",")+") ORDER BY id", ids...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	values := make([]any, len(columns))
+	ptrs := make([]any, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		row := make(map[string]any, len(columns))
+		for i, col := range columns {
+			if b, ok := values[i].([]byte); ok {
+				row[col] = string(b)
+			} else {
+				row[col] = values[i]
+			}
+		}
+		if err := enc.Encode(row); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	path := filepath.Join(config.RetentionArchiveDir, "messages-"+now.UTC().Format("2006-01-02")+".jsonl")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	// ต้องถึง disk ก่อนลบแถวออกจาก DB
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// บทสนทนาที่เพิ่งมีข้อความใหม่ รอ trimmer ตัดให้เหลือ MaxMessagesPerConversation ข้อความ
+type trimTarget struct{ tenant, key string }
+
+var (
+	trimMu      sync.Mutex
+	pendingTrim = make(map[trimTarget]int) // -> MaxMessagesPerConversation ตอนบันทึก
+	trimWake    = make(chan struct{}, 1)
+)
+
+// จดบทสนทนาของข้อความที่บันทึกแล้วไว้ให้ trimmer ตัดทีหลัง (ไม่ทำใน path ของการบันทึก)
+// ข้อความหลายชุดที่เข้ามาก่อน trimmer ตื่นรวมเป็นรอบเดียว
+func scheduleTrim(msgs []Message) {
+	max := config.MaxMessagesPerConversation
+	if max <= 0 {
+		return
+	}
+	trimMu.Lock()
+	for _, msg := range msgs {
+		if msg.RoomID != 0 {
+			continue
+		}
+		pendingTrim[trimTarget{tenantOrDefault(msg.TenantID), conversationKey(msg.SenderID, msg.ReceiverID)}] = max
+	}
+	trimMu.Unlock()
+	select {
+	case trimWake <- struct{}{}:
+	default:
+	}
+}
+
+// เปิด goroutine ที่ตัดบทสนทนาที่ scheduleTrim จดไว้
+func startConversationTrimmer() {
+	go func() {
+		for range trimWake {
+			trimConversations()
+		}
+	}()
+}
+
+// ลบข้อความที่อ่านแล้วที่เก่ากว่าข้อความล่าสุด MaxMessagesPerConversation ข้อความ
+// ของบทสนทนาที่รออยู่ (ข้อความที่ยังไม่อ่านจะไม่ถูกลบ)
+func trimConversations() {
+	trimMu.Lock()
+	targets := pendingTrim
+	pendingTrim = make(map[trimTarget]int)
+	trimMu.Unlock()
+
+	for target, max := range targets {
+		n, err := trimConversation(target.tenant, target.key, max)
+		if err != nil {
+			slog.Error("trimming conversation", "tenant", target.tenant, "err", err)
+			continue
+		}
+		if n > 0 {
+			slog.Info("trimmed conversation", "tenant", target.tenant, "count", n)
+		}
+	}
+}
+
+// ลบข้อความที่อ่านแล้วที่เก่ากว่าข้อความลำดับที่ max (นับจากล่าสุด) ของบทสนทนา
+// ใช้ idx_messages_conversation จึงไม่ต้อง scan ทั้งตาราง
+func trimConversation(tenant, key string, max int) (int64, error) {
+	rows, err := db.Query(`
+		SELECT id FROM messages
+		WHERE conversation_key = ? AND tenant_id = ? AND room_id IS NULL AND is_read = TRUE
+			AND id < (SELECT id FROM messages WHERE conversation_key = ? AND tenant_id = ? AND room_id IS NULL ORDER BY id DESC LIMIT 1 OFFSET ?)`,
+		key, tenant, key, tenant, max-1)
+	if err != nil {
+		return 0, err
+	}
+	var ids []any
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	if err := deleteMessages(ids); err != nil {
+		return 0, err
+	}
+	messagesPurgedTotal.Add(float64(len(ids)))
+	return int64(len(ids)), nil
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// คืนค่า retention เดิมหลังจบ test (ทีละ field เพราะ goroutine ของ server อ่าน config อยู่) และปิดการพักระหว่าง batch
+func withRetention(t *testing.T) {
+	t.Helper()
+	prevReadAfter, prevMaxAge, prevBatch, prevPause := config.RetentionReadAfter, config.RetentionMaxAge, config.RetentionBatchSize, config.RetentionBatchPause
+	prevArchive, prevVacuum := config.RetentionArchiveDir, config.RetentionVacuumEvery
+	t.Cleanup(func() {
+		config.RetentionReadAfter, config.RetentionMaxAge, config.RetentionBatchSize, config.RetentionBatchPause = prevReadAfter, prevMaxAge, prevBatch, prevPause
+		config.RetentionArchiveDir, config.RetentionVacuumEvery = prevArchive, prevVacuum
+	})
+	config.RetentionBatchPause = 0
+}
+
+func TestPurgeArchivesReadMessagesInBatches(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	old := time.Now().Add(-48 * time.Hour).UTC()
+	var ids []int64
+	for _, text := range []string{"one", "two", "three"} {
+		id := saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: text})
+		db.Exec("UPDATE messages SET is_read = TRUE, created_at = ? WHERE id = ?", old, id)
+		ids = append(ids, id)
+	}
+	// ยังไม่อ่าน ไม่ถูกลบแม้จะเก่า
+	unread := saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: "unread"})
+	db.Exec("UPDATE messages SET created_at = ? WHERE id = ?", old, unread)
+
+	withRetention(t)
+	config.RetentionReadAfter = 24 * time.Hour
+	config.RetentionBatchSize = 2
+	config.RetentionArchiveDir = t.TempDir()
+
+	now := time.Now()
+	purged, err := purgeOldMessages(now)
+	if err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if purged < 3 {
+		t.Fatalf("expected at least 3 purged, got %d", purged)
+	}
+	if n := countStored(t, alice, bob, false); n != 1 {
+		t.Fatalf("expected only the unread message left, got %d", n)
+	}
+
+	f, err := os.Open(filepath.Join(config.RetentionArchiveDir, "messages-"+now.UTC().Format("2006-01-02")+".jsonl"))
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer f.Close()
+	archived := make(map[int64]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var row struct {
+			ID       int64  `json:"id"`
+			SenderID string `json:"sender_id"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			t.Fatalf("archive line %q: %v", scanner.Text(), err)
+		}
+		if row.SenderID == alice {
+			archived[row.ID] = true
+		}
+	}
+	for _, id := range ids {
+		if !archived[id] {
+			t.Fatalf("message %d not archived", id)
+		}
+	}
+	if archived[unread] {
+		t.Fatal("unread message should not be archived")
+	}
+}
+
+func TestMaxAgePurgeCleansUpReferencesAndVacuums(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	old := time.Now().Add(-48 * time.Hour).UTC()
+
+	// ไฟล์แนบสองไฟล์: ไฟล์หนึ่งมีแต่ข้อความเก่าใช้ อีกไฟล์ถูกส่งต่อไปในข้อความใหม่ด้วย
+	attach := func(id string) {
+		db.Exec("INSERT INTO attachments (id, tenant_id, uploader_id, filename, content_type, size, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			id, DefaultTenant, alice, id+".png", "image/png", len(testPNG), old)
+		if err := attachmentStorage.Put(id, bytes.NewReader(testPNG)); err != nil {
+			t.Fatalf("put attachment: %v", err)
+		}
+	}
+	orphan, shared := uuid.NewString(), uuid.NewString()
+	attach(orphan)
+	attach(shared)
+
+	expired := saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: "old, unread"})
+	expiredShared := saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: "old photo"})
+	reply := saveMessageToDB(Message{SenderID: bob, ReceiverID: alice, Text: "reply", ReplyToID: expired})
+	forward := saveMessageToDB(Message{SenderID: bob, ReceiverID: alice, Text: "old photo"})
+	db.Exec("UPDATE messages SET created_at = ?, attachment_id = ? WHERE id = ?", old, orphan, expired)
+	db.Exec("UPDATE messages SET created_at = ?, attachment_id = ? WHERE id = ?", old, shared, expiredShared)
+	db.Exec("UPDATE messages SET attachment_id = ?, forwarded_from_id = ?, forwarded_sender_id = ? WHERE id = ?", shared, expiredShared, alice, forward)
+
+	withRetention(t)
+	config.RetentionMaxAge = 24 * time.Hour
+	config.RetentionVacuumEvery = 2
+
+	if vacuumed := runRetention(1, time.Now()); vacuumed {
+		t.Fatal("VACUUM should only run every RetentionVacuumEvery rounds")
+	}
+	// ข้อความที่ยังไม่อ่านก็ถูกลบเมื่อเก่ากว่า RetentionMaxAge
+	if n := countStored(t, alice, bob, false); n != 0 {
+		t.Fatalf("expected alice's expired messages to be purged, %d left", n)
+	}
+
+	var replyTo, forwardedFrom sql.NullInt64
+	var forwardedSender string
+	db.QueryRow("SELECT reply_to_id FROM messages WHERE id = ?", reply).Scan(&replyTo)
+	db.QueryRow("SELECT forwarded_from_id, forwarded_sender_id FROM messages WHERE id = ?", forward).Scan(&forwardedFrom, &forwardedSender)
+	if replyTo.Valid || forwardedFrom.Valid || forwardedSender != alice {
+		t.Fatalf("references to purged messages must be cleared: reply_to=%v forwarded_from=%v sender=%q", replyTo, forwardedFrom, forwardedSender)
+	}
+
+	if _, _, err := getAttachment(DefaultTenant, orphan); !errors.Is(err, errAttachmentNotFound) {
+		t.Fatalf("orphaned attachment should be deleted, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(config.AttachmentDir, orphan)); !os.IsNotExist(err) {
+		t.Fatalf("orphaned attachment file should be removed, stat err %v", err)
+	}
+	if _, _, err := getAttachment(DefaultTenant, shared); err != nil {
+		t.Fatalf("attachment still used by a forward must be kept: %v", err)
+	}
+
+	if vacuumed := runRetention(2, time.Now()); !vacuumed {
+		t.Fatal("expected VACUUM on the RetentionVacuumEvery-th round")
+	}
+}
@@ -0,0 +1,505 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	errRoomNotFound     = errors.New("room not found")
+	errNotRoomMember    = errors.New("user is not a member of the room")
+	errOwnerCannotLeave = errors.New("room owner cannot leave the room")
+	errInvalidRoomRole  = errors.New("invalid room role")
+)
+
+// บทบาทในห้อง เรียงจากสิทธิ์น้อยไปมาก
+// admin ลบสมาชิกและข้อความของคนอื่นได้ owner ลบห้องและเปลี่ยนบทบาทได้
+const (
+	roomRoleMember = "member"
+	roomRoleAdmin  = "admin"
+	roomRoleOwner  = "owner"
+)
+
+var roomRoleRank = map[string]int{roomRoleMember: 1, roomRoleAdmin: 2, roomRoleOwner: 3}
+
+// บทบาทไม่พอสำหรับการกระทำในห้อง
+type roomPermissionError struct {
+	Role         string `json:"role"`
+	RequiredRole string `json:"required_role"`
+}
+
+func (e *roomPermissionError) Error() string {
+	return fmt.Sprintf("room role %s required, have %s", e.RequiredRole, e.Role)
+}
+
+// ห้องแชทกลุ่ม
+type Room struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	Members   []string  `json:"members"`
+}
+
+// body ของ POST /rooms
+type CreateRoomRequest struct {
+	UserID  string   `json:"user_id"` // ผู้สร้าง เป็นสมาชิกคนแรกของห้องเสมอ
+	Name    string   `json:"name"`
+	Members []string `json:"members,omitempty"`
+}
+
+// body ของ POST /rooms/:id/join และ /rooms/:id/leave
+type RoomMemberRequest struct {
+	UserID string `json:"user_id"`
+}
+
+// body ของ POST /rooms/:id/role
+type RoomRoleRequest struct {
+	UserID   string `json:"user_id"` // ผู้เปลี่ยน (owner)
+	TargetID string `json:"target_id"`
+	Role     string `json:"role"` // admin | member
+}
+
+// สร้างห้องพร้อมสมาชิกเริ่มต้นใน transaction เดียว ผู้สร้างเป็น owner
+func createRoom(tenant, name, createdBy string, members []string) (Room, error) {
+	room := Room{Name: name, CreatedBy: createdBy, CreatedAt: time.Now().UTC()}
+	room.Members = uniqueIDs(append([]string{createdBy}, members...))
+
+	err := retryOnBusy("creating room", func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		err = tx.QueryRow("INSERT INTO rooms (tenant_id, name, created_by, created_at) VALUES (?, ?, ?, ?) RETURNING id", tenant, name, createdBy, room.CreatedAt).Scan(&room.ID)
+		if err != nil {
+			return err
+		}
+		for _, userID := range room.Members {
+			role := roomRoleMember
+			if userID == createdBy {
+				role = roomRoleOwner
+			}
+			if _, err := tx.Exec("INSERT INTO room_members (room_id, user_id, role, joined_at) VALUES (?, ?, ?, ?)", room.ID, userID, role, room.CreatedAt); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+	return room, err
+}
+
+// ตรวจว่าห้องอยู่ใน tenant นี้
+func roomExists(tenant string, roomID int64) (bool, error) {
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM rooms WHERE id = ? AND tenant_id = ?)", roomID, tenant).Scan(&exists)
+	return exists, err
+}
+
+// เพิ่มสมาชิก (เข้าห้องซ้ำไม่ถือว่าผิด)
+func joinRoom(tenant string, roomID int64, userID string) error {
+	exists, err := roomExists(tenant, roomID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errRoomNotFound
+	}
+	return retryOnBusy("joining room", func() error {
+		_, err := db.Exec("INSERT INTO room_members (room_id, user_id, joined_at) VALUES (?, ?, ?) ON CONFLICT DO NOTHING", roomID, userID, time.Now().UTC())
+		return err
+	})
+}
+
+// บทบาทของผู้ใช้ในห้อง
+func roomRole(tenant string, roomID int64, userID string) (string, error) {
+	exists, err := roomExists(tenant, roomID)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", errRoomNotFound
+	}
+	var role string
+	err = db.QueryRow("SELECT role FROM room_members WHERE room_id = ? AND user_id = ?", roomID, userID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", errNotRoomMember
+	}
+	return role, err
+}
+
+// ตรวจว่าผู้ใช้เป็นสมาชิกที่มีบทบาทอย่างน้อย required คืนค่าบทบาทจริง
+func requireRoomRole(tenant string, roomID int64, userID, required string) (string, error) {
+	role, err := roomRole(tenant, roomID, userID)
+	if err != nil {
+		return "", err
+	}
+	if roomRoleRank[role] < roomRoleRank[required] {
+		return role, &roomPermissionError{Role: role, RequiredRole: required}
+	}
+	return role, nil
+}
+
+// ผู้ใช้ออกจากห้องเอง owner ออกไม่ได้ (ต้องลบห้อง)
+func leaveRoom(tenant string, roomID int64, userID string) error {
+	role, err := roomRole(tenant, roomID, userID)
+	if err != nil {
+		return err
+	}
+	if role == roomRoleOwner {
+		return errOwnerCannotLeave
+	}
+	return deleteRoomMember(roomID, userID)
+}
+
+// admin/owner เอาสมาชิกที่บทบาทต่ำกว่าตัวเองออกจากห้อง
+func removeRoomMember(tenant string, roomID int64, actorID, targetID string) error {
+	actorRole, err := requireRoomRole(tenant, roomID, actorID, roomRoleAdmin)
+	if err != nil {
+		return err
+	}
+	targetRole, err := roomRole(tenant, roomID, targetID)
+	if err != nil {
+		return err
+	}
+	if roomRoleRank[targetRole] >= roomRoleRank[actorRole] {
+		return &roomPermissionError{Role: actorRole, RequiredRole: roomRoleOwner}
+	}
+	return deleteRoomMember(roomID, targetID)
+}
+
+func deleteRoomMember(roomID int64, userID string) error {
+	var res sql.Result
+	err := retryOnBusy("leaving room", func() error {
+		var err error
+		res, err = db.Exec("DELETE FROM room_members WHERE room_id = ? AND user_id = ?", roomID, userID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errNotRoomMember
+	}
+	return nil
+}
+
+// owner ตั้งบทบาทของสมาชิกคนอื่นเป็น admin หรือ member (โอนความเป็น owner ไม่ได้)
+func setRoomRole(tenant string, roomID int64, actorID, targetID, role string) error {
+	if role != roomRoleAdmin && role != roomRoleMember {
+		return errInvalidRoomRole
+	}
+	if _, err := requireRoomRole(tenant, roomID, actorID, roomRoleOwner); err != nil {
+		return err
+	}
+	if actorID == targetID {
+		return errInvalidRoomRole
+	}
+	if _, err := roomRole(tenant, roomID, targetID); err != nil {
+		return err
+	}
+	return retryOnBusy("setting room role", func() error {
+		_, err := db.Exec("UPDATE room_members SET role = ? WHERE room_id = ? AND user_id = ?", role, roomID, targetID)
+		return err
+	})
+}
+
+// owner ลบห้อง: สมาชิกทั้งหมดถูกเอาออกและข้อความของห้องถูกลบ (soft delete)
+func deleteRoom(tenant string, roomID int64, actorID string) error {
+	if _, err := requireRoomRole(tenant, roomID, actorID, roomRoleOwner); err != nil {
+		return err
+	}
+	return retryOnBusy("deleting room", func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.Exec("UPDATE messages SET deleted_at = ? WHERE tenant_id = ? AND room_id = ? AND deleted_at IS NULL", time.Now().UTC(), tenant, roomID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM room_members WHERE room_id = ?", roomID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM rooms WHERE id = ? AND tenant_id = ?", roomID, tenant); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// บทบาทของสมาชิกทุกคนในห้อง
+func getRoomRoles(roomID int64) (map[string]string, error) {
+	rows, err := db.Query("SELECT user_id, role FROM room_members WHERE room_id = ?", roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := make(map[string]string)
+	for rows.Next() {
+		var userID, role string
+		if err := rows.Scan(&userID, &role); err != nil {
+			return nil, err
+		}
+		roles[userID] = role
+	}
+	return roles, rows.Err()
+}
+
+// รายชื่อสมาชิกของห้อง เรียงตามลำดับที่เข้าห้อง
+func getRoomMembers(tenant string, roomID int64) ([]string, error) {
+	exists, err := roomExists(tenant, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errRoomNotFound
+	}
+
+	rows, err := db.Query("SELECT user_id FROM room_members WHERE room_id = ? ORDER BY joined_at, user_id", roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := make([]string, 0)
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		members = append(members, userID)
+	}
+	return members, rows.Err()
+}
+
+// ตรวจว่าผู้ส่งเป็นสมาชิกของห้องที่ข้อความระบุ
+func checkRoomSender(msg Message) error {
+	var member bool
+	err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM room_members m JOIN rooms r ON r.id = m.room_id WHERE r.id = ? AND r.tenant_id = ? AND m.user_id = ?)",
+		msg.RoomID, tenantOrDefault(msg.TenantID), msg.SenderID).Scan(&member)
+	if err != nil {
+		return fmt.Errorf("checking room membership: %w", err)
+	}
+	if !member {
+		return errNotRoomMember
+	}
+	return nil
+}
+
+// ผู้รับของข้อความห้อง: สมาชิกทุกคนยกเว้นผู้ส่ง และสมาชิกที่บล็อกผู้ส่งไว้
+func roomRecipients(msg Message) ([]string, error) {
+	if err := checkRoomSender(msg); err != nil {
+		return nil, err
+	}
+	members, err := getRoomMembers(msg.TenantID, msg.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	blockers, err := blockersOf(msg.TenantID, msg.SenderID)
+	if err != nil {
+		return nil, err
+	}
+
+	recipients := make([]string, 0, len(members))
+	for _, userID := range members {
+		if userID != msg.SenderID && !blockers[userID] {
+			recipients = append(recipients, userID)
+		}
+	}
+	return recipients, nil
+}
+
+// แปลง error ของห้องเป็น Error
+func roomAPIError(err error) error {
+	var perr *roomPermissionError
+	switch {
+	case errors.Is(err, errRoomNotFound):
+		return NotFound("Room not found")
+	case errors.Is(err, errNotRoomMember):
+		return Forbidden("Not a room member")
+	case errors.Is(err, errOwnerCannotLeave):
+		return Forbidden("Room owner cannot leave; delete the room instead")
+	case errors.Is(err, errInvalidRoomRole):
+		return InvalidRequest("role must be admin or member and target_id another member")
+	case errors.As(err, &perr):
+		apiErr := Forbidden("Requires room role " + perr.RequiredRole)
+		apiErr.Details = perr
+		return apiErr
+	default:
+		return Internal("Error updating room", err)
+	}
+}
+
+// POST /rooms
+func handleCreateRoom(c *fiber.Ctx) error {
+	var req CreateRoomRequest
+	if err := c.BodyParser(&req); err != nil {
+		return InvalidRequest("Invalid request body")
+	}
+	if err := BindAuthUser(c, &req.UserID, "user_id"); err != nil {
+		return err
+	}
+	if req.UserID == "" || strings.TrimSpace(req.Name) == "" {
+		return InvalidRequest("user_id and name are required")
+	}
+
+	room, err := createRoom(TenantOf(c), strings.TrimSpace(req.Name), req.UserID, req.Members)
+	if err != nil {
+		return Internal("Error creating room", err)
+	}
+	slog.Info("room created", "request_id", requestIDOf(c), "tenant", TenantOf(c), "user_id", req.UserID, "room_id", room.ID, "members", len(room.Members))
+
+	return c.Status(fiber.StatusCreated).JSON(room)
+}
+
+// body ของ join/leave ผู้ใช้ต้องเป็นเจ้าของ token
+func parseRoomMemberRequest(c *fiber.Ctx) (RoomMemberRequest, error) {
+	var req RoomMemberRequest
+	if err := c.BodyParser(&req); err != nil {
+		return req, InvalidRequest("Invalid request body")
+	}
+	if err := BindAuthUser(c, &req.UserID, "user_id"); err != nil {
+		return req, err
+	}
+	if req.UserID == "" {
+		return req, InvalidRequest("user_id is required")
+	}
+	return req, nil
+}
+
+// POST /rooms/:id/join
+func handleJoinRoom(c *fiber.Ctx) error {
+	roomID, err := c.ParamsInt("id")
+	if err != nil {
+		return InvalidRequest("Invalid room id")
+	}
+	req, err := parseRoomMemberRequest(c)
+	if err != nil {
+		return err
+	}
+
+	if err := joinRoom(TenantOf(c), int64(roomID), req.UserID); err != nil {
+		return roomAPIError(err)
+	}
+	slog.Info("joined room", "request_id", requestIDOf(c), "tenant", TenantOf(c), "user_id", req.UserID, "room_id", roomID)
+
+	return c.JSON(fiber.Map{"status": "Joined room"})
+}
+
+// POST /rooms/:id/leave
+func handleLeaveRoom(c *fiber.Ctx) error {
+	roomID, err := c.ParamsInt("id")
+	if err != nil {
+		return InvalidRequest("Invalid room id")
+	}
+	req, err := parseRoomMemberRequest(c)
+	if err != nil {
+		return err
+	}
+
+	if err := leaveRoom(TenantOf(c), int64(roomID), req.UserID); err != nil {
+		return roomAPIError(err)
+	}
+	slog.Info("left room", "request_id", requestIDOf(c), "tenant", TenantOf(c), "user_id", req.UserID, "room_id", roomID)
+
+	return c.JSON(fiber.Map{"status": "Left room"})
+}
+
+// GET /rooms/:id/members  เมื่อเปิด RequireJWT ดูได้เฉพาะสมาชิกของห้อง
+func handleRoomMembers(c *fiber.Ctx) error {
+	roomID, err := c.ParamsInt("id")
+	if err != nil {
+		return InvalidRequest("Invalid room id")
+	}
+
+	members, err := getRoomMembers(TenantOf(c), int64(roomID))
+	if err != nil {
+		return roomAPIError(err)
+	}
+	if user := AuthUser(c); user != "" && !slices.Contains(members, user) {
+		return roomAPIError(errNotRoomMember)
+	}
+	roles, err := getRoomRoles(int64(roomID))
+	if err != nil {
+		return Internal("Error fetching room roles", err)
+	}
+	return c.JSON(fiber.Map{"room_id": roomID, "members": members, "roles": roles})
+}
+
+// POST /rooms/:id/role  {"user_id": <owner>, "target_id": ..., "role": "admin"|"member"}
+func handleSetRoomRole(c *fiber.Ctx) error {
+	roomID, err := c.ParamsInt("id")
+	if err != nil {
+		return InvalidRequest("Invalid room id")
+	}
+	var req RoomRoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return InvalidRequest("Invalid request body")
+	}
+	if err := BindAuthUser(c, &req.UserID, "user_id"); err != nil {
+		return err
+	}
+	if req.UserID == "" || req.TargetID == "" || req.Role == "" {
+		return InvalidRequest("user_id, target_id and role are required")
+	}
+
+	if err := setRoomRole(TenantOf(c), int64(roomID), req.UserID, req.TargetID, req.Role); err != nil {
+		return roomAPIError(err)
+	}
+	slog.Info("room role changed", "request_id", requestIDOf(c), "tenant", TenantOf(c), "user_id", req.UserID, "room_id", roomID, "target_id", req.TargetID, "role", req.Role)
+
+	return c.JSON(fiber.Map{"room_id": roomID, "user_id": req.TargetID, "role": req.Role})
+}
+
+// DELETE /rooms/:id/members/:memberID  (admin/owner)
+func handleRemoveRoomMember(c *fiber.Ctx) error {
+	roomID, err := c.ParamsInt("id")
+	if err != nil {
+		return InvalidRequest("Invalid room id")
+	}
+	userID, err := RequestUser(c)
+	if err != nil {
+		return err
+	}
+	targetID := c.Params("memberID")
+	if targetID == userID {
+		return InvalidRequest("Use /rooms/:id/leave to leave the room")
+	}
+
+	if err := removeRoomMember(TenantOf(c), int64(roomID), userID, targetID); err != nil {
+		return roomAPIError(err)
+	}
+	slog.Info("removed room member", "request_id", requestIDOf(c), "tenant", TenantOf(c), "user_id", userID, "room_id", roomID, "target_id", targetID)
+
+	return c.JSON(fiber.Map{"status": "Member removed"})
+}
+
+// DELETE /rooms/:id  (owner)
+func handleDeleteRoom(c *fiber.Ctx) error {
+	roomID, err := c.ParamsInt("id")
+	if err != nil {
+		return InvalidRequest("Invalid room id")
+	}
+	userID, err := RequestUser(c)
+	if err != nil {
+		return err
+	}
+
+	if err := deleteRoom(TenantOf(c), int64(roomID), userID); err != nil {
+		return roomAPIError(err)
+	}
+	slog.Info("room deleted", "request_id", requestIDOf(c), "tenant", TenantOf(c), "user_id", userID, "room_id", roomID)
+
+	return c.JSON(fiber.Map{"status": "Room deleted"})
+}
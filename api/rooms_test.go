@@ -0,0 +1,219 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func postRoom(t *testing.T, path, body string) (int, []byte) {
+	t.Helper()
+	resp, err := http.Post("http://"+testAddr+path, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("post %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	var raw json.RawMessage
+	json.NewDecoder(resp.Body).Decode(&raw)
+	return resp.StatusCode, raw
+}
+
+func TestRoomMessageFansOutToMembers(t *testing.T) {
+	alice, bob, carol := newTestUser("alice"), newTestUser("bob"), newTestUser("carol")
+
+	code, body := postRoom(t, "/rooms", `{"user_id":"`+alice+`","name":"team","members":["`+bob+`","`+carol+`"]}`)
+	if code != http.StatusCreated {
+		t.Fatalf("unexpected status %d: %s", code, body)
+	}
+	var room Room
+	json.Unmarshal(body, &room)
+	if len(room.Members) != 3 || room.Members[0] != alice {
+		t.Fatalf("unexpected room: %+v", room)
+	}
+
+	// bob ออนไลน์ carol ออฟไลน์
+	bobConn := dialWS(t, bob)
+	aliceConn := dialWS(t, alice)
+	if err := aliceConn.WriteJSON(Message{SenderID: alice, RoomID: room.ID, Text: "hello team"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	var got Message
+	readJSON(t, bobConn, &got)
+	if got.RoomID != room.ID || got.SenderID != alice || got.ReceiverID != bob || got.Text != "hello team" {
+		t.Fatalf("unexpected frame: %+v", got)
+	}
+
+	carolConn := dialWS(t, carol)
+	readJSON(t, carolConn, &got)
+	if got.RoomID != room.ID || got.ReceiverID != carol {
+		t.Fatalf("unexpected pending frame: %+v", got)
+	}
+	if n := countStored(t, alice, alice, false); n != 0 {
+		t.Fatalf("sender should not get a copy, got %d", n)
+	}
+}
+
+func TestRoomMembershipIsEnforced(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	room, err := createRoom(DefaultTenant, "pair", alice, []string{bob})
+	if err != nil {
+		t.Fatalf("createRoom: %v", err)
+	}
+	path := "/rooms/" + strconv.FormatInt(room.ID, 10)
+
+	// คนนอกห้องส่งข้อความไม่ได้
+	mallory := newTestUser("mallory")
+	malloryConn := dialWS(t, mallory)
+	malloryConn.WriteJSON(Message{SenderID: mallory, RoomID: room.ID, Text: "let me in"})
+	var errFrame ErrorFrame
+	readJSON(t, malloryConn, &errFrame)
+	if errFrame.Code != errCodeForbidden {
+		t.Fatalf("expected forbidden, got %+v", errFrame)
+	}
+
+	if code, _ := postRoom(t, path+"/join", `{"user_id":"`+mallory+`"}`); code != http.StatusOK {
+		t.Fatalf("join: unexpected status %d", code)
+	}
+	if code, _ := postRoom(t, path+"/leave", `{"user_id":"`+bob+`"}`); code != http.StatusOK {
+		t.Fatalf("leave: unexpected status %d", code)
+	}
+	if code, _ := postRoom(t, path+"/leave", `{"user_id":"`+bob+`"}`); code != http.StatusForbidden {
+		t.Fatalf("expected 403 leaving twice, got %d", code)
+	}
+
+	members, err := getRoomMembers(DefaultTenant, room.ID)
+	if err != nil {
+		t.Fatalf("getRoomMembers: %v", err)
+	}
+	if len(members) != 2 || members[0] != alice || members[1] != mallory {
+		t.Fatalf("unexpected members: %v", members)
+	}
+
+	if code, _ := postRoom(t, "/rooms/999999/join", `{"user_id":"`+bob+`"}`); code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown room, got %d", code)
+	}
+	if _, err := getRoomMembers("acme", room.ID); err != errRoomNotFound {
+		t.Fatalf("expected room to be invisible to other tenants, got %v", err)
+	}
+}
+
+func roomRequest(t *testing.T, method, path, body string) (int, Error) {
+	t.Helper()
+	req, _ := http.NewRequest(method, "http://"+testAddr+path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	var apiErr Error
+	if resp.StatusCode >= 400 {
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+	}
+	return resp.StatusCode, apiErr
+}
+
+func TestRoomRolesEnforcePermissions(t *testing.T) {
+	alice, bob, carol := newTestUser("alice"), newTestUser("bob"), newTestUser("carol")
+	room, err := createRoom(DefaultTenant, "mods", alice, []string{bob, carol})
+	if err != nil {
+		t.Fatalf("createRoom: %v", err)
+	}
+	path := "/rooms/" + strconv.FormatInt(room.ID, 10)
+
+	// member เอาคนอื่นออกหรือเปลี่ยนบทบาทไม่ได้ ได้ 403 พร้อมบทบาทที่ต้องมี
+	code, apiErr := roomRequest(t, http.MethodDelete, path+"/members/"+carol+"?user_id="+bob, "")
+	details, _ := apiErr.Details.(map[string]any)
+	if code != http.StatusForbidden || apiErr.Code != errCodeForbidden || details["required_role"] != roomRoleAdmin || details["role"] != roomRoleMember {
+		t.Fatalf("expected structured 403, got %d %+v", code, apiErr)
+	}
+	if code, _ := roomRequest(t, http.MethodPost, path+"/role", `{"user_id":"`+bob+`","target_id":"`+bob+`","role":"admin"}`); code != http.StatusForbidden {
+		t.Fatalf("expected 403 for member changing roles, got %d", code)
+	}
+
+	// owner ตั้ง bob เป็น admin แล้ว bob เอา carol ออกได้ แต่เอา owner ออกไม่ได้
+	if code, _ := roomRequest(t, http.MethodPost, path+"/role", `{"user_id":"`+alice+`","target_id":"`+bob+`","role":"admin"}`); code != http.StatusOK {
+		t.Fatalf("set role: unexpected status %d", code)
+	}
+	if code, _ := roomRequest(t, http.MethodDelete, path+"/members/"+carol+"?user_id="+bob, ""); code != http.StatusOK {
+		t.Fatalf("remove member: unexpected status %d", code)
+	}
+	if code, _ := roomRequest(t, http.MethodDelete, path+"/members/"+alice+"?user_id="+bob, ""); code != http.StatusForbidden {
+		t.Fatalf("expected 403 removing the owner, got %d", code)
+	}
+	roles, err := getRoomRoles(room.ID)
+	if err != nil || len(roles) != 2 || roles[alice] != roomRoleOwner || roles[bob] != roomRoleAdmin {
+		t.Fatalf("unexpected roles %v (%v)", roles, err)
+	}
+
+	// มีแต่ owner ที่ลบห้องได้ และ owner ออกจากห้องเองไม่ได้
+	if code, _ := roomRequest(t, http.MethodDelete, path+"?user_id="+bob, ""); code != http.StatusForbidden {
+		t.Fatalf("expected 403 for admin deleting the room, got %d", code)
+	}
+	if code, _ := postRoom(t, path+"/leave", `{"user_id":"`+alice+`"}`); code != http.StatusForbidden {
+		t.Fatalf("expected 403 for owner leaving, got %d", code)
+	}
+	if code, _ := roomRequest(t, http.MethodDelete, path+"?user_id="+alice, ""); code != http.StatusOK {
+		t.Fatalf("delete room: unexpected status %d", code)
+	}
+	if _, err := getRoomMembers(DefaultTenant, room.ID); err != errRoomNotFound {
+		t.Fatalf("expected deleted room to be gone, got %v", err)
+	}
+}
+
+func TestRoomMessageDeleteRequiresAdminForOthers(t *testing.T) {
+	alice, bob, carol := newTestUser("alice"), newTestUser("bob"), newTestUser("carol")
+	room, err := createRoom(DefaultTenant, "cleanup", alice, []string{bob, carol})
+	if err != nil {
+		t.Fatalf("createRoom: %v", err)
+	}
+	if _, err := dispatchMessage(Message{TenantID: DefaultTenant, SenderID: carol, RoomID: room.ID, Text: "spam"}); err != nil {
+		t.Fatalf("dispatchMessage: %v", err)
+	}
+	var bobCopy int64
+	db.QueryRow("SELECT id FROM messages WHERE room_id = ? AND receiver_id = ?", room.ID, bob).Scan(&bobCopy)
+	deletePath := "/messages/" + strconv.FormatInt(bobCopy, 10)
+
+	// bob เป็นแค่ member ลบข้อความของ carol ไม่ได้
+	if code, apiErr := roomRequest(t, http.MethodDelete, deletePath+"?user_id="+bob, ""); code != http.StatusForbidden || apiErr.Details == nil {
+		t.Fatalf("expected structured 403, got %d %+v", code, apiErr)
+	}
+
+	// owner ลบได้ ทุกสำเนาถูกลบและสมาชิกที่ออนไลน์ได้ event
+	bobConn := dialWS(t, bob)
+	waitFor(t, func() bool { _, ok := getClient(DefaultTenant, bob); return ok })
+	var pending Message
+	readJSON(t, bobConn, &pending)
+	if code, _ := roomRequest(t, http.MethodDelete, deletePath+"?user_id="+alice, ""); code != http.StatusOK {
+		t.Fatalf("delete: unexpected status %d", code)
+	}
+	var event MessageDeleted
+	readJSON(t, bobConn, &event)
+	if event.Type != frameTypeMessageDeleted || event.MessageID != bobCopy || event.RoomID != room.ID || event.DeletedBy != alice {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+	var left int
+	db.QueryRow("SELECT COUNT(*) FROM messages WHERE room_id = ? AND deleted_at IS NULL", room.ID).Scan(&left)
+	if left != 0 {
+		t.Fatalf("expected every copy deleted, %d left", left)
+	}
+}
+
+func TestDirectMessageDeleteOnlyBySender(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	id := saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: "oops"})
+	path := "/messages/" + strconv.FormatInt(id, 10)
+
+	if code, _ := roomRequest(t, http.MethodDelete, path+"?user_id="+bob, ""); code != http.StatusForbidden {
+		t.Fatalf("expected 403 for receiver, got %d", code)
+	}
+	if code, _ := roomRequest(t, http.MethodDelete, path+"?user_id="+alice, ""); code != http.StatusOK {
+		t.Fatalf("delete: unexpected status %d", code)
+	}
+	if _, msg := getMessageREST(t, id, bob); !msg.Deleted {
+		t.Fatalf("expected tombstone, got %+v", msg)
+	}
+}
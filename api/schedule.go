@@ -0,0 +1,172 @@
+package api
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// สถานะของข้อความตั้งเวลา
+const (
+	schedulePending   = "pending"
+	scheduleSent      = "sent"
+	scheduleCancelled = "cancelled"
+)
+
+// ตั้งเวลาล่วงหน้าได้ไม่เกินค่านี้
+const maxScheduleAhead = 365 * 24 * time.Hour
+
+// คำขอตั้งเวลาส่งข้อความ (POST /schedule) ใช้ field เดียวกับ /send และเพิ่ม send_at
+type ScheduleRequest struct {
+	Message
+	SendAt time.Time `json:"send_at"`
+}
+
+// ข้อความตั้งเวลาที่บันทึกไว้
+type ScheduledMessage struct {
+	ID     int64     `json:"id"`
+	SendAt time.Time `json:"send_at"`
+	Status string    `json:"status"`
+}
+
+// บันทึกข้อความตั้งเวลาลง DB (เก็บไว้ใน DB จึงไม่หายเมื่อ restart)
+func scheduleMessage(msg Message, sendAt time.Time) (int64, error) {
+	payload, keyVersion, err := sealPayload(msg)
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	err = db.QueryRow("INSERT INTO scheduled_messages (tenant_id, sender_id, receiver_id, payload, key_version, send_at, status, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id",
+		tenantOrDefault(msg.TenantID), msg.SenderID, msg.ReceiverID, payload, keyVersion, sendAt.UTC(), schedulePending, time.Now().UTC()).Scan(&id)
+	return id, err
+}
+
+// ยกเลิกข้อความตั้งเวลาของ senderID ที่ยังไม่ถูกส่ง คืนค่า false ถ้าไม่พบ (หรือส่งไปแล้ว)
+func cancelScheduledMessage(tenant string, id int64, senderID string) (bool, error) {
+	res, err := db.Exec("UPDATE scheduled_messages SET status = ? WHERE id = ? AND tenant_id = ? AND sender_id = ? AND status = ?", scheduleCancelled, id, tenant, senderID, schedulePending)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ดึงข้อความที่ถึงเวลาส่งแล้ว และตั้งสถานะเป็น sent ใน UPDATE เดียว (กันส่งซ้ำ/แย่งกับการยกเลิก)
+func claimDueMessages(now time.Time) ([]Message, error) {
+	rows, err := db.Query("UPDATE scheduled_messages SET status = ? WHERE status = ? AND send_at <= ? RETURNING id, tenant_id, payload, key_version", scheduleSent, schedulePending, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var due []Message
+	for rows.Next() {
+		var id int64
+		var tenant, payload string
+		var keyVersion int
+		if err := rows.Scan(&id, &tenant, &payload, &keyVersion); err != nil {
+			return nil, err
+		}
+		var msg Message
+		if err := openPayload(payload, keyVersion, &msg); err != nil {
+			slog.Error("decoding scheduled message", "tenant", tenant, "scheduled_id", id, "err", err)
+			continue
+		}
+		msg.TenantID = tenant
+		due = append(due, msg)
+	}
+	return due, rows.Err()
+}
+
+// ส่งข้อความที่ถึงเวลาเข้าเส้นทางส่งปกติ ผ่าน outbox เพื่อไม่ให้หายถ้า crash ก่อน worker จัดการ
+func dispatchDueMessages(now time.Time) {
+	due, err := claimDueMessages(now)
+	if err != nil {
+		slog.Error("claiming scheduled messages", "err", err)
+		return
+	}
+
+	for _, msg := range due {
+		queued := queuedMessage{Message: msg}
+		if queued.outboxID, err = addToOutbox(msg); err != nil {
+			messageLogger(msg).Error("saving scheduled message to outbox", "err", err)
+		}
+		if !enqueueMessage(queued) {
+			// ยังอยู่ใน outbox สถานะ pending จะถูกส่งใหม่ตอนเปิด server
+			messageLogger(msg).Warn("scheduled message not enqueued: broadcast queue is full")
+			continue
+		}
+		messageLogger(msg).Info("sending scheduled message")
+	}
+}
+
+// เปิด scheduler ที่ตรวจหาข้อความตั้งเวลาทุก config.SchedulerInterval
+func startScheduler() {
+	go func() {
+		ticker := time.NewTicker(config.SchedulerInterval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			dispatchDueMessages(now)
+		}
+	}()
+}
+
+// POST /schedule
+func handleSchedule(c *fiber.Ctx) error {
+	var req ScheduleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return InvalidRequest("Invalid request body")
+	}
+	msg := req.Message
+	if err := BindAuthUser(c, &msg.SenderID, "sender_id"); err != nil {
+		return err
+	}
+	msg.TenantID = TenantOf(c)
+	if err := validateOutgoing(&msg); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if !req.SendAt.After(now) {
+		return InvalidRequest("send_at must be in the future")
+	}
+	if req.SendAt.Sub(now) > maxScheduleAhead {
+		return InvalidRequest("send_at is too far in the future")
+	}
+	if ok, resetsAt := consumeQuota(msg.TenantID, msg.SenderID, 1, now); !ok {
+		return errQuotaExceeded(resetsAt)
+	}
+
+	id, err := scheduleMessage(msg, req.SendAt)
+	if err != nil {
+		return Internal("Error scheduling message", err)
+	}
+	messageLogger(msg).Info("message scheduled", "scheduled_id", id, "send_at", req.SendAt.UTC())
+
+	return c.Status(fiber.StatusCreated).JSON(ScheduledMessage{ID: id, SendAt: req.SendAt.UTC(), Status: schedulePending})
+}
+
+// DELETE /schedule/:id?sender_id=...  ยกเลิกได้เฉพาะผู้ส่งและก่อนถึงเวลาส่ง (sender_id มาจาก JWT เมื่อเปิด RequireJWT)
+func handleCancelSchedule(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return InvalidRequest("Invalid schedule id")
+	}
+	senderID := c.Query("sender_id")
+	if err := BindAuthUser(c, &senderID, "sender_id"); err != nil {
+		return err
+	}
+	if senderID == "" {
+		return InvalidRequest("sender_id is required")
+	}
+
+	ok, err := cancelScheduledMessage(TenantOf(c), int64(id), senderID)
+	if err != nil {
+		return Internal("Error cancelling scheduled message", err)
+	}
+	if !ok {
+		return NotFound("Scheduled message not found or already sent")
+	}
+	return c.JSON(ScheduledMessage{ID: int64(id), Status: scheduleCancelled})
+}
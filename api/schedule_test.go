@@ -0,0 +1,44 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduledMessageIsSentWhenDueUnlessCancelled(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	now := time.Now()
+
+	keep, err := scheduleMessage(Message{SenderID: alice, ReceiverID: bob, Text: "happy birthday"}, now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("schedule: %v", err)
+	}
+	cancel, err := scheduleMessage(Message{SenderID: alice, ReceiverID: bob, Text: "never mind"}, now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("schedule: %v", err)
+	}
+	if ok, _ := cancelScheduledMessage(DefaultTenant, cancel, bob); ok {
+		t.Fatal("only the sender may cancel")
+	}
+	if ok, err := cancelScheduledMessage(DefaultTenant, cancel, alice); !ok || err != nil {
+		t.Fatalf("cancel: %v %v", ok, err)
+	}
+
+	// ยังไม่ถึงเวลา
+	dispatchDueMessages(now)
+	if n := countStored(t, alice, bob, false); n != 0 {
+		t.Fatalf("message sent before send_at: %d", n)
+	}
+
+	dispatchDueMessages(now.Add(2 * time.Minute))
+	waitFor(t, func() bool { return countStored(t, alice, bob, false) == 1 })
+
+	var status string
+	db.QueryRow("SELECT status FROM scheduled_messages WHERE id = ?", keep).Scan(&status)
+	if status != scheduleSent {
+		t.Fatalf("expected sent status, got %q", status)
+	}
+	if ok, _ := cancelScheduledMessage(DefaultTenant, keep, alice); ok {
+		t.Fatal("sent message must not be cancellable")
+	}
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	chatclient "go-socket/client"
+	"go-socket/protocol"
+)
+
+func dialSDK(t *testing.T, userID string) *chatclient.Client {
+	t.Helper()
+	c, err := chatclient.Dial(context.Background(), chatclient.Options{URL: "http://" + testAddr, UserID: userID, MinBackoff: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("dial %s: %v", userID, err)
+	}
+	t.Cleanup(func() { c.Close() })
+	waitFor(t, func() bool { _, ok := getClient(DefaultTenant, userID); return ok })
+	return c
+}
+
+func receiveSDK(t *testing.T, c *chatclient.Client) protocol.Message {
+	t.Helper()
+	select {
+	case msg := <-c.Messages():
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message received")
+		return protocol.Message{}
+	}
+}
+
+func TestSDKSendReceiveAndHistory(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	aliceSDK, bobSDK := dialSDK(t, alice), dialSDK(t, bob)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	ack, err := aliceSDK.Send(ctx, protocol.Message{ReceiverID: bob, Text: "hi from sdk"})
+	if err != nil || ack.Status != protocol.AckDelivered || ack.ServerID == 0 {
+		t.Fatalf("unexpected ack: %+v %v", ack, err)
+	}
+	if msg := receiveSDK(t, bobSDK); msg.ID != ack.ServerID || msg.SenderID != alice || msg.Text != "hi from sdk" {
+		t.Fatalf("unexpected message: %+v", msg)
+	}
+
+	page, err := aliceSDK.History(ctx, bob, "", 10)
+	if err != nil || len(page.Messages) != 1 || page.Messages[0].ID != ack.ServerID {
+		t.Fatalf("unexpected history: %+v %v", page, err)
+	}
+	if _, err := aliceSDK.History(ctx, bob, "not-a-cursor", 0); err == nil {
+		t.Fatal("expected API error for bad cursor")
+	}
+}
+
+func TestSDKReconnectsAndResumes(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	aliceSDK, bobSDK := dialSDK(t, alice), dialSDK(t, bob)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := aliceSDK.Send(ctx, protocol.Message{ReceiverID: bob, Text: "first"}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	receiveSDK(t, bobSDK)
+
+	// ตัด connection ของ bob จากฝั่ง server แบบไม่มี close frame
+	cl, _ := getClient(DefaultTenant, bob)
+	cl.conn.Close()
+
+	if _, err := aliceSDK.Send(ctx, protocol.Message{ReceiverID: bob, Text: "while away"}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if msg := receiveSDK(t, bobSDK); msg.Text != "while away" {
+		t.Fatalf("unexpected message after reconnect: %+v", msg)
+	}
+	if bobSDK.Err() != nil {
+		t.Fatalf("client stopped: %v", bobSDK.Err())
+	}
+}
+
+func TestSDKHelloHandshake(t *testing.T) {
+	alice := newTestUser("alice")
+	token, _, _ := issueJWT(DefaultTenant, alice, time.Now())
+	c, err := chatclient.Dial(context.Background(), chatclient.Options{URL: "http://" + testAddr, UserID: alice, Token: token, Handshake: true})
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer c.Close()
+	waitFor(t, func() bool { _, ok := getClient(DefaultTenant, alice); return ok })
+
+	if _, err := chatclient.Dial(context.Background(), chatclient.Options{URL: "http://" + testAddr, UserID: alice, Token: "bad", Handshake: true}); err == nil {
+		t.Fatal("expected handshake with a bad token to fail")
+	}
+}
@@ -0,0 +1,787 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	fws "github.com/fasthttp/websocket" // error ของ read limit มาจาก library ตัวจริง ไม่ใช่ตัวที่ contrib ประกาศซ้ำไว้
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go-socket/hub"
+	"go-socket/protocol"
+	"go-socket/store"
+)
+
+var (
+	db        *sqlDB
+	broadcast chan queuedMessage // ขนาดตาม BroadcastQueueSize (สร้างใน initQueues)
+
+	// ช่องทางสำหรับข้อความเร่งด่วน (เช่น แจ้งเตือนความปลอดภัย) ให้ worker หยิบก่อนเสมอ
+	priorityBroadcast chan queuedMessage
+)
+
+// ค่า Priority ของข้อความเร่งด่วน (ค่าอื่น = ปกติ)
+const priorityHigh = "high"
+
+// จำนวนข้อความเร่งด่วนที่ router หยิบติดกันได้ก่อนเปิดโอกาสให้ข้อความปกติ (กัน starvation)
+const maxPriorityStreak = 10
+
+// ข้อความแชท ใช้ชนิดเดียวกับบน wire (TenantID และ TraceID เป็นของ server ไม่ถูก serialize)
+type Message = protocol.Message
+
+// ข้อความในคิว broadcast พร้อมข้อมูลที่ worker ใช้หลังบันทึก/ส่งเสร็จ
+type queuedMessage struct {
+	Message
+	outboxID int64   // แถวใน outbox ของข้อความที่รับมาทาง WebSocket (0 = ไม่ได้ผ่าน outbox)
+	origin   *client // connection ที่ส่งข้อความนี้มา ใช้ตอบ ack (nil = มาจาก REST หรือ outbox)
+	gated    bool    // นับอยู่ใน senderGate (overflow แบบ backpressure) worker ต้องคืนหลังจัดการเสร็จ
+}
+
+// DSN ที่ใช้ตอนรันจริงถ้าไม่ได้ตั้ง CHAT_DATABASE_URL (test ใช้ SQLite in-memory แทน)
+const defaultDatabaseURL = "file:chat.db?cache=shared&mode=rwc"
+
+// เปิดการเชื่อมต่อตาม DSN: postgres://... ใช้ PostgreSQL นอกนั้นเป็นไฟล์ SQLite
+func initDB(databaseURL string) error {
+	if err := openDB(databaseURL); err != nil {
+		return err
+	}
+
+	// อัปเดต schema ให้เป็นเวอร์ชันล่าสุด
+	if err := runMigrations(); err != nil {
+		return fmt.Errorf("migrating database: %w", err)
+	}
+
+	messageStore = store.NewMessages(db, messageHooks{})
+	startMessageWriter()
+
+	slog.Info("connected to database", "dialect", db.Dialect)
+	return nil
+}
+
+// เชื่อมต่อ DB และตั้งค่า connection pool (ยังไม่รัน migration)
+func openDB(databaseURL string) error {
+	var err error
+	if db, err = store.Open(databaseURL, config.SQLiteBusyTimeout); err != nil {
+		return fmt.Errorf("connecting to database: %w", err)
+	}
+
+	db.SetMaxOpenConns(config.DBMaxOpenConns)
+	db.SetMaxIdleConns(config.DBMaxIdleConns)
+	db.SetConnMaxLifetime(config.DBConnMaxLifetime)
+	return nil
+}
+
+// จัดการ schema ตาม args ของคำสั่ง migrate (up|down [version]|status) โดยไม่เปิด server
+func Migrate(cfg Config, args []string, out io.Writer) error {
+	config = cfg
+	if err := openDB(config.DatabaseURL); err != nil {
+		return err
+	}
+	return runMigrateCommand(args, out)
+}
+
+// สร้าง chat engine ตาม cfg: เชื่อมต่อ DB (พร้อม migration) เปิด worker และงาน background ทั้งหมด
+// แล้วคืน Fiber app ที่มี route ของ chat (เปิดด้วย Run หรือ Mount เข้ากับแอปอื่น)
+// state ของ engine เป็นของทั้ง process จึงเรียกได้ครั้งเดียว
+func New(cfg Config) (*fiber.App, error) {
+	config = cfg
+	if config.DevMode {
+		slog.Warn("dev mode enabled: origin checks are disabled")
+	}
+	if err := initEncryption(); err != nil {
+		return nil, fmt.Errorf("invalid encryption config: %w", err)
+	}
+	if err := initContentFilter(); err != nil {
+		return nil, fmt.Errorf("invalid content filter config: %w", err)
+	}
+	if err := initDB(config.DatabaseURL); err != nil {
+		return nil, err
+	}
+	initQueues()
+	if err := initAttachments(); err != nil {
+		return nil, fmt.Errorf("opening attachment storage: %w", err)
+	}
+	startWSTokenSweeper()
+
+	app := newApp()
+
+	if err := startNotifier(); err != nil {
+		return nil, fmt.Errorf("starting push notifications: %w", err)
+	}
+	startMessageSink()
+	startEventStream()
+	startWebhooks()
+	startBotDelivery()
+	if err := joinCluster(); err != nil {
+		return nil, fmt.Errorf("joining cluster: %w", err)
+	}
+	startAuditWriter()
+	startIdleSweeper()
+	startRateLimitSweeper()
+	startHeartbeat()
+	// เปิด Worker Pool สำหรับจัดการข้อความ (จำนวน worker คือจำนวนข้อความที่จะส่งพร้อมกัน)
+	startWorkers(config.Workers)
+	recoverOutbox()
+	startOutboxLeases()
+	startOutboxSweeper()
+	startSpillDrainer()
+	startScheduler()
+
+	// ลบข้อความเก่าตามนโยบาย retention (ถ้าเปิดใช้)
+	startRetentionJob()
+	startConversationTrimmer()
+
+	if err := startGRPCServer(); err != nil {
+		return nil, fmt.Errorf("starting gRPC server: %w", err)
+	}
+	return app, nil
+}
+
+// สร้าง Fiber app พร้อม route ทั้งหมด
+func newApp() *fiber.App {
+	app := fiber.New(fiber.Config{
+		ErrorHandler: ErrorHandler,
+		// เผื่อ multipart header ของไฟล์แนบขนาดสูงสุด (ค่า default ของ Fiber คือ 4MB)
+		BodyLimit: int(config.AttachmentMaxBytes) + 1<<20,
+	})
+	app.Use(requestid.New())
+	app.Use(corsMiddleware())
+	// liveness อยู่ก่อน rejectWhileDraining: ระหว่างปิด server ยังตอบ 200 ไม่ให้ถูก kill ก่อนระบายคิวเสร็จ
+	app.Get("/healthz", handleHealth)
+	app.Use(rejectWhileDraining)
+	app.Use(withTenant)
+	app.Use(authenticateBot)
+
+	app.Get("/chat", func(c *fiber.Ctx) error {
+		return c.SendFile("./index.html")
+	})
+	// Route สำหรับ WebSocket (ตรวจ Origin ก่อน upgrade)
+	app.Get("/ws/chat/:userID", checkOrigin, checkPathIdentity, checkWSToken, requireJWT, checkProtocol, websocket.New(handleWebSocket, websocket.Config{
+		EnableCompression: config.EnableCompression,
+		Subprotocols:      wsSubprotocols,
+	}))
+	// ผู้ใช้มาจาก token ใน hello frame แรกแทน path
+	app.Get("/ws/chat", checkOrigin, checkProtocol, websocket.New(handleHandshakeWebSocket, websocket.Config{
+		EnableCompression: config.EnableCompression,
+		Subprotocols:      wsSubprotocols,
+	}))
+
+	// Route สำหรับผู้ดูแลระบบดูข้อความทั้งหมดแบบ realtime
+	app.Get("/ws/admin/feed", requireAdmin, websocket.New(handleAdminFeed, websocket.Config{
+		EnableCompression: config.EnableCompression,
+	}))
+
+	// SSE สำหรับ client ที่ใช้ WebSocket ไม่ได้ (รับอย่างเดียว ส่งผ่าน /send) EventSource ตั้ง header ไม่ได้ จึงใช้ ?token=/?access_token=
+	app.Get("/sse/chat/:userID", checkOrigin, checkWSToken, requireJWT, handleSSE)
+
+	// GraphQL: query ผ่าน POST และ subscription ผ่าน WebSocket (graphql-transport-ws)
+	app.Post("/graphql", requireJWT, withGraphQLUser, handleGraphQL)
+	app.Get("/graphql", checkOrigin, requireJWT, withGraphQLUser, websocket.New(handleGraphQLWebSocket, websocket.Config{
+		EnableCompression: config.EnableCompression,
+		Subprotocols:      []string{graphqlWSProtocol},
+	}))
+
+	// API ออก token อายุสั้นสำหรับเชื่อมต่อ WebSocket
+	app.Post("/auth/ws-token", handleIssueWSToken)
+
+	// API ออก JWT สำหรับ WebSocket และ /send
+	app.Post("/auth/token", handleIssueJWT)
+
+	// Route สำหรับตรวจสถานะออนไลน์ของผู้ใช้เฉพาะกลุ่ม (เช่น รายชื่อผู้ติดต่อ)
+	app.Post("/presence", handlePresence)
+
+	// Route สำหรับดึงรายชื่อผู้ใช้งานออนไลน์
+	app.Get("/online", func(c *fiber.Ctx) error {
+		onlineUsers := getOnlineUsers(TenantOf(c))
+		return c.JSON(fiber.Map{
+			"online_users": onlineUsers,
+			"count":        len(onlineUsers),
+		})
+	})
+
+	// Route สำหรับ Prometheus
+	app.Get("/metrics", adaptor.HTTPHandler(promhttp.Handler()))
+
+	// Route สำหรับตรวจความพร้อมของ server
+	app.Get("/readyz", handleReady)
+
+	// Route สำหรับตัวเลขสรุปของระบบ (เฉพาะผู้ดูแล)
+	app.Get("/stats", requireAdmin, handleStats)
+
+	// Route สำหรับดูประวัติการเชื่อมต่อ WebSocket (เฉพาะผู้ดูแล)
+	app.Get("/audit/sessions", requireAdmin, handleAuditSessions)
+
+	// Route สำหรับผู้ดูแลระบบ (ทุก route ใต้ /admin ต้องใช้ admin token)
+	admin := app.Group("/admin", requireAdmin)
+	admin.Post("/users/:id/disconnect", handleAdminDisconnect)
+	admin.Get("/users/:id/pending", handleAdminPending)
+	admin.Post("/announcements", handleAdminAnnouncement)
+	admin.Get("/queues", handleAdminQueues)
+	// bot ใช้ API key ที่ได้ตอนสร้างกับ Authorization: Bot <key>
+	admin.Post("/bots", handleCreateBot)
+	admin.Get("/bots", handleListBots)
+	admin.Delete("/bots/:id", handleDeleteBot)
+
+	// Route สำหรับนับข้อความที่ยังไม่ได้อ่าน แยกตามคู่สนทนา
+	app.Get("/unread/:userID", requireJWT, func(c *fiber.Ctx) error {
+		userID := c.Params("userID")
+
+		// ?total=true คืนค่าเฉพาะยอดรวม
+		if c.QueryBool("total") {
+			total, err := messageStore.UnreadTotal(TenantOf(c), userID)
+			if err != nil {
+				return Internal("Error counting unread messages", err)
+			}
+			return c.JSON(fiber.Map{"total": total})
+		}
+
+		counts, err := messageStore.UnreadCounts(TenantOf(c), userID)
+		if err != nil {
+			return Internal("Error counting unread messages", err)
+		}
+		return c.JSON(counts)
+	})
+
+	// Route สำหรับตั้งเวลาส่งข้อความ และยกเลิกก่อนถึงเวลา
+	app.Post("/schedule", requireJWT, handleSchedule)
+	app.Delete("/schedule/:id", requireJWT, handleCancelSchedule)
+
+	// Route สำหรับ mark ทั้งบทสนทนาว่าอ่านแล้ว
+	app.Post("/read-all", requireJWT, handleReadAll)
+
+	// Route สำหรับ mark ข้อความว่าอ่านแล้วตามคู่สนทนาหรือ ID (client ที่อ่าน history ทาง REST)
+	app.Post("/messages/read", requireJWT, handleMarkRead)
+
+	// Route สำหรับรายการบทสนทนาล่าสุดของผู้ใช้ (หน้า inbox)
+	app.Get("/conversations", requireJWT, handleConversations)
+	app.Get("/conversations/:userID", requireJWT, handleConversations)
+
+	// Route สำหรับอัปโหลดไฟล์แนบ และดาวน์โหลด (เฉพาะผู้อัปโหลด ผู้ส่งและผู้รับของข้อความที่แนบไฟล์)
+	app.Post("/attachments", requireJWT, handleUploadAttachment)
+	app.Get("/attachments/:id", requireJWT, handleGetAttachment)
+
+	// Route สำหรับลงทะเบียน/ยกเลิก device token รับ push notification ตอนออฟไลน์
+	app.Post("/devices", requireJWT, handleRegisterDevice)
+	app.Delete("/devices/:token", requireJWT, handleUnregisterDevice)
+
+	// Long-poll สำหรับ client ที่ใช้ WebSocket ไม่ได้
+	app.Get("/poll/:userID", requireJWT, handlePoll)
+
+	// API ห้องแชทกลุ่ม: สร้าง เข้า/ออก และดูรายชื่อสมาชิก
+	app.Post("/rooms", requireJWT, handleCreateRoom)
+	app.Post("/rooms/:id/join", requireJWT, handleJoinRoom)
+	app.Post("/rooms/:id/leave", requireJWT, handleLeaveRoom)
+	app.Get("/rooms/:id/members", requireJWT, handleRoomMembers)
+	// บทบาทในห้อง: owner เปลี่ยนบทบาทและลบห้องได้ admin เอาสมาชิกออกได้
+	app.Post("/rooms/:id/role", requireJWT, handleSetRoomRole)
+	app.Delete("/rooms/:id/members/:memberID", requireJWT, handleRemoveRoomMember)
+	app.Delete("/rooms/:id", requireJWT, handleDeleteRoom)
+
+	// API ดึงประวัติการสนทนากับคู่สนทนาแบบแบ่งหน้าด้วย cursor
+	app.Get("/messages", requireJWT, handleHistory)
+
+	// API ดึงข้อความเดียวตาม ID (สำหรับ deep link / กดจาก notification)
+	app.Get("/messages/:id", requireJWT, handleGetMessage)
+
+	// API ลบข้อความ (ผู้ส่ง หรือ admin/owner ของห้อง)
+	app.Delete("/messages/:id", requireJWT, handleDeleteMessage)
+
+	// API กด/ยกเลิก reaction ให้ข้อความ
+	app.Post("/messages/:id/react", requireJWT, handleReactRequest)
+
+	// API ส่งต่อข้อความเดิมให้ผู้รับคนอื่น
+	app.Post("/messages/:id/forward", requireJWT, handleForwardRequest)
+
+	// API ส่งข้อความเดียวกันให้ผู้รับหลายคน
+	app.Post("/broadcast", requireJWT, handleBroadcastRequest)
+
+	// API บล็อก/ปิดเสียงผู้ใช้อื่น (:id = ผู้ที่ถูกบล็อก)
+	app.Post("/blocks", requireJWT, handleBlock)
+	app.Get("/blocks", requireJWT, handleListBlocks)
+	app.Delete("/blocks/:id", requireJWT, handleUnblock)
+
+	// API รับข้อความโดยไม่ต้อง Connect WebSocket
+	app.Post("/send", requireJWT, func(c *fiber.Ctx) error {
+		var msg Message
+		if err := c.BodyParser(&msg); err != nil {
+			return InvalidRequest("Invalid request body")
+		}
+		// ส่งในนามคนอื่นไม่ได้
+		if user := AuthUser(c); user != "" && msg.SenderID != user {
+			return Forbidden("sender_id does not match token")
+		}
+		msg.TenantID = TenantOf(c)
+		if ok, wait := allowInbound(msg.TenantID, msg.SenderID, c.IP(), time.Now()); !ok {
+			return RateLimited(c, wait)
+		}
+		if err := validateOutgoing(&msg); err != nil {
+			return err
+		}
+		if ok, resetsAt := consumeQuota(msg.TenantID, msg.SenderID, 1, time.Now()); !ok {
+			return errQuotaExceeded(resetsAt)
+		}
+
+		msg.TraceID = requestIDOf(c)
+
+		// บันทึกข้อความ แล้วเช็กว่าผู้รับออนไลน์หรือไม่
+		result, err := dispatchMessage(msg)
+		if err != nil && !result.Delivered {
+			return NewError(fiber.StatusInternalServerError, errCodeInternal, "Failed to store message")
+		}
+
+		status := "Message processed"
+		if result.Duplicate {
+			status = "Duplicate message"
+		}
+		return c.JSON(fiber.Map{
+			"status":        status,
+			"delivered":     result.Delivered,
+			"id":            result.Message.ID,
+			"client_msg_id": result.Message.ClientMsgID,
+			"created_at":    result.Message.CreatedAt,
+		})
+	})
+
+	return app
+}
+
+// ตรวจสอบข้อความที่ส่งผ่าน REST และแนบ preview ของ reply คืนค่า Error ถ้าไม่ผ่าน
+func validateOutgoing(msg *Message) error {
+	if verr := validateMessage(*msg); verr != nil {
+		return verr.apiError()
+	}
+	if msg.RoomID != 0 {
+		if err := checkRoomSender(*msg); err != nil {
+			if errors.Is(err, errNotRoomMember) {
+				return Forbidden("Not a room member")
+			}
+			return Internal("Error checking room membership", err)
+		}
+	}
+	if err := checkNotBlocked(*msg); err != nil {
+		if errors.Is(err, errBlocked) {
+			return errSenderBlocked()
+		}
+		return Internal("Error checking blocks", err)
+	}
+	clearForwarded(msg)
+	text, err := contentFilter.Filter(msg.Text)
+	if err != nil {
+		return InvalidRequest(err.Error())
+	}
+	msg.Text = text
+	if err := resolveReplyTo(msg); err != nil {
+		if errors.Is(err, errReplyNotFound) || errors.Is(err, errReplyCrossConversation) {
+			return InvalidRequest(err.Error())
+		}
+		return Internal("Error resolving reply_to", err)
+	}
+	if err := resolveAttachment(msg); err != nil {
+		if errors.Is(err, errAttachmentNotFound) || errors.Is(err, errAttachmentNotOwned) {
+			return InvalidRequest(err.Error())
+		}
+		return Internal("Error resolving attachment", err)
+	}
+	return nil
+}
+
+// สร้างคิวข้อความตามขนาดใน config (เรียกก่อนเปิด worker และรับ connection)
+func initQueues() {
+	broadcast = make(chan queuedMessage, config.BroadcastQueueSize)
+	priorityBroadcast = make(chan queuedMessage, config.PriorityQueueSize)
+}
+
+// WebSocket ที่ระบุผู้ใช้ใน path (/ws/chat/:id) ผ่านการยืนยันตัวตนจาก middleware แล้ว
+func handleWebSocket(c *websocket.Conn) {
+	tenant, _ := c.Locals(LocalsTenant).(string)
+	ServeClient(c, tenant, c.Params("userID"), c.Query("session"), nil)
+}
+
+// ลงทะเบียน connection ของ clientID แล้วอ่าน frame จนกว่าจะหลุด
+// hello = nil เมื่อเชื่อมต่อผ่าน /ws/chat/:id (ไม่มี handshake frame)
+// แอปที่ฝัง engine เรียกจาก WebSocket route ของตัวเองได้ หลังยืนยันตัวตนผู้ใช้เองแล้ว
+func ServeClient(c *websocket.Conn, tenant, clientID, sessionID string, hello *Hello) {
+	// ตรวจสอบจำนวน connection ก่อนลงทะเบียน
+	if code, reason, ok := acquireConnection(tenant, clientID); !ok {
+		slog.Info("connection rejected", "tenant", tenant, "user_id", clientID, "reason", reason)
+		closeWithReason(c, code, reason)
+		return
+	}
+	defer releaseConnection(tenant, clientID)
+
+	// จำกัดขนาด frame กัน client ส่งข้อความใหญ่มากจนต้องจอง memory มหาศาล
+	if config.MaxMessageBytes > 0 {
+		c.SetReadLimit(config.MaxMessageBytes)
+	}
+
+	cl := newClient(c, tenant, clientID, sessionID, c.Query("subscribe"))
+	cl.codec = negotiateCodec(c.Query("codec"), c.Subprotocol())
+	cl.protocolVersion = negotiateProtocolVersion(c.Subprotocol())
+	c.SetPongHandler(cl.handlePong)
+	// ✅ เก็บ WebSocket Conn ของผู้ใช้ และปิด session เดิมที่ถูกแทนที่
+	for _, old := range registerClient(cl) {
+		old.logger().Info("session replaced", "replaced_by", cl.connID)
+		old.closeWith(closeSessionReplaced, "session replaced")
+	}
+
+	// ✅ Log ตอน Connect
+	if hello != nil {
+		cl.logger().Info("connected", "protocol_version", cl.protocolVersion, "codec", cl.codec.Name(), "remote_ip", c.IP(), "client_version", hello.ClientVersion)
+		cl.send(Welcome{Type: frameTypeWelcome, UserID: clientID, SessionID: cl.sessionID, ConnID: cl.connID, ProtocolVersion: cl.protocolVersion})
+	} else {
+		cl.logger().Info("connected", "protocol_version", cl.protocolVersion, "codec", cl.codec.Name(), "remote_ip", c.IP())
+	}
+	auditID := auditConnect(cl, c.IP())
+	emitWebhook(tenant, webhookUserConnected, WebhookConnection{UserID: clientID, SessionID: cl.sessionID, ConnID: cl.connID})
+
+	// ส่งข้อความที่ค้างไว้ หรือทุกข้อความหลัง ?since= (เฉพาะ connection ที่รับข้อความแชท)
+	if cl.wants(frameTypeChat) {
+		replayOnConnect(cl, c.Query("since"))
+	}
+
+	var readErr error
+	malformed := 0  // จำนวน frame ที่ decode ไม่ได้ติดกัน
+	violations := 0 // จำนวนครั้งที่ส่งเกิน rate limit ใน connection นี้
+	remoteIP := c.IP()
+	defer func() {
+		// ถอนออกก่อน แล้วปิดการเขียน: ข้อความที่ worker กำลังส่งอยู่จะส่งไม่สำเร็จและค้างใน DB แทนที่จะหาย
+		unregisterClient(cl)
+		unsubscribePresence(cl)
+		cl.markClosed()
+		c.Close()
+		recordLastSeen(tenant, clientID, time.Now())
+		auditDisconnect(auditID, disconnectReason(cl, readErr))
+		emitWebhook(tenant, webhookUserDisconnected, WebhookConnection{UserID: clientID, SessionID: cl.sessionID, ConnID: cl.connID, Reason: disconnectReason(cl, readErr)})
+		// ✅ Log ตอน Disconnect
+		cl.logger().Info("disconnected", "reason", disconnectReason(cl, readErr))
+	}()
+
+	for {
+		_, msg, err := c.ReadMessage()
+		if err != nil {
+			// library ส่ง close 1009 (message too big) ให้ client แล้ว เหลือแค่ log และตัดการเชื่อมต่อ
+			readErr = err
+			switch {
+			case errors.Is(err, fws.ErrReadLimit):
+				websocketErrorsTotal.WithLabelValues(wsErrorReadLimit).Inc()
+				cl.logger().Warn("frame exceeds read limit", "limit", config.MaxMessageBytes)
+			case cl.closeReason() == "" && isAbnormalClose(err):
+				websocketErrorsTotal.WithLabelValues(wsErrorRead).Inc()
+			}
+			break
+		}
+		now := time.Now()
+		cl.touch(now)
+		if ok, wait := allowInbound(tenant, clientID, remoteIP, now); !ok {
+			violations++
+			if !reportRateLimited(cl, violations, wait) {
+				break
+			}
+			continue
+		}
+
+		// แยกประเภทข้อความก่อน (ข้อความแชทปกติไม่มี type) v3 ได้ payload ที่แกะจาก envelope แล้ว
+		frameType, payload, err := cl.decodeFrame(msg)
+		if err != nil {
+			malformed++
+			if !reportMalformedFrame(cl, malformed, err) {
+				break
+			}
+			continue
+		}
+		msg = payload
+		switch frameType {
+		case "react":
+			handleReactFrame(cl, msg)
+			continue
+		case "read":
+			handleReadFrame(cl, msg)
+			continue
+		case "ack":
+			handleReceiptAck(cl, msg)
+			continue
+		case "typing":
+			handleTypingFrame(cl, msg)
+			continue
+		case "ping_app":
+			handlePingApp(cl, msg)
+			continue
+		case "sync":
+			handleSyncFrame(cl, msg)
+			continue
+		case "presence_subscribe":
+			handlePresenceSubscribe(cl, msg)
+			continue
+		case "presence_unsubscribe":
+			unsubscribePresence(cl)
+			continue
+		case "hello":
+			cl.send(ErrorFrame{Type: frameTypeError, Code: errCodeInvalidRequest, Detail: "already authenticated"})
+			continue
+		}
+
+		var receivedMsg Message
+		if err := cl.codec.Unmarshal(msg, &receivedMsg); err != nil {
+			malformed++
+			if !reportMalformedFrame(cl, malformed, err) {
+				break
+			}
+			continue
+		}
+		malformed = 0
+		clearForwarded(&receivedMsg)
+		receivedMsg.TenantID = tenant
+		if config.RequireJWT || hello != nil {
+			// connection ผ่านการยืนยันตัวตนแล้ว ผู้ส่งคือเจ้าของ connection เสมอ
+			receivedMsg.SenderID = clientID
+		}
+		if verr := validateMessage(receivedMsg); verr != nil {
+			sendToUser(cl.tenant, clientID, frameTypeError, verr.frame())
+			continue
+		}
+		if receivedMsg.Text, err = contentFilter.Filter(receivedMsg.Text); err != nil {
+			sendToUser(cl.tenant, clientID, frameTypeError, ErrorFrame{Type: frameTypeError, Code: errCodeInvalidRequest, Detail: err.Error()})
+			continue
+		}
+		if receivedMsg.RoomID != 0 {
+			if err := checkRoomSender(receivedMsg); err != nil {
+				sendToUser(cl.tenant, clientID, frameTypeError, ErrorFrame{Type: frameTypeError, Code: errCodeForbidden, Detail: err.Error()})
+				continue
+			}
+		}
+		if err := checkNotBlocked(receivedMsg); err != nil {
+			code := errCodeBlocked
+			if !errors.Is(err, errBlocked) {
+				messageLogger(receivedMsg).Error("checking blocks", "err", err)
+				code, err = errCodeInternal, errors.New("could not send message")
+			}
+			sendToUser(cl.tenant, clientID, frameTypeError, ErrorFrame{Type: frameTypeError, Code: code, Detail: err.Error()})
+			continue
+		}
+		if err := resolveReplyTo(&receivedMsg); err != nil {
+			sendToUser(cl.tenant, clientID, frameTypeError, ErrorFrame{Type: frameTypeError, Code: errCodeInvalidRequest, Detail: err.Error()})
+			continue
+		}
+		if err := resolveAttachment(&receivedMsg); err != nil {
+			sendToUser(cl.tenant, clientID, frameTypeError, ErrorFrame{Type: frameTypeError, Code: errCodeInvalidRequest, Detail: err.Error()})
+			continue
+		}
+		if ok, resetsAt := consumeQuota(tenant, clientID, 1, time.Now()); !ok {
+			sendToUser(cl.tenant, clientID, frameTypeError, ErrorFrame{Type: frameTypeError, Code: errCodeQuotaExceeded, Detail: "daily message quota exceeded", ResetsAt: &resetsAt})
+			continue
+		}
+
+		// ✅ Log ตอนส่งข้อความจาก Client
+		receivedMsg.TraceID = newCorrelationID()
+		messageLogger(receivedMsg).Debug("message received", "conn_id", cl.connID)
+
+		queued := queuedMessage{Message: receivedMsg, origin: cl}
+
+		// เก็บลง outbox ก่อนเข้าคิว กันข้อความหายถ้า process crash
+		if queued.outboxID, err = addToOutbox(receivedMsg); err != nil {
+			messageLogger(receivedMsg).Error("saving message to outbox", "err", err)
+		}
+		if !enqueueMessage(queued) {
+			completeOutbox(queued.outboxID, outboxDropped)
+			sendToUser(cl.tenant, clientID, frameTypeError, ErrorFrame{Type: frameTypeError, Code: errCodeOverloaded, Detail: "server is busy, message was not accepted"})
+		}
+	}
+}
+
+// ตอบ error ให้ client ที่ส่ง frame ที่ decode ไม่ได้ คืนค่า false ถ้าติดกันเกิน MaxMalformedFrames
+// (ปิด connection แล้ว ผู้เรียกต้องออกจาก read loop)
+func reportMalformedFrame(cl *client, streak int, err error) bool {
+	malformedFramesTotal.Inc()
+	cl.logger().Warn("malformed frame", "codec", cl.codec.Name(), "streak", streak, "err", err)
+	cl.send(ErrorFrame{Type: frameTypeError, Code: errCodeMalformed, Detail: err.Error()})
+
+	if config.MaxMalformedFrames > 0 && streak >= config.MaxMalformedFrames {
+		cl.closeWith(closeMalformedFrames, "too many malformed frames")
+		return false
+	}
+	return true
+}
+
+// ส่งข้อความที่ worker หยิบมาจากคิว แล้วตอบ ack ให้ผู้ส่งทาง WebSocket
+func processMessage(msg queuedMessage) {
+	processingMessages.Add(1)
+	defer processingMessages.Add(-1)
+	if msg.gated {
+		defer senderGate.release(msg.Message)
+	}
+
+	result, err := dispatchMessage(msg.Message)
+	sendAck(msg, result, err)
+	switch {
+	case result.Delivered:
+		completeOutbox(msg.outboxID, outboxDelivered)
+	case err == nil:
+		completeOutbox(msg.outboxID, outboxPersisted)
+	}
+	// บันทึกไม่ได้และส่งไม่ถึง: คงสถานะ pending ไว้ให้ส่งใหม่ตอนเปิด server
+}
+
+// ผลการบันทึกและส่งข้อความหนึ่งข้อความ
+type dispatchResult = hub.Result
+
+// บันทึกและส่งข้อความแชท (ดู deliveryHooks)
+var dispatcher = hub.NewDispatcher(deliveryHooks{})
+
+// บันทึกข้อความลง DB ก่อน (เพื่อให้มี ID สำหรับ reaction/read receipt) แล้วส่งให้ผู้รับที่ออนไลน์
+// ข้อความที่ส่งถึงแล้วจะถูก mark ว่า delivered ส่วนที่เหลือจะถูกส่งตอนผู้รับเชื่อมต่อ
+func dispatchMessage(msg Message) (dispatchResult, error) {
+	msg.TenantID = tenantOrDefault(msg.TenantID)
+	msg.CreatedAt = time.Now().UTC()
+	if msg.TraceID == "" {
+		msg.TraceID = newCorrelationID()
+	}
+	result, err := dispatcher.Dispatch(msg)
+	if msg.RoomID != 0 && err == nil {
+		messageLogger(msg).Debug("room message dispatched", "delivered", result.Delivered)
+	}
+	return result, err
+}
+
+// สิ่งที่ dispatcher ใช้ในการบันทึก ส่ง และแจ้งผลของข้อความ
+type deliveryHooks struct{}
+
+func (deliveryHooks) RoomRecipients(msg Message) ([]string, error) { return roomRecipients(msg) }
+
+func (deliveryHooks) Save(msgs []Message) ([]storedMessage, error) { return saveMessagesToDB(msgs) }
+
+func (deliveryHooks) MarkDelivered(ids []int64, receipts bool) {
+	if receipts {
+		markDelivered(ids)
+		return
+	}
+	setDelivered(ids) // ผู้ส่งรู้สถานะจาก ack แล้ว
+}
+
+func (deliveryHooks) DeliverLocal(msg Message) bool { return deliverOnline(msg) }
+
+func (deliveryHooks) DeliverRemote(msg Message, deliveredLocally bool) bool {
+	return deliverRemote(msg, deliveredLocally)
+}
+
+func (deliveryHooks) Mirror(msg Message) { mirrorMessage(msg) }
+
+func (deliveryHooks) Dispatched(msg Message, outcome string, err error) {
+	messagesDispatchedTotal.WithLabelValues(outcome).Inc()
+	switch outcome {
+	case outcomeDelivered:
+		publishToFeed(msg, feedStatusDelivered)
+		emitWebhook(msg.TenantID, webhookMessageSent, msg)
+	case outcomeRemote:
+		emitWebhook(msg.TenantID, webhookMessageSent, msg)
+	case outcomeStored:
+		// ผู้รับออฟไลน์ (ไม่มีการเชื่อมต่อ WebSocket) หรือส่งไม่สำเร็จ
+		messageLogger(msg).Debug("recipient offline, message stored")
+		publishToFeed(msg, feedStatusStored)
+		notifyOffline(msg)
+		forwardToBot(msg)
+		emitWebhook(msg.TenantID, webhookMessageStoredOffline, msg)
+	case outcomeFailed:
+		messageLogger(msg).Error("saving message", "err", err)
+	}
+}
+
+// ฟังก์ชันบันทึกข้อความลงฐานข้อมูล คืนค่า ID ของแถว (0 ถ้าบันทึกไม่สำเร็จ)
+// ถ้า client_msg_id ซ้ำกับที่ผู้ส่งเคยส่งมาแล้ว จะไม่บันทึกซ้ำและคืนค่า ID ของแถวเดิม
+func saveMessageToDB(msg Message) int64 {
+	stored, err := saveMessagesToDB([]Message{msg})
+	if err != nil {
+		messageLogger(msg).Error("saving message", "err", err)
+		return 0
+	}
+	return stored[0].ID
+}
+
+// บันทึกหลายข้อความใน transaction เดียว คืนค่าผลตามลำดับของข้อความ
+// ข้อความที่ไม่ระบุ tenant ถูกบันทึกเป็นของ DefaultTenant
+func saveMessagesToDB(msgs []Message) ([]storedMessage, error) {
+	for i := range msgs {
+		msgs[i].TenantID = tenantOrDefault(msgs[i].TenantID)
+	}
+	stored, err := writeMessages(msgs)
+	if err != nil {
+		return nil, err
+	}
+	for i, s := range stored {
+		if s.Duplicate {
+			messageLogger(msgs[i]).Info("duplicate client_msg_id", "client_msg_id", msgs[i].ClientMsgID, "existing_id", s.ID)
+		}
+	}
+	// จำกัดจำนวนข้อความต่อบทสนทนา (ถ้าเปิดไว้) ตัดใน background หลังบันทึกเสร็จ
+	scheduleTrim(msgs)
+	return stored, nil
+}
+
+// ส่งข้อความที่ค้างไว้ให้ผู้ใช้ที่พึ่งเชื่อมต่อ
+func sendPendingMessages(cl *client) {
+	pending, err := messageStore.PendingFor(cl.tenant, cl.userID)
+	if err != nil {
+		slog.Error("fetching messages", "err", err)
+		return
+	}
+
+	var msgUpdate []int64
+	for _, msg := range pending {
+		// ส่งข้อความให้ WebSocket
+		if err := cl.send(cl.chatFrame(msg)); err == nil {
+			msgUpdate = append(msgUpdate, msg.ID)
+		}
+	}
+
+	markDelivered(msgUpdate)
+}
+
+// อัปเดตสถานะข้อความเป็น "ส่งถึงแล้ว" (ยังไม่นับว่าอ่าน จนกว่า client จะส่ง read receipt)
+func markDelivered(ids []int64) {
+	// แจ้งผู้ส่งว่าข้อความถึงผู้รับแล้ว แยกตาม tenant และผู้รับ (ข้อความห้องไม่มี delivery receipt)
+	type recipient struct{ tenant, userID string }
+	bySender := make(map[recipient]map[string][]int64)
+	for _, msg := range setDelivered(ids) {
+		if msg.RoomID != 0 {
+			continue
+		}
+		r := recipient{msg.TenantID, msg.ReceiverID}
+		if bySender[r] == nil {
+			bySender[r] = make(map[string][]int64)
+		}
+		bySender[r][msg.SenderID] = append(bySender[r][msg.SenderID], msg.ID)
+	}
+	for r, senders := range bySender {
+		sendDeliveryReceipts(r.tenant, r.userID, senders)
+	}
+}
+
+// อัปเดตสถานะเป็น delivered โดยไม่แจ้งผู้ส่ง (ใช้เมื่อผู้ส่งได้ ack "delivered" อยู่แล้ว)
+func setDelivered(ids []int64) []Message {
+	if len(ids) == 0 {
+		return nil
+	}
+	var delivered []Message
+	err := retryOnBusy("marking delivered", func() error {
+		var err error
+		delivered, err = messageStore.MarkDelivered(ids)
+		return err
+	})
+	if err != nil {
+		slog.Error("updating message status", "err", err)
+	}
+	for _, msg := range delivered {
+		streamEvent(ChatEvent{Type: eventDelivered, TenantID: msg.TenantID, UserID: msg.ReceiverID, PeerID: msg.SenderID, MessageID: msg.ID})
+	}
+	return delivered
+}
+
+// คืนค่าผู้ใช้ที่ออนไลน์
+func getOnlineUsers(tenant string) []string {
+	return registry.OnlineUsers(tenant)
+}
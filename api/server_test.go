@@ -0,0 +1,594 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	fws "github.com/fasthttp/websocket"
+)
+
+// ที่อยู่ของ server ที่เปิดไว้สำหรับ test
+var testAddr string
+
+// ใช้สร้าง user ID ที่ไม่ซ้ำกันในแต่ละ test
+var testUserSeq atomic.Int64
+
+func TestMain(m *testing.M) {
+	config.AllowedOrigins = []string{"http://allowed.example"}
+	config.EnableCompression = true
+	// test จำลอง reverse proxy ที่ตั้ง X-Tenant-ID ให้ (TestTenantHeaderRequiresTrustedProxy ตรวจกรณีปิด)
+	config.TrustTenantHeader = true
+	if err := initDB("file:chat_test?mode=memory&cache=shared"); err != nil {
+		fmt.Println("database:", err)
+		os.Exit(1)
+	}
+	initQueues()
+	attachmentDir, err := os.MkdirTemp("", "chat-attachments-")
+	if err != nil {
+		fmt.Println("attachment dir:", err)
+		os.Exit(1)
+	}
+	config.AttachmentDir = attachmentDir
+	if err := initAttachments(); err != nil {
+		fmt.Println("attachments:", err)
+		os.Exit(1)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		fmt.Println("listen:", err)
+		os.Exit(1)
+	}
+	testAddr = ln.Addr().String()
+
+	app := newApp()
+	go app.Listener(ln)
+	startWorkers(4)
+	startAuditWriter()
+	startBotDelivery()
+	startConversationTrimmer()
+
+	code := m.Run()
+	// fasthttp รอ connection keep-alive ที่ค้างอยู่ก่อนปิด ปิดฝั่ง client ก่อนไม่ให้รอจน idle timeout (90 วินาที)
+	http.DefaultClient.CloseIdleConnections()
+	app.Shutdown()
+	os.RemoveAll(attachmentDir)
+	os.Exit(code)
+}
+
+// สร้าง user ID ใหม่สำหรับ test
+func newTestUser(prefix string) string {
+	return fmt.Sprintf("%s-%d", prefix, testUserSeq.Add(1))
+}
+
+// เชื่อมต่อ WebSocket ในนามผู้ใช้ และรอให้ server ลงทะเบียน connection
+func dialWS(t *testing.T, userID string) *fws.Conn {
+	t.Helper()
+	conn, _, err := fws.DefaultDialer.Dial("ws://"+testAddr+"/ws/chat/"+userID, nil)
+	if err != nil {
+		t.Fatalf("dial %s: %v", userID, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	waitFor(t, func() bool {
+		_, ok := getClient(DefaultTenant, userID)
+		return ok
+	})
+	return conn
+}
+
+// อ่าน frame ถัดไปเป็น JSON
+func readJSON(t *testing.T, conn *fws.Conn, v any) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("unmarshal %s: %v", data, err)
+	}
+}
+
+// รอจนกว่าเงื่อนไขจะเป็นจริง (สูงสุด 2 วินาที)
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// นับข้อความใน DB ระหว่างผู้ส่ง/ผู้รับ
+func countStored(t *testing.T, senderID, receiverID string, onlyUnread bool) int {
+	t.Helper()
+	query := "SELECT COUNT(*) FROM messages WHERE sender_id = ? AND receiver_id = ?"
+	if onlyUnread {
+		query += " AND is_read = FALSE"
+	}
+	var n int
+	// shared-cache SQLite อาจคืน "table is locked" ระหว่างที่ worker กำลังเขียน
+	err := retryOnBusy("counting messages", func() error {
+		return db.QueryRow(query, senderID, receiverID).Scan(&n)
+	})
+	if err != nil {
+		t.Fatalf("count messages: %v", err)
+	}
+	return n
+}
+
+func TestDeliverToOnlineUser(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	aliceConn := dialWS(t, alice)
+	bobConn := dialWS(t, bob)
+
+	sent := Message{SenderID: alice, ReceiverID: bob, Text: "hello"}
+	if err := aliceConn.WriteJSON(sent); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	var got Message
+	readJSON(t, bobConn, &got)
+	if got.SenderID != alice || got.Text != "hello" {
+		t.Fatalf("unexpected message: %+v", got)
+	}
+	// ข้อความที่ส่งถึงแล้วยังถูกเก็บไว้ (สำหรับ inbox/history) และ mark ว่า delivered
+	if got.ID == 0 {
+		t.Fatal("delivered message should carry its server id")
+	}
+	waitFor(t, func() bool {
+		var delivered bool
+		db.QueryRow("SELECT is_delivered FROM messages WHERE id = ?", got.ID).Scan(&delivered)
+		return delivered
+	})
+}
+
+func TestOfflineMessageIsPersistedAndReplayed(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	aliceConn := dialWS(t, alice)
+
+	metadata := json.RawMessage(`{"location":{"lat":13.75,"lng":100.5}}`)
+	if err := aliceConn.WriteJSON(Message{SenderID: alice, ReceiverID: bob, Text: "are you there?", Metadata: metadata}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	waitFor(t, func() bool { return countStored(t, alice, bob, true) == 1 })
+
+	// เชื่อมต่อภายหลังต้องได้รับข้อความที่ค้างไว้
+	bobConn := dialWS(t, bob)
+	var got Message
+	readJSON(t, bobConn, &got)
+	if got.Text != "are you there?" || got.ID == 0 || string(got.Metadata) != string(metadata) {
+		t.Fatalf("unexpected replayed message: %+v", got)
+	}
+
+	// replay นับว่าส่งถึงแล้ว แต่ยังไม่ได้อ่าน
+	waitFor(t, func() bool {
+		var delivered bool
+		db.QueryRow("SELECT is_delivered FROM messages WHERE id = ?", got.ID).Scan(&delivered)
+		return delivered
+	})
+	if n := countStored(t, alice, bob, true); n != 1 {
+		t.Fatalf("replay must not mark the message read, got %d unread", n)
+	}
+	var delivery DeliveryReceipt
+	readJSON(t, aliceConn, &delivery)
+	if delivery.Type != frameTypeDeliveryReceipt || delivery.State != messageStateDelivered || delivery.RecipientID != bob || len(delivery.MessageIDs) != 1 || delivery.MessageIDs[0] != got.ID {
+		t.Fatalf("unexpected delivery receipt: %+v", delivery)
+	}
+
+	// read receipt จากผู้รับ ต้องตั้ง is_read และแจ้งผู้ส่ง
+	if err := bobConn.WriteJSON(map[string]any{"type": "read", "message_ids": []int64{got.ID}}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var receipt ReadReceipt
+	readJSON(t, aliceConn, &receipt)
+	if receipt.Type != frameTypeReadReceipt || receipt.ReaderID != bob || len(receipt.MessageIDs) != 1 || receipt.MessageIDs[0] != got.ID {
+		t.Fatalf("unexpected receipt: %+v", receipt)
+	}
+	if n := countStored(t, alice, bob, true); n != 0 {
+		t.Fatalf("expected message to be read, got %d unread", n)
+	}
+}
+
+func TestReceiptAckNotifiesSender(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	aliceConn := dialWS(t, alice)
+	bobConn := dialWS(t, bob)
+
+	if err := aliceConn.WriteJSON(Message{SenderID: alice, ReceiverID: bob, Text: "ping"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var got Message
+	readJSON(t, bobConn, &got)
+
+	bobConn.WriteJSON(map[string]any{"type": "ack", "message_id": got.ID, "status": "delivered"})
+	var delivered DeliveryReceipt
+	readJSON(t, aliceConn, &delivered)
+	if delivered.Type != frameTypeDeliveryReceipt || delivered.RecipientID != bob || len(delivered.MessageIDs) != 1 || delivered.MessageIDs[0] != got.ID {
+		t.Fatalf("unexpected delivery receipt: %+v", delivered)
+	}
+	if n := countStored(t, alice, bob, true); n != 1 {
+		t.Fatalf("delivered ack must not mark the message read, got %d unread", n)
+	}
+
+	// ไม่ระบุ status = read
+	bobConn.WriteJSON(map[string]any{"type": "ack", "message_id": got.ID})
+	var read ReadReceipt
+	readJSON(t, aliceConn, &read)
+	if read.Type != frameTypeReadReceipt || read.ReaderID != bob || read.MessageIDs[0] != got.ID {
+		t.Fatalf("unexpected read receipt: %+v", read)
+	}
+	if n := countStored(t, alice, bob, true); n != 0 {
+		t.Fatalf("expected message to be read, got %d unread", n)
+	}
+
+	// status ที่ไม่รู้จักได้ error กลับ
+	aliceConn.WriteJSON(map[string]any{"type": "ack", "message_id": got.ID, "status": "bogus"})
+	var errFrame ErrorFrame
+	readJSON(t, aliceConn, &errFrame)
+	if errFrame.Code != errCodeInvalidRequest {
+		t.Fatalf("expected invalid_request for unknown status, got %+v", errFrame)
+	}
+}
+
+func TestDuplicateClientMsgIDIsStoredOnce(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+
+	msg := Message{SenderID: alice, ReceiverID: bob, Text: "retry me", ClientMsgID: "c-1"}
+	first := saveMessageToDB(msg)
+	second := saveMessageToDB(msg)
+	if first == 0 || first != second {
+		t.Fatalf("expected duplicate to return the same id, got %d and %d", first, second)
+	}
+	if n := countStored(t, alice, bob, false); n != 1 {
+		t.Fatalf("expected 1 stored message, got %d", n)
+	}
+}
+
+func TestReconnectSameSessionReplacesOldSocket(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	url := "ws://" + testAddr + "/ws/chat/" + bob + "?session=tab-1"
+
+	oldConn, _, err := fws.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer oldConn.Close()
+	waitFor(t, func() bool { _, ok := getClient(DefaultTenant, bob); return ok })
+
+	newConn, _, err := fws.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer newConn.Close()
+
+	// socket เดิมต้องถูกปิด
+	oldConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := oldConn.ReadMessage(); !fws.IsCloseError(err, closeSessionReplaced) {
+		t.Fatalf("expected old session to be closed, got %v", err)
+	}
+
+	// ข้อความต้องไปที่ socket ใหม่ แม้ socket เดิมจะ disconnect ทีหลัง
+	aliceConn := dialWS(t, alice)
+	if err := aliceConn.WriteJSON(Message{SenderID: alice, ReceiverID: bob, Text: "after reconnect"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var got Message
+	readJSON(t, newConn, &got)
+	if got.Text != "after reconnect" {
+		t.Fatalf("unexpected message: %+v", got)
+	}
+}
+
+func TestCompressedLargeMessageRoundTrip(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	dialer := fws.Dialer{EnableCompression: true}
+
+	aliceConn, _, err := dialer.Dial("ws://"+testAddr+"/ws/chat/"+alice, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer aliceConn.Close()
+	bobConn, resp, err := dialer.Dial("ws://"+testAddr+"/ws/chat/"+bob, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer bobConn.Close()
+	if ext := resp.Header.Get("Sec-WebSocket-Extensions"); ext == "" {
+		t.Fatal("server did not negotiate permessage-deflate")
+	}
+	waitFor(t, func() bool { _, ok := getClient(DefaultTenant, bob); return ok })
+
+	prev := config.MaxTextLength
+	config.MaxTextLength = 0 // ทดสอบ frame ใหญ่ที่บีบอัด ไม่ใช่ขีดจำกัดของ text
+	defer func() { config.MaxTextLength = prev }()
+
+	large := strings.Repeat("lorem ipsum dolor sit amet ", 4000)
+	aliceConn.EnableWriteCompression(true)
+	if err := aliceConn.WriteJSON(Message{SenderID: alice, ReceiverID: bob, Text: large}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	var got Message
+	readJSON(t, bobConn, &got)
+	if got.Text != large {
+		t.Fatalf("large message corrupted: got %d bytes, want %d", len(got.Text), len(large))
+	}
+}
+
+func TestOversizedFrameClosesConnection(t *testing.T) {
+	alice := newTestUser("alice")
+	conn := dialWS(t, alice)
+
+	big := strings.Repeat("x", int(config.MaxMessageBytes)+1)
+	if err := conn.WriteJSON(Message{SenderID: alice, ReceiverID: alice, Text: big}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := conn.ReadMessage(); !fws.IsCloseError(err, fws.CloseMessageTooBig) {
+		t.Fatalf("expected close 1009, got %v", err)
+	}
+	waitFor(t, func() bool { _, ok := getClient(DefaultTenant, alice); return !ok })
+}
+
+func TestMalformedFramesGetErrorThenDisconnect(t *testing.T) {
+	alice := newTestUser("alice")
+	conn := dialWS(t, alice)
+
+	for i := 0; i < config.MaxMalformedFrames; i++ {
+		if err := conn.WriteMessage(fws.TextMessage, []byte("{not json")); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		var frame ErrorFrame
+		readJSON(t, conn, &frame)
+		if frame.Type != frameTypeError || frame.Code != errCodeMalformed || frame.Detail == "" {
+			t.Fatalf("unexpected frame: %+v", frame)
+		}
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := conn.ReadMessage(); !fws.IsCloseError(err, closeMalformedFrames) {
+		t.Fatalf("expected close %d, got %v", closeMalformedFrames, err)
+	}
+	waitFor(t, func() bool { _, ok := getClient(DefaultTenant, alice); return !ok })
+}
+
+func TestValidFrameResetsMalformedStreak(t *testing.T) {
+	alice := newTestUser("alice")
+	conn := dialWS(t, alice)
+
+	// ส่ง frame เสียเกือบครบ แล้วคั่นด้วยข้อความปกติ connection ต้องไม่ถูกตัด
+	for round := 0; round < 2; round++ {
+		for i := 0; i < config.MaxMalformedFrames-1; i++ {
+			conn.WriteMessage(fws.TextMessage, []byte("garbage"))
+			var frame ErrorFrame
+			readJSON(t, conn, &frame)
+		}
+		if err := conn.WriteJSON(Message{SenderID: alice, ReceiverID: alice, Text: "still here"}); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		var got Message
+		readJSON(t, conn, &got)
+		if got.Text != "still here" {
+			t.Fatalf("unexpected message: %+v", got)
+		}
+	}
+}
+
+func TestMessageFansOutToEveryDevice(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	base := "ws://" + testAddr + "/ws/chat/" + bob
+	phone, _, err := fws.DefaultDialer.Dial(base+"?session=phone", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer phone.Close()
+	laptop, _, err := fws.DefaultDialer.Dial(base+"?session=laptop", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer laptop.Close()
+	waitFor(t, func() bool { return len(getSessions(DefaultTenant, bob)) == 2 })
+
+	aliceConn := dialWS(t, alice)
+	aliceConn.WriteJSON(Message{SenderID: alice, ReceiverID: bob, Text: "both"})
+	var onPhone, onLaptop Message
+	readJSON(t, phone, &onPhone)
+	readJSON(t, laptop, &onLaptop)
+	if onPhone.ID == 0 || onPhone.ID != onLaptop.ID {
+		t.Fatalf("unexpected messages: %+v / %+v", onPhone, onLaptop)
+	}
+
+	// ปิดอุปกรณ์หนึ่ง อีกเครื่องยังได้รับข้อความ
+	phone.Close()
+	waitFor(t, func() bool { return len(getSessions(DefaultTenant, bob)) == 1 })
+	aliceConn.WriteJSON(Message{SenderID: alice, ReceiverID: bob, Text: "laptop only"})
+	readJSON(t, laptop, &onLaptop)
+	if onLaptop.Text != "laptop only" {
+		t.Fatalf("unexpected message: %+v", onLaptop)
+	}
+}
+
+func TestSelfMessageReachesEverySessionOnce(t *testing.T) {
+	alice := newTestUser("alice")
+	base := "ws://" + testAddr + "/ws/chat/" + alice
+	phone, _, err := fws.DefaultDialer.Dial(base+"?session=phone", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer phone.Close()
+	laptop, _, err := fws.DefaultDialer.Dial(base+"?session=laptop", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer laptop.Close()
+	waitFor(t, func() bool { return len(getSessions(DefaultTenant, alice)) == 2 })
+
+	if err := phone.WriteJSON(Message{SenderID: alice, ReceiverID: alice, Text: "note to self"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var onPhone, onLaptop Message
+	readJSON(t, phone, &onPhone)
+	readJSON(t, laptop, &onLaptop)
+	if onPhone.ID == 0 || onPhone.ID != onLaptop.ID || onPhone.Text != "note to self" {
+		t.Fatalf("unexpected self messages: %+v / %+v", onPhone, onLaptop)
+	}
+	if n := countStored(t, alice, alice, false); n != 1 {
+		t.Fatalf("expected 1 stored self message, got %d", n)
+	}
+	if n := countStored(t, alice, alice, true); n != 0 {
+		t.Fatalf("self message must not count as unread, got %d", n)
+	}
+
+	// read frame ของข้อความตัวเองต้องไม่มี receipt เด้งกลับมา: frame ถัดไปต้องเป็นข้อความใหม่
+	if err := phone.WriteJSON(map[string]any{"type": "read", "message_ids": []int64{onPhone.ID}}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := laptop.WriteJSON(Message{SenderID: alice, ReceiverID: alice, Text: "second note"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var next Message
+	readJSON(t, phone, &next)
+	if next.Text != "second note" {
+		t.Fatalf("expected the next self message, got %+v", next)
+	}
+}
+
+func TestDisconnectDuringBurstLosesNoMessages(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	aliceConn := dialWS(t, alice)
+	bobConn := dialWS(t, bob)
+
+	const total = 200
+	go func() {
+		for i := 0; i < total; i++ {
+			aliceConn.WriteJSON(Message{SenderID: alice, ReceiverID: bob, Text: fmt.Sprintf("burst %d", i), ClientMsgID: fmt.Sprintf("b-%d", i)})
+		}
+	}()
+
+	received := make(map[string]bool)
+	// อ่านไปส่วนหนึ่งแล้วปิด connection กลางคัน (อ่านต่อจนได้ close frame ตอบกลับ)
+	for len(received) < total/4 {
+		var got Message
+		readJSON(t, bobConn, &got)
+		received[got.Text] = true
+	}
+	bobConn.WriteControl(fws.CloseMessage, fws.FormatCloseMessage(fws.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	for {
+		bobConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, data, err := bobConn.ReadMessage()
+		if err != nil {
+			break
+		}
+		var got Message
+		json.Unmarshal(data, &got)
+		received[got.Text] = true
+	}
+	waitFor(t, func() bool { _, ok := getClient(DefaultTenant, bob); return !ok })
+
+	// เชื่อมต่อใหม่แล้วต้องได้ข้อความที่เหลือครบ
+	waitFor(t, func() bool { return countStored(t, alice, bob, false) == total })
+	bobConn = dialWS(t, bob)
+	for len(received) < total {
+		var got Message
+		readJSON(t, bobConn, &got)
+		received[got.Text] = true
+	}
+}
+
+func TestPingAppEchoesTimestamps(t *testing.T) {
+	conn := dialWS(t, newTestUser("alice"))
+
+	if err := conn.WriteJSON(map[string]any{"type": "ping_app", "client_ts": 1234}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var pong PongApp
+	readJSON(t, conn, &pong)
+	if pong.Type != frameTypePongApp || pong.ClientTS != 1234 || pong.ServerTS == 0 {
+		t.Fatalf("unexpected pong: %+v", pong)
+	}
+
+	// ping ถี่เกินไปต้องได้ error แทน pong
+	conn.WriteJSON(map[string]any{"type": "ping_app", "client_ts": 1235})
+	var limited ErrorFrame
+	readJSON(t, conn, &limited)
+	if limited.Code != errCodeRateLimited {
+		t.Fatalf("expected rate_limited, got %+v", limited)
+	}
+}
+
+func TestWebSocketSendIsAcknowledged(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	aliceConn := dialWS(t, alice)
+
+	// ผู้รับออฟไลน์ ยังต้องได้ ack
+	if err := aliceConn.WriteJSON(Message{SenderID: alice, ReceiverID: bob, Text: "hi", ClientMsgID: "c-1"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var ack Ack
+	readJSON(t, aliceConn, &ack)
+	if ack.Type != frameTypeAck || ack.ClientMsgID != "c-1" || ack.Status != ackStatusStored || ack.ServerID == 0 {
+		t.Fatalf("unexpected ack: %+v", ack)
+	}
+	firstID := ack.ServerID
+
+	// ส่งซ้ำด้วย client_msg_id เดิม ได้ ID เดิม
+	aliceConn.WriteJSON(Message{SenderID: alice, ReceiverID: bob, Text: "hi", ClientMsgID: "c-1"})
+	readJSON(t, aliceConn, &ack)
+	if ack.Status != ackStatusDuplicate || ack.ServerID != firstID {
+		t.Fatalf("unexpected ack for duplicate: %+v", ack)
+	}
+
+	bobConn := dialWS(t, bob)
+	var replayed Message
+	readJSON(t, bobConn, &replayed)
+	var delivery DeliveryReceipt
+	readJSON(t, aliceConn, &delivery)
+	if delivery.Type != frameTypeDeliveryReceipt || delivery.MessageIDs[0] != firstID {
+		t.Fatalf("expected delivery receipt for replayed message, got %+v", delivery)
+	}
+
+	aliceConn.WriteJSON(Message{SenderID: alice, ReceiverID: bob, Text: "online now", ClientMsgID: "c-2"})
+	readJSON(t, aliceConn, &ack)
+	if ack.ClientMsgID != "c-2" || ack.Status != ackStatusDelivered {
+		t.Fatalf("unexpected ack: %+v", ack)
+	}
+}
+
+func TestRetriedMessageAckEchoesOriginal(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	aliceConn := dialWS(t, alice)
+
+	clientMsgID := "6f1c2d4e-9a7b-4c3d-8e2f-1a2b3c4d5e6f"
+	var first, retry Ack
+	aliceConn.WriteJSON(Message{SenderID: alice, ReceiverID: bob, Text: "once", ClientMsgID: clientMsgID})
+	readJSON(t, aliceConn, &first)
+	time.Sleep(5 * time.Millisecond)
+	aliceConn.WriteJSON(Message{SenderID: alice, ReceiverID: bob, Text: "once", ClientMsgID: clientMsgID})
+	readJSON(t, aliceConn, &retry)
+
+	if first.CreatedAt == nil || retry.CreatedAt == nil || !retry.CreatedAt.Equal(*first.CreatedAt) || retry.ServerID != first.ServerID {
+		t.Fatalf("retry should echo the original message, got %+v then %+v", first, retry)
+	}
+	if n := countStored(t, alice, bob, false); n != 1 {
+		t.Fatalf("expected 1 stored message, got %d", n)
+	}
+
+	aliceConn.WriteJSON(Message{SenderID: alice, ReceiverID: bob, Text: "too long", ClientMsgID: strings.Repeat("x", maxClientMsgIDLength+1)})
+	var rejected ErrorFrame
+	readJSON(t, aliceConn, &rejected)
+	if rejected.Code != errCodeInvalidRequest {
+		t.Fatalf("expected invalid_request for oversized client_msg_id, got %+v", rejected)
+	}
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	// ตั้งเมื่อเริ่มปิด server: ไม่รับ request/connection ใหม่อีก
+	shuttingDown atomic.Bool
+	// จำนวนข้อความที่ worker กำลังประมวลผลอยู่ (หยิบออกจากคิวแล้วแต่ยังบันทึก/ส่งไม่เสร็จ)
+	processingMessages atomic.Int64
+)
+
+// ความถี่ที่ตรวจว่าคิวและ connection หมดแล้วระหว่างปิด server
+const drainPollInterval = 10 * time.Millisecond
+
+// middleware ตอบ 503 ระหว่างปิด server (load balancer จะย้าย client ไป instance อื่น)
+func rejectWhileDraining(c *fiber.Ctx) error {
+	if shuttingDown.Load() {
+		c.Set(fiber.HeaderConnection, "close")
+		return NewError(fiber.StatusServiceUnavailable, errCodeUnavailable, "Server is shutting down")
+	}
+	return c.Next()
+}
+
+// เปิด app ที่ addr แล้วรอ SIGINT/SIGTERM ก่อนปิด server ตามลำดับ คืนค่าเมื่อปิดเสร็จ (หรือ Listen ล้มเหลว)
+func Run(app *fiber.App, addr string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ln, err := listen(addr)
+	if err != nil {
+		return err
+	}
+	listenErr := make(chan error, 1)
+	go func() { listenErr <- app.Listener(ln) }()
+
+	select {
+	case err := <-listenErr:
+		return err
+	case <-ctx.Done():
+	}
+	stop() // สัญญาณครั้งที่สองระหว่างปิด = ปิดทันทีตามปกติของ Go
+	slog.Info("shutting down", "timeout", config.ShutdownTimeout)
+	shutdown(app, config.ShutdownTimeout)
+	return nil
+}
+
+// ปิด server แบบไม่ทิ้งข้อความ:
+//  1. หยุดรับ request/connection ใหม่
+//  2. ส่ง close frame 1001 ให้ทุก client แล้วรอ handler จบ (ข้อความที่อ่านมาแล้วยังอยู่ในคิว)
+//  3. ปิด listener (HTTP และ gRPC)
+//  4. รอ worker บันทึกข้อความที่ค้างในคิวลง DB
+//  5. ออกจาก cluster และปิด DB
+//
+// เกิน timeout จะข้ามไปขั้นถัดไป ข้อความที่ยังค้างอยู่ใน outbox จะถูกส่งใหม่ตอนเปิด server
+func shutdown(app *fiber.App, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	shuttingDown.Store(true)
+
+	closed := closeAllClients(websocket.CloseGoingAway, "server shutting down")
+	if !waitUntil(deadline, func() bool { return activeConnections.Load() == 0 }) {
+		slog.Warn("connections still open after shutdown timeout", "count", activeConnections.Load())
+	}
+	slog.Info("closed WebSocket connections", "count", closed)
+
+	if err := app.ShutdownWithTimeout(time.Until(deadline)); err != nil {
+		slog.Error("shutting down HTTP server", "err", err)
+	}
+	acmeCtx, cancel := context.WithDeadline(context.Background(), deadline)
+	stopACMEHTTPServer(acmeCtx)
+	cancel()
+	stopGRPCServer(deadline)
+
+	if !waitUntil(deadline, queuesDrained) {
+		slog.Warn("messages still queued after shutdown timeout", "count", len(broadcast)+len(priorityBroadcast)+laneBacklog().Length+int(processingMessages.Load()))
+	}
+	slog.Info("message queues drained")
+	stopMessageWriter()
+
+	stopCluster()
+	if err := db.Close(); err != nil {
+		slog.Error("closing database", "err", err)
+	}
+}
+
+// ส่ง close frame ให้ทุก session ของทุก tenant คืนจำนวน connection ที่ปิด
+func closeAllClients(code int, text string) int {
+	sessions := allSessions()
+	for _, cl := range sessions {
+		cl.closeWith(code, text)
+	}
+	return len(sessions)
+}
+
+// ไม่มีข้อความค้างในคิว และไม่มี worker ที่ยังประมวลผลไม่เสร็จ (รวมถึง audit ที่ยังไม่ได้เขียน)
+func queuesDrained() bool {
+	return len(broadcast) == 0 && len(priorityBroadcast) == 0 && laneBacklog().Length == 0 && processingMessages.Load() == 0 && len(auditQueue) == 0
+}
+
+// รอจน cond เป็นจริงหรือถึง deadline คืนค่า false ถ้าหมดเวลา
+func waitUntil(deadline time.Time, cond func() bool) bool {
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(drainPollInterval)
+	}
+	return true
+}
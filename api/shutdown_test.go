@@ -0,0 +1,55 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	fws "github.com/fasthttp/websocket"
+)
+
+func TestShutdownClosesClientsWithGoingAway(t *testing.T) {
+	alice := newTestUser("alice")
+	conn := dialWS(t, alice)
+
+	if n := closeAllClients(fws.CloseGoingAway, "server shutting down"); n == 0 {
+		t.Fatal("no clients closed")
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := conn.ReadMessage(); !fws.IsCloseError(err, fws.CloseGoingAway) {
+		t.Fatalf("expected close %d, got %v", fws.CloseGoingAway, err)
+	}
+	waitFor(t, func() bool { _, ok := getClient(DefaultTenant, alice); return !ok })
+}
+
+func TestRequestsRejectedWhileDraining(t *testing.T) {
+	shuttingDown.Store(true)
+	t.Cleanup(func() { shuttingDown.Store(false) })
+
+	resp, err := http.Get("http://" + testAddr + "/online")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", resp.StatusCode)
+	}
+
+	if _, resp, err := fws.DefaultDialer.Dial("ws://"+testAddr+"/ws/chat/"+newTestUser("bob"), nil); err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected upgrade to be rejected with 503, got %v", err)
+	}
+}
+
+func TestQueuedMessagesDrainBeforeShutdown(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	for i := 0; i < 20; i++ {
+		broadcast <- queuedMessage{Message: Message{TenantID: DefaultTenant, SenderID: alice, ReceiverID: bob, Text: "bye"}}
+	}
+
+	if !waitUntil(time.Now().Add(2*time.Second), queuesDrained) {
+		t.Fatal("queues not drained in time")
+	}
+	if n := countStored(t, alice, bob, false); n != 20 {
+		t.Fatalf("expected 20 stored messages, got %d", n)
+	}
+}
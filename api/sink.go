@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// ค่าของ Kafka writer ที่ sink และ audit stream ใช้ร่วมกัน
+// write timeout สั้นและจำกัดจำนวนครั้งที่ลอง เพื่อให้ตอน broker ล่มชุดที่ส่งไม่ได้ fail เร็ว
+// (audit stream จะเขียนลง dead-letter) แทนที่จะค้างอยู่ในการส่งจนคิวเต็ม
+const (
+	kafkaBatchSize       = 100 // จำนวนรายการสูงสุดต่อชุด ทั้งที่หยิบจากคิวและที่ writer ส่งต่อครั้ง
+	kafkaBatchTimeout    = 10 * time.Millisecond
+	kafkaWriteTimeout    = 2 * time.Second
+	kafkaMaxAttempts     = 3
+	kafkaWriteBackoffMax = 250 * time.Millisecond
+)
+
+var (
+	kafkaWriterOnce sync.Once
+	kafkaWriter     *kafka.Writer
+)
+
+// Kafka writer ตัวเดียวของ process (connection และ batch ใช้ร่วมกันทุก topic แต่ละ record กำหนด topic เอง)
+func sharedKafkaWriter(brokers []string) *kafka.Writer {
+	kafkaWriterOnce.Do(func() {
+		kafkaWriter = &kafka.Writer{
+			Addr:            kafka.TCP(brokers...),
+			Balancer:        &kafka.Hash{},
+			BatchSize:       kafkaBatchSize,
+			BatchTimeout:    kafkaBatchTimeout,
+			WriteTimeout:    kafkaWriteTimeout,
+			MaxAttempts:     kafkaMaxAttempts,
+			WriteBackoffMax: kafkaWriteBackoffMax,
+			RequiredAcks:    kafka.RequireAll,
+		}
+	})
+	return kafkaWriter
+}
+
+// ต่อ batch (ที่มีรายการแรกอยู่แล้ว) ด้วยรายการที่รออยู่ในคิว จนครบ kafkaBatchSize หรือคิวว่าง/ถูกปิด
+func nextBatch[T any](batch []T, queue <-chan T) []T {
+	for len(batch) < kafkaBatchSize {
+		select {
+		case next, ok := <-queue:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, next)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// ปลายทางภายนอกที่รับสำเนาของทุกข้อความ (เช่น Kafka สำหรับ analytics)
+type MessageSink interface {
+	Publish(msgs []Message) error
+}
+
+// ค่า default: ไม่ส่งออกไปไหน
+type noopMessageSink struct{}
+
+func (noopMessageSink) Publish([]Message) error { return nil }
+
+// ส่งข้อความเป็น JSON เข้า Kafka topic ใช้ conversation เป็น key เพื่อให้ข้อความในบทสนทนาเดียวกันเรียงลำดับใน partition เดียว
+type kafkaSink struct {
+	writer *kafka.Writer
+	topic  string
+}
+
+func newKafkaSink(brokers []string, topic string) kafkaSink {
+	return kafkaSink{writer: sharedKafkaWriter(brokers), topic: topic}
+}
+
+func (s kafkaSink) Publish(msgs []Message) error {
+	records := make([]kafka.Message, 0, len(msgs))
+	for _, msg := range msgs {
+		value, err := json.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("marshalling message %d: %w", msg.ID, err)
+		}
+		records = append(records, kafka.Message{
+			Topic:   s.topic,
+			Key:     []byte(tenantKey(msg.TenantID, conversationKey(msg.SenderID, msg.ReceiverID))),
+			Value:   value,
+			Headers: []kafka.Header{{Key: "tenant_id", Value: []byte(msg.TenantID)}},
+		})
+	}
+	return s.writer.WriteMessages(context.Background(), records...)
+}
+
+var (
+	messageSink MessageSink  = noopMessageSink{}
+	sinkQueue   chan Message // nil = ไม่ได้เปิด sink
+)
+
+// เลือก sink ตาม config และเปิด goroutine ส่งข้อความเป็นชุด
+func startMessageSink() {
+	if len(config.KafkaBrokers) > 0 {
+		messageSink = newKafkaSink(config.KafkaBrokers, config.KafkaTopic)
+		slog.Info("mirroring messages to Kafka", "topic", config.KafkaTopic)
+	}
+	if _, ok := messageSink.(noopMessageSink); ok {
+		return
+	}
+
+	sinkQueue = make(chan Message, config.SinkQueueSize)
+	go runSink(sinkQueue, messageSink)
+}
+
+// หยิบข้อความจากคิวส่งให้ sink จนกว่าคิวจะถูกปิด โดยรวมข้อความที่รออยู่เป็นชุดละไม่เกิน kafkaBatchSize
+func runSink(queue <-chan Message, sink MessageSink) {
+	batch := make([]Message, 0, kafkaBatchSize)
+	for msg := range queue {
+		batch = nextBatch(append(batch[:0], msg), queue)
+		if err := sink.Publish(batch); err != nil {
+			sinkErrorsTotal.Add(float64(len(batch)))
+			slog.Error("publishing messages to sink", "count", len(batch), "err", err)
+		}
+	}
+}
+
+// ส่งสำเนาข้อความให้ sink และ audit stream แบบ async ไม่ block การส่งข้อความ ถ้าคิวเต็มจะทิ้งและนับไว้
+func mirrorMessage(msg Message) {
+	streamMessage(msg)
+	if sinkQueue == nil {
+		return
+	}
+	select {
+	case sinkQueue <- msg:
+	default:
+		sinkDroppedTotal.Inc()
+		messageLogger(msg).Warn("sink queue full, dropped message")
+	}
+}
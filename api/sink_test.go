@@ -0,0 +1,58 @@
+package api
+
+import (
+	"errors"
+	"testing"
+)
+
+// sink ที่จำชุดข้อความที่ได้รับไว้ตรวจใน test
+type recordingSink struct {
+	batches [][]Message
+	err     error
+}
+
+func (s *recordingSink) Publish(msgs []Message) error {
+	s.batches = append(s.batches, append([]Message(nil), msgs...))
+	return s.err
+}
+
+func TestRunSinkBatchesQueuedMessages(t *testing.T) {
+	queue := make(chan Message, kafkaBatchSize+10)
+	for i := 0; i < kafkaBatchSize+5; i++ {
+		queue <- Message{ID: int64(i + 1)}
+	}
+	close(queue)
+
+	sink := &recordingSink{}
+	runSink(queue, sink)
+
+	if len(sink.batches) != 2 || len(sink.batches[0]) != kafkaBatchSize || len(sink.batches[1]) != 5 {
+		t.Fatalf("unexpected batches: %d", len(sink.batches))
+	}
+	if sink.batches[1][4].ID != kafkaBatchSize+5 {
+		t.Fatalf("messages out of order: %+v", sink.batches[1])
+	}
+}
+
+func TestRunSinkContinuesAfterPublishError(t *testing.T) {
+	queue := make(chan Message, 1)
+	sink := &recordingSink{err: errors.New("broker unavailable")}
+
+	done := make(chan struct{})
+	go func() {
+		runSink(queue, sink)
+		close(done)
+	}()
+	queue <- Message{ID: 1}
+	queue <- Message{ID: 2}
+	close(queue)
+	<-done
+
+	total := 0
+	for _, b := range sink.batches {
+		total += len(b)
+	}
+	if total != 2 {
+		t.Fatalf("expected both messages to be attempted, got %d", total)
+	}
+}
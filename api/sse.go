@@ -0,0 +1,143 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Server-Sent Events สำหรับ client ที่อยู่หลัง proxy ที่ตัด WebSocket (รับอย่างเดียว ส่งข้อความผ่าน POST /send)
+// GET /sse/chat/:id ส่ง frame เดียวกับ /ws/chat/:id เป็น "data: <json>" ทีละ event (JSON codec, protocol v1 เสมอ)
+// stream ลงทะเบียนเป็น session ใน hub เหมือน WebSocket ผู้ใช้จึงออนไลน์ ได้ข้อความสดและข้อความที่ค้าง (?since= เหมือนกัน)
+// server ปิด stream เอง (ถูกแทนที่ เตะออก ปิด server) จะส่ง "event: close" พร้อม code/reason ก่อน
+
+// ความถี่ที่ส่ง comment กัน proxy ตัด connection ที่เงียบ (และเป็นทางเดียวที่รู้ว่า client หลุดไปแล้ว)
+const sseKeepAliveInterval = 15 * time.Second
+
+// event ที่ส่งก่อน server ปิด stream (code เดียวกับ close code ของ WebSocket)
+type sseCloseEvent struct {
+	Code   int    `json:"code"`
+	Reason string `json:"reason"`
+}
+
+// ปลายทางของ client ที่เชื่อมต่อผ่าน SSE (writer ของ fasthttp ใช้ได้จนกว่า stream writer จะคืนค่า)
+type sseStream struct {
+	mu        sync.Mutex
+	w         *bufio.Writer
+	done      chan struct{} // ถูกปิดเมื่อ stream ต้องจบ (server ปิดเอง หรือเขียนไม่สำเร็จ)
+	closeOnce sync.Once
+}
+
+func newSSEStream(w *bufio.Writer) *sseStream {
+	return &sseStream{w: w, done: make(chan struct{})}
+}
+
+// เขียน event หนึ่ง event แล้ว flush เขียนไม่สำเร็จ = client หลุด ให้ stream จบ
+func (s *sseStream) write(event string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.done:
+		return errClientClosed
+	default:
+	}
+	if event != "" {
+		s.w.WriteString("event: " + event + "\n")
+	}
+	s.w.WriteString("data: ")
+	s.w.Write(data)
+	s.w.WriteString("\n\n")
+	return s.flush()
+}
+
+// comment (บรรทัดที่ขึ้นต้นด้วย ":") EventSource ไม่ส่งให้ application
+func (s *sseStream) comment(text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.w.WriteString(": " + text + "\n\n")
+	return s.flush()
+}
+
+func (s *sseStream) flush() error {
+	err := s.w.Flush()
+	if err != nil {
+		s.close()
+	}
+	return err
+}
+
+// แจ้งเหตุผลแล้วจบ stream
+func (s *sseStream) closeWith(code int, text string) {
+	data, _ := json.Marshal(sseCloseEvent{Code: code, Reason: text})
+	s.write("close", data)
+	s.close()
+}
+
+func (s *sseStream) close() {
+	s.closeOnce.Do(func() { close(s.done) })
+}
+
+// GET /sse/chat/:userID?session=&subscribe=&since=
+func handleSSE(c *fiber.Ctx) error {
+	tenant, userID := TenantOf(c), c.Params("userID")
+	if _, reason, ok := acquireConnection(tenant, userID); !ok {
+		slog.Info("connection rejected", "tenant", tenant, "user_id", userID, "reason", reason)
+		return NewError(fiber.StatusServiceUnavailable, errCodeUnavailable, reason)
+	}
+	// ค่าจาก request ต้องอ่านก่อน handler คืนค่า (stream writer ทำงานหลังจากนั้น)
+	sessionID, subscribe, since, remoteIP := c.Query("session"), c.Query("subscribe"), c.Query("since"), c.IP()
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no") // nginx ไม่ต้อง buffer
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer releaseConnection(tenant, userID)
+		serveSSE(newSSEStream(w), tenant, userID, sessionID, subscribe, since, remoteIP)
+	})
+	return nil
+}
+
+// ลงทะเบียน stream เป็น session ของผู้ใช้แล้วส่ง keepalive จนกว่า stream จะจบ
+func serveSSE(stream *sseStream, tenant, userID, sessionID, subscribe, since, remoteIP string) {
+	cl := newClient(nil, tenant, userID, sessionID, subscribe)
+	cl.sse = stream
+	for _, old := range registerClient(cl) {
+		old.logger().Info("session replaced", "replaced_by", cl.connID)
+		old.closeWith(closeSessionReplaced, "session replaced")
+	}
+	cl.logger().Info("connected", "transport", "sse", "remote_ip", remoteIP)
+	auditID := auditConnect(cl, remoteIP)
+	emitWebhook(tenant, webhookUserConnected, WebhookConnection{UserID: userID, SessionID: cl.sessionID, ConnID: cl.connID})
+
+	// ส่ง byte แรกทันที browser และ proxy จะได้รู้ว่า stream เปิดแล้ว
+	err := stream.comment("connected")
+	if err == nil && cl.wants(frameTypeChat) {
+		replayOnConnect(cl, since)
+	}
+
+	ticker := time.NewTicker(sseKeepAliveInterval)
+	defer ticker.Stop()
+	for err == nil {
+		select {
+		case <-stream.done:
+			err = errClientClosed
+		case <-ticker.C:
+			err = stream.comment("keepalive")
+		}
+	}
+
+	// เหมือน WebSocket: ถอนออกก่อนหยุดเขียน ข้อความที่กำลังส่งอยู่จะค้างใน DB แทนที่จะหาย
+	unregisterClient(cl)
+	unsubscribePresence(cl)
+	cl.markClosed()
+	recordLastSeen(tenant, userID, time.Now())
+	reason := disconnectReason(cl, err)
+	auditDisconnect(auditID, reason)
+	emitWebhook(tenant, webhookUserDisconnected, WebhookConnection{UserID: userID, SessionID: cl.sessionID, ConnID: cl.connID, Reason: reason})
+	cl.logger().Info("disconnected", "transport", "sse", "reason", reason)
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// event หนึ่ง event ของ text/event-stream (comment ถูกข้าม)
+type sseEvent struct {
+	Event string
+	Data  string
+}
+
+// stream ละ connection ไม่ใช้ connection ที่ค้างจาก request ก่อนหน้า
+var sseHTTPClient = &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+// เปิด /sse/chat/:id คืน channel ของ event ที่อ่านได้ (ปิดเมื่อ stream จบ)
+func dialSSE(t *testing.T, userID, query string) (*http.Response, <-chan sseEvent) {
+	t.Helper()
+	resp, err := sseHTTPClient.Get("http://" + testAddr + "/sse/chat/" + userID + query)
+	if err != nil {
+		t.Fatalf("get sse: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	// server รู้ว่า client หลุดตอนเขียน keepalive ครั้งถัดไปเท่านั้น ปิดจากฝั่ง server ให้ test ไม่ต้องรอ
+	t.Cleanup(func() { disconnectUserLocal(DefaultTenant, userID, "test finished") })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected response %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	events := make(chan sseEvent, 16)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		var ev sseEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				if ev.Data != "" {
+					events <- ev
+				}
+				ev = sseEvent{}
+			case strings.HasPrefix(line, "event: "):
+				ev.Event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				ev.Data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+	return resp, events
+}
+
+func nextSSEEvent(t *testing.T, events <-chan sseEvent) sseEvent {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		if !ok {
+			t.Fatal("stream ended")
+		}
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for SSE event")
+	}
+	return sseEvent{}
+}
+
+func TestSSEReceivesPendingAndLiveMessages(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	stored := saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: "while away"})
+
+	_, events := dialSSE(t, bob, "")
+	var got Message
+	json.Unmarshal([]byte(nextSSEEvent(t, events).Data), &got)
+	if got.ID != stored || got.Text != "while away" {
+		t.Fatalf("unexpected pending message: %+v", got)
+	}
+
+	// ผู้ใช้ที่เชื่อมต่อผ่าน SSE นับว่าออนไลน์ และ /send ส่งถึงทันที
+	if _, ok := getClient(DefaultTenant, bob); !ok {
+		t.Fatal("SSE client should be registered as online")
+	}
+	resp, err := http.Post("http://"+testAddr+"/send", "application/json", strings.NewReader(`{"sender_id":"`+alice+`","receiver_id":"`+bob+`","text":"live"}`))
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	var sent struct {
+		Delivered bool  `json:"delivered"`
+		ID        int64 `json:"id"`
+	}
+	json.NewDecoder(resp.Body).Decode(&sent)
+	resp.Body.Close()
+	if !sent.Delivered {
+		t.Fatal("message to an SSE client should be delivered")
+	}
+	json.Unmarshal([]byte(nextSSEEvent(t, events).Data), &got)
+	if got.ID != sent.ID || got.Text != "live" {
+		t.Fatalf("unexpected live message: %+v", got)
+	}
+}
+
+func TestSSEStreamClosedWhenSessionReplaced(t *testing.T) {
+	bob := newTestUser("bob")
+	_, first := dialSSE(t, bob, "?session=phone")
+	waitFor(t, func() bool { _, ok := getClient(DefaultTenant, bob); return ok })
+
+	_, second := dialSSE(t, bob, "?session=phone")
+	ev := nextSSEEvent(t, first)
+	var closed sseCloseEvent
+	json.Unmarshal([]byte(ev.Data), &closed)
+	if ev.Event != "close" || closed.Code != closeSessionReplaced {
+		t.Fatalf("expected close event, got %+v", ev)
+	}
+	if _, ok := <-first; ok {
+		t.Fatal("replaced stream should end")
+	}
+
+	// stream ใหม่ยังเป็น session ของ bob
+	waitFor(t, func() bool { return len(getSessions(DefaultTenant, bob)) == 1 })
+	dispatchMessage(Message{SenderID: newTestUser("alice"), ReceiverID: bob, Text: "to new stream"})
+	var got Message
+	json.Unmarshal([]byte(nextSSEEvent(t, second).Data), &got)
+	if got.Text != "to new stream" {
+		t.Fatalf("unexpected message: %+v", got)
+	}
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// จำนวนข้อความที่นับจาก DB (cache ไว้ตาม config.StatsCacheTTL)
+type dbStats struct {
+	TotalMessages int64 `json:"total_messages"`
+	TotalUnread   int64 `json:"total_unread"`
+	MessagesLast  int64 `json:"messages_last_24h"`
+}
+
+// การใช้งาน buffer ของคิวข้อความ
+type queueStats struct {
+	Length   int `json:"length"`
+	Capacity int `json:"capacity"`
+}
+
+var statsCache struct {
+	mu        sync.Mutex
+	stats     dbStats
+	fetchedAt time.Time
+}
+
+// ดึงจำนวนข้อความจาก DB หรือใช้ค่าใน cache ถ้ายังไม่หมดอายุ
+func getDBStats(now time.Time) (dbStats, error) {
+	statsCache.mu.Lock()
+	defer statsCache.mu.Unlock()
+
+	if !statsCache.fetchedAt.IsZero() && now.Sub(statsCache.fetchedAt) < config.StatsCacheTTL {
+		return statsCache.stats, nil
+	}
+
+	var s dbStats
+	err := db.QueryRow(`
+		SELECT
+			COUNT(*),
+			COALESCE(SUM(CASE WHEN is_read = FALSE THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN created_at >= ? THEN 1 ELSE 0 END), 0)
+		FROM messages
+		WHERE deleted_at IS NULL`, now.Add(-24*time.Hour).UTC()).Scan(&s.TotalMessages, &s.TotalUnread, &s.MessagesLast)
+	if err != nil {
+		return dbStats{}, err
+	}
+
+	statsCache.stats = s
+	statsCache.fetchedAt = now
+	return s, nil
+}
+
+// นับผู้ใช้ที่ออนไลน์อยู่
+func countOnlineUsers() int {
+	n := 0
+	registry.RangeUsers(func(_, _ string) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// GET /stats ตัวเลขสรุปสำหรับผู้ดูแลระบบ (ไม่ต้องใช้ Prometheus)
+func handleStats(c *fiber.Ctx) error {
+	s, err := getDBStats(time.Now())
+	if err != nil {
+		return Internal("Error fetching stats", err)
+	}
+
+	return c.JSON(fiber.Map{
+		"messages":     s,
+		"online_users": countOnlineUsers(),
+		"queues": fiber.Map{
+			"broadcast": queueStats{Length: len(broadcast), Capacity: cap(broadcast)},
+			"priority":  queueStats{Length: len(priorityBroadcast), Capacity: cap(priorityBroadcast)},
+		},
+	})
+}
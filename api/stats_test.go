@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestStatsRequiresAdminToken(t *testing.T) {
+	prevToken := config.AdminToken
+	defer func() { config.AdminToken = prevToken }()
+
+	for _, tc := range []struct {
+		token string
+		want  int
+	}{
+		{"", http.StatusForbidden},                // ไม่ได้ตั้ง admin token = ปิด
+		{"admin-secret", http.StatusUnauthorized}, // ตั้งแล้วแต่ request ไม่มี token
+	} {
+		config.AdminToken = tc.token
+		resp, err := http.Get("http://" + testAddr + "/stats")
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.want {
+			t.Fatalf("admin token %q: expected %d, got %d", tc.token, tc.want, resp.StatusCode)
+		}
+	}
+}
+
+func TestStatsReportsCountsAndQueues(t *testing.T) {
+	config.StatsCacheTTL = 0
+	defer func() { config.StatsCacheTTL = defaultConfig().StatsCacheTTL }()
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	dialWS(t, alice)
+
+	type statsResponse struct {
+		Messages    dbStats               `json:"messages"`
+		OnlineUsers int                   `json:"online_users"`
+		Queues      map[string]queueStats `json:"queues"`
+	}
+	getStats := func() statsResponse {
+		status, body := adminRequest(t, http.MethodGet, "/stats", "")
+		if status != http.StatusOK {
+			t.Fatalf("stats: status %d: %s", status, body)
+		}
+		var s statsResponse
+		if err := json.Unmarshal(body, &s); err != nil {
+			t.Fatalf("decode %s: %v", body, err)
+		}
+		return s
+	}
+
+	before := getStats()
+	saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: "unread"})
+	read := saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: "read"})
+	deleted := saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: "deleted"})
+	db.Exec("UPDATE messages SET is_read = TRUE WHERE id = ?", read)
+	db.Exec("UPDATE messages SET deleted_at = CURRENT_TIMESTAMP WHERE id = ?", deleted)
+	after := getStats()
+
+	// ข้อความที่ถูกลบไม่นับ
+	if d := after.Messages.TotalMessages - before.Messages.TotalMessages; d != 2 {
+		t.Fatalf("expected total to grow by 2, got %d", d)
+	}
+	if d := after.Messages.TotalUnread - before.Messages.TotalUnread; d != 1 {
+		t.Fatalf("expected unread to grow by 1, got %d", d)
+	}
+	if d := after.Messages.MessagesLast - before.Messages.MessagesLast; d != 2 {
+		t.Fatalf("expected last 24h to grow by 2, got %d", d)
+	}
+	if after.OnlineUsers < 1 {
+		t.Fatalf("expected online users, got %d", after.OnlineUsers)
+	}
+	if q := after.Queues["broadcast"]; q.Capacity != cap(broadcast) {
+		t.Fatalf("unexpected broadcast queue stats: %+v", q)
+	}
+	if q := after.Queues["priority"]; q.Capacity != cap(priorityBroadcast) {
+		t.Fatalf("unexpected priority queue stats: %+v", q)
+	}
+}
+
+func TestStatsAreCached(t *testing.T) {
+	config.StatsCacheTTL = time.Minute
+	defer func() { config.StatsCacheTTL = defaultConfig().StatsCacheTTL }()
+	statsCache.mu.Lock()
+	statsCache.fetchedAt = time.Time{}
+	statsCache.mu.Unlock()
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+
+	now := time.Now()
+	first, err := getDBStats(now)
+	if err != nil {
+		t.Fatalf("getDBStats: %v", err)
+	}
+	saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: "after cache"})
+
+	// ยังไม่หมดอายุ ได้ค่าเดิมโดยไม่ query ใหม่
+	cached, _ := getDBStats(now.Add(30 * time.Second))
+	if cached != first {
+		t.Fatalf("expected cached stats %+v, got %+v", first, cached)
+	}
+	fresh, _ := getDBStats(now.Add(time.Minute))
+	if fresh.TotalMessages != first.TotalMessages+1 {
+		t.Fatalf("expected refreshed total %d, got %d", first.TotalMessages+1, fresh.TotalMessages)
+	}
+}
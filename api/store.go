@@ -0,0 +1,65 @@
+package api
+
+import "go-socket/store"
+
+// ที่เก็บข้อความแชทหลัก (บันทึก ข้อความค้าง สถานะส่งถึง/อ่าน ยอด unread history และ sync)
+// ครอบเฉพาะตาราง messages ในเส้นทางหลัก ส่วนอื่น (outbox, ห้อง, reaction, ไฟล์แนบ, block, audit, retention ฯลฯ)
+// ยัง query ผ่าน db ตรงๆ จึงต้องใช้ฐานข้อมูล SQL ที่ store.DB รองรับ (SQLite หรือ PostgreSQL) การเปลี่ยนเป็น backend
+// ที่ไม่ใช่ SQL ต้องย้าย query เหล่านั้นมาไว้หลัง interface ก่อน
+// ตัวที่ใช้จริงคือ store.Messages
+type MessageStore interface {
+	// บันทึกหลายข้อความใน transaction เดียว คืนค่าผลตามลำดับ (client_msg_id ซ้ำคืน ID ของแถวเดิม)
+	Save(msgs []Message) ([]storedMessage, error)
+	// ข้อความที่ยังไม่ได้ส่งถึง userID
+	PendingFor(tenant, userID string) ([]Message, error)
+	// mark ว่าส่งถึงแล้ว คืนค่าข้อความที่เพิ่งเปลี่ยนสถานะ (เพื่อแจ้งผู้ส่ง)
+	MarkDelivered(ids []int64) ([]Message, error)
+	// mark ว่าส่งถึงตาม ack ของ receiverID คืนค่า ID แยกตามผู้ส่ง (ข้อความที่อ่านแล้วไม่คืน)
+	AckDelivered(tenant, receiverID string, ids []int64) (map[string][]int64, error)
+	// mark ข้อความที่ readerID เป็นผู้รับว่าอ่านแล้ว คืนค่า ID ที่เพิ่งถูกอ่าน แยกตามผู้ส่ง
+	MarkRead(tenant, readerID string, ids []int64) (map[string][]int64, error)
+	// mark ข้อความที่ peerID ส่งถึง readerID ที่ ID ไม่เกิน upToID (ศูนย์ = ทั้งหมด) ว่าอ่านแล้ว
+	MarkConversationRead(tenant, readerID, peerID string, upToID int64) ([]int64, error)
+	UnreadCounts(tenant, userID string) ([]UnreadCount, error)
+	UnreadTotal(tenant, userID string) (int, error)
+	// ข้อความระหว่าง userID กับ peerID ที่เก่ากว่า before (ศูนย์ = ล่าสุด) เรียงจากใหม่ไปเก่า
+	History(tenant, userID, peerID string, before historyCursor, limit int) ([]Message, error)
+	// ข้อความของ userID (รับ หรือส่งจากอุปกรณ์อื่น) ที่ ID มากกว่า afterID เรียงจากเก่าไปใหม่ สำหรับ sync
+	Since(tenant, userID string, afterID int64, limit int) ([]Message, error)
+}
+
+var messageStore MessageStore
+
+type (
+	// ผลการบันทึกข้อความหนึ่งข้อความ
+	storedMessage = store.SaveResult
+	// จำนวนข้อความที่ยังไม่ได้อ่านจากคู่สนทนาแต่ละคน
+	UnreadCount = store.UnreadCount
+	// ตำแหน่งในประวัติการสนทนา: ข้อความสุดท้ายของหน้าก่อน (ศูนย์ = เริ่มจากข้อความล่าสุด)
+	historyCursor = store.Cursor
+)
+
+var (
+	// key ของบทสนทนาระหว่างผู้ใช้สองคน (ตรงกับ generated column messages.conversation_key)
+	conversationKey = store.ConversationKey
+	// placeholder "?" n ตัว สำหรับสร้างคำสั่ง IN
+	makePlaceholders = store.Placeholders
+	// แปลงสตริงว่างเป็น NULL เพื่อไม่ให้ชนกับ unique index
+	nullString = store.NullString
+)
+
+// ผูก store.Messages กับการเข้ารหัสและข้อมูลจากตารางอื่นของ server
+type messageHooks struct{}
+
+func (messageHooks) SealText(plain string) (string, int, error) { return sealText(plain) }
+
+func (messageHooks) OpenText(stored string, version int) (string, error) {
+	return openText(stored, version)
+}
+
+func (messageHooks) Enrich(userID string, msgs []Message) {
+	attachReactions(msgs)
+	attachAttachments(msgs)
+	attachMentioned(userID, msgs)
+	attachReplyPreviews(msgs)
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"strconv"
+
+	"go-socket/protocol"
+)
+
+// จำนวนข้อความที่ดึงจาก DB ต่อรอบระหว่าง sync
+const syncPageSize = 200
+
+// frame ขอ sync หลังเชื่อมต่อ: {"type":"sync","since":<ID สูงสุดที่ client มี>}
+type SyncRequest = protocol.SyncRequest
+
+// ส่งหลัง replay ครบ last_id คือ ID ที่ client ควรใช้เป็น since ครั้งถัดไป
+type SyncedFrame = protocol.SyncedFrame
+
+// ส่งข้อความทุกข้อความหลัง since ให้ connection นี้ แล้วปิดท้ายด้วย synced frame
+// ใช้แทน sendPendingMessages เมื่อ client บอกได้ว่ามีข้อความถึง ID ไหนแล้ว จึงไม่พึ่ง is_delivered อย่างเดียว
+// (อุปกรณ์ใหม่ของผู้ใช้ได้ข้อความที่อุปกรณ์อื่นรับไปแล้วด้วย)
+func syncMessages(cl *client, since int64) {
+	lastID, count := since, 0
+	for {
+		msgs, err := messageStore.Since(cl.tenant, cl.userID, lastID, syncPageSize)
+		if err != nil {
+			cl.logger().Error("fetching messages for sync", "after_id", lastID, "err", err)
+			cl.send(ErrorFrame{Type: frameTypeError, Code: errCodeInternal, Detail: "sync failed"})
+			return
+		}
+
+		var delivered []int64
+		for _, msg := range msgs {
+			if err := cl.send(cl.chatFrame(msg)); err != nil {
+				// ส่งไม่ครบ: client จะ sync ใหม่จาก ID สุดท้ายที่ได้รับตอนเชื่อมต่อครั้งหน้า
+				markDelivered(delivered)
+				return
+			}
+			if msg.ReceiverID == cl.userID && !msg.IsDelivered {
+				delivered = append(delivered, msg.ID)
+			}
+			lastID = msg.ID
+			count++
+		}
+		markDelivered(delivered)
+		if len(msgs) < syncPageSize {
+			break
+		}
+	}
+
+	cl.logger().Info("replayed messages", "since", since, "count", count)
+	cl.send(SyncedFrame{Type: frameTypeSynced, LastID: lastID, Count: count})
+}
+
+// ส่งข้อความที่ค้างให้ connection ที่เพิ่งเชื่อมต่อ: ?since=<id> ใช้ sync ไม่ระบุใช้ข้อความที่ยังไม่ได้ส่งถึง
+func replayOnConnect(cl *client, since string) {
+	if since == "" {
+		sendPendingMessages(cl)
+		return
+	}
+	id, err := strconv.ParseInt(since, 10, 64)
+	if err != nil || id < 0 {
+		cl.send(ErrorFrame{Type: frameTypeError, Code: errCodeInvalidRequest, Detail: "invalid since"})
+		sendPendingMessages(cl)
+		return
+	}
+	syncMessages(cl, id)
+}
+
+// frame sync จาก client ที่เชื่อมต่ออยู่แล้ว (เช่น กลับมาจาก background)
+func handleSyncFrame(cl *client, raw []byte) {
+	var req SyncRequest
+	if err := cl.codec.Unmarshal(raw, &req); err != nil || req.Since < 0 {
+		cl.send(ErrorFrame{Type: frameTypeError, Code: errCodeInvalidRequest, Detail: "sync requires a non-negative since"})
+		return
+	}
+	if !cl.wants(frameTypeChat) {
+		cl.send(ErrorFrame{Type: frameTypeError, Code: errCodeInvalidRequest, Detail: "connection is not subscribed to chat"})
+		return
+	}
+	syncMessages(cl, req.Since)
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"strconv"
+	"testing"
+
+	fws "github.com/fasthttp/websocket"
+)
+
+func dialWSSince(t *testing.T, userID string, since int64) *fws.Conn {
+	t.Helper()
+	conn, _, err := fws.DefaultDialer.Dial("ws://"+testAddr+"/ws/chat/"+userID+"?since="+strconv.FormatInt(since, 10), nil)
+	if err != nil {
+		t.Fatalf("dial %s: %v", userID, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestReconnectWithSinceReplaysOnlyNewerMessages(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	var ids []int64
+	for _, text := range []string{"one", "two", "three"} {
+		ids = append(ids, saveMessageToDB(Message{SenderID: alice, ReceiverID: bob, Text: text}))
+	}
+	// ข้อความที่ bob ส่งจากอุปกรณ์อื่นก็ต้องได้ด้วย
+	ids = append(ids, saveMessageToDB(Message{SenderID: bob, ReceiverID: alice, Text: "four"}))
+	markDelivered(ids[:3]) // อุปกรณ์อื่นของ bob รับไปแล้ว
+
+	conn := dialWSSince(t, bob, ids[0])
+	var texts []string
+	for range ids[1:] {
+		var msg Message
+		readJSON(t, conn, &msg)
+		texts = append(texts, msg.Text)
+	}
+	if len(texts) != 3 || texts[0] != "two" || texts[2] != "four" {
+		t.Fatalf("unexpected replay %v", texts)
+	}
+	var done SyncedFrame
+	readJSON(t, conn, &done)
+	if done.Type != frameTypeSynced || done.LastID != ids[3] || done.Count != 3 {
+		t.Fatalf("unexpected synced frame %+v", done)
+	}
+
+	// sync หลังเชื่อมต่อแล้วด้วย ID ล่าสุด = ไม่มีอะไรใหม่
+	conn.WriteJSON(map[string]any{"type": "sync", "since": done.LastID})
+	readJSON(t, conn, &done)
+	if done.Count != 0 || done.LastID != ids[3] {
+		t.Fatalf("expected empty sync, got %+v", done)
+	}
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// tenant ของ deployment แบบเดิมที่ไม่ได้ระบุ tenant (แถวเดิมใน DB ทั้งหมดเป็นของ tenant นี้)
+const DefaultTenant = "public"
+
+// header ที่ reverse proxy ใช้ระบุ tenant (เชื่อเฉพาะเมื่อเปิด TenantSettings.TrustHeader)
+const HeaderTenantID = "X-Tenant-ID"
+
+// key ใน fiber Locals ที่เก็บ tenant ของ request (WebSocket อ่านผ่าน conn.Locals)
+const LocalsTenant = "tenant"
+
+// ชื่อ tenant ใช้ได้เฉพาะตัวพิมพ์เล็ก ตัวเลข และ - (ใช้เป็น subdomain ได้)
+var tenantPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+func ValidTenant(tenant string) bool {
+	return tenantPattern.MatchString(tenant)
+}
+
+// วิธีหา tenant ของ request
+type TenantSettings struct {
+	// โดเมนหลักสำหรับแยก tenant จาก subdomain (เช่น chat.example.com -> acme.chat.example.com) ว่าง = ไม่ใช้
+	Domain string
+	// เชื่อ header X-Tenant-ID (เปิดเฉพาะเมื่อมี reverse proxy ที่เขียนทับ header นี้อยู่ข้างหน้าเสมอ)
+	TrustHeader bool
+}
+
+// หา tenant ของ request: subdomain ของ Domain มาก่อนเสมอ (เช่น acme.chat.example.com -> acme)
+// header X-Tenant-ID ที่ไม่ตรงกับ subdomain หรือส่งมาโดยไม่ได้เปิด TrustHeader ถูกปฏิเสธ
+// (ไม่งั้น client ของ tenant หนึ่งตั้ง header เองแล้วเข้าถึง tenant อื่นได้) ไม่พบทั้งสองแบบ = DefaultTenant
+func ResolveTenant(c *fiber.Ctx, settings TenantSettings) (string, error) {
+	header := strings.ToLower(c.Get(HeaderTenantID))
+	if settings.Domain != "" {
+		host := strings.ToLower(c.Hostname())
+		if sub, ok := strings.CutSuffix(host, "."+settings.Domain); ok && !strings.Contains(sub, ".") {
+			if header != "" && header != sub {
+				return "", Forbidden("X-Tenant-ID does not match the host")
+			}
+			return sub, nil
+		}
+	}
+	if header != "" {
+		if !settings.TrustHeader {
+			return "", Forbidden("X-Tenant-ID is only accepted from a trusted proxy")
+		}
+		return header, nil
+	}
+	return DefaultTenant, nil
+}
+
+// middleware ตรวจและเก็บ tenant ของ request ไว้ใน Locals
+// settings ถูกอ่านทุก request (เปลี่ยนค่าได้โดยไม่ต้องสร้าง app ใหม่)
+func WithTenant(settings func() TenantSettings) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		tenant, err := ResolveTenant(c, settings())
+		if err != nil {
+			return err
+		}
+		if !ValidTenant(tenant) {
+			return InvalidRequest("Invalid tenant")
+		}
+		c.Locals(LocalsTenant, tenant)
+		return c.Next()
+	}
+}
+
+// tenant ของ request ปัจจุบัน
+func TenantOf(c *fiber.Ctx) string {
+	if t, ok := c.Locals(LocalsTenant).(string); ok {
+		return t
+	}
+	return DefaultTenant
+}
+
+// key ของผู้ใช้ใน map ที่อยู่ใน memory (quota, connection limit, poller) ผู้ใช้ชื่อเดียวกันต่าง tenant เป็นคนละคน
+func tenantKey(tenant, userID string) string {
+	return tenant + "\x1f" + userID
+}
+
+// session ทั้งหมดของทุก tenant ณ ตอนเรียก (เก็บรายชื่อก่อน ผู้เรียกจะเขียน socket หลังปล่อย lock ได้)
+func allSessions() []*client {
+	return registry.All()
+}
+
+// middleware ของ server: tenant จาก subdomain ของ config.TenantDomain ก่อน header X-Tenant-ID ใช้ได้เมื่อเปิด config.TrustTenantHeader
+var withTenant = WithTenant(func() TenantSettings {
+	return TenantSettings{Domain: config.TenantDomain, TrustHeader: config.TrustTenantHeader}
+})
+
+// ข้อความที่สร้างภายใน server โดยไม่ผ่าน request (เช่น test หรือ job) ถือเป็นของ DefaultTenant
+func tenantOrDefault(tenant string) string {
+	if tenant == "" {
+		return DefaultTenant
+	}
+	return tenant
+}
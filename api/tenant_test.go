@@ -0,0 +1,184 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	fws "github.com/fasthttp/websocket"
+)
+
+// เชื่อมต่อ WebSocket ในนามผู้ใช้ของ tenant ที่ระบุผ่าน header
+func dialTenantWS(t *testing.T, tenant, userID string) *fws.Conn {
+	t.Helper()
+	conn, _, err := fws.DefaultDialer.Dial("ws://"+testAddr+"/ws/chat/"+userID, http.Header{HeaderTenantID: {tenant}})
+	if err != nil {
+		t.Fatalf("dial %s/%s: %v", tenant, userID, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	waitFor(t, func() bool {
+		_, ok := getClient(tenant, userID)
+		return ok
+	})
+	return conn
+}
+
+func TestTenantsCannotMessageEachOther(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+
+	// bob ของ globex ออนไลน์ แต่ bob ของ acme ออฟไลน์
+	globexBob := dialTenantWS(t, "globex", bob)
+	acmeAlice := dialTenantWS(t, "acme", alice)
+	if err := acmeAlice.WriteJSON(Message{SenderID: alice, ReceiverID: bob, Text: "acme only"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	waitFor(t, func() bool {
+		var n int
+		db.QueryRow("SELECT COUNT(*) FROM messages WHERE tenant_id = 'acme' AND sender_id = ? AND receiver_id = ?", alice, bob).Scan(&n)
+		return n == 1
+	})
+
+	globexBob.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, data, err := globexBob.ReadMessage(); err == nil {
+		t.Fatalf("message leaked to another tenant: %s", data)
+	}
+
+	// bob ของ acme ได้ข้อความตอนเชื่อมต่อ
+	acmeBob := dialTenantWS(t, "acme", bob)
+	var got Message
+	readJSON(t, acmeBob, &got)
+	if got.Text != "acme only" {
+		t.Fatalf("unexpected message: %+v", got)
+	}
+
+	// tenant public ไม่เห็นข้อความของ acme
+	pending, err := messageStore.PendingFor(DefaultTenant, bob)
+	if err != nil {
+		t.Fatalf("PendingFor: %v", err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("public tenant saw %d acme messages", len(pending))
+	}
+}
+
+func TestTenantScopesRESTQueries(t *testing.T) {
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	id := saveMessageToDB(Message{TenantID: "acme", SenderID: alice, ReceiverID: bob, Text: "secret"})
+
+	get := func(tenant, path string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+testAddr+path, nil)
+		if tenant != "" {
+			req.Header.Set(HeaderTenantID, tenant)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("get %s: %v", path, err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	var total struct {
+		Total int `json:"total"`
+	}
+	json.NewDecoder(get("acme", "/unread/"+bob+"?total=true").Body).Decode(&total)
+	if total.Total != 1 {
+		t.Fatalf("expected 1 unread in acme, got %d", total.Total)
+	}
+	json.NewDecoder(get("", "/unread/"+bob+"?total=true").Body).Decode(&total)
+	if total.Total != 0 {
+		t.Fatalf("expected 0 unread in public tenant, got %d", total.Total)
+	}
+
+	// participant ชื่อเดียวกันจาก tenant อื่นแตะข้อความไม่ได้
+	req, _ := http.NewRequest(http.MethodPost, "http://"+testAddr+"/messages/"+strconv.FormatInt(id, 10)+"/react", strings.NewReader(`{"user_id":"`+bob+`","emoji":"👍"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderTenantID, "globex")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("react: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 across tenants, got %d", resp.StatusCode)
+	}
+
+	if resp := get("Not A Tenant!", "/online"); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid tenant, got %d", resp.StatusCode)
+	}
+}
+
+func TestTenantFromSubdomain(t *testing.T) {
+	prev := config.TenantDomain
+	config.TenantDomain = "chat.example"
+	t.Cleanup(func() { config.TenantDomain = prev })
+
+	alice := newTestUser("alice")
+	dialTenantWS(t, "initech", alice)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://"+testAddr+"/online", nil)
+	req.Host = "initech.chat.example"
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("get online: %v", err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		OnlineUsers []string `json:"online_users"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	if len(body.OnlineUsers) != 1 || body.OnlineUsers[0] != alice {
+		t.Fatalf("unexpected online users: %v", body.OnlineUsers)
+	}
+}
+
+func TestTenantHeaderRequiresTrustedProxy(t *testing.T) {
+	prevDomain, prevTrust := config.TenantDomain, config.TrustTenantHeader
+	t.Cleanup(func() { config.TenantDomain, config.TrustTenantHeader = prevDomain, prevTrust })
+	config.TenantDomain = "chat.example"
+	config.TrustTenantHeader = false
+
+	get := func(host, tenant string) int {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+testAddr+"/online", nil)
+		if host != "" {
+			req.Host = host
+		}
+		if tenant != "" {
+			req.Header.Set(HeaderTenantID, tenant)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("get online: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	for _, tc := range []struct {
+		name, host, tenant string
+		want               int
+	}{
+		{"subdomain only", "acme.chat.example", "", http.StatusOK},
+		{"header matches subdomain", "acme.chat.example", "acme", http.StatusOK},
+		{"header overrides subdomain", "acme.chat.example", "globex", http.StatusForbidden},
+		{"untrusted header without subdomain", "", "globex", http.StatusForbidden},
+		{"no tenant at all", "", "", http.StatusOK},
+	} {
+		if got := get(tc.host, tc.tenant); got != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.name, got, tc.want)
+		}
+	}
+
+	// เปิดเมื่อมี proxy ที่เชื่อถือได้: header ใช้ได้เมื่อไม่มี subdomain แต่ยังแทนที่ subdomain ไม่ได้
+	config.TrustTenantHeader = true
+	if got := get("", "globex"); got != http.StatusOK {
+		t.Fatalf("trusted header: got %d", got)
+	}
+	if got := get("acme.chat.example", "globex"); got != http.StatusForbidden {
+		t.Fatalf("trusted header must not override the subdomain: got %d", got)
+	}
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// server ที่รับ HTTP-01 challenge ของ autocert (nil = ไม่ได้เปิด)
+var acmeHTTPServer *http.Server
+
+// listener ของ server ตาม config: TCP ธรรมดา, TLS จากไฟล์ cert/key หรือ TLS ที่ขอ cert จาก Let's Encrypt เอง
+func listen(addr string) (net.Listener, error) {
+	tlsConfig, err := serverTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig == nil {
+		return ln, nil
+	}
+	slog.Info("serving TLS", "addr", addr, "autocert", len(config.AutocertDomains) > 0)
+	return tls.NewListener(ln, tlsConfig), nil
+}
+
+// tls.Config ตาม config (nil = ไม่เปิด TLS)
+func serverTLSConfig() (*tls.Config, error) {
+	switch {
+	case len(config.AutocertDomains) > 0:
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(config.AutocertDomains...),
+			Cache:      autocert.DirCache(config.AutocertCacheDir),
+			Email:      config.AutocertEmail,
+		}
+		startACMEHTTPServer(m)
+		tlsConfig := m.TLSConfig()
+		tlsConfig.MinVersion = tls.VersionTLS12
+		return tlsConfig, nil
+	case config.TLSCertFile != "":
+		cert, err := tls.LoadX509KeyPair(config.TLSCertFile, config.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading TLS certificate: %w", err)
+		}
+		return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+	}
+	return nil, nil
+}
+
+// รับ HTTP-01 challenge บน AutocertHTTPAddr ส่วน request อื่น redirect ไป https
+func startACMEHTTPServer(m *autocert.Manager) {
+	if config.AutocertHTTPAddr == "" {
+		return
+	}
+	acmeHTTPServer = &http.Server{
+		Addr:              config.AutocertHTTPAddr,
+		Handler:           m.HTTPHandler(nil),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := acmeHTTPServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("autocert HTTP listener", "addr", config.AutocertHTTPAddr, "err", err)
+		}
+	}()
+}
+
+func stopACMEHTTPServer(ctx context.Context) {
+	if acmeHTTPServer == nil {
+		return
+	}
+	if err := acmeHTTPServer.Shutdown(ctx); err != nil {
+		slog.Error("shutting down autocert HTTP listener", "err", err)
+	}
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	fws "github.com/fasthttp/websocket"
+)
+
+// เขียน cert แบบ self-signed ของ 127.0.0.1 ลงโฟลเดอร์ชั่วคราว คืน path ของ cert และ key
+func writeSelfSignedCert(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "chat test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create cert: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return certFile, keyFile
+}
+
+func TestServeWSSWithCertFiles(t *testing.T) {
+	prevCert, prevKey := config.TLSCertFile, config.TLSKeyFile
+	config.TLSCertFile, config.TLSKeyFile = writeSelfSignedCert(t)
+	defer func() { config.TLSCertFile, config.TLSKeyFile = prevCert, prevKey }()
+
+	ln, err := listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	app := newApp()
+	go app.Listener(ln)
+	defer app.Shutdown()
+
+	alice := newTestUser("alice")
+	dialer := fws.Dialer{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	conn, _, err := dialer.Dial("wss://"+ln.Addr().String()+"/ws/chat/"+alice, nil)
+	if err != nil {
+		t.Fatalf("dial wss: %v", err)
+	}
+	defer conn.Close()
+	waitFor(t, func() bool { _, ok := getClient(DefaultTenant, alice); return ok })
+
+	// plain ws บน port เดียวกันต้องไม่ผ่าน
+	if _, _, err := fws.DefaultDialer.Dial("ws://"+ln.Addr().String()+"/ws/chat/"+newTestUser("bob"), nil); err == nil {
+		t.Fatal("plain ws was accepted on the TLS listener")
+	}
+}
+
+func TestListenRejectsMissingCertFile(t *testing.T) {
+	prevCert, prevKey := config.TLSCertFile, config.TLSKeyFile
+	config.TLSCertFile, config.TLSKeyFile = "/nonexistent/cert.pem", "/nonexistent/key.pem"
+	defer func() { config.TLSCertFile, config.TLSKeyFile = prevCert, prevKey }()
+
+	if _, err := listen("127.0.0.1:0"); err == nil {
+		t.Fatal("expected error for missing certificate")
+	}
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go-socket/protocol"
+)
+
+// สถานะ "กำลังพิมพ์" หายไปเองถ้า client ไม่ส่ง typing ซ้ำภายในเวลานี้ (test ปรับให้สั้นลงได้)
+var typingTTL = 5 * time.Second
+
+// สถานะใน typing frame
+const (
+	typingStart = protocol.TypingStart
+	typingStop  = protocol.TypingStop
+)
+
+// typing frame ทั้งขาเข้าและขาออก (ไม่บันทึกลง DB)
+// ขาเข้า: {"type":"typing","receiver_id":...} หรือ {"type":"typing","room_id":...} และ "state":"stop" เมื่อหยุดพิมพ์
+type TypingEvent = protocol.TypingEvent
+
+// ผู้ใช้ที่กำลังพิมพ์อยู่ key = tenant/ผู้ส่ง/ปลายทาง ค่าเป็น timer ที่จะส่ง stop เมื่อหมดอายุ
+var (
+	typingMu     sync.Mutex
+	typingTimers = make(map[string]*time.Timer)
+)
+
+func typingKey(tenant string, ev TypingEvent) string {
+	return fmt.Sprintf("%s\x1f%s\x1f%s\x1f%d", tenant, ev.SenderID, ev.ReceiverID, ev.RoomID)
+}
+
+// จัดการ typing frame จาก client: ส่งต่อเฉพาะตอนเริ่ม/หยุดพิมพ์
+// typing ซ้ำระหว่างที่ยังพิมพ์อยู่แค่ต่ออายุ ไม่ส่งต่อ เพื่อไม่ให้ client ที่ส่งทุกการกดแป้นกลายเป็น flood
+func handleTypingFrame(cl *client, raw []byte) {
+	var ev TypingEvent
+	if err := cl.codec.Unmarshal(raw, &ev); err != nil || (ev.ReceiverID == "" && ev.RoomID == 0) {
+		cl.send(ErrorFrame{Type: frameTypeError, Code: errCodeInvalidRequest, Detail: "typing requires receiver_id or room_id"})
+		return
+	}
+	ev.Type = frameTypeTyping
+	ev.SenderID = cl.userID
+	if ev.RoomID != 0 {
+		ev.ReceiverID = ""
+	}
+	if ev.State == "" {
+		ev.State = typingStart
+	}
+
+	switch ev.State {
+	case typingStart:
+		if ev.RoomID != 0 {
+			if err := checkRoomSender(Message{TenantID: cl.tenant, SenderID: cl.userID, RoomID: ev.RoomID}); err != nil {
+				cl.send(ErrorFrame{Type: frameTypeError, Code: errCodeForbidden, Detail: err.Error()})
+				return
+			}
+		}
+		if startTyping(cl.tenant, ev) {
+			relayTyping(cl.tenant, ev)
+		}
+	case typingStop:
+		if stopTyping(cl.tenant, ev) {
+			relayTyping(cl.tenant, ev)
+		}
+	default:
+		cl.send(ErrorFrame{Type: frameTypeError, Code: errCodeInvalidRequest, Detail: "unknown typing state " + ev.State})
+	}
+}
+
+// ตั้ง/ต่ออายุ timer ของสถานะพิมพ์ คืนค่า true ถ้าเพิ่งเริ่มพิมพ์ (ต้องแจ้งปลายทาง)
+func startTyping(tenant string, ev TypingEvent) bool {
+	key := typingKey(tenant, ev)
+	typingMu.Lock()
+	defer typingMu.Unlock()
+
+	if timer, ok := typingTimers[key]; ok {
+		timer.Reset(typingTTL)
+		return false
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(typingTTL, func() {
+		typingMu.Lock()
+		// timer ถูกแทนที่หรือหยุดไปแล้ว (stop มาพร้อมกับตอนหมดอายุพอดี)
+		if typingTimers[key] != timer {
+			typingMu.Unlock()
+			return
+		}
+		delete(typingTimers, key)
+		typingMu.Unlock()
+
+		expired := ev
+		expired.State = typingStop
+		relayTyping(tenant, expired)
+	})
+	typingTimers[key] = timer
+	return true
+}
+
+// ยกเลิกสถานะพิมพ์ คืนค่า true ถ้ากำลังพิมพ์อยู่ (ต้องแจ้งปลายทาง)
+func stopTyping(tenant string, ev TypingEvent) bool {
+	key := typingKey(tenant, ev)
+	typingMu.Lock()
+	defer typingMu.Unlock()
+
+	timer, ok := typingTimers[key]
+	if !ok {
+		return false
+	}
+	timer.Stop()
+	delete(typingTimers, key)
+	return true
+}
+
+// ส่ง typing ให้ผู้รับ หรือสมาชิกทุกคนในห้องยกเว้นผู้พิมพ์ (ใครออฟไลน์ก็ไม่ได้รับ)
+func relayTyping(tenant string, ev TypingEvent) {
+	if ev.RoomID == 0 {
+		sendToUser(tenant, ev.ReceiverID, frameTypeTyping, ev)
+		return
+	}
+	members, err := getRoomMembers(tenant, ev.RoomID)
+	if err != nil {
+		slog.Error("loading room members for typing", "tenant", tenant, "room_id", ev.RoomID, "err", err)
+		return
+	}
+	for _, userID := range members {
+		if userID != ev.SenderID {
+			sendToUser(tenant, userID, frameTypeTyping, ev)
+		}
+	}
+}
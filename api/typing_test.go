@@ -0,0 +1,69 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTypingRelaysStartOnceAndExpires(t *testing.T) {
+	typingTTL = 200 * time.Millisecond
+	defer func() { typingTTL = 5 * time.Second }()
+
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	aliceConn := dialWS(t, alice)
+	bobConn := dialWS(t, bob)
+
+	// typing ซ้ำระหว่างพิมพ์อยู่ต้องไม่ถูกส่งต่อซ้ำ
+	aliceConn.WriteJSON(map[string]any{"type": "typing", "receiver_id": bob})
+	aliceConn.WriteJSON(map[string]any{"type": "typing", "receiver_id": bob})
+
+	var ev TypingEvent
+	readJSON(t, bobConn, &ev)
+	if ev.Type != frameTypeTyping || ev.SenderID != alice || ev.State != typingStart {
+		t.Fatalf("unexpected typing event: %+v", ev)
+	}
+	// ไม่ส่ง typing ต่อ สถานะต้องหมดอายุเองเป็น stop
+	readJSON(t, bobConn, &ev)
+	if ev.State != typingStop || ev.SenderID != alice {
+		t.Fatalf("expected expiry stop, got %+v", ev)
+	}
+
+	// stop ที่ส่งมาเองแจ้งทันที และไม่มีอะไรถูกบันทึกลง DB
+	aliceConn.WriteJSON(map[string]any{"type": "typing", "receiver_id": bob})
+	readJSON(t, bobConn, &ev)
+	aliceConn.WriteJSON(map[string]any{"type": "typing", "receiver_id": bob, "state": "stop"})
+	readJSON(t, bobConn, &ev)
+	if ev.State != typingStop {
+		t.Fatalf("expected stop, got %+v", ev)
+	}
+	if n := countStored(t, alice, bob, false); n != 0 {
+		t.Fatalf("typing must not be persisted, got %d rows", n)
+	}
+}
+
+func TestTypingInRoomRequiresMembership(t *testing.T) {
+	alice, bob, mallory := newTestUser("alice"), newTestUser("bob"), newTestUser("mallory")
+	room, err := createRoom(DefaultTenant, "team", alice, []string{bob})
+	if err != nil {
+		t.Fatalf("createRoom: %v", err)
+	}
+	bobConn := dialWS(t, bob)
+	aliceConn := dialWS(t, alice)
+	malloryConn := dialWS(t, mallory)
+
+	malloryConn.WriteJSON(map[string]any{"type": "typing", "room_id": room.ID})
+	var errFrame ErrorFrame
+	readJSON(t, malloryConn, &errFrame)
+	if errFrame.Code != errCodeForbidden {
+		t.Fatalf("expected forbidden, got %+v", errFrame)
+	}
+
+	aliceConn.WriteJSON(map[string]any{"type": "typing", "room_id": room.ID})
+	var ev TypingEvent
+	readJSON(t, bobConn, &ev)
+	if ev.RoomID != room.ID || ev.SenderID != alice || ev.State != typingStart {
+		t.Fatalf("unexpected room typing event: %+v", ev)
+	}
+	aliceConn.WriteJSON(map[string]any{"type": "typing", "room_id": room.ID, "state": "stop"})
+	readJSON(t, bobConn, &ev)
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ข้อความไม่ผ่านการตรวจ ระบุ field ให้ client ชี้จุดที่ผิดได้
+type validationError struct {
+	Field  string
+	Reason string
+}
+
+func (e *validationError) Error() string {
+	return e.Field + ": " + e.Reason
+}
+
+func invalidField(field, reason string) *validationError {
+	return &validationError{Field: field, Reason: reason}
+}
+
+// ตรวจ field ของข้อความแชทที่ client ส่งมา (WebSocket และ POST /send) ก่อนถึง DB
+// ตรวจเฉพาะรูปแบบ ส่วนสิทธิ์ (ห้อง, block, ไฟล์แนบ) ตรวจแยกทีหลัง
+func validateMessage(msg Message) *validationError {
+	if msg.SenderID == "" {
+		return invalidField("sender_id", "is required")
+	}
+	if msg.ReceiverID == "" && msg.RoomID == 0 {
+		return invalidField("receiver_id", "receiver_id or room_id is required")
+	}
+	if strings.TrimSpace(msg.Text) == "" && msg.AttachmentID == "" {
+		return invalidField("text", "text or attachment_id is required")
+	}
+	if !utf8.ValidString(msg.Text) {
+		return invalidField("text", "must be valid UTF-8")
+	}
+	if config.MaxTextLength > 0 && utf8.RuneCountInString(msg.Text) > config.MaxTextLength {
+		return invalidField("text", fmt.Sprintf("exceeds %d characters", config.MaxTextLength))
+	}
+	if len(msg.Mentions) > maxMentions {
+		return invalidField("mentions", fmt.Sprintf("too many mentions (max %d)", maxMentions))
+	}
+	if err := validateClientMsgID(msg.ClientMsgID); err != nil {
+		return invalidField("client_msg_id", err.Error())
+	}
+	if err := validateMetadata(msg.Metadata); err != nil {
+		return invalidField("metadata", err.Error())
+	}
+	return nil
+}
+
+// error frame ของข้อความที่ไม่ผ่านการตรวจ
+func (e *validationError) frame() ErrorFrame {
+	return ErrorFrame{Type: frameTypeError, Code: errCodeInvalidRequest, Detail: e.Error(), Field: e.Field}
+}
+
+// Error ของข้อความที่ไม่ผ่านการตรวจ (details.field = field ที่ผิด)
+func (e *validationError) apiError() *Error {
+	apiErr := InvalidRequest(e.Error())
+	apiErr.Details = fiber.Map{"field": e.Field}
+	return apiErr
+}
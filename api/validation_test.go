@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestInvalidMessageGetsValidationError(t *testing.T) {
+	prev := config.MaxTextLength
+	config.MaxTextLength = 10
+	defer func() { config.MaxTextLength = prev }()
+
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	conn := dialWS(t, alice)
+
+	cases := []struct {
+		msg   Message
+		field string
+	}{
+		{Message{SenderID: alice, Text: "hi"}, "receiver_id"},
+		{Message{SenderID: alice, ReceiverID: bob, Text: "   "}, "text"},
+		{Message{SenderID: alice, ReceiverID: bob, Text: "สวัสดีครับทุกคน"}, "text"},
+		// mention เกินกำหนดถูกปฏิเสธเหมือน REST ไม่ใช่ตัดทิ้งเงียบๆ
+		{Message{SenderID: alice, ReceiverID: bob, Text: "hi", Mentions: make([]string, maxMentions+1)}, "mentions"},
+	}
+	for _, tc := range cases {
+		if err := conn.WriteJSON(tc.msg); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		var frame ErrorFrame
+		readJSON(t, conn, &frame)
+		if frame.Type != frameTypeError || frame.Code != errCodeInvalidRequest || frame.Field != tc.field {
+			t.Fatalf("expected invalid_request on %s, got %+v", tc.field, frame)
+		}
+	}
+	if n := countStored(t, alice, bob, false); n != 0 {
+		t.Fatalf("invalid messages must not be stored, found %d", n)
+	}
+
+	// 10 ตัวอักษรพอดี (ไทย 1 ตัวอักษรใช้ 3 byte) ยังส่งได้
+	if err := conn.WriteJSON(Message{SenderID: alice, ReceiverID: bob, Text: "สวัสดีครับ"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	waitFor(t, func() bool { return countStored(t, alice, bob, false) == 1 })
+}
+
+func TestSendRejectsInvalidMessageWithField(t *testing.T) {
+	alice := newTestUser("alice")
+	resp, err := http.Post("http://"+testAddr+"/send", "application/json", strings.NewReader(`{"sender_id":"`+alice+`","text":"hi"}`))
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var apiErr struct {
+		Code    string            `json:"code"`
+		Details map[string]string `json:"details"`
+	}
+	json.NewDecoder(resp.Body).Decode(&apiErr)
+	if resp.StatusCode != http.StatusBadRequest || apiErr.Code != errCodeInvalidRequest || apiErr.Details["field"] != "receiver_id" {
+		t.Fatalf("expected 400 invalid_request on receiver_id, got %d %+v", resp.StatusCode, apiErr)
+	}
+}
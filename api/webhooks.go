@@ -0,0 +1,166 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ชนิด event ที่ส่งออกทาง webhook
+const (
+	webhookMessageSent          = "message.sent"           // ส่งถึงผู้รับที่เชื่อมต่ออยู่ (instance นี้หรือ instance อื่น)
+	webhookMessageStoredOffline = "message.stored_offline" // ผู้รับออฟไลน์ เก็บไว้ใน DB
+	webhookUserConnected        = "user.connected"
+	webhookUserDisconnected     = "user.disconnected"
+)
+
+// label outcome ของ chat_webhook_deliveries_total
+const (
+	webhookOutcomeDelivered = "delivered"
+	webhookOutcomeFailed    = "failed"  // ลองครบแล้วยังไม่สำเร็จ หรือ URL ตอบ 4xx
+	webhookOutcomeDropped   = "dropped" // คิวเต็ม
+)
+
+var webhookEventTypes = []string{webhookMessageSent, webhookMessageStoredOffline, webhookUserConnected, webhookUserDisconnected}
+
+// header ที่แนบไปกับทุก request ผู้รับตรวจลายเซ็นได้จาก HMAC-SHA256(secret, timestamp + "." + body)
+const (
+	headerWebhookEvent     = "X-Chat-Event"
+	headerWebhookDelivery  = "X-Chat-Delivery"
+	headerWebhookTimestamp = "X-Chat-Timestamp"
+	headerWebhookSignature = "X-Chat-Signature"
+)
+
+// body ที่ POST ไปยัง webhook
+type WebhookEvent struct {
+	ID        string    `json:"id"` // ใช้กันประมวลผลซ้ำเมื่อมีการส่งซ้ำ (retry)
+	Type      string    `json:"type"`
+	TenantID  string    `json:"tenant_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// data ของ user.connected / user.disconnected
+type WebhookConnection struct {
+	UserID    string `json:"user_id"`
+	SessionID string `json:"session_id,omitempty"`
+	ConnID    string `json:"conn_id"`
+	Reason    string `json:"reason,omitempty"` // เหตุผลที่ตัดการเชื่อมต่อ
+}
+
+// คิวของ webhook กับชนิด event ที่เปิดไว้ อ่านพร้อมกันจาก goroutine ที่ส่งข้อความ จึงสลับทั้งชุดผ่าน atomic
+type webhookDispatch struct {
+	queue  chan WebhookEvent
+	events []string // ว่าง = ทุก event
+}
+
+var webhooks atomic.Pointer[webhookDispatch] // nil = ไม่ได้เปิด webhook
+
+// เปิด worker ส่ง webhook ถ้าตั้ง URL ไว้
+func startWebhooks() {
+	if len(config.WebhookURLs) == 0 {
+		return
+	}
+	d := &webhookDispatch{queue: make(chan WebhookEvent, config.WebhookQueueSize), events: config.WebhookEvents}
+	webhooks.Store(d)
+	client := &http.Client{Timeout: config.WebhookTimeout}
+	for i := 0; i < config.WebhookConcurrency; i++ {
+		go func() {
+			for event := range d.queue {
+				deliverWebhookEvent(client, event)
+			}
+		}()
+	}
+	slog.Info("webhooks enabled", "urls", len(config.WebhookURLs), "events", config.WebhookEvents)
+}
+
+// ส่ง event แบบ async ไม่ block ผู้เรียก ถ้าคิวเต็มจะทิ้ง event
+func emitWebhook(tenant, eventType string, data any) {
+	d := webhooks.Load()
+	if d == nil {
+		return
+	}
+	if len(d.events) > 0 && !slices.Contains(d.events, eventType) {
+		return
+	}
+	event := WebhookEvent{ID: uuid.NewString(), Type: eventType, TenantID: tenantOrDefault(tenant), CreatedAt: time.Now().UTC(), Data: data}
+	select {
+	case d.queue <- event:
+	default:
+		webhookDeliveriesTotal.WithLabelValues(eventType, webhookOutcomeDropped).Inc()
+		slog.Warn("webhook queue full, dropped event", "event", eventType, "tenant", event.TenantID)
+	}
+}
+
+// ลายเซ็นของ body ในรูปแบบ "sha256=<hex>"
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ส่ง event ไปทุก URL ที่ตั้งไว้
+func deliverWebhookEvent(client *http.Client, event WebhookEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("marshalling webhook event", "event", event.Type, "err", err)
+		return
+	}
+	for _, url := range config.WebhookURLs {
+		postWebhookWithRetry(client, url, config.WebhookSecret, event, body)
+	}
+}
+
+// POST ไปยัง url ลองใหม่เมื่อ network error, 429 หรือ 5xx (backoff เพิ่มเท่าตัวทุกรอบ) คืนค่า true ถ้าสำเร็จ
+func postWebhookWithRetry(client *http.Client, url, secret string, event WebhookEvent, body []byte) bool {
+	backoff := config.WebhookRetryBackoff
+	for attempt := 0; ; attempt++ {
+		status, err := postWebhook(client, url, secret, event, body)
+		if err == nil && status < 300 {
+			webhookDeliveriesTotal.WithLabelValues(event.Type, webhookOutcomeDelivered).Inc()
+			return true
+		}
+		retryable := err != nil || status == http.StatusTooManyRequests || status >= 500
+		if !retryable || attempt >= config.WebhookMaxRetries {
+			slog.Warn("webhook delivery failed", "event", event.Type, "delivery_id", event.ID, "url", url, "status", status, "err", err, "attempts", attempt+1)
+			webhookDeliveriesTotal.WithLabelValues(event.Type, webhookOutcomeFailed).Inc()
+			return false
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// POST หนึ่งครั้ง timestamp ใหม่ทุกครั้งที่ลองส่ง (ผู้รับใช้ปฏิเสธ request ที่เก่าเกินไป) secret ว่าง = ไม่เซ็น
+func postWebhook(client *http.Client, url, secret string, event WebhookEvent, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(headerWebhookEvent, event.Type)
+	req.Header.Set(headerWebhookDelivery, event.ID)
+	req.Header.Set(headerWebhookTimestamp, strconv.FormatInt(timestamp, 10))
+	if secret != "" {
+		req.Header.Set(headerWebhookSignature, signWebhook(secret, timestamp, body))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookIsSignedAndRetried(t *testing.T) {
+	// คืนค่าเฉพาะ field ของ webhook: การคัดลอกทั้ง config ทับจะชนกับ goroutine ของ server ที่อ่าน config อยู่
+	prevURLs, prevSecret, prevBackoff, prevRetries := config.WebhookURLs, config.WebhookSecret, config.WebhookRetryBackoff, config.WebhookMaxRetries
+	defer func() {
+		config.WebhookURLs, config.WebhookSecret, config.WebhookRetryBackoff, config.WebhookMaxRetries = prevURLs, prevSecret, prevBackoff, prevRetries
+	}()
+	config.WebhookSecret = "s3cret"
+	config.WebhookRetryBackoff = time.Millisecond
+	config.WebhookMaxRetries = 2
+
+	var attempts atomic.Int32
+	verified := make(chan bool, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(headerWebhookTimestamp), 10, 64)
+		verified <- r.Header.Get(headerWebhookSignature) == signWebhook("s3cret", timestamp, body) &&
+			r.Header.Get(headerWebhookEvent) == webhookUserConnected
+	}))
+	defer server.Close()
+	config.WebhookURLs = []string{server.URL}
+
+	deliverWebhookEvent(server.Client(), WebhookEvent{ID: "evt-1", Type: webhookUserConnected, TenantID: DefaultTenant, Data: WebhookConnection{UserID: "alice"}})
+	if attempts.Load() != 2 {
+		t.Fatalf("expected 2 attempts, got %d", attempts.Load())
+	}
+	if !<-verified {
+		t.Fatal("signature or event header mismatch")
+	}
+}
+
+// เปิด webhook เฉพาะ event ที่ระบุระหว่าง test คืนคิวไว้อ่าน event ที่ถูกส่งออก (ไม่มี worker ส่งจริง)
+func captureWebhooks(t *testing.T, events ...string) chan WebhookEvent {
+	t.Helper()
+	queue := make(chan WebhookEvent, 10)
+	webhooks.Store(&webhookDispatch{queue: queue, events: events})
+	t.Cleanup(func() { webhooks.Store(nil) })
+	return queue
+}
+
+func TestWebhookEventForOfflineMessage(t *testing.T) {
+	webhookQueue := captureWebhooks(t, webhookMessageStoredOffline)
+
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	resp, err := http.Post("http://"+testAddr+"/send", "application/json", strings.NewReader(`{"sender_id":"`+alice+`","receiver_id":"`+bob+`","text":"hi"}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	resp.Body.Close()
+
+	select {
+	case event := <-webhookQueue:
+		data, _ := json.Marshal(event.Data)
+		var msg Message
+		json.Unmarshal(data, &msg)
+		if event.Type != webhookMessageStoredOffline || event.ID == "" || msg.ReceiverID != bob {
+			t.Fatalf("unexpected event: %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected message.stored_offline event")
+	}
+}
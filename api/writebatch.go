@@ -0,0 +1,146 @@
+package api
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// การบันทึกข้อความแบบ group commit: writer ตัวเดียวรวมคำขอจากหลาย lane/handler เป็น transaction เดียว
+// ผู้เรียกยังรอจนบันทึกเสร็จและได้ ID เหมือนเดิม แต่ภายใต้โหลดสูงจำนวน transaction ลดลงตามขนาด batch
+
+// คำขอบันทึกข้อความหนึ่งชุด (เช่น ข้อความเดียว หรือทุกสำเนาของข้อความห้อง)
+type writeRequest struct {
+	msgs []Message
+	done chan writeResult
+}
+
+type writeResult struct {
+	stored []storedMessage
+	err    error
+}
+
+var (
+	writerMu   sync.RWMutex
+	writeQueue chan writeRequest // nil = ไม่ได้เปิด writer หรือหยุดแล้ว บันทึกตรงทีละชุด
+	writerDone chan struct{}
+)
+
+// เปิด writer ถ้า DBWriteBatchSize > 1
+func startMessageWriter() {
+	if config.DBWriteBatchSize <= 1 {
+		return
+	}
+	writerMu.Lock()
+	defer writerMu.Unlock()
+	writeQueue = make(chan writeRequest, config.DBWriteBatchSize)
+	writerDone = make(chan struct{})
+	go runMessageWriter(writeQueue, writerDone)
+}
+
+// หยุดรับคำขอใหม่และรอให้คำขอที่ค้างอยู่ถูก flush ครบ (เรียกตอน shutdown ก่อนปิด DB)
+// คำขอหลังจากนี้บันทึกตรงโดยไม่ผ่าน batch
+func stopMessageWriter() {
+	writerMu.Lock()
+	queue, done := writeQueue, writerDone
+	writeQueue = nil
+	writerMu.Unlock()
+	if queue == nil {
+		return
+	}
+	close(queue)
+	<-done
+}
+
+// บันทึกข้อความผ่าน writer (หรือบันทึกตรงถ้าไม่ได้เปิด) คืนผลตามลำดับของ msgs
+func writeMessages(msgs []Message) ([]storedMessage, error) {
+	writerMu.RLock()
+	if writeQueue == nil {
+		writerMu.RUnlock()
+		return saveNow(msgs)
+	}
+	req := writeRequest{msgs: msgs, done: make(chan writeResult, 1)}
+	writeQueue <- req
+	writerMu.RUnlock()
+
+	res := <-req.done
+	return res.stored, res.err
+}
+
+func saveNow(msgs []Message) ([]storedMessage, error) {
+	var stored []storedMessage
+	err := retryOnBusy("saving messages", func() error {
+		var err error
+		stored, err = messageStore.Save(msgs)
+		return err
+	})
+	return stored, err
+}
+
+// รวมคำขอจนได้ DBWriteBatchSize ข้อความหรือครบ DBWriteBatchWait นับจากคำขอแรก แล้ว flush
+func runMessageWriter(queue <-chan writeRequest, done chan<- struct{}) {
+	defer close(done)
+	for req := range queue {
+		batch, size := []writeRequest{req}, len(req.msgs)
+		deadline := time.After(config.DBWriteBatchWait)
+		for size < config.DBWriteBatchSize {
+			next, ok := nextWrite(queue, deadline)
+			if !ok {
+				break
+			}
+			batch = append(batch, next)
+			size += len(next.msgs)
+		}
+		flushWrites(batch, size)
+	}
+}
+
+// คำขอถัดไปที่มาก่อน deadline (DBWriteBatchWait 0 = เฉพาะคำขอที่รออยู่แล้ว)
+func nextWrite(queue <-chan writeRequest, deadline <-chan time.Time) (writeRequest, bool) {
+	if config.DBWriteBatchWait <= 0 {
+		select {
+		case req, ok := <-queue:
+			return req, ok
+		default:
+			return writeRequest{}, false
+		}
+	}
+	select {
+	case req, ok := <-queue:
+		return req, ok
+	case <-deadline:
+		return writeRequest{}, false
+	}
+}
+
+func flushWrites(batch []writeRequest, size int) {
+	if len(batch) == 1 {
+		stored, err := saveNow(batch[0].msgs)
+		batch[0].done <- writeResult{stored, err}
+		dbWriteBatchSize.Observe(float64(size))
+		return
+	}
+
+	msgs := make([]Message, 0, size)
+	for _, req := range batch {
+		msgs = append(msgs, req.msgs...)
+	}
+	stored, err := saveNow(msgs)
+	if err != nil {
+		// ข้อความที่มีปัญหาไม่ควรทำให้คำขออื่นใน batch ล้มเหลวไปด้วย บันทึกแยกทีละคำขอ
+		slog.Warn("batched insert failed, retrying requests one by one", "requests", len(batch), "messages", size, "err", err)
+		for _, req := range batch {
+			stored, err := saveNow(req.msgs)
+			req.done <- writeResult{stored, err}
+			dbWriteBatchSize.Observe(float64(len(req.msgs)))
+		}
+		return
+	}
+	dbWriteBatchSize.Observe(float64(size))
+
+	offset := 0
+	for _, req := range batch {
+		req.done <- writeResult{stored: stored[offset : offset+len(req.msgs)]}
+		offset += len(req.msgs)
+	}
+}
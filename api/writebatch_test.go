@@ -0,0 +1,67 @@
+package api
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrentSavesShareBatchesAndKeepTheirIDs(t *testing.T) {
+	prev := config.DBWriteBatchWait
+	config.DBWriteBatchWait = 20 * time.Millisecond
+	defer func() { config.DBWriteBatchWait = prev }()
+
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	const n = 20
+	ids := make([]int64, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			stored, err := saveMessagesToDB([]Message{{SenderID: alice, ReceiverID: bob, Text: strconv.Itoa(i)}})
+			if err != nil {
+				t.Errorf("save %d: %v", i, err)
+				return
+			}
+			ids[i] = stored[0].ID
+		}(i)
+	}
+	wg.Wait()
+
+	for i, id := range ids {
+		var text string
+		var keyVersion int
+		if err := db.QueryRow("SELECT text, text_key_version FROM messages WHERE id = ?", id).Scan(&text, &keyVersion); err != nil {
+			t.Fatalf("message %d: %v", id, err)
+		}
+		if text, _ = openText(text, keyVersion); text != strconv.Itoa(i) {
+			t.Fatalf("id %d returned to request %d holds %q", id, i, text)
+		}
+	}
+}
+
+func TestStopMessageWriterFlushesPending(t *testing.T) {
+	prev := config.DBWriteBatchWait
+	config.DBWriteBatchWait = time.Second
+	defer func() { config.DBWriteBatchWait = prev }()
+
+	alice, bob := newTestUser("alice"), newTestUser("bob")
+	saved := make(chan error, 1)
+	go func() {
+		_, err := saveMessagesToDB([]Message{{SenderID: alice, ReceiverID: bob, Text: "last words"}})
+		saved <- err
+	}()
+	// ให้คำขออยู่ใน batch ที่ writer กำลังรอเติมก่อนหยุด
+	time.Sleep(50 * time.Millisecond)
+
+	stopMessageWriter()
+	defer startMessageWriter()
+	if n := countStored(t, alice, bob, false); n != 1 {
+		t.Fatalf("expected pending write to be flushed on stop, got %d rows", n)
+	}
+	if err := <-saved; err != nil {
+		t.Fatalf("save: %v", err)
+	}
+}
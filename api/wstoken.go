@@ -0,0 +1,154 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	errTokenInvalid = errors.New("invalid ws token")
+	errTokenExpired = errors.New("ws token expired")
+	errTokenUsed    = errors.New("ws token already used or unknown")
+)
+
+// token ที่ออกไปแล้วแต่ยังไม่ถูกใช้ (nonce -> เวลาหมดอายุ)
+var issuedWSTokens sync.Map
+
+// secret ที่ใช้เซ็น token ถ้าไม่ได้ตั้งค่าไว้จะสุ่มใหม่ตอนเริ่ม server
+var (
+	wsTokenSecretOnce sync.Once
+	wsTokenSecret     []byte
+)
+
+func getWSTokenSecret() []byte {
+	wsTokenSecretOnce.Do(func() {
+		if config.WSTokenSecret != "" {
+			wsTokenSecret = []byte(config.WSTokenSecret)
+			return
+		}
+		wsTokenSecret = make([]byte, 32)
+		if _, err := rand.Read(wsTokenSecret); err != nil {
+			panic(err)
+		}
+	})
+	return wsTokenSecret
+}
+
+// ออก token แบบใช้ครั้งเดียวสำหรับ userID ของ tenant
+// รูปแบบ: base64url(tenant|userID|expiry|nonce).hex(hmac)
+func issueWSToken(tenant, userID string, now time.Time) (string, time.Time) {
+	nonceBytes := make([]byte, 16)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		panic(err)
+	}
+	nonce := hex.EncodeToString(nonceBytes)
+	expiresAt := now.Add(config.WSTokenTTL)
+
+	payload := base64.RawURLEncoding.EncodeToString([]byte(tenant + "|" + userID + "|" + strconv.FormatInt(expiresAt.Unix(), 10) + "|" + nonce))
+	issuedWSTokens.Store(nonce, expiresAt)
+	return payload + "." + signWSToken(payload), expiresAt
+}
+
+func signWSToken(payload string) string {
+	mac := hmac.New(sha256.New, getWSTokenSecret())
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ตรวจสอบ token และใช้ทิ้งทันที (ใช้ซ้ำไม่ได้) คืนค่า tenant และ userID ที่ผูกกับ token
+func consumeWSToken(token string, now time.Time) (string, string, error) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(signWSToken(payload))) {
+		return "", "", errTokenInvalid
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", "", errTokenInvalid
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 4 {
+		return "", "", errTokenInvalid
+	}
+	tenant, userID, nonce := parts[0], parts[1], parts[3]
+	expiry, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return "", "", errTokenInvalid
+	}
+
+	// ลบออกจาก map ก่อนตรวจเวลา เพื่อให้ใช้ได้ครั้งเดียวแม้จะหมดอายุแล้ว
+	if _, exists := issuedWSTokens.LoadAndDelete(nonce); !exists {
+		return "", "", errTokenUsed
+	}
+	if now.After(time.Unix(expiry, 0)) {
+		return "", "", errTokenExpired
+	}
+	return tenant, userID, nil
+}
+
+// ลบ token ที่หมดอายุแล้วแต่ไม่ถูกใช้ ออกจาก map เป็นระยะ
+func startWSTokenSweeper() {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			issuedWSTokens.Range(func(key, value any) bool {
+				if now.After(value.(time.Time)) {
+					issuedWSTokens.Delete(key)
+				}
+				return true
+			})
+		}
+	}()
+}
+
+// POST /auth/ws-token  (Authorization: Bearer <issuer key>, body {"user_id": ...})
+// ให้ backend ที่ยืนยันตัวตนผู้ใช้แล้วขอ token ไปให้ browser ใช้เชื่อมต่อ WebSocket
+func handleIssueWSToken(c *fiber.Ctx) error {
+	if config.WSTokenIssuerKey == "" {
+		return Forbidden("WebSocket token issuing disabled")
+	}
+	key := strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(key), []byte(config.WSTokenIssuerKey)) != 1 {
+		return NewError(fiber.StatusUnauthorized, errCodeUnauthorized, "Invalid credentials")
+	}
+
+	var req struct {
+		UserID string `json:"user_id"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.UserID == "" || strings.Contains(req.UserID, "|") {
+		return InvalidRequest("user_id is required")
+	}
+
+	token, expiresAt := issueWSToken(TenantOf(c), req.UserID, time.Now())
+	return c.JSON(fiber.Map{"token": token, "expires_at": expiresAt.UTC()})
+}
+
+// middleware ตรวจ ?token= ก่อน upgrade WebSocket (เมื่อเปิด RequireWSToken, bot ใช้ API key แทน)
+func checkWSToken(c *fiber.Ctx) error {
+	if !config.RequireWSToken || isBot(c) {
+		return c.Next()
+	}
+
+	tenant, userID, err := consumeWSToken(c.Query("token"), time.Now())
+	if err != nil {
+		slog.Info("rejected WebSocket token", "request_id", requestIDOf(c), "user_id", c.Params("userID"), "err", err)
+		return NewError(fiber.StatusUnauthorized, errCodeUnauthorized, err.Error())
+	}
+	if tenant != TenantOf(c) || userID != c.Params("userID") {
+		return Forbidden("Token does not match user")
+	}
+	return c.Next()
+}
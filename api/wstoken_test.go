@@ -0,0 +1,70 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	fws "github.com/fasthttp/websocket"
+)
+
+func TestWSTokenIsSingleUse(t *testing.T) {
+	now := time.Now()
+	token, _ := issueWSToken(DefaultTenant, "alice", now)
+
+	tenant, userID, err := consumeWSToken(token, now)
+	if err != nil || tenant != DefaultTenant || userID != "alice" {
+		t.Fatalf("expected public/alice, got %q/%q (%v)", tenant, userID, err)
+	}
+	if _, _, err := consumeWSToken(token, now); !errors.Is(err, errTokenUsed) {
+		t.Fatalf("expected reuse to fail with errTokenUsed, got %v", err)
+	}
+}
+
+func TestWSTokenExpires(t *testing.T) {
+	now := time.Now()
+	token, _ := issueWSToken(DefaultTenant, "alice", now)
+
+	if _, _, err := consumeWSToken(token, now.Add(config.WSTokenTTL+time.Second)); !errors.Is(err, errTokenExpired) {
+		t.Fatalf("expected errTokenExpired, got %v", err)
+	}
+}
+
+func TestWSTokenRejectsTampering(t *testing.T) {
+	token, _ := issueWSToken(DefaultTenant, "alice", time.Now())
+	payload, sig, _ := strings.Cut(token, ".")
+
+	if _, _, err := consumeWSToken(payload+"x."+sig, time.Now()); !errors.Is(err, errTokenInvalid) {
+		t.Fatalf("expected errTokenInvalid, got %v", err)
+	}
+}
+
+func TestWebSocketUpgradeRequiresToken(t *testing.T) {
+	config.RequireWSToken = true
+	defer func() { config.RequireWSToken = false }()
+
+	bob := newTestUser("bob")
+	url := "ws://" + testAddr + "/ws/chat/" + bob
+
+	if _, resp, err := fws.DefaultDialer.Dial(url, nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %v", resp)
+	}
+
+	token, _ := issueWSToken(DefaultTenant, bob, time.Now())
+	conn, _, err := fws.DefaultDialer.Dial(url+"?token="+token, nil)
+	if err != nil {
+		t.Fatalf("dial with token: %v", err)
+	}
+	conn.Close()
+
+	if _, resp, err := fws.DefaultDialer.Dial(url+"?token="+token, nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected replayed token to be rejected, got %v", resp)
+	}
+
+	other, _ := issueWSToken(DefaultTenant, newTestUser("mallory"), time.Now())
+	if _, resp, err := fws.DefaultDialer.Dial(url+"?token="+other, nil); err == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected token for another user to be rejected, got %v", resp)
+	}
+}
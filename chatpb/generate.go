@@ -0,0 +1,4 @@
+// Package chatpb คือ type และ stub ของ gRPC ChatService ที่ generate จาก chat.proto
+package chatpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative chat.proto
@@ -0,0 +1,462 @@
+// Package client คือ Go SDK สำหรับคุยกับ chat server ผ่าน WebSocket (protocol v2)
+// จัดการ dial, token, reconnect แบบ backoff, ack ของข้อความที่ส่ง และดึงประวัติทาง REST
+//
+//	c, err := client.Dial(ctx, client.Options{URL: "http://localhost:3000", UserID: "alice"})
+//	ack, err := c.Send(ctx, protocol.Message{ReceiverID: "bob", Text: "hi"})
+//	for msg := range c.Messages() { ... }
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/google/uuid"
+
+	"go-socket/protocol"
+)
+
+// Client ถูกปิดแล้ว (เรียก Close หรือ server ปิดแบบที่ไม่ควร reconnect)
+var ErrClosed = errors.New("client closed")
+
+type Options struct {
+	URL       string // base URL ของ server เช่น "http://localhost:3000" (แปลงเป็น ws/wss ให้เอง)
+	UserID    string
+	Token     string // JWT ส่งเป็น Authorization: Bearer (ไม่ระบุ = server ไม่ได้เปิด RequireJWT)
+	SessionID string // ไม่ระบุ = สุ่มใหม่ ใช้ค่าเดิมทุกครั้งที่ reconnect
+
+	// ยืนยันตัวตนด้วย hello frame บน /ws/chat แทนการระบุผู้ใช้ใน path (ต้องมี Token)
+	// จำเป็นเมื่อ server เปิด RequireHandshake
+	Handshake     bool
+	ClientVersion string // ส่งไปกับ hello ใช้ใน log ของ server
+
+	MinBackoff time.Duration // default 500ms
+	MaxBackoff time.Duration // default 30s
+	BufferSize int           // ขนาดของ channel Messages/Events (default 256)
+
+	HTTPClient *http.Client // สำหรับ History (default http.DefaultClient)
+}
+
+// frame อื่นที่ไม่ใช่ข้อความแชทหรือ ack (receipt, typing, presence, error, ...)
+type Event struct {
+	Type string
+	Data json.RawMessage
+}
+
+// decode frame เป็นชนิดใน package protocol ตาม Type
+func (e Event) Decode(v any) error {
+	return json.Unmarshal(e.Data, v)
+}
+
+// ข้อความที่ส่งแล้วยังไม่ได้ ack (ส่งซ้ำตอน reconnect ด้วย client_msg_id เดิม server จึงไม่บันทึกซ้ำ)
+type pendingSend struct {
+	frame []byte
+	ack   chan protocol.Ack
+}
+
+type Client struct {
+	opts     Options
+	messages chan protocol.Message
+	events   chan Event
+
+	mu      sync.Mutex
+	conn    *websocket.Conn // nil = กำลัง reconnect
+	pending map[string]*pendingSend
+	err     error // เหตุผลที่หยุด
+
+	writeMu sync.Mutex
+	lastID  int64 // ID สูงสุดที่ได้รับ ใช้เป็น ?since= ตอน reconnect (ใช้เฉพาะใน run loop)
+
+	closing   chan struct{}
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// เชื่อมต่อครั้งแรก (error ของ URL/token คืนทันที) แล้ว reconnect เองในเบื้องหลังเมื่อหลุด
+func Dial(ctx context.Context, opts Options) (*Client, error) {
+	if opts.URL == "" || opts.UserID == "" {
+		return nil, errors.New("client: URL and UserID are required")
+	}
+	if opts.Handshake && opts.Token == "" {
+		return nil, errors.New("client: Handshake requires a Token")
+	}
+	if opts.SessionID == "" {
+		opts.SessionID = uuid.NewString()
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = 500 * time.Millisecond
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = max(30*time.Second, opts.MinBackoff)
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 256
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+
+	c := &Client{
+		opts:     opts,
+		messages: make(chan protocol.Message, opts.BufferSize),
+		events:   make(chan Event, opts.BufferSize),
+		pending:  make(map[string]*pendingSend),
+		closing:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	go c.run(conn)
+	return c, nil
+}
+
+// ข้อความแชทที่ได้รับ ถูกปิดเมื่อ client หยุด
+// ต้องอ่านอยู่ตลอด: ถ้า channel เต็ม การอ่าน frame (รวมถึง ack) จะรอจนมีที่ว่าง
+func (c *Client) Messages() <-chan protocol.Message {
+	return c.messages
+}
+
+// frame อื่นๆ ที่ได้รับ ถ้า channel เต็มจะถูกทิ้ง ถูกปิดเมื่อ client หยุด
+func (c *Client) Events() <-chan Event {
+	return c.events
+}
+
+// ผู้ใช้ของ client นี้
+func (c *Client) UserID() string {
+	return c.opts.UserID
+}
+
+// เหตุผลที่ client หยุด (nil = ยังทำงานอยู่)
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// ปิด connection และหยุด reconnect Send ที่ยังรอ ack อยู่ได้ ErrClosed
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closing)
+		c.mu.Lock()
+		conn := c.conn
+		c.mu.Unlock()
+		if conn != nil {
+			c.writeMu.Lock()
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+			c.writeMu.Unlock()
+			conn.Close()
+		}
+	})
+	<-c.done
+	return nil
+}
+
+// ส่งข้อความแล้วรอ ack (SenderID และ ClientMsgID เติมให้ถ้าไม่ระบุ)
+// ถ้าหลุดระหว่างรอ ข้อความจะถูกส่งซ้ำหลัง reconnect ด้วย client_msg_id เดิม
+// ข้อความที่ server ปฏิเสธ (เช่น blocked) ไม่มี ack ผู้เรียกควรตั้ง timeout ใน ctx และดู error frame จาก Events
+func (c *Client) Send(ctx context.Context, msg protocol.Message) (protocol.Ack, error) {
+	if msg.SenderID == "" {
+		msg.SenderID = c.opts.UserID
+	}
+	if msg.ClientMsgID == "" {
+		msg.ClientMsgID = uuid.NewString()
+	}
+	frame, err := json.Marshal(msg)
+	if err != nil {
+		return protocol.Ack{}, err
+	}
+	p := &pendingSend{frame: frame, ack: make(chan protocol.Ack, 1)}
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return protocol.Ack{}, ErrClosed
+	}
+	c.pending[msg.ClientMsgID] = p
+	conn := c.conn
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, msg.ClientMsgID)
+		c.mu.Unlock()
+	}()
+
+	// เขียนไม่สำเร็จ = connection กำลังหลุด run loop จะส่งให้ใหม่หลัง reconnect
+	if conn != nil {
+		c.write(conn, frame)
+	}
+
+	select {
+	case ack := <-p.ack:
+		return ack, nil
+	case <-ctx.Done():
+		return protocol.Ack{}, ctx.Err()
+	case <-c.done:
+		return protocol.Ack{}, ErrClosed
+	}
+}
+
+// ส่ง frame อื่นที่ไม่ต้องรอ ack เช่น protocol.TypingEvent หรือ {"type":"read",...}
+// ถ้ากำลัง reconnect frame จะไม่ถูกส่ง
+func (c *Client) SendFrame(frame any) error {
+	data, err := json.Marshal(frame)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	conn, stopped := c.conn, c.err != nil
+	c.mu.Unlock()
+	if stopped {
+		return ErrClosed
+	}
+	if conn == nil {
+		return errors.New("client: not connected")
+	}
+	return c.write(conn, data)
+}
+
+func (c *Client) write(conn *websocket.Conn, data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (c *Client) wsURL() (string, error) {
+	u, err := url.Parse(c.opts.URL)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/ws/chat"
+	if !c.opts.Handshake {
+		u.Path += "/" + url.PathEscape(c.opts.UserID)
+	}
+	q := url.Values{"session": {c.opts.SessionID}}
+	if c.lastID > 0 {
+		// reconnect: ขอทุกข้อความหลังตัวล่าสุดที่ได้รับ แทนที่จะพึ่งสถานะ delivered
+		q.Set("since", strconv.FormatInt(c.lastID, 10))
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+func (c *Client) dial(ctx context.Context) (*websocket.Conn, error) {
+	target, err := c.wsURL()
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	if c.opts.Token != "" && !c.opts.Handshake {
+		header.Set("Authorization", "Bearer "+c.opts.Token)
+	}
+	dialer := websocket.Dialer{Subprotocols: []string{protocol.SubprotocolV2}, HandshakeTimeout: 10 * time.Second}
+	conn, resp, err := dialer.DialContext(ctx, target, header)
+	if err != nil {
+		if resp != nil {
+			return nil, &HandshakeError{Status: resp.StatusCode, err: err}
+		}
+		return nil, err
+	}
+	if c.opts.Handshake {
+		if err := c.hello(conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// ส่ง hello แล้วรอ welcome (server ปิดด้วย CloseHandshakeFailed ถ้า token ไม่ผ่าน)
+func (c *Client) hello(conn *websocket.Conn) error {
+	hello := protocol.Hello{Type: protocol.FrameHello, Token: c.opts.Token, ClientVersion: c.opts.ClientVersion, DeviceID: c.opts.SessionID}
+	if err := conn.WriteJSON(hello); err != nil {
+		return err
+	}
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	defer conn.SetReadDeadline(time.Time{})
+	var welcome protocol.Welcome
+	if err := conn.ReadJSON(&welcome); err != nil {
+		return err
+	}
+	if welcome.Type != protocol.FrameWelcome {
+		return fmt.Errorf("client: expected welcome frame, got %q", welcome.Type)
+	}
+	return nil
+}
+
+// server ปฏิเสธตอน upgrade (เช่น 401 token หมดอายุ, 403 origin)
+type HandshakeError struct {
+	Status int
+	err    error
+}
+
+func (e *HandshakeError) Error() string {
+	return fmt.Sprintf("client: handshake failed with status %d: %v", e.Status, e.err)
+}
+
+func (e *HandshakeError) Unwrap() error {
+	return e.err
+}
+
+// ไม่ควร reconnect ต่อ: ถูกปฏิเสธสิทธิ์ หรือ server ปิดด้วย code ที่ห้าม reconnect อัตโนมัติ
+func permanent(err error) bool {
+	var handshake *HandshakeError
+	if errors.As(err, &handshake) {
+		return handshake.Status == http.StatusUnauthorized || handshake.Status == http.StatusForbidden
+	}
+	var closeErr *websocket.CloseError
+	return errors.As(err, &closeErr) && protocol.PermanentClose(closeErr.Code)
+}
+
+// อ่าน frame จนหลุด แล้ว reconnect แบบ exponential backoff (มี jitter) จนกว่าจะ Close หรือเจอ error ถาวร
+func (c *Client) run(conn *websocket.Conn) {
+	defer func() {
+		close(c.messages)
+		close(c.events)
+		close(c.done)
+	}()
+
+	backoff := c.opts.MinBackoff
+	for {
+		c.attach(conn)
+		err := c.readLoop(conn)
+		c.mu.Lock()
+		c.conn = nil
+		c.mu.Unlock()
+		conn.Close()
+
+		for {
+			if c.stopping(err) {
+				return
+			}
+			select {
+			case <-c.closing:
+				c.stop(ErrClosed)
+				return
+			case <-time.After(jitter(backoff)):
+			}
+			backoff = min(backoff*2, c.opts.MaxBackoff)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			conn, err = c.dial(ctx)
+			cancel()
+			if err == nil {
+				backoff = c.opts.MinBackoff
+				break
+			}
+		}
+	}
+}
+
+// เก็บ error ที่ทำให้หยุด คืนค่า true ถ้าต้องหยุด
+func (c *Client) stopping(err error) bool {
+	select {
+	case <-c.closing:
+		c.stop(ErrClosed)
+		return true
+	default:
+	}
+	if permanent(err) {
+		c.stop(err)
+		return true
+	}
+	return false
+}
+
+func (c *Client) stop(err error) {
+	c.mu.Lock()
+	c.err = err
+	c.mu.Unlock()
+}
+
+// ใช้ connection ใหม่ และส่งข้อความที่ยังไม่ได้ ack ซ้ำ
+func (c *Client) attach(conn *websocket.Conn) {
+	c.mu.Lock()
+	c.conn = conn
+	frames := make([][]byte, 0, len(c.pending))
+	for _, p := range c.pending {
+		frames = append(frames, p.frame)
+	}
+	c.mu.Unlock()
+	// Close ที่เกิดก่อนตั้ง c.conn ไม่เห็น connection นี้ ปิดเองเพื่อให้ readLoop หลุด
+	select {
+	case <-c.closing:
+		conn.Close()
+		return
+	default:
+	}
+	for _, frame := range frames {
+		if c.write(conn, frame) != nil {
+			return
+		}
+	}
+}
+
+func (c *Client) readLoop(conn *websocket.Conn) error {
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		var frame struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(data, &frame); err != nil {
+			continue
+		}
+
+		switch frame.Type {
+		case protocol.FrameChat:
+			var msg protocol.Message
+			if err := json.Unmarshal(data, &msg); err != nil {
+				continue
+			}
+			c.lastID = max(c.lastID, msg.ID)
+			select {
+			case c.messages <- msg:
+			case <-c.closing:
+				return ErrClosed
+			}
+		case protocol.FrameAck:
+			var ack protocol.Ack
+			if err := json.Unmarshal(data, &ack); err != nil {
+				continue
+			}
+			c.mu.Lock()
+			p := c.pending[ack.ClientMsgID]
+			c.mu.Unlock()
+			if p != nil {
+				select {
+				case p.ack <- ack:
+				default:
+				}
+			}
+		default:
+			select {
+			case c.events <- Event{Type: frame.Type, Data: data}:
+			default:
+			}
+		}
+	}
+}
+
+// สุ่มระยะรอ 50-100% ของ d กัน client จำนวนมาก reconnect พร้อมกัน
+func jitter(d time.Duration) time.Duration {
+	return d/2 + rand.N(d/2+1)
+}
@@ -0,0 +1,66 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go-socket/protocol"
+)
+
+// หน้าหนึ่งของ GET /messages เรียงจากใหม่ไปเก่า NextCursor ว่าง = ไม่มีข้อความเก่ากว่านี้แล้ว
+type HistoryPage struct {
+	Messages   []protocol.Message `json:"messages"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+// error จาก REST API ({"code": ..., "message": ...})
+type APIError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("client: %d %s: %s", e.Status, e.Code, e.Message)
+}
+
+// ประวัติการสนทนากับ peerID before คือ NextCursor ของหน้าก่อน (ว่าง = หน้าล่าสุด) limit 0 = ค่า default ของ server
+func (c *Client) History(ctx context.Context, peerID, before string, limit int) (HistoryPage, error) {
+	q := url.Values{"user_id": {c.opts.UserID}, "peer": {peerID}}
+	if before != "" {
+		q.Set("before", before)
+	}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	var page HistoryPage
+	err := c.getJSON(ctx, "/messages?"+q.Encode(), &page)
+	return page, err
+}
+
+func (c *Client) getJSON(ctx context.Context, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(c.opts.URL, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	if c.opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.opts.Token)
+	}
+	resp, err := c.opts.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &APIError{Status: resp.StatusCode}
+		json.NewDecoder(resp.Body).Decode(apiErr)
+		return apiErr
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
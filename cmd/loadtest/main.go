@@ -0,0 +1,267 @@
+// loadtest เปิด WebSocket หลาย connection พร้อมกัน ส่งข้อความตาม rate ที่กำหนด
+// แล้วรายงาน latency ของ ack และของการส่งถึงผู้รับ (percentile) กับอัตรา error
+//
+//	go run ./cmd/loadtest -url http://localhost:3000 -conns 200 -rate 500 -duration 30s
+//
+// ผู้ใช้ i ส่งถึงผู้ใช้ i+1 (วนกลับ) เวลาที่ส่งฝังไว้ใน metadata เพื่อวัด latency ฝั่งผู้รับ
+// ถ้า server เปิด RequireJWT ให้ระบุ -issuer-key เพื่อขอ token ของแต่ละผู้ใช้จาก POST /auth/token
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"go-socket/client"
+	"go-socket/protocol"
+)
+
+type options struct {
+	url       string
+	conns     int
+	rate      float64
+	duration  time.Duration
+	drain     time.Duration
+	size      int
+	inflight  int
+	timeout   time.Duration
+	issuerKey string
+}
+
+// metadata ที่แนบกับทุกข้อความ run แยกข้อความของรอบนี้ออกจากข้อความค้างของรอบก่อน
+type loadMeta struct {
+	Run    string `json:"loadtest_run"`
+	SentAt int64  `json:"sent_at_ns"`
+}
+
+// ตัวเลขที่เก็บระหว่างทดสอบ
+type stats struct {
+	dialErrors atomic.Int64
+	sent       atomic.Int64
+	acked      atomic.Int64
+	ackFailed  atomic.Int64 // ack status failed
+	sendErrors atomic.Int64 // timeout หรือ connection หลุด
+	skipped    atomic.Int64 // in-flight เต็ม ข้าม tick นี้
+	received   atomic.Int64
+
+	mu         sync.Mutex
+	ackLatency []time.Duration
+	e2eLatency []time.Duration
+}
+
+func (s *stats) record(latencies *[]time.Duration, d time.Duration) {
+	s.mu.Lock()
+	*latencies = append(*latencies, d)
+	s.mu.Unlock()
+}
+
+func main() {
+	var opts options
+	flag.StringVar(&opts.url, "url", "http://localhost:3000", "base URL ของ server")
+	flag.IntVar(&opts.conns, "conns", 100, "จำนวน WebSocket connection (1 connection ต่อผู้ใช้)")
+	flag.Float64Var(&opts.rate, "rate", 100, "จำนวนข้อความต่อวินาที (รวมทุก connection)")
+	flag.DurationVar(&opts.duration, "duration", 30*time.Second, "ระยะเวลาที่ส่งข้อความ")
+	flag.DurationVar(&opts.drain, "drain", 5*time.Second, "เวลารอข้อความที่ยังส่งไม่ถึงหลังหยุดส่ง")
+	flag.IntVar(&opts.size, "size", 64, "ความยาวข้อความ (bytes)")
+	flag.IntVar(&opts.inflight, "inflight", 1000, "จำนวนข้อความที่รอ ack พร้อมกันได้สูงสุด")
+	flag.DurationVar(&opts.timeout, "timeout", 10*time.Second, "เวลารอ ack ต่อข้อความ")
+	flag.StringVar(&opts.issuerKey, "issuer-key", "", "issuer key สำหรับขอ JWT (server ที่เปิด RequireJWT)")
+	flag.Parse()
+
+	if opts.conns < 2 || opts.rate <= 0 {
+		log.Fatal("conns must be at least 2 and rate must be positive")
+	}
+
+	var st stats
+	run := uuid.NewString()
+	clients := connect(opts, run, &st)
+	if len(clients) < 2 {
+		log.Fatalf("only %d connections succeeded", len(clients))
+	}
+	log.Printf("connected %d/%d clients, sending %.0f msg/s for %s", len(clients), opts.conns, opts.rate, opts.duration)
+
+	start := time.Now()
+	drive(opts, run, clients, &st)
+	elapsed := time.Since(start)
+
+	// รอข้อความที่ยังส่งไม่ถึง จนกว่าจะครบหรือหมดเวลา drain
+	deadline := time.Now().Add(opts.drain)
+	for st.received.Load() < st.acked.Load() && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+	for _, c := range clients {
+		c.Close()
+	}
+
+	report(os.Stdout, opts, &st, elapsed)
+}
+
+// เปิด connection ทั้งหมดพร้อมกัน และเริ่ม goroutine อ่านข้อความของแต่ละ connection
+func connect(opts options, run string, st *stats) []*client.Client {
+	prefix := "load-" + run[:8] + "-"
+	results := make([]*client.Client, opts.conns)
+	var wg sync.WaitGroup
+	for i := range opts.conns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			userID := fmt.Sprintf("%s%d", prefix, i)
+			token, err := issueToken(opts, userID)
+			if err != nil {
+				st.dialErrors.Add(1)
+				log.Printf("token for %s: %v", userID, err)
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			c, err := client.Dial(ctx, client.Options{URL: opts.url, UserID: userID, Token: token})
+			if err != nil {
+				st.dialErrors.Add(1)
+				log.Printf("dial %s: %v", userID, err)
+				return
+			}
+			results[i] = c
+			go receive(c, run, st)
+		}()
+	}
+	wg.Wait()
+	return slices.DeleteFunc(results, func(c *client.Client) bool { return c == nil })
+}
+
+func issueToken(opts options, userID string) (string, error) {
+	if opts.issuerKey == "" {
+		return "", nil
+	}
+	body, _ := json.Marshal(map[string]string{"user_id": userID})
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(opts.url, "/")+"/auth/token", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+opts.issuerKey)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status %d", resp.StatusCode)
+	}
+	var result struct {
+		Token string `json:"token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	return result.Token, err
+}
+
+// วัด latency ตั้งแต่ส่งจนถึงผู้รับ จาก sent_at_ns ใน metadata
+func receive(c *client.Client, run string, st *stats) {
+	for msg := range c.Messages() {
+		var meta loadMeta
+		if json.Unmarshal(msg.Metadata, &meta) != nil || meta.Run != run {
+			continue
+		}
+		st.received.Add(1)
+		st.record(&st.e2eLatency, time.Duration(time.Now().UnixNano()-meta.SentAt))
+	}
+}
+
+// ส่งข้อความตาม rate จนครบ duration โดยวนผู้ส่งไปทีละคน
+func drive(opts options, run string, clients []*client.Client, st *stats) {
+	interval := time.Duration(float64(time.Second) / opts.rate)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	stop := time.After(opts.duration)
+	slots := make(chan struct{}, opts.inflight)
+	text := strings.Repeat("x", opts.size)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for i := 0; ; i++ {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		select {
+		case slots <- struct{}{}:
+		default:
+			st.skipped.Add(1)
+			continue
+		}
+
+		sender := clients[i%len(clients)]
+		receiver := clients[(i+1)%len(clients)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			send(opts, run, sender, receiver, text, st)
+		}()
+	}
+}
+
+func send(opts options, run string, sender, receiver *client.Client, text string, st *stats) {
+	sentAt := time.Now()
+	meta, _ := json.Marshal(loadMeta{Run: run, SentAt: sentAt.UnixNano()})
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+
+	st.sent.Add(1)
+	ack, err := sender.Send(ctx, protocol.Message{ReceiverID: receiver.UserID(), Text: text, Metadata: meta})
+	switch {
+	case err != nil:
+		st.sendErrors.Add(1)
+	case ack.Status == protocol.AckFailed:
+		st.ackFailed.Add(1)
+	default:
+		st.acked.Add(1)
+		st.record(&st.ackLatency, time.Since(sentAt))
+	}
+}
+
+func report(w *os.File, opts options, st *stats, elapsed time.Duration) {
+	sent, acked, received := st.sent.Load(), st.acked.Load(), st.received.Load()
+	failed := st.sendErrors.Load() + st.ackFailed.Load()
+
+	fmt.Fprintf(w, "\nconnections  %d requested, %d dial errors\n", opts.conns, st.dialErrors.Load())
+	fmt.Fprintf(w, "messages     %d sent in %s (%.1f msg/s), %d skipped (in-flight limit)\n", sent, elapsed.Round(time.Millisecond), float64(sent)/elapsed.Seconds(), st.skipped.Load())
+	fmt.Fprintf(w, "acks         %d ok, %d failed, %d errors/timeouts (error rate %.2f%%)\n", acked, st.ackFailed.Load(), st.sendErrors.Load(), percent(failed, sent))
+	fmt.Fprintf(w, "delivered    %d of %d acked (%.2f%% missing)\n", received, acked, percent(max(acked-received, 0), acked))
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	printLatency(w, "ack latency", st.ackLatency)
+	printLatency(w, "e2e latency", st.e2eLatency)
+}
+
+func percent(n, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(total)
+}
+
+func printLatency(w *os.File, name string, latencies []time.Duration) {
+	if len(latencies) == 0 {
+		fmt.Fprintf(w, "%-12s no samples\n", name)
+		return
+	}
+	slices.Sort(latencies)
+	p := func(q float64) time.Duration {
+		return latencies[min(int(q*float64(len(latencies))), len(latencies)-1)].Round(10 * time.Microsecond)
+	}
+	fmt.Fprintf(w, "%-12s p50 %s  p90 %s  p99 %s  max %s\n", name, p(0.50), p(0.90), p(0.99), latencies[len(latencies)-1].Round(10*time.Microsecond))
+}
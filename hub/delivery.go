@@ -0,0 +1,165 @@
+package hub
+
+import (
+	"time"
+
+	"go-socket/protocol"
+	"go-socket/store"
+)
+
+// ผลการส่งข้อความถึงผู้รับหนึ่งคน (ใช้เป็น label ของ metric ได้)
+const (
+	OutcomeDelivered = "delivered" // ส่งถึง connection บน instance นี้
+	OutcomeRemote    = "remote"    // ส่งต่อให้ instance อื่นใน cluster
+	OutcomeStored    = "stored"    // ผู้รับออฟไลน์ เก็บไว้ใน DB
+	OutcomeDuplicate = "duplicate" // client_msg_id ซ้ำ ไม่ได้ส่งซ้ำ
+	OutcomeFailed    = "failed"    // บันทึกลง DB ไม่สำเร็จ
+)
+
+// สิ่งที่ Dispatcher ใช้จาก server: ที่เก็บ transport และสิ่งที่ต้องทำตามผลการส่ง
+// ถูกเรียกจากหลาย worker พร้อมกัน
+type DeliveryHooks interface {
+	// ผู้รับของข้อความห้อง (สมาชิกที่ไม่ได้บล็อกผู้ส่ง ไม่รวมผู้ส่ง) คืน error ถ้าผู้ส่งส่งเข้าห้องนี้ไม่ได้
+	RoomRecipients(msg protocol.Message) ([]string, error)
+	// บันทึกหลายข้อความใน transaction เดียว คืนค่าผลตามลำดับ
+	Save(msgs []protocol.Message) ([]store.SaveResult, error)
+	// mark ว่าส่งถึงแล้ว receipts = แจ้งผู้ส่งด้วย delivery receipt (ผู้ส่งข้อความ 1 ต่อ 1 รู้จาก ack แล้ว)
+	MarkDelivered(ids []int64, receipts bool)
+	// ส่งให้ session ของผู้รับบน instance นี้ คืนค่า true ถ้าถึงอย่างน้อยหนึ่ง session
+	DeliverLocal(msg protocol.Message) bool
+	// ส่งต่อให้ instance อื่นที่ผู้รับเชื่อมต่ออยู่ (deliveredLocally = instance นี้ส่งถึงแล้ว)
+	DeliverRemote(msg protocol.Message, deliveredLocally bool) bool
+	// ผลการส่งของแต่ละข้อความ (metric, feed, webhook, แจ้งเตือนผู้รับที่ออฟไลน์) err มีค่าเฉพาะ OutcomeFailed
+	Dispatched(msg protocol.Message, outcome string, err error)
+	// สำเนาของข้อความที่ส่งถึงหรือบันทึกแล้ว (sink, audit)
+	Mirror(msg protocol.Message)
+}
+
+// ผลการบันทึกและส่งข้อความหนึ่งข้อความ
+type Result struct {
+	Message   protocol.Message // ข้อความพร้อม ID ที่ server กำหนด
+	Delivered bool             // ส่งถึงผู้รับที่ออนไลน์แล้ว
+	Duplicate bool             // client_msg_id ซ้ำกับข้อความที่เคยบันทึกไว้ ไม่ได้ส่งซ้ำ
+}
+
+// บันทึกและส่งข้อความแชท ใช้ได้หลาย goroutine พร้อมกัน
+type Dispatcher struct {
+	hooks DeliveryHooks
+}
+
+func NewDispatcher(hooks DeliveryHooks) *Dispatcher {
+	return &Dispatcher{hooks: hooks}
+}
+
+// บันทึกข้อความลง DB ก่อน (เพื่อให้มี ID สำหรับ reaction/read receipt) แล้วส่งให้ผู้รับที่ออนไลน์
+// ข้อความที่ส่งถึงแล้วจะถูก mark ว่า delivered ส่วนที่เหลือจะถูกส่งตอนผู้รับเชื่อมต่อ
+// ผู้เรียกกำหนด TenantID และ CreatedAt เอง
+func (d *Dispatcher) Dispatch(msg protocol.Message) (Result, error) {
+	if msg.RoomID != 0 {
+		return d.dispatchRoom(msg)
+	}
+	msg.Mentioned = protocol.IsMentioned(msg.Mentions, msg.ReceiverID)
+	// ข้อความถึงตัวเอง (saved messages) ถือว่าอ่านแล้ว ไม่มี read receipt
+	msg.IsRead = msg.SenderID == msg.ReceiverID
+
+	stored, err := d.hooks.Save([]protocol.Message{msg})
+	if err != nil {
+		// บันทึกไม่ได้ ยังพยายามส่งให้ผู้รับที่ออนไลน์ เพื่อไม่ให้ข้อความหาย
+		d.hooks.Dispatched(msg, OutcomeFailed, err)
+		delivered := d.hooks.DeliverLocal(msg)
+		if delivered {
+			d.hooks.Mirror(msg)
+		}
+		return Result{Message: msg, Delivered: delivered}, err
+	}
+	msg.ID, msg.CreatedAt = stored[0].ID, stored[0].CreatedAt
+	if stored[0].Duplicate {
+		d.hooks.Dispatched(msg, OutcomeDuplicate, nil)
+		return Result{Message: msg, Duplicate: true}, nil
+	}
+
+	if d.DeliverStored(msg) {
+		d.hooks.MarkDelivered([]int64{msg.ID}, false)
+		return Result{Message: msg, Delivered: true}, nil
+	}
+	return Result{Message: msg}, nil
+}
+
+// กระจายข้อความห้องเป็นแถวของผู้รับแต่ละคน แล้วใช้เส้นทางบันทึก/ส่งเดียวกับข้อความปกติ
+// สมาชิกที่ออนไลน์ได้รับทันที ที่เหลือได้ตอนเชื่อมต่อ เหมือนข้อความ 1 ต่อ 1
+func (d *Dispatcher) dispatchRoom(msg protocol.Message) (Result, error) {
+	recipients, err := d.hooks.RoomRecipients(msg)
+	if err != nil {
+		return Result{Message: msg}, err
+	}
+
+	// ทุกสำเนาใช้เวลาเดียวกัน ใช้หาสำเนาของข้อความเดียวกันตอนลบ
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = time.Now().UTC()
+	}
+	copies := make([]protocol.Message, 0, len(recipients))
+	for _, userID := range recipients {
+		c := msg
+		c.ReceiverID = userID
+		c.Mentioned = protocol.IsMentioned(c.Mentions, userID)
+		copies = append(copies, c)
+	}
+	if len(copies) == 0 {
+		return Result{Message: msg}, nil
+	}
+
+	stored, err := d.hooks.Save(copies)
+	if err != nil {
+		// บันทึกไม่ได้ ยังพยายามส่งให้สมาชิกที่ออนไลน์ เพื่อไม่ให้ข้อความหาย
+		delivered := false
+		for _, c := range copies {
+			d.hooks.Dispatched(c, OutcomeFailed, err)
+			if d.hooks.DeliverLocal(c) {
+				delivered = true
+				d.hooks.Mirror(c)
+			}
+		}
+		return Result{Message: msg, Delivered: delivered}, err
+	}
+
+	result := Result{Message: copies[0], Duplicate: true}
+	result.Message.ID = stored[0].ID
+	var deliveredIDs []int64
+	for i, c := range copies {
+		c.ID = stored[i].ID
+		if stored[i].Duplicate {
+			d.hooks.Dispatched(c, OutcomeDuplicate, nil)
+			continue
+		}
+		result.Duplicate = false
+		if d.DeliverStored(c) {
+			deliveredIDs = append(deliveredIDs, c.ID)
+			result.Delivered = true
+		}
+	}
+	d.hooks.MarkDelivered(deliveredIDs, true)
+	return result, nil
+}
+
+// ส่งข้อความที่บันทึกแล้วหนึ่งข้อความ (ใช้ร่วมกันทั้งข้อความ 1 ต่อ 1 ห้อง และ broadcast)
+// คืนค่า true ถ้าส่งถึงผู้รับที่ออนไลน์บน instance นี้ ผู้เรียก mark delivered เอง
+func (d *Dispatcher) DeliverStored(msg protocol.Message) bool {
+	defer d.hooks.Mirror(msg)
+
+	// ส่งให้อุปกรณ์ที่ออนไลน์บน instance นี้ และส่งต่อให้อุปกรณ์อื่นของผู้รับที่เชื่อมต่ออยู่กับ instance อื่นเสมอ
+	// (ไม่ส่งต่อ อุปกรณ์บน instance อื่นจะไม่ได้ข้อความเลย เพราะข้อความถูก mark delivered ไปแล้ว)
+	local := d.hooks.DeliverLocal(msg)
+	remote := d.hooks.DeliverRemote(msg, local)
+	switch {
+	case local:
+		d.hooks.Dispatched(msg, OutcomeDelivered, nil)
+		return true
+	case remote:
+		// ผู้รับเชื่อมต่ออยู่กับ instance อื่นอย่างเดียว: instance นั้นจะ mark delivered และแจ้ง feed เอง
+		d.hooks.Dispatched(msg, OutcomeRemote, nil)
+		return false
+	}
+	// ผู้รับออฟไลน์ (ไม่มีการเชื่อมต่อ) หรือส่งไม่สำเร็จ
+	d.hooks.Dispatched(msg, OutcomeStored, nil)
+	return false
+}
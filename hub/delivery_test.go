@@ -0,0 +1,107 @@
+package hub
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"go-socket/protocol"
+	"go-socket/store"
+)
+
+// hooks ของ Dispatcher ที่จำลองผู้รับออนไลน์/ออฟไลน์ และจดผลการส่งไว้ตรวจ
+type testDelivery struct {
+	online    map[string]bool // ผู้รับที่ออนไลน์บน instance นี้
+	members   []string
+	saveErr   error
+	duplicate map[string]bool // ผู้รับที่ client_msg_id ซ้ำ
+	nextID    int64
+
+	outcomes  []string
+	delivered []int64
+	mirrored  int
+}
+
+func (h *testDelivery) RoomRecipients(msg protocol.Message) ([]string, error) {
+	var out []string
+	for _, m := range h.members {
+		if m != msg.SenderID {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+func (h *testDelivery) Save(msgs []protocol.Message) ([]store.SaveResult, error) {
+	if h.saveErr != nil {
+		return nil, h.saveErr
+	}
+	out := make([]store.SaveResult, len(msgs))
+	for i, m := range msgs {
+		h.nextID++
+		out[i] = store.SaveResult{ID: h.nextID, CreatedAt: m.CreatedAt, Duplicate: h.duplicate[m.ReceiverID]}
+	}
+	return out, nil
+}
+
+func (h *testDelivery) MarkDelivered(ids []int64, receipts bool) {
+	h.delivered = append(h.delivered, ids...)
+}
+func (h *testDelivery) DeliverLocal(msg protocol.Message) bool { return h.online[msg.ReceiverID] }
+func (h *testDelivery) DeliverRemote(protocol.Message, bool) bool {
+	return false
+}
+func (h *testDelivery) Dispatched(msg protocol.Message, outcome string, err error) {
+	h.outcomes = append(h.outcomes, msg.ReceiverID+":"+outcome)
+}
+func (h *testDelivery) Mirror(protocol.Message) { h.mirrored++ }
+
+func TestDispatchDirectMessage(t *testing.T) {
+	hooks := &testDelivery{online: map[string]bool{"bob": true}}
+	d := NewDispatcher(hooks)
+
+	res, err := d.Dispatch(protocol.Message{SenderID: "alice", ReceiverID: "bob", Mentions: []string{"@bob"}})
+	if err != nil || !res.Delivered || res.Message.ID != 1 || !res.Message.Mentioned {
+		t.Fatalf("unexpected result %+v, %v", res, err)
+	}
+	if _, err := d.Dispatch(protocol.Message{SenderID: "alice", ReceiverID: "carol"}); err != nil {
+		t.Fatalf("dispatch to offline user: %v", err)
+	}
+	if want := []string{"bob:delivered", "carol:stored"}; !slices.Equal(hooks.outcomes, want) {
+		t.Fatalf("outcomes = %v, want %v", hooks.outcomes, want)
+	}
+	// เฉพาะข้อความที่ส่งถึงเท่านั้นที่ถูก mark delivered
+	if !slices.Equal(hooks.delivered, []int64{1}) || hooks.mirrored != 2 {
+		t.Fatalf("delivered = %v, mirrored = %d", hooks.delivered, hooks.mirrored)
+	}
+}
+
+func TestDispatchSaveFailureStillDeliversOnline(t *testing.T) {
+	hooks := &testDelivery{online: map[string]bool{"bob": true}, saveErr: errors.New("db down")}
+	res, err := NewDispatcher(hooks).Dispatch(protocol.Message{SenderID: "alice", ReceiverID: "bob"})
+	if err == nil || !res.Delivered {
+		t.Fatalf("expected delivery despite save error, got %+v, %v", res, err)
+	}
+	if want := []string{"bob:failed"}; !slices.Equal(hooks.outcomes, want) || len(hooks.delivered) != 0 {
+		t.Fatalf("outcomes = %v, delivered = %v", hooks.outcomes, hooks.delivered)
+	}
+}
+
+func TestDispatchRoomFansOutPerMember(t *testing.T) {
+	hooks := &testDelivery{
+		members:   []string{"alice", "bob", "carol", "dave"},
+		online:    map[string]bool{"bob": true},
+		duplicate: map[string]bool{"dave": true},
+	}
+	res, err := NewDispatcher(hooks).Dispatch(protocol.Message{SenderID: "alice", RoomID: 7, Mentions: []string{"@all"}})
+	if err != nil || !res.Delivered || res.Duplicate {
+		t.Fatalf("unexpected result %+v, %v", res, err)
+	}
+	// ผู้ส่งไม่ได้สำเนาของตัวเอง สำเนาที่ซ้ำไม่ถูกส่ง
+	if want := []string{"bob:delivered", "carol:stored", "dave:duplicate"}; !slices.Equal(hooks.outcomes, want) {
+		t.Fatalf("outcomes = %v, want %v", hooks.outcomes, want)
+	}
+	if !slices.Equal(hooks.delivered, []int64{1}) {
+		t.Fatalf("delivered = %v", hooks.delivered)
+	}
+}
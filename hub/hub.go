@@ -0,0 +1,211 @@
+// Package hub คือ registry ของ connection ที่เปิดอยู่ (tenant -> ผู้ใช้ -> session) และการส่งข้อความแชท
+// ไม่ขึ้นกับ transport (WebSocket, SSE, ...) หรือ state อื่นของ server
+// การส่ง frame การบันทึก และสิ่งที่ต้องทำตามเหตุการณ์เป็นหน้าที่ของผู้ใช้ package ผ่าน Conn, Hooks และ DeliveryHooks
+package hub
+
+import (
+	"sync"
+	"time"
+)
+
+// connection หนึ่งตัวที่ลงทะเบียนใน Registry
+type Conn interface {
+	comparable
+	Tenant() string
+	UserID() string
+	SessionID() string
+	ConnectedAt() time.Time
+}
+
+// การตั้งค่าและ callback ของ Registry
+// UserOnline/UserOffline ถูกเรียกหลังปล่อย lock แล้ว (เขียน socket หรือเรียก network ได้)
+type Hooks interface {
+	// true = ผู้ใช้มีได้ session เดียว connection ใหม่แทนที่ทุก session เดิม
+	SingleSession() bool
+	// ผู้ใช้มี session แรกบน registry นี้
+	UserOnline(tenant, userID string)
+	// session สุดท้ายของผู้ใช้ถูกยกเลิก
+	UserOffline(tenant, userID string)
+}
+
+// connection ที่เปิดอยู่ แยกตาม tenant และผู้ใช้ ใช้พร้อมกันหลาย goroutine ได้
+type Registry[C Conn] struct {
+	hooks   Hooks
+	tenants sync.Map // tenant -> *sync.Map ของ userID -> *userSessions[C]
+}
+
+func New[C Conn](hooks Hooks) *Registry[C] {
+	return &Registry[C]{hooks: hooks}
+}
+
+// session ทั้งหมดของผู้ใช้หนึ่งคน
+type userSessions[C Conn] struct {
+	mu       sync.Mutex
+	sessions map[string]C // sessionID -> connection
+	latest   C            // session ที่เชื่อมต่อล่าสุด (zero value = ไม่มี)
+	removed  bool         // ถูกลบออกจาก registry แล้ว ห้ามใช้ต่อ
+}
+
+// map ของผู้ใช้ใน tenant (สร้างใหม่ถ้ายังไม่มี)
+func (r *Registry[C]) users(tenant string) *sync.Map {
+	if v, ok := r.tenants.Load(tenant); ok {
+		return v.(*sync.Map)
+	}
+	v, _ := r.tenants.LoadOrStore(tenant, &sync.Map{})
+	return v.(*sync.Map)
+}
+
+func (r *Registry[C]) load(tenant, userID string) (*userSessions[C], bool) {
+	v, ok := r.users(tenant).Load(userID)
+	if !ok {
+		return nil, false
+	}
+	return v.(*userSessions[C]), true
+}
+
+// ลงทะเบียน connection ใหม่ คืนค่า connection เดิมที่ผู้เรียกต้องปิด
+// (session เดิมที่ใช้ ID ซ้ำ หรือทุก session ถ้าเปิด SingleSession)
+func (r *Registry[C]) Register(c C) []C {
+	users := r.users(c.Tenant())
+	for {
+		v, _ := users.LoadOrStore(c.UserID(), &userSessions[C]{sessions: make(map[string]C)})
+		us := v.(*userSessions[C])
+
+		us.mu.Lock()
+		if us.removed {
+			// ถูกลบไประหว่างที่โหลดมา ลองใหม่
+			us.mu.Unlock()
+			continue
+		}
+
+		wasOffline := len(us.sessions) == 0
+		single := r.hooks.SingleSession()
+		var replaced []C
+		for id, old := range us.sessions {
+			if id == c.SessionID() || single {
+				replaced = append(replaced, old)
+				delete(us.sessions, id)
+			}
+		}
+		us.sessions[c.SessionID()] = c
+		us.latest = c
+		us.mu.Unlock()
+
+		if wasOffline {
+			r.hooks.UserOnline(c.Tenant(), c.UserID())
+		}
+		return replaced
+	}
+}
+
+// ยกเลิกการลงทะเบียน เฉพาะถ้า connection นี้ยังเป็นเจ้าของ session อยู่
+// (กันไม่ให้ connection เก่าที่เพิ่งปิดไปลบ connection ใหม่ที่ reconnect เข้ามาแล้ว)
+func (r *Registry[C]) Unregister(c C) {
+	users := r.users(c.Tenant())
+	v, exists := users.Load(c.UserID())
+	if !exists {
+		return
+	}
+	us := v.(*userSessions[C])
+
+	var zero C
+	us.mu.Lock()
+	if us.sessions[c.SessionID()] != c {
+		us.mu.Unlock()
+		return
+	}
+	delete(us.sessions, c.SessionID())
+
+	if us.latest == c {
+		us.latest = zero
+		for _, other := range us.sessions {
+			if us.latest == zero || other.ConnectedAt().After(us.latest.ConnectedAt()) {
+				us.latest = other
+			}
+		}
+	}
+	wentOffline := len(us.sessions) == 0
+	if wentOffline {
+		us.removed = true
+		users.CompareAndDelete(c.UserID(), us)
+	}
+	us.mu.Unlock()
+
+	if wentOffline {
+		r.hooks.UserOffline(c.Tenant(), c.UserID())
+	}
+}
+
+// session ล่าสุดของผู้ใช้ที่ออนไลน์อยู่
+func (r *Registry[C]) Latest(tenant, userID string) (C, bool) {
+	var zero C
+	us, ok := r.load(tenant, userID)
+	if !ok {
+		return zero, false
+	}
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	return us.latest, us.latest != zero
+}
+
+// ทุก session ของผู้ใช้ที่ออนไลน์อยู่
+func (r *Registry[C]) Sessions(tenant, userID string) []C {
+	us, ok := r.load(tenant, userID)
+	if !ok {
+		return nil
+	}
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	sessions := make([]C, 0, len(us.sessions))
+	for _, c := range us.sessions {
+		sessions = append(sessions, c)
+	}
+	return sessions
+}
+
+// ผู้ใช้มี session อยู่บน registry นี้หรือไม่
+func (r *Registry[C]) Online(tenant, userID string) bool {
+	_, ok := r.users(tenant).Load(userID)
+	return ok
+}
+
+// ผู้ใช้ที่ออนไลน์ใน tenant
+func (r *Registry[C]) OnlineUsers(tenant string) []string {
+	online := make([]string, 0)
+	r.users(tenant).Range(func(key, _ any) bool {
+		online = append(online, key.(string))
+		return true
+	})
+	return online
+}
+
+// วนผู้ใช้ที่ออนไลน์ทุกคนของทุก tenant หยุดเมื่อ fn คืนค่า false
+func (r *Registry[C]) RangeUsers(fn func(tenant, userID string) bool) {
+	r.tenants.Range(func(tenant, users any) bool {
+		cont := true
+		users.(*sync.Map).Range(func(userID, _ any) bool {
+			cont = fn(tenant.(string), userID.(string))
+			return cont
+		})
+		return cont
+	})
+}
+
+// session ทั้งหมดของทุก tenant ณ ตอนเรียก
+// (เก็บรายชื่อก่อน ผู้เรียกเขียน socket หลังปล่อย lock ได้)
+func (r *Registry[C]) All() []C {
+	var all []C
+	r.tenants.Range(func(_, users any) bool {
+		users.(*sync.Map).Range(func(_, value any) bool {
+			us := value.(*userSessions[C])
+			us.mu.Lock()
+			for _, c := range us.sessions {
+				all = append(all, c)
+			}
+			us.mu.Unlock()
+			return true
+		})
+		return true
+	})
+	return all
+}
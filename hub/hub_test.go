@@ -0,0 +1,88 @@
+package hub
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+type testConn struct {
+	tenant, user, session string
+	at                    time.Time
+}
+
+func (c *testConn) Tenant() string         { return c.tenant }
+func (c *testConn) UserID() string         { return c.user }
+func (c *testConn) SessionID() string      { return c.session }
+func (c *testConn) ConnectedAt() time.Time { return c.at }
+
+// hooks ที่จดเหตุการณ์ online/offline ไว้ตรวจ
+type testHooks struct {
+	single bool
+	events []string
+}
+
+func (h *testHooks) SingleSession() bool { return h.single }
+func (h *testHooks) UserOnline(tenant, userID string) {
+	h.events = append(h.events, "online:"+tenant+"/"+userID)
+}
+func (h *testHooks) UserOffline(tenant, userID string) {
+	h.events = append(h.events, "offline:"+tenant+"/"+userID)
+}
+
+func TestRegistrySessionsAndHooks(t *testing.T) {
+	hooks := &testHooks{}
+	r := New[*testConn](hooks)
+	now := time.Now()
+	phone := &testConn{"acme", "alice", "phone", now}
+	laptop := &testConn{"acme", "alice", "laptop", now.Add(time.Second)}
+
+	r.Register(phone)
+	r.Register(laptop)
+	if got := r.Sessions("acme", "alice"); len(got) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(got))
+	}
+	if latest, _ := r.Latest("acme", "alice"); latest != laptop {
+		t.Fatal("latest should be the newest session")
+	}
+	// ผู้ใช้ชื่อเดียวกันต่าง tenant เป็นคนละคน
+	if r.Online("globex", "alice") {
+		t.Fatal("user leaked across tenants")
+	}
+
+	// reconnect ด้วย session เดิม: connection เก่าถูกคืนให้ปิด และ unregister ของมันไม่ลบตัวใหม่
+	phone2 := &testConn{"acme", "alice", "phone", now.Add(2 * time.Second)}
+	if replaced := r.Register(phone2); len(replaced) != 1 || replaced[0] != phone {
+		t.Fatalf("expected old phone to be replaced, got %v", replaced)
+	}
+	r.Unregister(phone)
+	if got := r.Sessions("acme", "alice"); !slices.Contains(got, phone2) || len(got) != 2 {
+		t.Fatalf("stale unregister removed the new session: %v", got)
+	}
+
+	r.Unregister(phone2)
+	if latest, _ := r.Latest("acme", "alice"); latest != laptop {
+		t.Fatal("latest should fall back to the remaining session")
+	}
+	r.Unregister(laptop)
+	if r.Online("acme", "alice") || len(r.All()) != 0 {
+		t.Fatal("user still registered after last session left")
+	}
+	if want := []string{"online:acme/alice", "offline:acme/alice"}; !slices.Equal(hooks.events, want) {
+		t.Fatalf("hooks = %v, want %v", hooks.events, want)
+	}
+}
+
+func TestRegistrySingleSessionReplacesAll(t *testing.T) {
+	r := New[*testConn](&testHooks{single: true})
+	a := &testConn{"public", "bob", "a", time.Now()}
+	b := &testConn{"public", "bob", "b", time.Now()}
+
+	r.Register(a)
+	if replaced := r.Register(b); len(replaced) != 1 || replaced[0] != a {
+		t.Fatalf("expected every old session to be replaced, got %v", replaced)
+	}
+	if got := r.OnlineUsers("public"); len(got) != 1 || got[0] != "bob" {
+		t.Fatalf("unexpected online users: %v", got)
+	}
+}
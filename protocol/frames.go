@@ -0,0 +1,247 @@
+package protocol
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// ข้อความแชทตามที่อยู่บน wire (server เติม field ที่ระบุว่า "server เติมให้" เอง ค่าจาก client ถูกทับ)
+type Message struct {
+	ID         int64  `json:"id"`
+	TenantID   string `json:"-"` // server กำหนดจาก request เสมอ ไม่ส่งบน wire
+	SenderID   string `json:"sender_id"`
+	ReceiverID string `json:"receiver_id"`
+	RoomID     int64  `json:"room_id,omitempty"` // ส่งถึงห้อง: server กระจายเป็นข้อความถึงสมาชิกแต่ละคน
+	Text       string `json:"text"`
+	IsRead     bool   `json:"is_read"`
+
+	CreatedAt time.Time `json:"created_at"` // เวลาที่ server รับข้อความ
+
+	IsDelivered bool `json:"is_delivered"` // ส่งถึงอุปกรณ์ของผู้รับแล้ว (ยังไม่แน่ว่าอ่าน)
+
+	State       string     `json:"state,omitempty"` // StateSent/StateDelivered/StateRead (เฉพาะ history และ sync)
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+	ReadAt      *time.Time `json:"read_at,omitempty"`
+
+	// ID ที่ client สร้างเอง ใช้กันข้อความซ้ำเมื่อส่งซ้ำ และจับคู่กับ Ack
+	ClientMsgID string `json:"client_msg_id,omitempty"`
+
+	Priority string `json:"priority,omitempty"` // "high" = ส่งก่อนข้อความปกติ
+
+	Mentions  []string `json:"mentions,omitempty"`  // ผู้ใช้ที่ถูก @mention ("@all" = ทุกคน)
+	Mentioned bool     `json:"mentioned,omitempty"` // ผู้รับของ frame นี้ถูก mention หรือไม่
+
+	Reactions map[string]int `json:"reactions,omitempty"` // จำนวน reaction แยกตาม emoji
+
+	// ข้อมูลเพิ่มเติมรูปแบบ JSON ที่ client กำหนดเอง (เช่น location, rich card) server ส่งต่อโดยไม่แก้ไข
+	Metadata json.RawMessage `json:"metadata,omitempty"`
+
+	ReplyToID int64         `json:"reply_to_id,omitempty"` // ID ของข้อความที่ตอบกลับ (ต้องอยู่ในบทสนทนาเดียวกัน)
+	ReplyTo   *ReplyPreview `json:"reply_to,omitempty"`    // ข้อความต้นทางแบบย่อ (server เติมให้)
+
+	AttachmentID string      `json:"attachment_id,omitempty"` // ID จาก POST /attachments (ผู้ส่งต้องเป็นคนอัปโหลด)
+	Attachment   *Attachment `json:"attachment,omitempty"`    // metadata ของไฟล์แนบ (server เติมให้)
+
+	Forwarded     bool           `json:"forwarded,omitempty"`      // ข้อความนี้ถูกส่งต่อมา (server เติมให้)
+	ForwardedFrom *ForwardedFrom `json:"forwarded_from,omitempty"` // ข้อความต้นฉบับและผู้ส่งเดิม
+
+	Deleted bool `json:"deleted,omitempty"` // ข้อความถูกลบแล้ว (tombstone ไม่มีเนื้อหาเดิม)
+
+	// ID สำหรับโยง log ของข้อความนี้ฝั่ง server (request ID ของ REST หรือสร้างใหม่ตอนรับทาง WebSocket) ไม่ส่งบน wire
+	TraceID string `json:"-"`
+}
+
+// mention พิเศษที่หมายถึงสมาชิกทุกคนในบทสนทนา
+const MentionAll = "all"
+
+// ตรวจว่า userID ถูก mention ใน mentions หรือไม่ (รองรับทั้ง "bob" และ "@bob")
+func IsMentioned(mentions []string, userID string) bool {
+	for _, m := range mentions {
+		m = strings.TrimPrefix(strings.TrimSpace(m), "@")
+		if m == MentionAll || m == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// ข้อความต้นทางแบบย่อ สำหรับให้ client แสดง thread
+type ReplyPreview struct {
+	ID       int64  `json:"id"`
+	SenderID string `json:"sender_id"`
+	Snippet  string `json:"snippet"`
+}
+
+// ไฟล์ที่แนบกับข้อความ (server เติมให้จาก attachment_id)
+type Attachment struct {
+	ID          string    `json:"id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ที่มาของข้อความที่ถูกส่งต่อ (ผู้ส่งต้นฉบับ ไม่ใช่ผู้ที่กดส่งต่อ)
+type ForwardedFrom struct {
+	MessageID int64  `json:"message_id"`
+	SenderID  string `json:"sender_id"`
+}
+
+// ทุก frame ของ v3 ทั้งขาเข้าและขาออก
+// id ไม่ซ้ำกันต่อ frame ts เป็น Unix milliseconds ตอนที่ส่ง payload คือ frame ของ v2 (ข้อความแชทเป็น Message)
+type Envelope struct {
+	Type    string `json:"type"`
+	ID      string `json:"id,omitempty"`
+	TS      int64  `json:"ts"`
+	Payload any    `json:"payload,omitempty"`
+}
+
+// frame แรกที่ client ต้องส่งหลังเชื่อมต่อ /ws/chat (ผู้ใช้มาจาก token ไม่ได้อยู่ใน URL)
+type Hello struct {
+	Type          string `json:"type"`
+	Token         string `json:"token"`                    // JWT จาก POST /auth/token หรือ connect token จาก POST /auth/ws-token
+	ClientVersion string `json:"client_version,omitempty"` // เช่น "ios/2.3.1" ใช้ใน log
+	DeviceID      string `json:"device_id,omitempty"`      // ใช้เป็น session ของ connection (reconnect ด้วยค่าเดิมแทนที่ connection เก่า)
+}
+
+// คำตอบของ hello เมื่อยืนยันตัวตนสำเร็จ
+type Welcome struct {
+	Type            string `json:"type"`
+	UserID          string `json:"user_id"`
+	SessionID       string `json:"session_id"`
+	ConnID          string `json:"conn_id"`
+	ProtocolVersion int    `json:"protocol_version"`
+}
+
+// คำตอบของข้อความแชทที่ระบุ client_msg_id
+type Ack struct {
+	Type        string `json:"type"`
+	ClientMsgID string `json:"client_msg_id"`
+	ServerID    int64  `json:"server_id,omitempty"`
+	Status      string `json:"status"`
+
+	CreatedAt *time.Time `json:"created_at,omitempty"` // เวลาที่ server บันทึก (ข้อความซ้ำ = ของข้อความเดิม)
+}
+
+// frame แจ้งข้อผิดพลาดให้ client
+type ErrorFrame struct {
+	Type   string `json:"type"`
+	Code   string `json:"code"`
+	Detail string `json:"detail,omitempty"`
+	Field  string `json:"field,omitempty"` // field ของข้อความที่ไม่ผ่านการตรวจ (เฉพาะ invalid_request)
+
+	ResetsAt *time.Time `json:"resets_at,omitempty"` // สำหรับ quota_exceeded และ rate_limited (ส่งได้อีกเมื่อไหร่)
+}
+
+// คำขอ mark ข้อความว่าอ่านแล้ว ({"type":"read","message_ids":[...]})
+type ReadRequest struct {
+	MessageIDs []int64 `json:"message_ids"`
+}
+
+// ack ที่ผู้รับส่งยืนยันข้อความหนึ่งข้อความ ({"type":"ack","message_id":...,"status":"delivered"|"read"})
+// ไม่ระบุ status = read
+type ReceiptAck struct {
+	MessageID int64  `json:"message_id"`
+	Status    string `json:"status"`
+}
+
+// read receipt ที่ส่งให้ผู้ส่งข้อความ
+type ReadReceipt struct {
+	Type       string  `json:"type"`
+	State      string  `json:"state"` // "read"
+	ReaderID   string  `json:"reader_id"`
+	MessageIDs []int64 `json:"message_ids"`
+}
+
+// delivery receipt ที่ส่งให้ผู้ส่งข้อความ
+type DeliveryReceipt struct {
+	Type        string  `json:"type"`
+	State       string  `json:"state"` // "delivered"
+	RecipientID string  `json:"recipient_id"`
+	MessageIDs  []int64 `json:"message_ids"`
+}
+
+// คำขอกด reaction (ใช้ทั้ง REST และ WebSocket)
+type ReactionRequest struct {
+	MessageID int64  `json:"message_id"`
+	UserID    string `json:"user_id"`
+	Emoji     string `json:"emoji"`
+}
+
+// event ที่ส่งให้อีกฝ่ายเมื่อมีการกด/ยกเลิก reaction
+type ReactionEvent struct {
+	Type      string `json:"type"`
+	MessageID int64  `json:"message_id"`
+	Emoji     string `json:"emoji"`
+	UserID    string `json:"user_id"`
+	Action    string `json:"action"` // add | remove
+	Count     int    `json:"count"`  // จำนวน reaction ของ emoji นี้บนข้อความหลังกด/ยกเลิก
+}
+
+// event ที่ส่งให้ผู้เข้าร่วมเมื่อข้อความถูกลบ (message_id เป็น ID ของสำเนาที่ผู้รับแต่ละคนมี)
+type MessageDeleted struct {
+	Type      string `json:"type"`
+	MessageID int64  `json:"message_id"`
+	RoomID    int64  `json:"room_id,omitempty"`
+	DeletedBy string `json:"deleted_by"`
+}
+
+// typing frame ทั้งขาเข้าและขาออก
+type TypingEvent struct {
+	Type       string `json:"type"`
+	SenderID   string `json:"sender_id"`
+	ReceiverID string `json:"receiver_id,omitempty"`
+	RoomID     int64  `json:"room_id,omitempty"`
+	State      string `json:"state"`
+}
+
+// frame ขอ sync หลังเชื่อมต่อ: {"type":"sync","since":<ID สูงสุดที่ client มี>}
+type SyncRequest struct {
+	Since int64 `json:"since"`
+}
+
+// ส่งหลัง replay ครบ last_id คือ ID ที่ client ควรใช้เป็น since ครั้งถัดไป
+type SyncedFrame struct {
+	Type   string `json:"type"`
+	LastID int64  `json:"last_id"`
+	Count  int    `json:"count"`
+}
+
+// คำขอทดสอบ connection จาก client ({"type":"ping_app","client_ts":...})
+type PingApp struct {
+	ClientTS int64 `json:"client_ts"` // เวลาฝั่ง client (ms) ส่งกลับไปให้คำนวณ RTT
+}
+
+// คำตอบของ ping_app
+type PongApp struct {
+	Type     string `json:"type"`
+	ClientTS int64  `json:"client_ts"`
+	ServerTS int64  `json:"server_ts"` // เวลาฝั่ง server (ms)
+}
+
+// frame เตือนก่อนตัด connection ที่ไม่มีการใช้งาน
+type IdleWarning struct {
+	Type     string    `json:"type"`
+	ClosesAt time.Time `json:"closes_at"`
+}
+
+// คำขอติดตาม presence ({"type":"presence_subscribe","users":[...]}) ไม่ระบุ users = ติดตามทุกคน
+type PresenceSubscribe struct {
+	Users []string `json:"users"`
+}
+
+// รายชื่อผู้ใช้ที่ออนไลน์ตอน subscribe (ส่งครั้งเดียว)
+type PresenceSnapshot struct {
+	Type   string   `json:"type"`
+	Online []string `json:"online"`
+}
+
+// การเปลี่ยนสถานะของผู้ใช้หนึ่งคน
+type PresenceDelta struct {
+	Type     string     `json:"type"`
+	Event    string     `json:"event"` // user_online / user_offline
+	UserID   string     `json:"user_id"`
+	Status   string     `json:"status"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+}
@@ -0,0 +1,135 @@
+// Package protocol รวมชนิดของ frame และค่าคงที่บน WebSocket ที่ server และ client ใช้ร่วมกัน
+// ไม่ขึ้นกับ Fiber หรือ DB จึง import ได้จากบริการอื่น (เช่น client SDK) โดยไม่ดึง server มาด้วย
+package protocol
+
+// เวอร์ชันของ protocol (เลือกต่อ connection ผ่าน Sec-WebSocket-Protocol)
+//
+//	v1 (chat.v1 หรือไม่ระบุ)  frame ข้อความแชทเป็น Message ตรงๆ ไม่มี type
+//	v2 (chat.v2)              ทุก frame ที่ server ส่งมี "type" รวมถึงข้อความแชท ("type":"chat")
+//	v3 (chat.v3)              ทุก frame ทั้งสองทิศทางเป็น Envelope {type, id, ts, payload}
+const (
+	V1 = 1
+	V2 = 2
+	V3 = 3
+)
+
+// ชื่อ subprotocol ของแต่ละเวอร์ชัน
+const (
+	SubprotocolV1 = "chat.v1"
+	SubprotocolV2 = "chat.v2"
+	SubprotocolV3 = "chat.v3"
+)
+
+// ประเภท frame ที่ server ส่งให้ client (ใช้กับ ?subscribe=)
+const (
+	FrameChat             = "chat"
+	FrameReaction         = "reaction"
+	FrameReadReceipt      = "read_receipt"
+	FrameDeliveryReceipt  = "delivery_receipt"
+	FrameError            = "error"
+	FramePongApp          = "pong_app"
+	FrameIdleWarning      = "idle_warning"
+	FrameAck              = "ack"
+	FrameTyping           = "typing"
+	FrameSynced           = "synced"
+	FrameAnnouncement     = "announcement"
+	FramePresenceSnapshot = "presence_snapshot"
+	FramePresence         = "presence"
+	FrameWelcome          = "welcome"
+	FrameMessageDeleted   = "message_deleted"
+)
+
+// ประเภท frame ที่ client ส่งเข้ามา (ข้อความแชทของ v1/v2 ไม่มี type, v3 ใช้ FrameMessage)
+const (
+	FrameMessage             = "message"
+	FrameReact               = "react"
+	FrameRead                = "read"
+	FramePingApp             = "ping_app"
+	FrameSync                = "sync"
+	FramePresenceSubscribe   = "presence_subscribe"
+	FramePresenceUnsubscribe = "presence_unsubscribe"
+	FrameHello               = "hello"
+	// "ack" (ReceiptAck) และ "typing" ใช้ชื่อเดียวกับ frame ขาออก
+)
+
+// สถานะใน Ack ที่ตอบผู้ส่ง
+const (
+	AckDelivered = "delivered" // ส่งถึงผู้รับที่ออนไลน์แล้ว
+	AckStored    = "stored"    // บันทึกแล้ว รอผู้รับเชื่อมต่อ
+	AckDuplicate = "duplicate" // client_msg_id ซ้ำ ใช้ข้อความเดิม ไม่ได้ส่งซ้ำ
+	AckFailed    = "failed"    // บันทึกไม่สำเร็จ server จะส่งใหม่เอง
+)
+
+// สถานะใน ReceiptAck ที่ผู้รับส่งกลับมา
+const (
+	ReceiptDelivered = "delivered" // ได้รับข้อความบนอุปกรณ์แล้ว
+	ReceiptRead      = "read"      // ผู้ใช้เปิดอ่านแล้ว
+)
+
+// สถานะของข้อความ ไล่ตามลำดับ sent -> delivered -> read
+const (
+	StateSent      = "sent"
+	StateDelivered = "delivered"
+	StateRead      = "read"
+)
+
+// สถานะใน TypingEvent
+const (
+	TypingStart = "start"
+	TypingStop  = "stop"
+)
+
+// รหัส error ใน ErrorFrame (และ REST API)
+const (
+	ErrInvalidRequest = "invalid_request"
+	ErrUnauthorized   = "unauthorized"
+	ErrForbidden      = "forbidden"
+	ErrNotFound       = "not_found"
+	ErrRateLimited    = "rate_limited"
+	ErrQuotaExceeded  = "quota_exceeded"
+	ErrMalformed      = "malformed"
+	ErrInternal       = "internal_error"
+	ErrUnavailable    = "unavailable"
+	ErrBlocked        = "blocked"
+	ErrOverloaded     = "overloaded"
+)
+
+// close code ที่ server ใช้ตอนปิด WebSocket เอง client ใช้ตัดสินใจว่าควร reconnect หรือไม่
+//
+//	1001 going away           server กำลังปิด — reconnect แบบ backoff
+//	1007 invalid payload      ส่ง frame ที่ decode ไม่ได้ติดกันเกินกำหนด — แก้ client ก่อน reconnect
+//	1009 message too big      frame ใหญ่เกิน MaxMessageBytes — อย่าส่งข้อความเดิมซ้ำ
+//	1013 try again later      server รับ connection เต็มแล้ว — reconnect แบบ backoff
+//	4000 session replaced     มี connection ใหม่ใช้ session เดียวกัน — อย่า reconnect อัตโนมัติ
+//	4001 idle timeout         ไม่มี frame เข้ามาเกิน IdleTimeout — reconnect เมื่อผู้ใช้กลับมาใช้งาน
+//	4002 heartbeat timeout    ไม่ตอบ pong ติดกันครบกำหนด — reconnect ได้ทันที
+//	4003 kicked               ผู้ดูแลระบบตัดการเชื่อมต่อ — อย่า reconnect อัตโนมัติ
+//	4004 handshake timeout    ไม่ได้ส่ง hello ภายใน HelloTimeout — reconnect แล้วส่ง hello ทันที
+//	4005 handshake failed     hello ผิดรูปแบบหรือ token ไม่ถูกต้อง — ขอ token ใหม่ก่อน reconnect
+//	4006 slow consumer        อ่าน frame ไม่ทันจนคิวขาออกเต็ม — reconnect ได้ทันที ข้อความที่ค้างจะถูกส่งใหม่
+//	4008 too many sessions    เปิด connection เกิน MaxConnectionsPerUser — ปิด tab อื่นก่อน
+//	4029 rate limited         ส่ง frame เกิน rate limit — reconnect แบบ backoff และส่งให้ช้าลง
+const (
+	CloseGoingAway        = 1001
+	CloseMalformedFrames  = 1007
+	CloseMessageTooBig    = 1009
+	CloseTryAgainLater    = 1013
+	CloseSessionReplaced  = 4000
+	CloseIdleTimeout      = 4001
+	CloseHeartbeatTimeout = 4002
+	CloseKicked           = 4003
+	CloseHandshakeTimeout = 4004
+	CloseHandshakeFailed  = 4005
+	CloseSlowConsumer     = 4006
+	CloseTooManySessions  = 4008
+	CloseRateLimited      = 4029
+)
+
+// client ไม่ควร reconnect อัตโนมัติหลังถูกปิดด้วย code นี้
+func PermanentClose(code int) bool {
+	switch code {
+	case CloseMalformedFrames, CloseMessageTooBig, CloseSessionReplaced, CloseKicked, CloseHandshakeFailed, CloseTooManySessions:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+// Package store คือชั้นฐานข้อมูลของ chat server: เลือก dialect (SQLite/PostgreSQL) จาก DSN
+// แปลง placeholder ให้ทุก query retry เมื่อ SQLite ถูก lock รัน schema migration และเก็บข้อความแชท (Messages)
+// ไม่ขึ้นกับ config หรือ state ของ server จึงใช้กับ *sql.DB ของแอปอื่นที่ฝัง chat engine ได้
+package store
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// ชนิดของฐานข้อมูลที่ใช้ เลือกจาก DSN ตอนเปิดการเชื่อมต่อ
+type Dialect int
+
+const (
+	SQLite Dialect = iota
+	Postgres
+)
+
+// เลือก dialect จาก DSN: postgres:// หรือ postgresql:// = PostgreSQL นอกนั้นเป็น SQLite
+func DialectFor(dsn string) Dialect {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return Postgres
+	}
+	return SQLite
+}
+
+// ชื่อ driver ของ database/sql
+func (d Dialect) Driver() string {
+	if d == Postgres {
+		return "pgx"
+	}
+	return "sqlite3"
+}
+
+func (d Dialect) String() string {
+	if d == Postgres {
+		return "PostgreSQL"
+	}
+	return "SQLite"
+}
+
+// แปลง placeholder "?" เป็น "$1", "$2", ... สำหรับ PostgreSQL
+// SQL ที่ส่งผ่าน DB/Tx เขียนด้วย "?" เสมอ และต้องไม่มี "?" อยู่ใน string literal
+func (d Dialect) Rebind(query string) string {
+	if d != Postgres || !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// *sql.DB ที่แปลง placeholder ตาม dialect ให้ทุก query
+// โค้ดที่ใช้เรียก Query/Exec/QueryRow/Begin ได้เหมือนเดิมโดยไม่ต้องรู้ว่าเป็นฐานข้อมูลอะไร
+type DB struct {
+	*sql.DB
+	Dialect Dialect
+}
+
+// เปิดการเชื่อมต่อตาม DSN แล้ว ping (SQLite ใส่ busy_timeout ลง DSN และเปิด WAL)
+// การตั้งค่า connection pool เป็นหน้าที่ของผู้เรียก
+func Open(dsn string, busyTimeout time.Duration) (*DB, error) {
+	d := DialectFor(dsn)
+	if d == SQLite {
+		dsn = WithBusyTimeout(dsn, busyTimeout)
+	}
+
+	conn, err := sql.Open(d.Driver(), dsn)
+	if err != nil {
+		return nil, err
+	}
+	db := &DB{DB: conn, Dialect: d}
+	if err := db.Ping(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// ให้ SQLite รองรับการอ่านพร้อมกับการเขียนได้ดีขึ้น
+	if d == SQLite {
+		if _, err := db.Exec("PRAGMA journal_mode=WAL;"); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+func (db *DB) Exec(query string, args ...any) (sql.Result, error) {
+	return db.DB.Exec(db.Dialect.Rebind(query), args...)
+}
+
+func (db *DB) Query(query string, args ...any) (*sql.Rows, error) {
+	return db.DB.Query(db.Dialect.Rebind(query), args...)
+}
+
+func (db *DB) QueryRow(query string, args ...any) *sql.Row {
+	return db.DB.QueryRow(db.Dialect.Rebind(query), args...)
+}
+
+func (db *DB) Begin() (*Tx, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, Dialect: db.Dialect}, nil
+}
+
+// *sql.Tx ที่แปลง placeholder ตาม dialect
+type Tx struct {
+	*sql.Tx
+	Dialect Dialect
+}
+
+func (tx *Tx) Exec(query string, args ...any) (sql.Result, error) {
+	return tx.Tx.Exec(tx.Dialect.Rebind(query), args...)
+}
+
+func (tx *Tx) Query(query string, args ...any) (*sql.Rows, error) {
+	return tx.Tx.Query(tx.Dialect.Rebind(query), args...)
+}
+
+func (tx *Tx) QueryRow(query string, args ...any) *sql.Row {
+	return tx.Tx.QueryRow(tx.Dialect.Rebind(query), args...)
+}
+
+func (tx *Tx) Prepare(query string) (*sql.Stmt, error) {
+	return tx.Tx.Prepare(tx.Dialect.Rebind(query))
+}
@@ -0,0 +1,430 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"go-socket/protocol"
+)
+
+// สิ่งที่ Messages ใช้จาก server: การเข้ารหัสเนื้อหาและข้อมูลจากตารางอื่น
+type MessageHooks interface {
+	// เข้ารหัสเนื้อหาก่อนเก็บ คืนค่าข้อความที่เก็บและรุ่นของ key (ไม่เข้ารหัส = คืนค่าเดิม)
+	SealText(plain string) (string, int, error)
+	// ถอดรหัสเนื้อหาที่อ่านจาก DB ตามรุ่นของ key ที่เก็บไว้
+	OpenText(stored string, version int) (string, error)
+	// เติม reaction ไฟล์แนบ สถานะการถูก mention และข้อความต้นทางของ reply ให้ข้อความที่ส่งให้ userID
+	Enrich(userID string, msgs []protocol.Message)
+}
+
+// ที่เก็บข้อความแชทบนตาราง messages ใช้ได้ทั้ง SQLite และ PostgreSQL
+// tenant ว่างไม่ถูกแทนด้วยค่า default ผู้เรียกต้องกำหนด TenantID ให้ข้อความเอง
+type Messages struct {
+	db    *DB
+	hooks MessageHooks
+}
+
+func NewMessages(db *DB, hooks MessageHooks) *Messages {
+	return &Messages{db: db, hooks: hooks}
+}
+
+// ผลการบันทึกข้อความหนึ่งข้อความ
+type SaveResult struct {
+	ID        int64
+	CreatedAt time.Time // ของแถวเดิมถ้าเป็นข้อความซ้ำ
+	Duplicate bool      // มีข้อความที่ใช้ client_msg_id นี้อยู่แล้ว
+}
+
+// จำนวนข้อความที่ยังไม่ได้อ่านจากคู่สนทนาแต่ละคน
+type UnreadCount struct {
+	PeerID string `json:"peer_id"`
+	Count  int    `json:"count"`
+}
+
+// ตำแหน่งในประวัติการสนทนา: ข้อความสุดท้ายของหน้าก่อน (ศูนย์ = เริ่มจากข้อความล่าสุด)
+type Cursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
+
+// key ของบทสนทนาระหว่างผู้ใช้สองคน (ตรงกับ generated column messages.conversation_key)
+func ConversationKey(a, b string) string {
+	if a < b {
+		return a + "\x1f" + b
+	}
+	return b + "\x1f" + a
+}
+
+// placeholder "?" n ตัว สำหรับสร้างคำสั่ง IN
+func Placeholders(n int) []string {
+	placeholders := make([]string, n)
+	for i := range placeholders {
+		placeholders[i] = "?"
+	}
+	return placeholders
+}
+
+// แปลงสตริงว่างเป็น NULL เพื่อไม่ให้ชนกับ unique index
+func NullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// insert ข้อความทั้งหมดใน transaction เดียว คืนค่าผลตามลำดับของข้อความ
+// client_msg_id ที่ผู้ส่งเคยใช้แล้วไม่ถูกบันทึกซ้ำ คืนค่า ID ของแถวเดิม (ผู้เรียก retry เองเมื่อ SQLite ไม่ว่าง)
+func (s *Messages) Save(msgs []protocol.Message) ([]SaveResult, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare("INSERT INTO messages (tenant_id, sender_id, receiver_id, room_id, text, text_key_version, client_msg_id, metadata, reply_to_id, attachment_id, forwarded_from_id, forwarded_sender_id, is_read, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (tenant_id, sender_id, receiver_id, client_msg_id) DO NOTHING RETURNING id")
+	if err != nil {
+		return nil, fmt.Errorf("preparing statement: %w", err)
+	}
+	defer stmt.Close()
+
+	stored := make([]SaveResult, len(msgs))
+	for i, msg := range msgs {
+		text, keyVersion, err := s.hooks.SealText(msg.Text)
+		if err != nil {
+			return nil, fmt.Errorf("encrypting text: %w", err)
+		}
+		fwdFromID, fwdSenderID := forwardedColumns(msg)
+		stored[i].CreatedAt = msg.CreatedAt
+		if stored[i].CreatedAt.IsZero() {
+			stored[i].CreatedAt = time.Now().UTC()
+		}
+		// ข้อความถึงตัวเอง (saved messages) ถือว่าอ่านแล้ว ไม่นับเป็น unread
+		isRead := msg.SenderID == msg.ReceiverID
+		err = stmt.QueryRow(msg.TenantID, msg.SenderID, msg.ReceiverID, sql.NullInt64{Int64: msg.RoomID, Valid: msg.RoomID != 0}, text, keyVersion, NullString(msg.ClientMsgID), nullMetadata(msg.Metadata), sql.NullInt64{Int64: msg.ReplyToID, Valid: msg.ReplyToID != 0}, NullString(msg.AttachmentID), fwdFromID, fwdSenderID, isRead, stored[i].CreatedAt).Scan(&stored[i].ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			// ข้อความซ้ำ (ON CONFLICT DO NOTHING ไม่คืนแถว) ใช้ ID ของแถวเดิม
+			err = tx.QueryRow("SELECT id, created_at FROM messages WHERE tenant_id = ? AND sender_id = ? AND receiver_id = ? AND client_msg_id = ?", msg.TenantID, msg.SenderID, msg.ReceiverID, msg.ClientMsgID).Scan(&stored[i].ID, &stored[i].CreatedAt)
+			if err != nil {
+				return nil, fmt.Errorf("fetching duplicate message: %w", err)
+			}
+			stored[i].Duplicate = true
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("executing insert: %w", err)
+		}
+
+		// เก็บการ mention ของผู้รับไว้ เพื่อแจ้งตอนส่งข้อความค้าง
+		if msg.Mentioned {
+			if _, err := tx.Exec("INSERT INTO mentions (message_id, user_id) VALUES (?, ?) ON CONFLICT DO NOTHING", stored[i].ID, msg.ReceiverID); err != nil {
+				return nil, fmt.Errorf("saving mention: %w", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("committing transaction: %w", err)
+	}
+	return stored, nil
+}
+
+// ค่าของคอลัมน์ forwarded_from_id / forwarded_sender_id
+func forwardedColumns(msg protocol.Message) (sql.NullInt64, sql.NullString) {
+	if msg.ForwardedFrom == nil {
+		return sql.NullInt64{}, sql.NullString{}
+	}
+	return sql.NullInt64{Int64: msg.ForwardedFrom.MessageID, Valid: true}, NullString(msg.ForwardedFrom.SenderID)
+}
+
+// แปลง metadata เป็นค่าที่เก็บลง DB (ว่าง = NULL)
+func nullMetadata(metadata json.RawMessage) any {
+	if len(metadata) == 0 || string(metadata) == "null" {
+		return nil
+	}
+	return string(metadata)
+}
+
+// ดึงข้อความที่ยังไม่ได้ส่งถึงผู้ใช้ พร้อม reaction และสถานะการถูก mention
+// แถวที่อ่านหรือถอดรหัสไม่ได้ถูกข้าม (log ไว้) เพื่อไม่ให้ข้อความอื่นค้างไปด้วย
+func (s *Messages) PendingFor(tenant, userID string) ([]protocol.Message, error) {
+	rows, err := s.db.Query("SELECT id, sender_id, receiver_id, COALESCE(room_id, 0), text, text_key_version, COALESCE(client_msg_id, ''), is_read, created_at, metadata, COALESCE(reply_to_id, 0), forwarded_from_id, forwarded_sender_id FROM messages WHERE tenant_id = ? AND receiver_id = ? AND is_delivered = FALSE ORDER BY created_at, id", tenant, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pending []protocol.Message
+	for rows.Next() {
+		msg := protocol.Message{TenantID: tenant}
+		var metadata sql.NullString
+		var text string
+		var keyVersion int
+		var fwdFromID sql.NullInt64
+		var fwdSenderID sql.NullString
+		if err := rows.Scan(&msg.ID, &msg.SenderID, &msg.ReceiverID, &msg.RoomID, &text, &keyVersion, &msg.ClientMsgID, &msg.IsRead, &msg.CreatedAt, &metadata, &msg.ReplyToID, &fwdFromID, &fwdSenderID); err != nil {
+			slog.Error("scanning message", "err", err)
+			continue
+		}
+		if msg.Text, err = s.hooks.OpenText(text, keyVersion); err != nil {
+			slog.Error("decrypting message", "msg_id", msg.ID, "err", err)
+			continue
+		}
+		applyContent(&msg, metadata, fwdFromID, fwdSenderID)
+		pending = append(pending, msg)
+	}
+	rows.Close()
+
+	s.hooks.Enrich(userID, pending)
+	return pending, nil
+}
+
+// ตั้ง is_delivered ให้ข้อความที่ยังไม่ได้ส่งถึง คืนค่าข้อความที่เพิ่งเปลี่ยนสถานะ (เฉพาะ ID, tenant, ผู้ส่ง, ผู้รับ, ห้อง)
+func (s *Messages) MarkDelivered(ids []int64) ([]protocol.Message, error) {
+	args := make([]any, 0, len(ids)+1)
+	args = append(args, time.Now().UTC())
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	query := fmt.Sprintf("UPDATE messages SET is_delivered = TRUE, delivered_at = ? WHERE is_delivered = FALSE AND id IN (%s) RETURNING id, tenant_id, sender_id, receiver_id, COALESCE(room_id, 0)", strings.Join(Placeholders(len(ids)), ","))
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var delivered []protocol.Message
+	for rows.Next() {
+		var msg protocol.Message
+		if err := rows.Scan(&msg.ID, &msg.TenantID, &msg.SenderID, &msg.ReceiverID, &msg.RoomID); err != nil {
+			return nil, err
+		}
+		delivered = append(delivered, msg)
+	}
+	return delivered, rows.Err()
+}
+
+// ตั้ง is_delivered ให้ข้อความที่ receiverID เป็นผู้รับและยังไม่ได้อ่าน คืนค่า ID แยกตามผู้ส่ง
+// ข้อความที่ server mark ว่าส่งถึงไปแล้วตอนเขียน socket ก็คืนด้วย เพราะ ack จาก client คือการยืนยันจริง
+func (s *Messages) AckDelivered(tenant, receiverID string, ids []int64) (map[string][]int64, error) {
+	delivered := make(map[string][]int64)
+	if len(ids) == 0 {
+		return delivered, nil
+	}
+
+	args := make([]any, 0, len(ids)+3)
+	args = append(args, time.Now().UTC(), tenant, receiverID)
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	query := fmt.Sprintf("UPDATE messages SET is_delivered = TRUE, delivered_at = COALESCE(delivered_at, ?) WHERE tenant_id = ? AND receiver_id = ? AND is_read = FALSE AND id IN (%s) RETURNING id, sender_id", strings.Join(Placeholders(len(ids)), ","))
+	return s.idsBySender(delivered, query, args...)
+}
+
+// ตั้ง is_read ให้ข้อความที่ readerID เป็นผู้รับเท่านั้น
+// คืนค่า ID ของข้อความที่เพิ่งถูกอ่าน แยกตามผู้ส่ง
+func (s *Messages) MarkRead(tenant, readerID string, ids []int64) (map[string][]int64, error) {
+	read := make(map[string][]int64)
+	if len(ids) == 0 {
+		return read, nil
+	}
+
+	now := time.Now().UTC()
+	args := make([]any, 0, len(ids)+4)
+	args = append(args, now, now, tenant, readerID)
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	query := fmt.Sprintf("UPDATE messages SET is_read = TRUE, is_delivered = TRUE, read_at = ?, delivered_at = COALESCE(delivered_at, ?) WHERE tenant_id = ? AND receiver_id = ? AND is_read = FALSE AND id IN (%s) RETURNING id, sender_id", strings.Join(Placeholders(len(ids)), ","))
+	return s.idsBySender(read, query, args...)
+}
+
+// รัน UPDATE ... RETURNING id, sender_id แล้วเก็บ ID ลงใน bySender แยกตามผู้ส่ง
+func (s *Messages) idsBySender(bySender map[string][]int64, query string, args ...any) (map[string][]int64, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var senderID string
+		if err := rows.Scan(&id, &senderID); err != nil {
+			return nil, err
+		}
+		bySender[senderID] = append(bySender[senderID], id)
+	}
+	return bySender, rows.Err()
+}
+
+// ตั้ง is_read ให้ข้อความที่ peerID ส่งถึง readerID (ถึง upToID ถ้าไม่เป็นศูนย์) ใน UPDATE เดียว คืนค่า ID ที่เพิ่งถูกอ่าน
+// (ใช้ idx_messages_receiver_sender_is_read และแตะได้เฉพาะข้อความที่ readerID เป็นผู้รับ)
+func (s *Messages) MarkConversationRead(tenant, readerID, peerID string, upToID int64) ([]int64, error) {
+	now := time.Now().UTC()
+	rows, err := s.db.Query("UPDATE messages SET is_read = TRUE, is_delivered = TRUE, read_at = ?, delivered_at = COALESCE(delivered_at, ?) WHERE tenant_id = ? AND receiver_id = ? AND sender_id = ? AND is_read = FALSE AND (? = 0 OR id <= ?) RETURNING id", now, now, tenant, readerID, peerID, upToID, upToID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// นับข้อความที่ยังไม่ได้อ่านของผู้ใช้ แยกตามผู้ส่ง
+func (s *Messages) UnreadCounts(tenant, userID string) ([]UnreadCount, error) {
+	rows, err := s.db.Query("SELECT sender_id, COUNT(*) FROM messages WHERE tenant_id = ? AND receiver_id = ? AND is_read = FALSE GROUP BY sender_id", tenant, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make([]UnreadCount, 0)
+	for rows.Next() {
+		var uc UnreadCount
+		if err := rows.Scan(&uc.PeerID, &uc.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, uc)
+	}
+	return counts, rows.Err()
+}
+
+// นับข้อความที่ยังไม่ได้อ่านทั้งหมดของผู้ใช้
+func (s *Messages) UnreadTotal(tenant, userID string) (int, error) {
+	var total int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM messages WHERE tenant_id = ? AND receiver_id = ? AND is_read = FALSE", tenant, userID).Scan(&total)
+	return total, err
+}
+
+// ดึงข้อความระหว่าง userID กับ peerID ที่เก่ากว่า before (ศูนย์ = ล่าสุด) สูงสุด limit ข้อความ เรียงตาม created_at
+// ข้อความที่ถูกลบแล้วคืนเป็น tombstone เพื่อให้ client รู้ว่ามีข้อความอยู่ตรงนั้น
+func (s *Messages) History(tenant, userID, peerID string, before Cursor, limit int) ([]protocol.Message, error) {
+	query := `SELECT id, sender_id, receiver_id, text, text_key_version, COALESCE(client_msg_id, ''), is_read, is_delivered, delivered_at, read_at, created_at,
+		metadata, COALESCE(reply_to_id, 0), forwarded_from_id, forwarded_sender_id, deleted_at IS NOT NULL
+		FROM messages
+		WHERE tenant_id = ? AND conversation_key = ? AND room_id IS NULL`
+	args := []any{tenant, ConversationKey(userID, peerID)}
+	if before.ID > 0 {
+		query += " AND (created_at < ? OR (created_at = ? AND id < ?))"
+		args = append(args, before.CreatedAt, before.CreatedAt, before.ID)
+	}
+	query += " ORDER BY created_at DESC, id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	msgs := make([]protocol.Message, 0, limit)
+	for rows.Next() {
+		msg := protocol.Message{TenantID: tenant}
+		var text string
+		var keyVersion int
+		var metadata, fwdSenderID sql.NullString
+		var fwdFromID sql.NullInt64
+		var deliveredAt, readAt sql.NullTime
+		if err := rows.Scan(&msg.ID, &msg.SenderID, &msg.ReceiverID, &text, &keyVersion, &msg.ClientMsgID, &msg.IsRead, &msg.IsDelivered, &deliveredAt, &readAt, &msg.CreatedAt,
+			&metadata, &msg.ReplyToID, &fwdFromID, &fwdSenderID, &msg.Deleted); err != nil {
+			return nil, err
+		}
+		applyState(&msg, deliveredAt, readAt)
+		if msg.Deleted {
+			msg.ReplyToID = 0
+			msgs = append(msgs, msg)
+			continue
+		}
+		if msg.Text, err = s.hooks.OpenText(text, keyVersion); err != nil {
+			return nil, fmt.Errorf("decrypting message %d: %w", msg.ID, err)
+		}
+		applyContent(&msg, metadata, fwdFromID, fwdSenderID)
+		msgs = append(msgs, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	s.hooks.Enrich(userID, msgs)
+	return msgs, nil
+}
+
+// ข้อความที่ userID รับ หรือส่งเอง (จากอุปกรณ์อื่น) ที่ ID มากกว่า afterID เรียงจากเก่าไปใหม่
+// ข้อความห้องที่ผู้ใช้ส่งเก็บเป็นแถวของสมาชิกแต่ละคน จึงนับเฉพาะแถวที่ผู้ใช้เป็นผู้รับ ข้อความที่ถูกลบไม่ส่ง
+func (s *Messages) Since(tenant, userID string, afterID int64, limit int) ([]protocol.Message, error) {
+	rows, err := s.db.Query(`SELECT id, sender_id, receiver_id, COALESCE(room_id, 0), text, text_key_version, COALESCE(client_msg_id, ''), is_read, is_delivered, delivered_at, read_at, created_at,
+		metadata, COALESCE(reply_to_id, 0), forwarded_from_id, forwarded_sender_id
+		FROM messages
+		WHERE tenant_id = ? AND id > ? AND deleted_at IS NULL AND (receiver_id = ? OR (sender_id = ? AND room_id IS NULL))
+		ORDER BY id LIMIT ?`, tenant, afterID, userID, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	msgs := make([]protocol.Message, 0, limit)
+	for rows.Next() {
+		msg := protocol.Message{TenantID: tenant}
+		var text string
+		var keyVersion int
+		var metadata, fwdSenderID sql.NullString
+		var fwdFromID sql.NullInt64
+		var deliveredAt, readAt sql.NullTime
+		if err := rows.Scan(&msg.ID, &msg.SenderID, &msg.ReceiverID, &msg.RoomID, &text, &keyVersion, &msg.ClientMsgID, &msg.IsRead, &msg.IsDelivered, &deliveredAt, &readAt, &msg.CreatedAt,
+			&metadata, &msg.ReplyToID, &fwdFromID, &fwdSenderID); err != nil {
+			return nil, err
+		}
+		applyState(&msg, deliveredAt, readAt)
+		if msg.Text, err = s.hooks.OpenText(text, keyVersion); err != nil {
+			return nil, fmt.Errorf("decrypting message %d: %w", msg.ID, err)
+		}
+		applyContent(&msg, metadata, fwdFromID, fwdSenderID)
+		msgs = append(msgs, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	s.hooks.Enrich(userID, msgs)
+	return msgs, nil
+}
+
+// เติม metadata และข้อมูลการส่งต่อจากคอลัมน์ของข้อความ
+func applyContent(msg *protocol.Message, metadata sql.NullString, fwdFromID sql.NullInt64, fwdSenderID sql.NullString) {
+	if metadata.Valid {
+		msg.Metadata = json.RawMessage(metadata.String)
+	}
+	if fwdFromID.Valid {
+		msg.Forwarded = true
+		msg.ForwardedFrom = &protocol.ForwardedFrom{MessageID: fwdFromID.Int64, SenderID: fwdSenderID.String}
+	}
+}
+
+// เติม State/DeliveredAt/ReadAt จากคอลัมน์ของข้อความ
+func applyState(msg *protocol.Message, deliveredAt, readAt sql.NullTime) {
+	msg.State = protocol.StateSent
+	if msg.IsDelivered {
+		msg.State = protocol.StateDelivered
+	}
+	if msg.IsRead {
+		msg.State = protocol.StateRead
+	}
+	if deliveredAt.Valid {
+		msg.DeliveredAt = &deliveredAt.Time
+	}
+	if readAt.Valid {
+		msg.ReadAt = &readAt.Time
+	}
+}
@@ -0,0 +1,175 @@
+package store
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// migration หนึ่งเวอร์ชันของ schema
+// ฟีเจอร์ใหม่ที่ต้องแก้ schema ให้เพิ่ม migration ใหม่ต่อท้ายเสมอ ห้ามแก้ของเดิม
+type Migration struct {
+	Version    int
+	Name       string
+	Statements []string
+	// statement สำหรับ PostgreSQL เมื่อแปลงจาก Statements อัตโนมัติไม่ได้ (nil = ใช้ postgresDDL)
+	Postgres []string
+	// statement สำหรับย้อน migration นี้ (คำสั่ง migrate down) nil = ย้อนไม่ได้
+	Down []string
+}
+
+// แปลง DDL ของ SQLite ให้ใช้กับ PostgreSQL ได้
+var postgresDDL = strings.NewReplacer(
+	"INTEGER PRIMARY KEY AUTOINCREMENT", "BIGSERIAL PRIMARY KEY",
+	"INTEGER", "BIGINT",
+)
+
+// SQLite ไม่บังคับ foreign key (ไม่ได้เปิด PRAGMA foreign_keys) ตัดออกใน PostgreSQL เพื่อให้ลบข้อความได้เหมือนกัน
+var referencesClause = regexp.MustCompile(` REFERENCES \w+ \(\w+\)`)
+
+// statement ของ migration สำหรับ dialect ที่ใช้อยู่
+func (m Migration) StatementsFor(d Dialect) []string {
+	if d != Postgres {
+		return m.Statements
+	}
+	if m.Postgres != nil {
+		return m.Postgres
+	}
+	return translatePostgres(m.Statements)
+}
+
+// statement สำหรับย้อน migration บน dialect ที่ใช้อยู่
+func (m Migration) DownFor(d Dialect) []string {
+	if d != Postgres {
+		return m.Down
+	}
+	return translatePostgres(m.Down)
+}
+
+func translatePostgres(statements []string) []string {
+	stmts := make([]string, len(statements))
+	for i, stmt := range statements {
+		stmts[i] = referencesClause.ReplaceAllString(postgresDDL.Replace(stmt), "")
+	}
+	return stmts
+}
+
+// รัน migration ที่ยังไม่เคยรันตามลำดับเวอร์ชัน แต่ละเวอร์ชันอยู่ใน transaction ของตัวเอง
+func Migrate(db *DB, migrations []Migration) error {
+	applied, err := Applied(db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if applied[m.Version] {
+			continue
+		}
+		if err := apply(db, m); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		slog.Info("applied migration", "version", m.Version, "name", m.Name)
+	}
+	return nil
+}
+
+// เวอร์ชันที่รันไปแล้ว (สร้าง schema_migrations ถ้ายังไม่มี)
+func Applied(db *DB) (map[int]bool, error) {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT,
+		applied_at TIMESTAMP
+	);`)
+	if err != nil {
+		return nil, fmt.Errorf("creating schema_migrations: %w", err)
+	}
+
+	applied := make(map[int]bool)
+	rows, err := db.Query("SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("reading schema_migrations: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			return nil, fmt.Errorf("reading schema_migrations: %w", err)
+		}
+		applied[v] = true
+	}
+	return applied, rows.Err()
+}
+
+func apply(db *DB, m Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range m.StatementsFor(db.Dialect) {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", m.Version, m.Name, time.Now().UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ย้อน migration ที่รันแล้วซึ่งเวอร์ชันมากกว่า target จากใหม่ไปเก่า (target 0 = ย้อนทั้งหมด)
+// หยุดที่เวอร์ชันแรกที่ย้อนไม่ได้ เวอร์ชันที่ย้อนไปแล้วก่อนหน้านั้นไม่ถูกรันกลับ
+func Rollback(db *DB, migrations []Migration, target int) error {
+	applied, err := Applied(db)
+	if err != nil {
+		return err
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.Version <= target || !applied[m.Version] {
+			continue
+		}
+		if m.Down == nil {
+			return fmt.Errorf("migration %d (%s) cannot be rolled back", m.Version, m.Name)
+		}
+		if err := revert(db, m); err != nil {
+			return fmt.Errorf("rolling back migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		slog.Info("rolled back migration", "version", m.Version, "name", m.Name)
+	}
+	return nil
+}
+
+func revert(db *DB, m Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range m.DownFor(db.Dialect) {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM schema_migrations WHERE version = ?", m.Version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// เวอร์ชันล่าสุดที่รันแล้ว (0 = ยังไม่มี)
+func CurrentVersion(applied map[int]bool) int {
+	current := 0
+	for v := range applied {
+		current = max(current, v)
+	}
+	return current
+}
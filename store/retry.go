@@ -0,0 +1,50 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// เวลารอก่อน retry ครั้งแรก (ครั้งถัดไปรอนานขึ้นเป็นเท่าตัวของรอบ)
+const RetryBackoff = 20 * time.Millisecond
+
+// ใส่ busy_timeout ลงใน DSN เพื่อให้มีผลกับทุก connection ใน pool
+// (PRAGMA busy_timeout ผ่าน db.Exec มีผลแค่ connection เดียวที่บังเอิญได้ไป)
+func WithBusyTimeout(dsn string, timeout time.Duration) string {
+	if timeout <= 0 || strings.Contains(dsn, "_busy_timeout=") {
+		return dsn
+	}
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return fmt.Sprintf("%s%s_busy_timeout=%d", dsn, sep, timeout.Milliseconds())
+}
+
+// ตรวจว่า error มาจาก SQLite ที่กำลังถูก lock อยู่ (ลองใหม่ได้)
+func IsBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	return false
+}
+
+// รัน fn ใหม่เมื่อเจอ SQLITE_BUSY/SQLITE_LOCKED สูงสุด retries ครั้ง โดยเรียก onRetry ก่อนรอแต่ละรอบ (nil ได้)
+// fn ต้องเริ่ม transaction ใหม่เองทุกรอบ
+func RetryOnBusy(retries int, fn func() error, onRetry func(attempt int, err error)) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !IsBusy(err) || attempt > retries {
+			return err
+		}
+		if onRetry != nil {
+			onRetry(attempt, err)
+		}
+		time.Sleep(RetryBackoff * time.Duration(attempt))
+	}
+}